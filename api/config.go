@@ -0,0 +1,111 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/direct-state-transfer/dst-go/config"
+	"github.com/direct-state-transfer/dst-go/log"
+	"github.com/spf13/pflag"
+)
+
+var logger log.LoggerInterface
+
+// SetLogger sets the logger instance for this module.
+func SetLogger(moduleLogger log.LoggerInterface) {
+	logger = moduleLogger
+}
+
+// Config represents the configuration for this module.
+type Config struct {
+	//Logger config - Do not specify default value
+	//will be inherited from node manager
+	Logger log.Config
+
+	listenAddr string //Address (host:port or unix:<path>) on which the api server listens, see StartServer
+	token      string //Token required in the requests to the api, mandatory when listening on tcp address
+	tokenFile  string //File from which the token is read, if not set directly
+}
+
+// TokenEnvVar is the environment variable from which the api token is read, if it is not set using the flags.
+const TokenEnvVar = "DSTGO_API_TOKEN"
+
+// ConfigDefault represents the default configuration for this module.
+var ConfigDefault = Config{
+	listenAddr: "unix:dst-go-api.sock",
+}
+
+// GetFlagSet initializes and returns a flagset with flags for configuring this module.
+func GetFlagSet() *pflag.FlagSet {
+
+	var apiFlags pflag.FlagSet
+
+	apiFlags.String("apiLogLevel", "", "Log level for api module")
+	apiFlags.String("apiLogBackend", "", "Log Backend for api module")
+	apiFlags.String("apiAddr", "", "Address (host:port or unix:<path>) on which the api server listens")
+	apiFlags.String("apiToken", "",
+		"Bearer token required in api requests (insecure, visible to other local users, prefer apiTokenFile or "+TokenEnvVar+")")
+	apiFlags.String("apiTokenFile", "", "File containing the bearer token required in api requests")
+
+	return &apiFlags
+}
+
+// ParseFlags parses the flags defined in this module.
+func ParseFlags(flagSet *pflag.FlagSet, cfg *Config) error {
+
+	var flagsToParse = []config.FlagInfo{
+		{Name: "apiLogLevel", Ptr: &cfg.Logger.Level},
+		{Name: "apiLogBackend", Ptr: &cfg.Logger.Backend},
+		{Name: "apiAddr", Ptr: &cfg.listenAddr},
+		{Name: "apiToken", Ptr: &cfg.token},
+		{Name: "apiTokenFile", Ptr: &cfg.tokenFile},
+	}
+	return config.LookUpMultiple(flagSet, flagsToParse)
+}
+
+// apiToken returns the token required in the api requests.
+//
+// Token set using the apiToken flag is used if set, though it can be read by other users on the same machine
+// from the command line of the process. Else the token is read from the environment variable TokenEnvVar
+// and then from the token file. Empty string is returned if the token is not configured in any of them.
+func (cfg *Config) apiToken() (token string, err error) {
+
+	if cfg.token != "" {
+		logger.Info("Api token passed on the command line is visible to other users, use", TokenEnvVar, "or apiTokenFile instead")
+		return cfg.token, nil
+	}
+	if token = os.Getenv(TokenEnvVar); token != "" {
+		return token, nil
+	}
+	if cfg.tokenFile == "" {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(cfg.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("error reading api token file - %s", err.Error())
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("api token file %s is empty", cfg.tokenFile)
+	}
+	return token, nil
+}
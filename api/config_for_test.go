@@ -0,0 +1,48 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/log"
+)
+
+var dummyConfigFileFlagVar string
+
+func TestMain(m *testing.M) {
+
+	//Define and parse flag for compatibility with other models
+	flag.StringVar(&dummyConfigFileFlagVar, "configFile", "", "Flag defined for compatibility, do not use")
+	flag.Parse()
+
+	setupLogger()
+
+	os.Exit(m.Run())
+}
+
+func setupLogger() {
+	var err error
+	logger, err = log.NewLogger(log.DebugLevel, log.StdoutBackend, "api-test")
+	if err != nil {
+		fmt.Printf("Error setting up logger - %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_FlagSet(t *testing.T) {
+
+	flagSet := GetFlagSet()
+	requiredFlags := []string{"apiLogLevel", "apiLogBackend", "apiAddr", "apiToken", "apiTokenFile"}
+
+	failed := false
+	t.Run("GetFlagset", func(t *testing.T) {
+		for _, val := range requiredFlags {
+			if nil == flagSet.Lookup(val) {
+				failed = true
+				t.Errorf("GetFlagSet() %s flag not defined", val)
+			}
+		}
+	})
+
+	if failed {
+		return
+	}
+
+	sampleValues := map[string]string{
+		"apiLogLevel":   "Debug",
+		"apiLogBackend": "stdout",
+		"apiAddr":       "localhost:9605",
+		"apiToken":      "token",
+		"apiTokenFile":  "token.txt",
+	}
+	for key, value := range sampleValues {
+		err := flagSet.Set(key, value)
+		if err != nil {
+			t.Fatalf("Setup() error setting flag %s to value %s", key, value)
+		}
+	}
+
+}
+
+func Test_Config_apiToken(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dst-go-api-token")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	tokenFile := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err = ioutil.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{name: "not_configured", cfg: Config{}, want: ""},
+		{name: "flag", cfg: Config{token: "flag-token", tokenFile: tokenFile}, env: "env-token", want: "flag-token"},
+		{name: "env", cfg: Config{tokenFile: tokenFile}, env: "env-token", want: "env-token"},
+		{name: "file", cfg: Config{tokenFile: tokenFile}, want: "file-token"},
+		{name: "file_empty", cfg: Config{tokenFile: emptyFile}, wantErr: true},
+		{name: "file_missing", cfg: Config{tokenFile: filepath.Join(dir, "missing")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv(TokenEnvVar, tt.env); err != nil {
+				t.Fatalf("Setenv() error = %v", err)
+			}
+			defer func() {
+				_ = os.Unsetenv(TokenEnvVar)
+			}()
+
+			got, err := tt.cfg.apiToken()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config.apiToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Config.apiToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
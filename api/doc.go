@@ -0,0 +1,32 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements the interface through which users control the node software.
+//
+// It runs a http server that serves a REST/JSON api for creating user sessions, listing known identities,
+// opening channels with peers, sending vpc state updates, querying the channel status and closing channels.
+// It also delivers the vpc closing events of the channels in manual closing mode, that require a response from the user.
+// The actual operations are performed by the node manager, which provides the implementation of
+// Node and Session interfaces defined in this package.
+//
+// The api must not be exposed to anyone other than the owner of the node, as the requests carry the passwords of
+// the keystores and can move the funds in the channels. By default, it is served on a unix socket accessible only to
+// the user running the node. When served on a tcp address, a bearer token is mandatory and the address should still be
+// reachable only from trusted hosts, as the token and passwords are sent without encryption.
+//
+// The token should be passed in the environment variable DSTGO_API_TOKEN or in a file using the apiTokenFile flag.
+// Passing it with the apiToken flag is insecure, as the command line of the node can be read by all local users.
+package api
@@ -0,0 +1,379 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// Paths served by the api handler. Parameters are shown in braces.
+//
+//	POST /sessions                                        - create a new session
+//	GET  /sessions/{addr}                                 - get session details
+//	GET  /sessions/{addr}/ids                             - list known identities
+//	GET  /sessions/{addr}/channels                        - list all channels
+//	POST /sessions/{addr}/channels                        - open a new channel
+//	GET  /sessions/{addr}/channels/{peerAddr}             - get channel details
+//	POST /sessions/{addr}/channels/{peerAddr}/vpc-states  - send a new vpc state
+//	POST /sessions/{addr}/channels/{peerAddr}/close       - close the channel
+//	GET  /sessions/{addr}/closing-notifications           - get the vpc closing events awaiting a response
+const (
+	sessionsPath             = "sessions"
+	idsPath                  = "ids"
+	channelsPath             = "channels"
+	vpcStatesPath            = "vpc-states"
+	closePath                = "close"
+	closingNotificationsPath = "closing-notifications"
+)
+
+// NewSessionRequest is the request body for creating a new session.
+type NewSessionRequest struct {
+	EthAddr  types.Address `json:"eth_addr"`
+	Password string        `json:"password"`
+	KeysDir  string        `json:"keys_dir"`
+	IDFile   string        `json:"id_file"`
+	MaxConn  uint32        `json:"max_conn"`
+}
+
+// SessionInfo is the response body containing the details of a session.
+type SessionInfo struct {
+	Owner identity.OffChainID `json:"owner"`
+}
+
+// OpenChannelRequest is the request body for opening a new channel.
+// Deposits and confirm timeout that are not set in the terms are taken from the policy of the session.
+// If closing mode is not set, the closing mode of the session is used.
+type OpenChannelRequest struct {
+	PeerAddr    types.Address       `json:"peer_addr"`
+	Terms       channel.Terms       `json:"terms"`
+	ClosingMode channel.ClosingMode `json:"closing_mode,omitempty"`
+}
+
+// NewVPCStateRequest is the request body for sending a new vpc state to the peer.
+type NewVPCStateRequest struct {
+	BlockedSender   *big.Int `json:"blocked_sender"`
+	BlockedReceiver *big.Int `json:"blocked_receiver"`
+}
+
+// ChannelInfo is the response body containing the details of a channel.
+type ChannelInfo struct {
+	SelfID          identity.OffChainID         `json:"self_id"`
+	PeerID          identity.OffChainID         `json:"peer_id"`
+	RoleChannel     channel.Role                `json:"role_channel"`
+	Status          channel.Status              `json:"status"`
+	ClosingMode     channel.ClosingMode         `json:"closing_mode"`
+	Connected       bool                        `json:"connected"`
+	SessionID       *big.Int                    `json:"session_id,omitempty"`
+	MSCBaseState    *channel.MSCBaseStateSigned `json:"msc_base_state,omitempty"`
+	CurrentVPCState *channel.VPCStateSigned     `json:"current_vpc_state,omitempty"`
+}
+
+// ClosingNotificationInfo is the response body containing a vpc closing event registered in the blockchain,
+// for a channel in manual closing mode. The user should respond to it, if the registered state is not the latest.
+type ClosingNotificationInfo struct {
+	Channel         ChannelInfo `json:"channel"`
+	Version         *big.Int    `json:"version"`
+	BlockedSender   *big.Int    `json:"blocked_sender"`
+	BlockedReceiver *big.Int    `json:"blocked_receiver"`
+}
+
+// ErrorResponse is the response body when a request fails.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	node Node
+}
+
+// NewHandler returns a http handler that serves the api using node for performing the operations.
+func NewHandler(node Node) http.Handler {
+	return &handler{node: node}
+}
+
+// ServeHTTP implements http.Handler interface. It routes the request based on the method and path.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != sessionsPath {
+		writeError(w, http.StatusNotFound, fmt.Errorf("path not found - %s", r.URL.Path))
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed - %s", r.Method))
+			return
+		}
+		h.newSession(w, r)
+		return
+	}
+
+	session, err := h.session(parts[1])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	//Replace the peer address parameter with a placeholder to obtain the route
+	var route string
+	switch len(parts) {
+	case 2:
+		route = r.Method + " /"
+	case 3:
+		route = r.Method + " /" + parts[2]
+	case 4:
+		route = r.Method + " /" + parts[2] + "/{}"
+	case 5:
+		route = r.Method + " /" + parts[2] + "/{}/" + parts[4]
+	}
+
+	switch route {
+	case "GET /":
+		writeJSON(w, http.StatusOK, SessionInfo{Owner: session.Owner()})
+	case "GET /" + idsPath:
+		writeJSON(w, http.StatusOK, session.KnownIDs())
+	case "GET /" + channelsPath:
+		h.listChannels(w, session)
+	case "GET /" + closingNotificationsPath:
+		h.closingNotifications(w, session)
+	case "POST /" + channelsPath:
+		h.openChannel(w, r, session)
+	case "GET /" + channelsPath + "/{}":
+		h.getChannel(w, session, parts[3])
+	case "POST /" + channelsPath + "/{}/" + vpcStatesPath:
+		h.newVPCState(w, r, session, parts[3])
+	case "POST /" + channelsPath + "/{}/" + closePath:
+		h.closeChannel(w, session, parts[3])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("path not found - %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (h *handler) newSession(w http.ResponseWriter, r *http.Request) {
+
+	var req NewSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body - %s", err.Error()))
+		return
+	}
+
+	if _, present := h.node.Session(req.EthAddr); present {
+		writeError(w, http.StatusConflict, fmt.Errorf("session already exists for %s", req.EthAddr.Hex()))
+		return
+	}
+
+	session, err := h.node.NewSession(req.EthAddr, req.Password, req.KeysDir, req.IDFile, req.MaxConn)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("New session created for", req.EthAddr.Hex())
+	writeJSON(w, http.StatusCreated, SessionInfo{Owner: session.Owner()})
+}
+
+func (h *handler) session(addrStr string) (session Session, err error) {
+
+	addr, err := parseAddress(addrStr)
+	if err != nil {
+		return nil, err
+	}
+
+	session, present := h.node.Session(addr)
+	if !present {
+		return nil, fmt.Errorf("session not found for %s", addrStr)
+	}
+	return session, nil
+}
+
+func (h *handler) listChannels(w http.ResponseWriter, session Session) {
+
+	channels := session.Channels()
+	infoList := make([]ChannelInfo, len(channels))
+	for idx := range channels {
+		infoList[idx] = NewChannelInfo(channels[idx])
+	}
+	writeJSON(w, http.StatusOK, infoList)
+}
+
+func (h *handler) openChannel(w http.ResponseWriter, r *http.Request, session Session) {
+
+	var req OpenChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body - %s", err.Error()))
+		return
+	}
+
+	if (req.Terms.DepositSender != nil && req.Terms.DepositSender.Sign() < 0) ||
+		(req.Terms.DepositReceiver != nil && req.Terms.DepositReceiver.Sign() < 0) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("deposits should not be negative"))
+		return
+	}
+	if req.ClosingMode != "" {
+		if _, err := channel.ParseClosingMode(string(req.ClosingMode)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ch, err := session.OpenChannel(req.PeerAddr, req.Terms, req.ClosingMode)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, NewChannelInfo(ch))
+}
+
+func (h *handler) getChannel(w http.ResponseWriter, session Session, peerAddrStr string) {
+
+	ch, err := channelOf(session, peerAddrStr)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewChannelInfo(ch))
+}
+
+func (h *handler) newVPCState(w http.ResponseWriter, r *http.Request, session Session, peerAddrStr string) {
+
+	ch, err := channelOf(session, peerAddrStr)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var req NewVPCStateRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body - %s", err.Error()))
+		return
+	}
+	if req.BlockedSender == nil || req.BlockedReceiver == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("blocked_sender and blocked_receiver are required"))
+		return
+	}
+
+	state, err := session.NewVPCState(ch.PeerID().OnChainID, req.BlockedSender, req.BlockedReceiver)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (h *handler) closeChannel(w http.ResponseWriter, session Session, peerAddrStr string) {
+
+	ch, err := channelOf(session, peerAddrStr)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err = session.CloseChannel(ch.PeerID().OnChainID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewChannelInfo(ch))
+}
+
+func (h *handler) closingNotifications(w http.ResponseWriter, session Session) {
+
+	notifications := session.ClosingNotifications()
+	infoList := make([]ClosingNotificationInfo, len(notifications))
+	for idx := range notifications {
+		infoList[idx] = ClosingNotificationInfo{
+			Channel:         NewChannelInfo(notifications[idx].Channel),
+			Version:         notifications[idx].OnChainState.SeqNo,
+			BlockedSender:   notifications[idx].OnChainState.AliceCash,
+			BlockedReceiver: notifications[idx].OnChainState.BobCash,
+		}
+	}
+	writeJSON(w, http.StatusOK, infoList)
+}
+
+// NewChannelInfo returns the details of the channel instance in a form that can be encoded as json.
+func NewChannelInfo(ch *channel.Instance) ChannelInfo {
+
+	info := ChannelInfo{
+		SelfID:      ch.SelfID(),
+		PeerID:      ch.PeerID(),
+		RoleChannel: ch.RoleChannel(),
+		Status:      ch.Status(),
+		ClosingMode: ch.ClosingMode(),
+		Connected:   ch.Connected(),
+		SessionID:   ch.SessionID().SidComplete,
+	}
+
+	if mscBaseState := ch.MscBaseState(); mscBaseState.MSContractBaseState.Version != nil {
+		info.MSCBaseState = &mscBaseState
+	}
+	if vpcState := ch.CurrentVpcState(); vpcState.VPCState.Version != nil {
+		info.CurrentVPCState = &vpcState
+	}
+	return info
+}
+
+func channelOf(session Session, peerAddrStr string) (ch *channel.Instance, err error) {
+
+	peerAddr, err := parseAddress(peerAddrStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, present := session.Channel(peerAddr)
+	if !present {
+		return nil, fmt.Errorf("channel not found for %s", peerAddrStr)
+	}
+	return ch, nil
+}
+
+func parseAddress(addrStr string) (addr types.Address, err error) {
+
+	addrHex := strings.TrimPrefix(strings.ToLower(addrStr), "0x")
+	addrBytes, err := hex.DecodeString(addrHex)
+	if err != nil || len(addrBytes) != 20 {
+		return types.Address{}, fmt.Errorf("invalid address - %s", addrStr)
+	}
+	return types.HexToAddress(addrHex), nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("error writing api response -", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	logger.Debug("api request failed -", err)
+	writeJSON(w, statusCode, ErrorResponse{Error: err.Error()})
+}
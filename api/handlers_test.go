@@ -0,0 +1,461 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/blockchain"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+var (
+	ownerAddr = types.HexToAddress("932a74da117eb9288ea759487360cd700e7777e1")
+	peerAddr  = types.HexToAddress("815430d6ea7275317d09199a5a5675f017e011ef")
+)
+
+type dummyNode struct {
+	sessions   map[types.Address]Session
+	sessionErr error
+}
+
+func (node *dummyNode) NewSession(ethAddr types.Address, password, keysDir, idFile string, maxConn uint32) (Session, error) {
+	if node.sessionErr != nil {
+		return nil, node.sessionErr
+	}
+	session := &dummySession{owner: identity.OffChainID{OnChainID: ethAddr}, channels: make(map[types.Address]*channel.Instance)}
+	node.sessions[ethAddr] = session
+	return session, nil
+}
+
+func (node *dummyNode) Session(ethAddr types.Address) (Session, bool) {
+	session, present := node.sessions[ethAddr]
+	return session, present
+}
+
+type dummySession struct {
+	owner             identity.OffChainID
+	channels          map[types.Address]*channel.Instance
+	openedTerms       channel.Terms       //Terms with which the last channel was opened
+	openedClosingMode channel.ClosingMode //Closing mode with which the last channel was opened
+	notifications     []blockchain.ClosingNotification
+	err               error
+}
+
+func (session *dummySession) Owner() identity.OffChainID {
+	return session.owner
+}
+
+func (session *dummySession) KnownIDs() []identity.OffChainID {
+	return []identity.OffChainID{session.owner, {OnChainID: peerAddr}}
+}
+
+func (session *dummySession) OpenChannel(peerAddr types.Address, terms channel.Terms, closingMode channel.ClosingMode) (
+	*channel.Instance, error) {
+	if session.err != nil {
+		return nil, session.err
+	}
+	session.openedTerms = terms
+	session.openedClosingMode = closingMode
+	ch := &channel.Instance{}
+	session.channels[peerAddr] = ch
+	return ch, nil
+}
+
+func (session *dummySession) Channel(peerAddr types.Address) (*channel.Instance, bool) {
+	ch, present := session.channels[peerAddr]
+	return ch, present
+}
+
+func (session *dummySession) Channels() []*channel.Instance {
+	var channels []*channel.Instance
+	for _, ch := range session.channels {
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+func (session *dummySession) NewVPCState(peerAddr types.Address, blockedSender, blockedReceiver *big.Int) (channel.VPCStateSigned, error) {
+	if session.err != nil {
+		return channel.VPCStateSigned{}, session.err
+	}
+	return channel.VPCStateSigned{
+		VPCState: channel.VPCState{
+			Version:         big.NewInt(1),
+			BlockedSender:   blockedSender,
+			BlockedReceiver: blockedReceiver,
+		},
+	}, nil
+}
+
+func (session *dummySession) CloseChannel(peerAddr types.Address) error {
+	return session.err
+}
+
+func (session *dummySession) ClosingNotifications() []blockchain.ClosingNotification {
+	notifications := session.notifications
+	session.notifications = nil
+	return notifications
+}
+
+func newDummyNode(sessionErr error) *dummyNode {
+	return &dummyNode{
+		sessions:   make(map[types.Address]Session),
+		sessionErr: sessionErr,
+	}
+}
+
+func Test_handler_ServeHTTP(t *testing.T) {
+
+	ownerPath := "/sessions/" + ownerAddr.Hex()
+	peerPath := ownerPath + "/channels/" + peerAddr.Hex()
+
+	tests := []struct {
+		name            string
+		withSession     bool
+		withChannel     bool
+		sessionErr      error
+		method          string
+		path            string
+		body            string
+		wantStatusCode  int
+		wantTerms       *channel.Terms
+		wantClosingMode channel.ClosingMode
+	}{
+		{
+			name:           "new_session_valid",
+			method:         http.MethodPost,
+			path:           "/sessions",
+			body:           fmt.Sprintf(`{"eth_addr":"%s"}`, ownerAddr.Hex()),
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "new_session_already_exists",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           "/sessions",
+			body:           fmt.Sprintf(`{"eth_addr":"%s"}`, ownerAddr.Hex()),
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "new_session_error",
+			sessionErr:     fmt.Errorf("keystore not found"),
+			method:         http.MethodPost,
+			path:           "/sessions",
+			body:           fmt.Sprintf(`{"eth_addr":"%s"}`, ownerAddr.Hex()),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "new_session_invalid_body",
+			method:         http.MethodPost,
+			path:           "/sessions",
+			body:           `{"eth_addr":`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "sessions_invalid_method",
+			method:         http.MethodGet,
+			path:           "/sessions",
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "unknown_path",
+			method:         http.MethodGet,
+			path:           "/unknown",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "get_session_valid",
+			withSession:    true,
+			method:         http.MethodGet,
+			path:           ownerPath,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "get_session_not_found",
+			method:         http.MethodGet,
+			path:           ownerPath,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "get_session_invalid_address",
+			method:         http.MethodGet,
+			path:           "/sessions/0x1234",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "known_ids_valid",
+			withSession:    true,
+			method:         http.MethodGet,
+			path:           ownerPath + "/ids",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "list_channels_valid",
+			withSession:    true,
+			withChannel:    true,
+			method:         http.MethodGet,
+			path:           ownerPath + "/channels",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "open_channel_valid",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           ownerPath + "/channels",
+			body:           fmt.Sprintf(`{"peer_addr":"%s"}`, peerAddr.Hex()),
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "open_channel_with_terms",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           ownerPath + "/channels",
+			body:           fmt.Sprintf(`{"peer_addr":"%s","terms":{"deposit_sender":10,"deposit_receiver":5}}`, peerAddr.Hex()),
+			wantStatusCode: http.StatusCreated,
+			wantTerms:      &channel.Terms{DepositSender: big.NewInt(10), DepositReceiver: big.NewInt(5)},
+		},
+		{
+			name:            "open_channel_with_closing_mode",
+			withSession:     true,
+			method:          http.MethodPost,
+			path:            ownerPath + "/channels",
+			body:            fmt.Sprintf(`{"peer_addr":"%s","closing_mode":"auto-normal"}`, peerAddr.Hex()),
+			wantStatusCode:  http.StatusCreated,
+			wantClosingMode: channel.ClosingModeAutoNormal,
+		},
+		{
+			name:           "open_channel_invalid_closing_mode",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           ownerPath + "/channels",
+			body:           fmt.Sprintf(`{"peer_addr":"%s","closing_mode":"auto"}`, peerAddr.Hex()),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "open_channel_negative_deposit",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           ownerPath + "/channels",
+			body:           fmt.Sprintf(`{"peer_addr":"%s","terms":{"deposit_sender":-10}}`, peerAddr.Hex()),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "open_channel_error",
+			withSession:    true,
+			sessionErr:     fmt.Errorf("peer not reachable"),
+			method:         http.MethodPost,
+			path:           ownerPath + "/channels",
+			body:           fmt.Sprintf(`{"peer_addr":"%s"}`, peerAddr.Hex()),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "get_channel_valid",
+			withSession:    true,
+			withChannel:    true,
+			method:         http.MethodGet,
+			path:           peerPath,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "get_channel_not_found",
+			withSession:    true,
+			method:         http.MethodGet,
+			path:           peerPath,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "new_vpc_state_valid",
+			withSession:    true,
+			withChannel:    true,
+			method:         http.MethodPost,
+			path:           peerPath + "/vpc-states",
+			body:           `{"blocked_sender":9,"blocked_receiver":11}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "new_vpc_state_missing_amount",
+			withSession:    true,
+			withChannel:    true,
+			method:         http.MethodPost,
+			path:           peerPath + "/vpc-states",
+			body:           `{"blocked_sender":9}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "new_vpc_state_error",
+			withSession:    true,
+			withChannel:    true,
+			sessionErr:     fmt.Errorf("declined by peer"),
+			method:         http.MethodPost,
+			path:           peerPath + "/vpc-states",
+			body:           `{"blocked_sender":9,"blocked_receiver":11}`,
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "close_channel_valid",
+			withSession:    true,
+			withChannel:    true,
+			method:         http.MethodPost,
+			path:           peerPath + "/close",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "close_channel_not_found",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           peerPath + "/close",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "closing_notifications_valid",
+			withSession:    true,
+			method:         http.MethodGet,
+			path:           ownerPath + "/closing-notifications",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "closing_notifications_invalid_method",
+			withSession:    true,
+			method:         http.MethodPost,
+			path:           ownerPath + "/closing-notifications",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "close_channel_invalid_method",
+			withSession:    true,
+			withChannel:    true,
+			method:         http.MethodGet,
+			path:           peerPath + "/close",
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			node := newDummyNode(nil)
+			var session Session
+			if tt.withSession {
+				session, _ = node.NewSession(ownerAddr, "", "", "", 0)
+				if tt.withChannel {
+					_, _ = session.OpenChannel(peerAddr, channel.Terms{}, "")
+				}
+				session.(*dummySession).err = tt.sessionErr
+			} else {
+				node.sessionErr = tt.sessionErr
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+			NewHandler(node).ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatusCode {
+				t.Fatalf("ServeHTTP() status code = %d, want %d, body %s", recorder.Code, tt.wantStatusCode, recorder.Body.String())
+			}
+
+			if tt.wantStatusCode >= http.StatusBadRequest {
+				var errResponse ErrorResponse
+				if err := json.Unmarshal(recorder.Body.Bytes(), &errResponse); err != nil || errResponse.Error == "" {
+					t.Errorf("ServeHTTP() error response = %s, want non empty error message", recorder.Body.String())
+				}
+			}
+
+			if tt.wantTerms != nil && !session.(*dummySession).openedTerms.Equal(*tt.wantTerms) {
+				t.Errorf("OpenChannel() terms = %v, want %v", session.(*dummySession).openedTerms, *tt.wantTerms)
+			}
+			if tt.wantClosingMode != "" && session.(*dummySession).openedClosingMode != tt.wantClosingMode {
+				t.Errorf("OpenChannel() closing mode = %v, want %v", session.(*dummySession).openedClosingMode, tt.wantClosingMode)
+			}
+		})
+	}
+}
+
+func Test_handler_closingNotifications(t *testing.T) {
+
+	node := newDummyNode(nil)
+	session, _ := node.NewSession(ownerAddr, "", "", "", 0)
+	session.(*dummySession).notifications = []blockchain.ClosingNotification{{
+		Channel:      &channel.Instance{},
+		OnChainState: blockchain.VPCState{SeqNo: big.NewInt(2), AliceCash: big.NewInt(9), BobCash: big.NewInt(11)},
+	}}
+	path := "/sessions/" + ownerAddr.Hex() + "/closing-notifications"
+
+	recorder := httptest.NewRecorder()
+	NewHandler(node).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	var got []ClosingNotificationInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+		t.Fatalf("ServeHTTP() response = %s, error decoding - %v", recorder.Body.String(), err)
+	}
+	if len(got) != 1 || got[0].Version.Cmp(big.NewInt(2)) != 0 ||
+		got[0].BlockedSender.Cmp(big.NewInt(9)) != 0 || got[0].BlockedReceiver.Cmp(big.NewInt(11)) != 0 {
+		t.Errorf("ServeHTTP() closing notifications = %s, want one with version 2, blocked 9 and 11", recorder.Body.String())
+	}
+
+	//Notifications are returned only once
+	recorder = httptest.NewRecorder()
+	NewHandler(node).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if body := strings.TrimSpace(recorder.Body.String()); body != "[]" {
+		t.Errorf("ServeHTTP() closing notifications on second call = %s, want []", body)
+	}
+}
+
+func Test_NewChannelInfo(t *testing.T) {
+
+	info := NewChannelInfo(&channel.Instance{})
+	if info.MSCBaseState != nil || info.CurrentVPCState != nil {
+		t.Errorf("NewChannelInfo() = %+v, want nil msc base state and vpc state", info)
+	}
+	if info.Connected {
+		t.Errorf("NewChannelInfo() connected = true, want false")
+	}
+}
+
+func Test_parseAddress(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		addrStr string
+		want    types.Address
+		wantErr bool
+	}{
+		{"valid_with_prefix", ownerAddr.Hex(), ownerAddr, false},
+		{"valid_without_prefix", strings.TrimPrefix(ownerAddr.Hex(), "0x"), ownerAddr, false},
+		{"invalid_length", "0x1234", types.Address{}, true},
+		{"invalid_hex", "0xzz2a74da117eb9288ea759487360cd700e7777e1", types.Address{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAddress(tt.addrStr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseAddress() = %v, want %v", got.Hex(), tt.want.Hex())
+			}
+		})
+	}
+}
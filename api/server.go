@@ -0,0 +1,182 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/blockchain"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+	"github.com/direct-state-transfer/dst-go/log"
+)
+
+var packageName = "api"
+
+// Node is the interface that should be implemented by the node manager to be controlled via the api.
+type Node interface {
+	// NewSession initialises a user session with ethAddr as the owner,
+	// using the keystore at keysDir and identity store in idFile.
+	NewSession(ethAddr types.Address, password, keysDir, idFile string, maxConn uint32) (Session, error)
+
+	// Session returns the active session of the user with ethAddr, if any.
+	Session(ethAddr types.Address) (session Session, present bool)
+}
+
+// Session is the interface that should be implemented by a user session to be controlled via the api.
+type Session interface {
+	// Owner returns the offchain identity of the user owning the session.
+	Owner() identity.OffChainID
+
+	// KnownIDs returns the list of all offchain identities in the identity store of the session.
+	KnownIDs() []identity.OffChainID
+
+	// OpenChannel opens a new channel with the peer having peerAddr as on chain address, proposing terms.
+	// Deposits and confirm timeout that are not set in terms are taken from the policy of the session.
+	// Vpc closing events of the channel are handled according to closingMode, or that of the session if it is empty.
+	OpenChannel(peerAddr types.Address, terms channel.Terms, closingMode channel.ClosingMode) (*channel.Instance, error)
+
+	// Channel returns the channel with the peer having peerAddr as on chain address, if any.
+	Channel(peerAddr types.Address) (ch *channel.Instance, present bool)
+
+	// Channels returns the list of all channels in the session.
+	Channels() []*channel.Instance
+
+	// NewVPCState proposes a new vpc state with the blocked amounts to the peer
+	// and returns the doubly signed state if it was accepted.
+	NewVPCState(peerAddr types.Address, blockedSender, blockedReceiver *big.Int) (channel.VPCStateSigned, error)
+
+	// CloseChannel triggers closing of the channel with the peer.
+	CloseChannel(peerAddr types.Address) error
+
+	// ClosingNotifications returns the vpc closing events of channels in manual closing mode,
+	// that were received since the last call.
+	ClosingNotifications() []blockchain.ClosingNotification
+}
+
+// InitModule initializes this module with provided configuration and
+// starts the api server that controls the node.
+// The server is returned, so that it can be shutdown by the caller.
+func InitModule(cfg *Config, node Node) (server *http.Server, err error) {
+
+	logger, err = log.NewLogger(cfg.Logger.Level, cfg.Logger.Backend, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := cfg.apiToken()
+	if err != nil {
+		return nil, err
+	}
+	return StartServer(cfg.listenAddr, token, node)
+}
+
+// unixAddrPrefix is the prefix of listen address, for serving the api on a unix socket.
+const unixAddrPrefix = "unix:"
+
+// StartServer starts a http server on listenAddr that serves the api for controlling the node.
+// The listener is opened before returning, so that any error in binding to the address is reported to the caller.
+//
+// As the api carries the keystore passwords of the users, it should not be exposed to anyone other than the
+// owner of the node. If listenAddr is of the form "unix:<path>", the api is served on a unix socket at path that
+// is accessible only to the user running the node. Else it is served on the tcp address and a token is required,
+// which should be sent by the clients as bearer token in the Authorization header of each request.
+// If a token is set for the unix socket as well, it is also required.
+func StartServer(listenAddr, token string, node Node) (server *http.Server, err error) {
+
+	if node == nil {
+		return nil, fmt.Errorf("node is nil")
+	}
+
+	var listener net.Listener
+	if strings.HasPrefix(listenAddr, unixAddrPrefix) {
+		listener, err = listenUnix(strings.TrimPrefix(listenAddr, unixAddrPrefix))
+	} else if token == "" {
+		err = fmt.Errorf("api token is required to listen on tcp address %s, use a unix socket otherwise", listenAddr)
+	} else {
+		listener, err = net.Listen("tcp", listenAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	handler := NewHandler(node)
+	if token != "" {
+		handler = requireToken(token, handler)
+	}
+
+	server = &http.Server{
+		Addr:         listener.Addr().String(),
+		Handler:      handler,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 5 * time.Minute, //Handlers like open channel, involve communication with the peer
+	}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("api server stopped with error -", err)
+		}
+	}()
+
+	logger.Info("api server listening on", listener.Addr().String())
+	return server, nil
+}
+
+// listenUnix listens on a unix socket at path, that can be accessed only by the user running the node.
+// A stale socket file left at path (e.g if the node was not shutdown gracefully) is removed.
+func listenUnix(path string) (listener net.Listener, err error) {
+
+	if info, errStat := os.Lstat(path); errStat == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket - %s", err.Error())
+		}
+	}
+
+	listener, err = net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("restricting access to socket - %s", err.Error())
+	}
+	return listener, nil
+}
+
+// requireToken returns a handler that serves the request using next, only if it has token as bearer token
+// in the Authorization header. Else the request fails with status unauthorized.
+func requireToken(token string, next http.Handler) http.Handler {
+
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid api token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testToken = "test-token"
+
+func Test_StartServer(t *testing.T) {
+
+	t.Run("Valid", func(t *testing.T) {
+		server, err := StartServer("localhost:0", testToken, newDummyNode(nil))
+		if err != nil {
+			t.Fatalf("StartServer() error = %v, want nil", err)
+		}
+		if err = server.Shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown() error = %v, want nil", err)
+		}
+	})
+	t.Run("Nil_Node", func(t *testing.T) {
+		_, err := StartServer("localhost:0", testToken, nil)
+		if err == nil {
+			t.Errorf("StartServer() error = nil, want non nil")
+		}
+	})
+	t.Run("Invalid_Address", func(t *testing.T) {
+		_, err := StartServer("invalid-address", testToken, newDummyNode(nil))
+		if err == nil {
+			t.Errorf("StartServer() error = nil, want non nil")
+		}
+	})
+	t.Run("Token_Required_On_TCP", func(t *testing.T) {
+		_, err := StartServer("localhost:0", "", newDummyNode(nil))
+		if err == nil {
+			t.Errorf("StartServer() error = nil, want non nil")
+		}
+	})
+	t.Run("Unix_Socket", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "dst-go-api")
+		if err != nil {
+			t.Fatalf("TempDir() error = %v", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		socketPath := filepath.Join(dir, "api.sock")
+
+		server, err := StartServer(unixAddrPrefix+socketPath, "", newDummyNode(nil))
+		if err != nil {
+			t.Fatalf("StartServer() error = %v, want nil", err)
+		}
+		defer func() {
+			_ = server.Shutdown(context.Background())
+		}()
+
+		info, err := os.Stat(socketPath)
+		if err != nil {
+			t.Fatalf("Stat() error = %v, want nil", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("StartServer() socket permissions = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+		client := http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}}
+		resp, err := client.Get("http://unix/sessions/" + ownerAddr.Hex())
+		if err != nil {
+			t.Fatalf("GET error = %v, want nil", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+		}
+	})
+	t.Run("Address_In_Use", func(t *testing.T) {
+		server, err := StartServer("localhost:0", testToken, newDummyNode(nil))
+		if err != nil {
+			t.Fatalf("StartServer() error = %v, want nil", err)
+		}
+		defer func() {
+			_ = server.Shutdown(context.Background())
+		}()
+
+		_, err = StartServer(server.Addr, testToken, newDummyNode(nil))
+		if err == nil {
+			t.Errorf("StartServer() error = nil, want non nil")
+		}
+	})
+}
+
+func Test_requireToken(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"valid", "Bearer " + testToken, http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"invalid", "Bearer other-token", http.StatusUnauthorized},
+		{"not_bearer", testToken, http.StatusUnauthorized},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			requireToken(testToken, next).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("requireToken() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
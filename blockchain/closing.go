@@ -0,0 +1,187 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+)
+
+// ClosingNotification is sent to the user when a vpc closing event is received for a channel in manual closing mode.
+type ClosingNotification struct {
+	Channel      *channel.Instance //Channel for which the closing event was received
+	OnChainState VPCState          //State of the vpc channel registered in the blockchain
+}
+
+type closingAction int
+
+// Enumeration of actions that can be taken by the node software on receiving a vpc closing event.
+const (
+	closingActionNone    closingAction = iota //Do nothing, the channel will be closed after timeout
+	closingActionNotify                       //Pass the event on to the user
+	closingActionRefute                       //Call close with the latest state, as the closing state is older
+	closingActionConfirm                      //Call close with the latest state, so that channel is closed immediately
+)
+
+// ClosingHandler handles the vpc closing events of an offchain channel according to the closing mode of the channel.
+//
+// In ClosingModeManual (or if the closing mode is not set), the event is passed on to the user as a notification.
+// In ClosingModeAutoNormal, if the closing state is older than the current vpc state of the channel,
+// it is refuted by calling close on the vpc contract with the current state. Else no action is taken.
+// In ClosingModeAutoImmediate, close is called with the current state even if the closing state is the latest,
+// so that the channel is closed immediately without waiting until timeout.
+type ClosingHandler struct {
+	bcInst *Instance
+	ch     *channel.Instance
+	notify chan<- ClosingNotification
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewClosingHandler initialises a closing handler for the channel ch and starts it in the background.
+// Vpc closing events are read from the events channel of bcInst and transactions are made using bcInst.
+// Notifications for the user are sent on notify. If notify is nil, notifications are only logged.
+func NewClosingHandler(bcInst *Instance, ch *channel.Instance, notify chan<- ClosingNotification) *ClosingHandler {
+
+	handler := &ClosingHandler{
+		bcInst: bcInst,
+		ch:     ch,
+		notify: notify,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go handler.run()
+	return handler
+}
+
+// Stop stops the closing handler and waits until the background routine returns.
+func (handler *ClosingHandler) Stop() {
+	close(handler.quit)
+	<-handler.done
+}
+
+func (handler *ClosingHandler) run() {
+
+	defer close(handler.done)
+
+	for {
+		select {
+		case event, ok := <-handler.bcInst.EventsChan.VPCVPCClosingChan:
+			if !ok {
+				return
+			}
+			err := handler.handleClosing(event)
+			if err != nil {
+				logger.Error("Error handling vpc closing event for channel with", handler.ch.PeerID(), "-", err)
+			}
+		case <-handler.quit:
+			return
+		}
+	}
+}
+
+func (handler *ClosingHandler) handleClosing(event *contract.VPCEventVpcClosing) (err error) {
+
+	sid := handler.ch.SessionID()
+	if sid.SidComplete == nil {
+		return fmt.Errorf("session id not set for the channel")
+	}
+	vpcStateID := channel.VPCStateID{
+		AddSender:    handler.ch.SenderID().OnChainID,
+		AddrReceiver: handler.ch.ReceiverID().OnChainID,
+		SID:          sid.SidComplete,
+	}
+
+	//Vpc contract is shared by all channels, ignore the events of other channels
+	if !bytes.Equal(event.Id[:], vpcStateID.SoliditySHA3()) {
+		return nil
+	}
+	logger.Info("VPC closing event received for channel with", handler.ch.PeerID())
+
+	//Vpc close made as part of closing the channel cooperatively requires no action
+	if status := handler.ch.Status(); status == channel.VPCClosing || status == channel.VPCClosed {
+		logger.Info("Channel is being closed cooperatively, no action required")
+		return nil
+	}
+	handler.ch.SetStatus(channel.VPCClosing)
+
+	onChainState, err := handler.bcInst.VPCStates(event.Id)
+	if err != nil {
+		return err
+	}
+
+	latestState := handler.ch.CurrentVpcState()
+	action := decideClosingAction(handler.ch.ClosingMode(), handler.ch.RoleChannel(), onChainState, latestState)
+
+	switch action {
+	case closingActionNotify:
+		logger.Info("VPC closing with version", onChainState.SeqNo, "passed on to the user")
+		if handler.notify != nil {
+			select {
+			case handler.notify <- ClosingNotification{Channel: handler.ch, OnChainState: onChainState}:
+			case <-handler.quit:
+			}
+		}
+		return nil
+	case closingActionRefute:
+		logger.Info("VPC closing with older version", onChainState.SeqNo, "refuting with latest version", latestState.VPCState.Version)
+	case closingActionConfirm:
+		logger.Info("VPC closing with latest version", onChainState.SeqNo, "closing immediately")
+	default:
+		logger.Info("VPC closing with version", onChainState.SeqNo, "no action required")
+		return nil
+	}
+
+	return handler.bcInst.VPCClose(sid.SidComplete, latestState.VPCState.Version,
+		handler.ch.SenderID().OnChainID, handler.ch.ReceiverID().OnChainID,
+		latestState.VPCState.BlockedSender, latestState.VPCState.BlockedReceiver,
+		latestState.SignSender, latestState.SignReceiver)
+}
+
+// decideClosingAction returns the action to be taken on a vpc closing event, based on the closing mode and
+// role of the user in the channel, the state registered in the blockchain and the latest state of the channel.
+func decideClosingAction(closingMode channel.ClosingMode, role channel.Role, onChainState VPCState,
+	latestState channel.VPCStateSigned) closingAction {
+
+	if closingMode != channel.ClosingModeAutoNormal && closingMode != channel.ClosingModeAutoImmediate {
+		return closingActionNotify
+	}
+
+	//Nothing to do if the vpc is already closed or this user has already responded
+	waitingForSelf := (role == channel.Sender && onChainState.WaitingForAlice) ||
+		(role == channel.Receiver && onChainState.WaitingForBob)
+	if !onChainState.Open || !waitingForSelf {
+		return closingActionNone
+	}
+	if latestState.VPCState.Version == nil || onChainState.SeqNo == nil {
+		return closingActionNone
+	}
+
+	switch latestState.VPCState.Version.Cmp(onChainState.SeqNo) {
+	case 1:
+		return closingActionRefute
+	case 0:
+		if closingMode == channel.ClosingModeAutoImmediate {
+			return closingActionConfirm
+		}
+	}
+	return closingActionNone
+}
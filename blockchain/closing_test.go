@@ -0,0 +1,163 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+)
+
+func Test_decideClosingAction(t *testing.T) {
+
+	latestState := func(version int64) channel.VPCStateSigned {
+		return channel.VPCStateSigned{VPCState: channel.VPCState{Version: big.NewInt(version)}}
+	}
+	onChainState := func(version int64, waitingForAlice, waitingForBob bool) VPCState {
+		return VPCState{SeqNo: big.NewInt(version), Open: true, Init: true,
+			WaitingForAlice: waitingForAlice, WaitingForBob: waitingForBob}
+	}
+
+	tests := []struct {
+		name         string
+		closingMode  channel.ClosingMode
+		role         channel.Role
+		onChainState VPCState
+		latestState  channel.VPCStateSigned
+		want         closingAction
+	}{
+		{"manual_older_state", channel.ClosingModeManual, channel.Sender, onChainState(1, true, false), latestState(2), closingActionNotify},
+		{"manual_latest_state", channel.ClosingModeManual, channel.Sender, onChainState(2, true, false), latestState(2), closingActionNotify},
+		{"mode_not_set", channel.ClosingMode(""), channel.Sender, onChainState(1, true, false), latestState(2), closingActionNotify},
+		{"auto_normal_older_state_sender", channel.ClosingModeAutoNormal, channel.Sender, onChainState(1, true, false), latestState(2), closingActionRefute},
+		{"auto_normal_older_state_receiver", channel.ClosingModeAutoNormal, channel.Receiver, onChainState(1, false, true), latestState(2), closingActionRefute},
+		{"auto_normal_latest_state", channel.ClosingModeAutoNormal, channel.Sender, onChainState(2, true, false), latestState(2), closingActionNone},
+		{"auto_normal_already_responded", channel.ClosingModeAutoNormal, channel.Receiver, onChainState(1, true, false), latestState(2), closingActionNone},
+		{"auto_immediate_older_state", channel.ClosingModeAutoImmediate, channel.Sender, onChainState(1, true, false), latestState(2), closingActionRefute},
+		{"auto_immediate_latest_state", channel.ClosingModeAutoImmediate, channel.Receiver, onChainState(2, false, true), latestState(2), closingActionConfirm},
+		{"auto_immediate_newer_on_chain", channel.ClosingModeAutoImmediate, channel.Receiver, onChainState(3, false, true), latestState(2), closingActionNone},
+		{"auto_immediate_vpc_closed", channel.ClosingModeAutoImmediate, channel.Sender, VPCState{SeqNo: big.NewInt(1), WaitingForAlice: true}, latestState(2), closingActionNone},
+		{"auto_immediate_no_latest_state", channel.ClosingModeAutoImmediate, channel.Sender, onChainState(1, true, false), channel.VPCStateSigned{}, closingActionNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideClosingAction(tt.closingMode, tt.role, tt.onChainState, tt.latestState)
+			if got != tt.want {
+				t.Errorf("decideClosingAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestSessionID(t *testing.T) channel.SessionID {
+
+	sid := channel.NewSessionID(aliceID.OnChainID, bobID.OnChainID)
+	if err := sid.GenerateSenderPart(aliceID.OnChainID); err != nil {
+		t.Fatalf("Error generating sender part of sid - %v", err)
+	}
+	if err := sid.GenerateReceiverPart(bobID.OnChainID); err != nil {
+		t.Fatalf("Error generating receiver part of sid - %v", err)
+	}
+	if err := sid.GenerateCompleteSid(); err != nil {
+		t.Fatalf("Error generating complete sid - %v", err)
+	}
+	return sid
+}
+
+func Test_ClosingHandler_handleClosing(t *testing.T) {
+
+	t.Run("session_id_not_set", func(t *testing.T) {
+		handler := &ClosingHandler{ch: &channel.Instance{}}
+
+		err := handler.handleClosing(&contract.VPCEventVpcClosing{})
+		if err == nil {
+			t.Errorf("ClosingHandler.handleClosing() error = nil, want non nil")
+		}
+	})
+	t.Run("event_of_other_channel", func(t *testing.T) {
+		ch := &channel.Instance{}
+		ch.SetRoleChannel(channel.Sender)
+		if err := ch.SetSessionID(newTestSessionID(t)); err != nil {
+			t.Fatalf("Error setting session id - %v", err)
+		}
+		handler := &ClosingHandler{ch: ch}
+
+		err := handler.handleClosing(&contract.VPCEventVpcClosing{Id: [32]byte{1, 2, 3}})
+		if err != nil {
+			t.Errorf("ClosingHandler.handleClosing() error = %v, want nil", err)
+		}
+	})
+	t.Run("cooperative_close_in_progress", func(t *testing.T) {
+		ch := &channel.Instance{}
+		ch.SetRoleChannel(channel.Sender)
+		sid := newTestSessionID(t)
+		if err := ch.SetSessionID(sid); err != nil {
+			t.Fatalf("Error setting session id - %v", err)
+		}
+		for _, status := range []channel.Status{channel.PreSetup, channel.Setup, channel.Init, channel.Open, channel.VPCClosing} {
+			ch.SetStatus(status)
+		}
+		vpcStateID := channel.VPCStateID{AddSender: ch.SenderID().OnChainID, AddrReceiver: ch.ReceiverID().OnChainID, SID: sid.SidComplete}
+		event := &contract.VPCEventVpcClosing{}
+		copy(event.Id[:], vpcStateID.SoliditySHA3())
+
+		//Blockchain instance is not set, so any call on it fails the test
+		handler := &ClosingHandler{ch: ch}
+		err := handler.handleClosing(event)
+		if err != nil {
+			t.Errorf("ClosingHandler.handleClosing() error = %v, want nil", err)
+		}
+	})
+}
+
+func Test_ClosingHandler_Stop(t *testing.T) {
+
+	t.Run("stop", func(t *testing.T) {
+		bcInst := &Instance{}
+		bcInst.EventsChan.VPCVPCClosingChan = make(chan *contract.VPCEventVpcClosing, 1)
+		handler := NewClosingHandler(bcInst, &channel.Instance{}, nil)
+
+		bcInst.EventsChan.VPCVPCClosingChan <- &contract.VPCEventVpcClosing{}
+		stopped := make(chan struct{})
+		go func() {
+			handler.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Errorf("ClosingHandler.Stop() did not return")
+		}
+	})
+	t.Run("events_channel_closed", func(t *testing.T) {
+		bcInst := &Instance{}
+		bcInst.EventsChan.VPCVPCClosingChan = make(chan *contract.VPCEventVpcClosing)
+		handler := NewClosingHandler(bcInst, &channel.Instance{}, nil)
+
+		close(bcInst.EventsChan.VPCVPCClosingChan)
+		select {
+		case <-handler.done:
+		case <-time.After(time.Second):
+			t.Errorf("ClosingHandler did not return when events channel was closed")
+		}
+	})
+}
@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/direct-state-transfer/dst-go/channel"
 	"github.com/direct-state-transfer/dst-go/ethereum/keystore"
 	"github.com/direct-state-transfer/dst-go/ethereum/types"
 	"github.com/direct-state-transfer/dst-go/identity"
@@ -152,4 +153,7 @@ func setupLogger() {
 		fmt.Printf("error setting up logger - %s\n", err)
 		os.Exit(1)
 	}
+
+	//Channel module is used in closing handler tests
+	channel.SetLogger(logger)
 }
@@ -0,0 +1,190 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+)
+
+// CloseChannel closes the open channel ch cooperatively. The peer should call AcceptCloseChannel on its side.
+//
+// The latest vpc state is agreed with the peer as the final state using a close channel request (see channel.Instance.ProposeFinalState)
+// and the channel is then settled on the blockchain using bcInst, as described in settleCooperatively.
+// ctx bounds the time spent waiting for the peer and for contract events. It returns the amounts paid out to the users.
+func CloseChannel(ctx context.Context, ch *channel.Instance, bcInst *Instance) (payout Payout, err error) {
+
+	finalState, err := ch.ProposeFinalState(ctx)
+	if err != nil {
+		return payout, err
+	}
+	return settleCooperatively(ctx, ch, bcInst, finalState)
+}
+
+// AcceptCloseChannel responds to the close channel request from the peer with the proposed final state
+// (see channel.Instance.AgreeFinalState) and if accepted, settles the channel on the blockchain using bcInst,
+// as described in settleCooperatively. ctx bounds the time spent waiting for contract events.
+// It returns the amounts paid out to the users.
+func AcceptCloseChannel(ctx context.Context, ch *channel.Instance, bcInst *Instance, proposal channel.VPCStateSigned) (
+	payout Payout, err error) {
+
+	finalState, err := ch.AgreeFinalState(proposal)
+	if err != nil {
+		return payout, err
+	}
+	return settleCooperatively(ctx, ch, bcInst, finalState)
+}
+
+// CloseConflictError is returned when waiting for the mscontract to be closed cooperatively, if a state was registered
+// in it instead (the peer started a dispute) or it could not be closed as it is no longer waiting to close.
+type CloseConflictError struct {
+	Reason string
+}
+
+func (e *CloseConflictError) Error() string {
+	return fmt.Sprintf("mscontract not closed cooperatively - %s", e.Reason)
+}
+
+// settleCooperatively settles the channel ch on the blockchain with the final state agreed by both the users.
+//
+// If no state is registered in the mscontract (it is in Open status), close is called on the mscontract and the channel
+// moves through WaitingToClose to Closed. Else the vpc is closed with the final state and the funds are distributed
+// using Settle. The offchain connection is closed after the mscontract is closed.
+//
+// If the peer registers a state in the mscontract instead of closing it, the channel is handed over for closing by dispute
+// (see respondToDispute) and is then settled with the final state. Vpc closing events are handled by the closing handler
+// of the channel and, if ctx is done before the channel is settled, the scheduler makes the remaining transactions after the deadlines.
+func settleCooperatively(ctx context.Context, ch *channel.Instance, bcInst *Instance, finalState channel.VPCStateSigned) (
+	payout Payout, err error) {
+
+	status, err := bcInst.Status()
+	if err != nil {
+		return payout, err
+	}
+
+	switch status {
+	case MSCStatusOpen, MSCStatusWaitingToClose:
+		payout, err = closeMSContract(ctx, ch, bcInst)
+		if conflictErr, ok := err.(*CloseConflictError); ok {
+			logger.Info("Channel with", ch.PeerID(), "-", conflictErr, "- settling it with the final state")
+			if err = respondToDispute(ctx, ch, bcInst); err == nil {
+				payout, err = settleFinalState(ctx, ch, bcInst, finalState)
+			}
+		}
+	case MSCStatusSettled:
+		payout, err = settleFinalState(ctx, ch, bcInst, finalState)
+	default:
+		err = fmt.Errorf("mscontract in status %s, cannot be closed cooperatively", status)
+	}
+	if err != nil {
+		return payout, err
+	}
+
+	ch.SetStatus(channel.Closed)
+	if ch.Connected() {
+		if errClose := ch.Close(); errClose != nil {
+			logger.Error("Error closing channel -", errClose)
+		}
+	}
+	logger.Info("Channel closed cooperatively with", ch.PeerID(), "- paid out", payout.Sender, "to sender and", payout.Receiver, "to receiver")
+	return payout, nil
+}
+
+// closeMSContract calls close on the mscontract and waits until the peer also calls it and the mscontract is closed.
+// The deposits held by the mscontract are paid out, as no state is registered in it.
+func closeMSContract(ctx context.Context, ch *channel.Instance, bcInst *Instance) (payout Payout, err error) {
+
+	alice, bob, err := bcInst.Parties()
+	if err != nil {
+		return payout, err
+	}
+
+	ch.SetStatus(channel.WaitingToClose)
+	if err = bcInst.Close(); err != nil {
+		return payout, err
+	}
+	if err = waitMSContractClosed(ctx, bcInst); err != nil {
+		return payout, err
+	}
+	return Payout{Sender: alice.Cash, Receiver: bob.Cash, Closed: true}, nil
+}
+
+// waitMSContractClosed waits until the mscontract is closed. A *CloseConflictError is returned if a state is registered
+// in the mscontract or it is reported as not closed, as it will then not be closed without a dispute.
+func waitMSContractClosed(ctx context.Context, bcInst *Instance) (err error) {
+
+	select {
+	case <-bcInst.EventsChan.MSCClosedChan:
+		return nil
+	case <-bcInst.EventsChan.MSCStateRegisteringChan:
+		return &CloseConflictError{Reason: "peer registered a state in the mscontract"}
+	case <-bcInst.EventsChan.MSCNotClosedChan:
+		return &CloseConflictError{Reason: "mscontract is no longer waiting to close"}
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for mscontract to be closed - %v", ctx.Err())
+	}
+}
+
+// respondToDispute registers the msc base state of the channel ch in the mscontract, after the peer registered a state
+// in it, and waits until the registration is complete. The channel moves through InConflict to Settled.
+// If ctx is done before, the registration is finalized by the scheduler after the timeout.
+func respondToDispute(ctx context.Context, ch *channel.Instance, bcInst *Instance) (err error) {
+
+	ch.SetStatus(channel.InConflict)
+
+	status, err := bcInst.Status()
+	if err != nil {
+		return err
+	}
+	if status == MSCStatusInConflict {
+		baseState := ch.MscBaseState()
+		state := baseState.MSContractBaseState
+		err = bcInst.StateRegister(state.Sid, state.Version, state.BlockedSender, state.BlockedReceiver,
+			baseState.SignSender, baseState.SignReceiver)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-bcInst.EventsChan.MSCStateRegisteredChan:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for msc base state to be registered - %v", ctx.Err())
+		}
+	} else if status != MSCStatusSettled {
+		return fmt.Errorf("mscontract in status %s, cannot respond to dispute", status)
+	}
+
+	ch.SetStatus(channel.Settled)
+	return nil
+}
+
+// settleFinalState settles the channel ch, with a state registered in the mscontract, using the final state agreed
+// by both the users (see Settle). It returns an error if the funds were not paid out.
+func settleFinalState(ctx context.Context, ch *channel.Instance, bcInst *Instance, finalState channel.VPCStateSigned) (
+	payout Payout, err error) {
+
+	if finalState.VPCState.Version == nil {
+		return payout, fmt.Errorf("msc base state registered, but no vpc state to close the vpc with")
+	}
+	payout, err = Settle(ctx, ch, bcInst, finalState, SystemClock)
+	if err == nil && !payout.Closed {
+		err = fmt.Errorf("vpc closed, but mscontract could not pay out the funds")
+	}
+	return payout, err
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_waitMSContractClosed(t *testing.T) {
+
+	t.Run("closed", func(t *testing.T) {
+		bcInst := &Instance{}
+		bcInst.EventsChan.MSCClosedChan = make(chan *contract.MSContractEventClosed, 1)
+		bcInst.EventsChan.MSCClosedChan <- &contract.MSContractEventClosed{}
+
+		if err := waitMSContractClosed(context.Background(), bcInst); err != nil {
+			t.Errorf("waitMSContractClosed() error = %v, want nil", err)
+		}
+	})
+	t.Run("state_registered_by_peer", func(t *testing.T) {
+		bcInst := &Instance{}
+		bcInst.EventsChan.MSCStateRegisteringChan = make(chan *contract.MSContractEventStateRegistering, 1)
+		bcInst.EventsChan.MSCStateRegisteringChan <- &contract.MSContractEventStateRegistering{}
+
+		err := waitMSContractClosed(context.Background(), bcInst)
+		if _, ok := err.(*CloseConflictError); !ok {
+			t.Errorf("waitMSContractClosed() error = %v, want *CloseConflictError", err)
+		}
+	})
+	t.Run("not_closed", func(t *testing.T) {
+		bcInst := &Instance{}
+		bcInst.EventsChan.MSCNotClosedChan = make(chan *contract.MSContractEventNotClosed, 1)
+		bcInst.EventsChan.MSCNotClosedChan <- &contract.MSContractEventNotClosed{}
+
+		err := waitMSContractClosed(context.Background(), bcInst)
+		if _, ok := err.(*CloseConflictError); !ok {
+			t.Errorf("waitMSContractClosed() error = %v, want *CloseConflictError", err)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		bcInst := &Instance{}
+		bcInst.EventsChan.MSCClosedChan = make(chan *contract.MSContractEventClosed)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := waitMSContractClosed(ctx, bcInst); err == nil {
+			t.Errorf("waitMSContractClosed() error = nil, want non nil")
+		}
+	})
+}
+
+func Test_respondToDispute(t *testing.T) {
+
+	contractAddr := types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D")
+
+	//statusWord returns the abi encoding of status, as returned by the status call on mscontract
+	statusWord := func(status MSCStatus) []byte {
+		word := make([]byte, 32)
+		word[31] = byte(status)
+		return word
+	}
+
+	tests := []struct {
+		name       string
+		callReturn []byte
+		callErr    error
+		wantErr    bool
+	}{
+		{name: "not_in_conflict", callReturn: statusWord(MSCStatusOpen), wantErr: true},
+		{name: "status_error", callErr: fmt.Errorf("call error"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			conn := &MockContractBackend{}
+			conn.On("CallContract", mock.Anything, mock.Anything, mock.Anything).Return(tt.callReturn, tt.callErr)
+			msContractInst, _ := contract.NewMSContract(contractAddr.Address, conn)
+			bcInst := &Instance{Conn: conn, OwnerID: aliceID, msContractAddr: contractAddr, MSContractInst: msContractInst}
+
+			err := respondToDispute(context.Background(), &channel.Instance{}, bcInst)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("respondToDispute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_CloseChannel_Simulated(t *testing.T) {
+
+	deposit := types.EtherToWei(big.NewInt(10))
+	aliceInst, bobInst, ch, peerCh, cleanup := openSimulatedChannel(t, deposit)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	acceptErr := make(chan error, 1)
+	go func() {
+		proposal, err := peerCh.CloseChannelRead()
+		if err == nil {
+			_, err = AcceptCloseChannel(ctx, peerCh, bobInst, proposal)
+		}
+		acceptErr <- err
+	}()
+
+	payout, err := CloseChannel(ctx, ch, aliceInst)
+	if err != nil {
+		t.Fatalf("CloseChannel() error = %v", err)
+	}
+	if payout.Sender.Cmp(deposit) != 0 || payout.Receiver.Cmp(deposit) != 0 || !payout.Closed {
+		t.Errorf("CloseChannel() payout = %+v, want %v each and closed", payout, deposit)
+	}
+	if err := <-acceptErr; err != nil {
+		t.Fatalf("AcceptCloseChannel() error = %v", err)
+	}
+
+	for _, inst := range []*channel.Instance{ch, peerCh} {
+		if inst.Status() != channel.Closed || inst.Connected() {
+			t.Errorf("channel status = %s, connected %v, want %s and not connected", inst.Status(), inst.Connected(), channel.Closed)
+		}
+		if finalState := inst.CurrentVpcState(); finalState.VPCState.Version == nil {
+			t.Errorf("channel final vpc state not set")
+		}
+	}
+}
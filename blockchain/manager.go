@@ -19,6 +19,8 @@ package blockchain
 import (
 	"fmt"
 	"math/big"
+	"sync"
+	"time"
 
 	"github.com/direct-state-transfer/dst-go/ethereum/adapter"
 	"github.com/direct-state-transfer/dst-go/ethereum/contract"
@@ -38,6 +40,7 @@ type EventsChan struct {
 	MSCStateRegisteredChan  chan *contract.MSContractEventStateRegistered
 	MSCClosingChan          chan *contract.MSContractEventClosing
 	MSCClosedChan           chan *contract.MSContractEventClosed
+	MSCNotClosedChan        chan *contract.MSContractEventNotClosed
 	VPCVPCClosingChan       chan *contract.VPCEventVpcClosing
 	VPCVPCClosedChan        chan *contract.VPCEventVpcClosed
 
@@ -47,6 +50,7 @@ type EventsChan struct {
 	MSCStateRegisterdSub   adapter.EventSubscription
 	MSCClosingSub          adapter.EventSubscription
 	MSCClosedSub           adapter.EventSubscription
+	MSCNotClosedSub        adapter.EventSubscription
 	VPCVPCClosingSub       adapter.EventSubscription
 	VPCVPCClosedSub        adapter.EventSubscription
 }
@@ -72,8 +76,14 @@ type Instance struct {
 	VPCInst        *contract.VPC
 
 	EventsChan EventsChan
+
+	busy       bool       //Set while transactions are made on the contracts by the scheduler or during settlement
+	busyAccess sync.Mutex //Access control for busy
 }
 
+// acquirePollInterval is the interval at which acquire checks if the instance is released.
+var acquirePollInterval = 100 * time.Millisecond
+
 // NewInstance initialises and returns a new blockchain instance.
 func NewInstance(conn adapter.ContractBackend, ownerID identity.OffChainID) Instance {
 	return Instance{
@@ -82,6 +92,54 @@ func NewInstance(conn adapter.ContractBackend, ownerID identity.OffChainID) Inst
 	}
 }
 
+// tryAcquire marks the instance as busy and returns true, if it is not already busy.
+func (inst *Instance) tryAcquire() bool {
+
+	inst.busyAccess.Lock()
+	defer inst.busyAccess.Unlock()
+
+	if inst.busy {
+		return false
+	}
+	inst.busy = true
+	return true
+}
+
+// acquire waits until the instance is not busy and marks it as busy. It returns an error if ctx is done before.
+func (inst *Instance) acquire(ctx context.Context) error {
+
+	ticker := time.NewTicker(acquirePollInterval)
+	defer ticker.Stop()
+
+	for !inst.tryAcquire() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for other transactions on the contracts to complete - %v", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// release marks the instance as not busy.
+func (inst *Instance) release() {
+
+	inst.busyAccess.Lock()
+	defer inst.busyAccess.Unlock()
+
+	inst.busy = false
+}
+
+// msContractTerminated returns true if the mscontract of the instance is terminated and its code is removed from the blockchain.
+func (inst *Instance) msContractTerminated() (terminated bool, err error) {
+
+	code, err := inst.Conn.CodeAt(context.Background(), inst.msContractAddr.Address, nil)
+	if err != nil {
+		return false, fmt.Errorf("error reading code of mscontract - %v", err)
+	}
+	return len(code) == 0, nil
+}
+
 // LibSignatures returns the address of libSignatures contract used in the instance.
 func (inst *Instance) LibSignatures() types.Address {
 	return inst.libSignaturesAddr
@@ -381,6 +439,326 @@ func (inst *Instance) Execute(AddrSender, AddrReceiver types.Address) (err error
 	return nil
 }
 
+// Refund makes a Refund call on the deployed instance of MSContract.
+// This call will return the confirmed amounts back to users' accounts and terminate the contract.
+//
+// It can be called only when the MSContract is in Init status (i.e the other user has not confirmed)
+// and the timeout period has passed.
+func (inst *Instance) Refund() (err error) {
+
+	//Make transaction opts
+	conn := inst.Conn
+	transactOpts, err := adapter.MakeTransactOpts(conn, inst.OwnerID, types.EtherToWei(big.NewInt(0)), uint64(40e4))
+	if err != nil {
+		return fmt.Errorf("refund() - txOpts - %v", err)
+	}
+
+	//Call function
+	tx, err := inst.MSContractInst.MSContractTransactor.Refund(transactOpts.TransactOpts)
+	if err != nil {
+		return fmt.Errorf("refund() - function call - %v", err)
+	}
+	inst.Conn.Commit()
+
+	hash := types.Hash{Hash: tx.Hash()}
+	_, err = adapter.WaitTillTxMined(conn, hash)
+	if err != nil {
+		return fmt.Errorf("refund() - tx not mined error - %v", err)
+	}
+
+	//Check transaction receipt for success / failure of execution
+	txReceipt, err := conn.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return fmt.Errorf("refund() - txReceipt - %v", err)
+	}
+	if txReceipt.Status == 0 {
+		return fmt.Errorf("refund() - txExecution status = 0 (fail)")
+	}
+
+	return nil
+}
+
+// Close makes a Close call on the deployed instance of MSContract.
+// This call will register this user's request to close the channel when there is no vpc state registered.
+//
+// When the first user calls close on an Open channel, status changes to WaitingToClose.
+// When the other user also calls close, funds are distributed back to users' accounts and the contract is terminated.
+func (inst *Instance) Close() (err error) {
+
+	//Make transaction opts
+	conn := inst.Conn
+	transactOpts, err := adapter.MakeTransactOpts(conn, inst.OwnerID, types.EtherToWei(big.NewInt(0)), uint64(40e4))
+	if err != nil {
+		return fmt.Errorf("close() - txOpts - %v", err)
+	}
+
+	//Call function
+	tx, err := inst.MSContractInst.MSContractTransactor.Close(transactOpts.TransactOpts)
+	if err != nil {
+		return fmt.Errorf("close() - function call - %v", err)
+	}
+	inst.Conn.Commit()
+
+	hash := types.Hash{Hash: tx.Hash()}
+	_, err = adapter.WaitTillTxMined(conn, hash)
+	if err != nil {
+		return fmt.Errorf("close() - tx not mined error - %v", err)
+	}
+
+	//Check transaction receipt for success / failure of execution
+	txReceipt, err := conn.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return fmt.Errorf("close() - txReceipt - %v", err)
+	}
+	if txReceipt.Status == 0 {
+		return fmt.Errorf("close() - txExecution status = 0 (fail)")
+	}
+
+	return nil
+}
+
+// FinalizeRegister makes a FinalizeRegister call on the deployed instance of MSContract.
+// This call will finalize the state registered by this user, when the other user has not registered the state.
+//
+// It can be called only when the MSContract is in InConflict status and the timeout period has passed.
+func (inst *Instance) FinalizeRegister() (err error) {
+
+	//Make transaction opts
+	conn := inst.Conn
+	transactOpts, err := adapter.MakeTransactOpts(conn, inst.OwnerID, types.EtherToWei(big.NewInt(0)), uint64(40e4))
+	if err != nil {
+		return fmt.Errorf("finalizeRegister() - txOpts - %v", err)
+	}
+
+	//Call function
+	tx, err := inst.MSContractInst.MSContractTransactor.FinalizeRegister(transactOpts.TransactOpts)
+	if err != nil {
+		return fmt.Errorf("finalizeRegister() - function call - %v", err)
+	}
+	inst.Conn.Commit()
+
+	hash := types.Hash{Hash: tx.Hash()}
+	_, err = adapter.WaitTillTxMined(conn, hash)
+	if err != nil {
+		return fmt.Errorf("finalizeRegister() - tx not mined error - %v", err)
+	}
+
+	//Check transaction receipt for success / failure of execution
+	txReceipt, err := conn.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return fmt.Errorf("finalizeRegister() - txReceipt - %v", err)
+	}
+	if txReceipt.Status == 0 {
+		return fmt.Errorf("finalizeRegister() - txExecution status = 0 (fail)")
+	}
+
+	return nil
+}
+
+// FinalizeClose makes a FinalizeClose call on the deployed instance of MSContract.
+// This call will distribute the funds back to users' accounts and terminate the contract,
+// when the other user has not responded to the close request.
+//
+// It has effect only when the MSContract is in WaitingToClose status and the timeout period has passed.
+func (inst *Instance) FinalizeClose() (err error) {
+
+	//Make transaction opts
+	conn := inst.Conn
+	transactOpts, err := adapter.MakeTransactOpts(conn, inst.OwnerID, types.EtherToWei(big.NewInt(0)), uint64(40e4))
+	if err != nil {
+		return fmt.Errorf("finalizeClose() - txOpts - %v", err)
+	}
+
+	//Call function
+	tx, err := inst.MSContractInst.MSContractTransactor.FinalizeClose(transactOpts.TransactOpts)
+	if err != nil {
+		return fmt.Errorf("finalizeClose() - function call - %v", err)
+	}
+	inst.Conn.Commit()
+
+	hash := types.Hash{Hash: tx.Hash()}
+	_, err = adapter.WaitTillTxMined(conn, hash)
+	if err != nil {
+		return fmt.Errorf("finalizeClose() - tx not mined error - %v", err)
+	}
+
+	//Check transaction receipt for success / failure of execution
+	txReceipt, err := conn.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return fmt.Errorf("finalizeClose() - txReceipt - %v", err)
+	}
+	if txReceipt.Status == 0 {
+		return fmt.Errorf("finalizeClose() - txExecution status = 0 (fail)")
+	}
+
+	return nil
+}
+
+// VPCFinalize makes a Finalize call on the deployed instance of VPC.
+// This call will close the vpc channel with the latest registered state, when the other user has not responded
+// to the vpc closing and the extended validity period has passed.
+//
+// Sid should be the unique session id of the channel.
+// AddrSender and AddrReceiver should be the onchain address of the respective users in offchain channel.
+func (inst *Instance) VPCFinalize(Sid *big.Int, AddrSender, AddrReceiver types.Address) (err error) {
+
+	//Make transaction opts
+	conn := inst.Conn
+	transactOpts, err := adapter.MakeTransactOpts(conn, inst.OwnerID, types.EtherToWei(big.NewInt(0)), uint64(40e4))
+	if err != nil {
+		return fmt.Errorf("vpcFinalize() - txOpts - %v", err)
+	}
+
+	//Call function
+	tx, err := inst.VPCInst.Finalize(transactOpts.TransactOpts, AddrSender.Address, AddrReceiver.Address, Sid)
+	if err != nil {
+		return fmt.Errorf("vpcFinalize() - function call - %v", err)
+	}
+	inst.Conn.Commit()
+
+	hash := types.Hash{Hash: tx.Hash()}
+	_, err = adapter.WaitTillTxMined(conn, hash)
+	if err != nil {
+		return fmt.Errorf("vpcFinalize() - tx not mined error - %v", err)
+	}
+
+	//Check transaction receipt for success / failure of execution
+	txReceipt, err := conn.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return fmt.Errorf("vpcFinalize() - txReceipt - %v", err)
+	}
+	if txReceipt.Status == 0 {
+		return fmt.Errorf("vpcFinalize() - txExecution status = 0 (fail)")
+	}
+
+	return nil
+}
+
+// MSCStatus represents the status of the channel in MSContract.
+// It corresponds to the ChannelStatus enum defined in MSContract.sol.
+type MSCStatus uint8
+
+// Enumeration of allowed values for status of the channel in MSContract.
+const (
+	MSCStatusInit           MSCStatus = iota //Contract deployed, waiting for confirmation from users
+	MSCStatusOpen                            //Both users have confirmed
+	MSCStatusInConflict                      //State registered by one of the users
+	MSCStatusSettled                         //State registered by both the users or finalized after timeout
+	MSCStatusWaitingToClose                  //Close called by one of the users
+	MSCStatusReadyToClose                    //Ready to close
+)
+
+// String implements fmt.Stringer interface.
+func (status MSCStatus) String() string {
+	switch status {
+	case MSCStatusInit:
+		return "Init"
+	case MSCStatusOpen:
+		return "Open"
+	case MSCStatusInConflict:
+		return "InConflict"
+	case MSCStatusSettled:
+		return "Settled"
+	case MSCStatusWaitingToClose:
+		return "WaitingToClose"
+	case MSCStatusReadyToClose:
+		return "ReadyToClose"
+	default:
+		return fmt.Sprintf("Unknown(%d)", uint8(status))
+	}
+}
+
+// MSCParty represents the properties of a user in MSContract.
+type MSCParty struct {
+	ID           types.Address //On chain address of the user
+	Cash         *big.Int      //Amount (in Wei) held by the contract on behalf of the user
+	WaitForInput bool          //True if the contract is waiting for an input from the user
+}
+
+// MSCInternalContract represents the properties of the vpc state registered in MSContract.
+type MSCInternalContract struct {
+	Active   bool
+	VPC      types.Address
+	Sid      *big.Int
+	BlockedA *big.Int
+	BlockedB *big.Int
+	Version  *big.Int
+}
+
+// Status makes a (read only) Status call on the deployed instance of MSContract.
+// This call will return the current status of the channel in MSContract.
+func (inst *Instance) Status() (status MSCStatus, err error) {
+
+	callOpts := adapter.MakeCallOpts(context.Background(), false, inst.OwnerID.OnChainID)
+
+	//Call function
+	statusValue, err := inst.MSContractInst.Status(callOpts)
+	if err != nil {
+		return status, fmt.Errorf("status() - function call - %v", err)
+	}
+
+	return MSCStatus(statusValue), nil
+}
+
+// Timeout makes a (read only) Timeout call on the deployed instance of MSContract.
+// This call will return the timeout (unix time in seconds) set in the MSContract for the current status.
+func (inst *Instance) Timeout() (timeout *big.Int, err error) {
+
+	callOpts := adapter.MakeCallOpts(context.Background(), false, inst.OwnerID.OnChainID)
+
+	//Call function
+	timeout, err = inst.MSContractInst.Timeout(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("timeout() - function call - %v", err)
+	}
+
+	return timeout, nil
+}
+
+// Parties makes (read only) Alice and Bob calls on the deployed instance of MSContract.
+// This call will return the properties of sender (alice) and receiver (bob) of the channel in MSContract.
+func (inst *Instance) Parties() (alice, bob MSCParty, err error) {
+
+	callOpts := adapter.MakeCallOpts(context.Background(), false, inst.OwnerID.OnChainID)
+
+	//Call function
+	aliceValue, err := inst.MSContractInst.Alice(callOpts)
+	if err != nil {
+		return alice, bob, fmt.Errorf("alice() - function call - %v", err)
+	}
+	bobValue, err := inst.MSContractInst.Bob(callOpts)
+	if err != nil {
+		return alice, bob, fmt.Errorf("bob() - function call - %v", err)
+	}
+
+	alice = MSCParty{ID: types.Address{Address: aliceValue.Id}, Cash: aliceValue.Cash, WaitForInput: aliceValue.WaitForInput}
+	bob = MSCParty{ID: types.Address{Address: bobValue.Id}, Cash: bobValue.Cash, WaitForInput: bobValue.WaitForInput}
+	return alice, bob, nil
+}
+
+// InternalContract makes a (read only) C call on the deployed instance of MSContract.
+// This call will return the properties of vpc state registered in the MSContract.
+func (inst *Instance) InternalContract() (internalContract MSCInternalContract, err error) {
+
+	callOpts := adapter.MakeCallOpts(context.Background(), false, inst.OwnerID.OnChainID)
+
+	//Call function
+	c, err := inst.MSContractInst.C(callOpts)
+	if err != nil {
+		return internalContract, fmt.Errorf("c() - function call - %v", err)
+	}
+
+	internalContract = MSCInternalContract{
+		Active:   c.Active,
+		VPC:      types.Address{Address: c.Vpc},
+		Sid:      c.Sid,
+		BlockedA: c.BlockedA,
+		BlockedB: c.BlockedB,
+		Version:  c.Version,
+	}
+	return internalContract, nil
+}
+
 // States makes a (read only) States call on the deployed instance of vpc.
 // This call will return the current state of vpc channel in blockchain.
 //
@@ -398,6 +776,40 @@ func (inst *Instance) States() (states interface{}, err error) {
 	return states, nil
 }
 
+// VPCState represents the state of a vpc channel as registered in the vpc contract.
+//
+// Alice and Bob correspond to sender and receiver of the offchain channel respectively.
+// SeqNo is the version of the registered state and WaitingForAlice, WaitingForBob indicate
+// if the respective users are yet to call close on the vpc contract.
+type VPCState struct {
+	AliceCash        *big.Int
+	BobCash          *big.Int
+	SeqNo            *big.Int
+	Validity         *big.Int
+	ExtendedValidity *big.Int
+	Open             bool
+	WaitingForAlice  bool
+	WaitingForBob    bool
+	Init             bool
+}
+
+// VPCStates makes a (read only) States call on the deployed instance of vpc.
+// This call will return the state of the vpc channel with vpcStateID registered in the blockchain.
+//
+// vpcStateID is the solidity sha3 hash of the VPCStateID of the offchain channel, see offchain_primitives.go.
+func (inst *Instance) VPCStates(vpcStateID [32]byte) (state VPCState, err error) {
+
+	callOpts := adapter.MakeCallOpts(context.Background(), false, inst.OwnerID.OnChainID)
+
+	//Call function
+	states, err := inst.VPCInst.States(callOpts, vpcStateID)
+	if err != nil {
+		return VPCState{}, fmt.Errorf("vpcStates() - function call - %v", err)
+	}
+
+	return VPCState(states), nil
+}
+
 // InitializeEventsChan initialises subscriptions for all the event defined in offchain protocol.
 //
 // List of events initialised currently
@@ -481,9 +893,40 @@ func (inst *Instance) InitializeEventsChan() (eventsChan EventsChan, err error)
 		return EventsChan{}, err
 	}
 
+	//Watch for MscEventNotClosed
+	eventsChan.MSCNotClosedChan = make(chan *contract.MSContractEventNotClosed, 10)
+	eventsChan.MSCNotClosedSub, err = inst.MSContractInst.WatchEventNotClosed(nil, eventsChan.MSCNotClosedChan)
+	if err != nil {
+		err = fmt.Errorf("watch event Msc not closed error - %v", err)
+		return EventsChan{}, err
+	}
+
 	return eventsChan, nil
 }
 
+// Unsubscribe cancels all the event subscriptions that have been initialised.
+// Subscriptions that were not initialised are skipped.
+// It should be called when the events are no longer required, so that the underlying resources are released.
+func (eventsChan *EventsChan) Unsubscribe() {
+
+	subs := []adapter.EventSubscription{
+		eventsChan.MSCInitalizingSub,
+		eventsChan.MSCInitalizedSub,
+		eventsChan.MSCStateRegisteringSub,
+		eventsChan.MSCStateRegisterdSub,
+		eventsChan.MSCClosingSub,
+		eventsChan.MSCClosedSub,
+		eventsChan.MSCNotClosedSub,
+		eventsChan.VPCVPCClosingSub,
+		eventsChan.VPCVPCClosedSub,
+	}
+	for _, sub := range subs {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+	}
+}
+
 // InitModule initialises blockchain module. It initialises logger and also checks if libSignatures Contract at LibSignAddr is valid.
 // If libSignAddr is empty, the validity check is skipped.
 func InitModule(cfg *Config) (conn *adapter.RealBackend, libSignAddr types.Address, err error) {
@@ -627,6 +627,49 @@ func Test_Instance_SetVPCAddr_mock(t *testing.T) {
 	})
 }
 
+func Test_Instance_acquire(t *testing.T) {
+
+	t.Run("try_acquire_busy", func(t *testing.T) {
+		inst := Instance{}
+		if !inst.tryAcquire() {
+			t.Fatalf("Instance.tryAcquire() = false, want true")
+		}
+		if inst.tryAcquire() {
+			t.Errorf("Instance.tryAcquire() when busy = true, want false")
+		}
+		inst.release()
+		if !inst.tryAcquire() {
+			t.Errorf("Instance.tryAcquire() after release = false, want true")
+		}
+	})
+
+	t.Run("acquire_after_release", func(t *testing.T) {
+		inst := Instance{}
+		inst.tryAcquire()
+		go func() {
+			time.Sleep(2 * acquirePollInterval)
+			inst.release()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := inst.acquire(ctx); err != nil {
+			t.Errorf("Instance.acquire() err = %v, want nil", err)
+		}
+	})
+
+	t.Run("acquire_timeout", func(t *testing.T) {
+		inst := Instance{}
+		inst.tryAcquire()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*acquirePollInterval)
+		defer cancel()
+		if err := inst.acquire(ctx); err == nil {
+			t.Errorf("Instance.acquire() when busy err = nil, want non nil")
+		}
+	})
+}
+
 func Test_Instance_DeployVPC_mock(t *testing.T) {
 
 	t.Run("VPCValid", func(t *testing.T) {
@@ -2748,6 +2791,62 @@ func Test_Instance_InitializeEventsChan_mock(t *testing.T) {
 	}
 }
 
+type countingSubscription struct {
+	unsubscribeCount int
+}
+
+func (s *countingSubscription) Unsubscribe() {
+	s.unsubscribeCount++
+}
+func (s *countingSubscription) Err() <-chan error {
+	errChan := make(chan error, 1)
+	return errChan
+}
+
+func Test_EventsChan_Unsubscribe(t *testing.T) {
+
+	t.Run("all_subscriptions", func(t *testing.T) {
+		subs := make([]*countingSubscription, 8)
+		for idx := range subs {
+			subs[idx] = &countingSubscription{}
+		}
+		eventsChan := EventsChan{
+			MSCInitalizingSub:      subs[0],
+			MSCInitalizedSub:       subs[1],
+			MSCStateRegisteringSub: subs[2],
+			MSCStateRegisterdSub:   subs[3],
+			MSCClosingSub:          subs[4],
+			MSCClosedSub:           subs[5],
+			VPCVPCClosingSub:       subs[6],
+			VPCVPCClosedSub:        subs[7],
+		}
+
+		eventsChan.Unsubscribe()
+
+		for idx := range subs {
+			if subs[idx].unsubscribeCount != 1 {
+				t.Errorf("EventsChan.Unsubscribe() - subscription %d unsubscribed %d times, want 1", idx, subs[idx].unsubscribeCount)
+			}
+		}
+	})
+	t.Run("partial_subscriptions", func(t *testing.T) {
+		sub := &countingSubscription{}
+		eventsChan := EventsChan{
+			MSCInitalizingSub: sub,
+		}
+
+		eventsChan.Unsubscribe()
+
+		if sub.unsubscribeCount != 1 {
+			t.Errorf("EventsChan.Unsubscribe() - subscription unsubscribed %d times, want 1", sub.unsubscribeCount)
+		}
+	})
+	t.Run("no_subscriptions", func(t *testing.T) {
+		eventsChan := EventsChan{}
+		eventsChan.Unsubscribe()
+	})
+}
+
 func Test_SetupLibSignatures_mock(t *testing.T) {
 	tests := []struct {
 		name                     string
@@ -2842,3 +2941,185 @@ func Test_NewSimulatedInstance(t *testing.T) {
 		t.Errorf("NewInstance() Instance.Conn not assigned properly")
 	}
 }
+
+//testTransactionCall_mock tests a function of instance that makes a transaction on a contract,
+//using mocks that do not depend on the hash of the transaction.
+func testTransactionCall_mock(t *testing.T, funcName string, call func(inst *Instance) error) {
+
+	idWithCredentials := identity.OffChainID{
+		OnChainID: aliceID.OnChainID,
+		KeyStore:  testKeyStore,
+		Password:  alicePassword,
+	}
+	contractAddr := types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D")
+
+	newInstance := func(conn *MockContractBackend) *Instance {
+		vpcInst, _ := contract.NewVPC(contractAddr.Address, conn)
+		msContractInst, _ := contract.NewMSContract(contractAddr.Address, conn)
+		return &Instance{
+			Conn:              conn,
+			OwnerID:           idWithCredentials,
+			libSignaturesAddr: contractAddr,
+			MSContractInst:    msContractInst,
+			VPCInst:           vpcInst,
+		}
+	}
+
+	tests := []struct {
+		name             string
+		nonceErr         error
+		sendErr          error
+		receiptStatus    uint64
+		wantSendCalls    int
+		wantReceiptCalls int
+		wantErr          bool
+	}{
+		{"Valid", nil, nil, ethereumTypes.ReceiptStatusSuccessful, 1, 1, false},
+		{"MakeTransaction_Error", fmt.Errorf("nonce error"), nil, 0, 0, 0, true},
+		{"SendTransaction_Error", nil, fmt.Errorf("send error"), 0, 1, 0, true},
+		{"Execution_Failed", nil, nil, ethereumTypes.ReceiptStatusFailed, 1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Setup mock
+			conn := &MockContractBackend{}
+			conn.On("PendingNonceAt", context.Background(), idWithCredentials.OnChainID.Address).Return(uint64(0), tt.nonceErr)
+			conn.On("SuggestGasPrice", context.Background()).Return(big.NewInt(0), nil)
+			conn.On("SendTransaction", mock.Anything, mock.Anything).Return(tt.sendErr)
+			conn.On("Commit").Return()
+			conn.On("BackendType").Return(adapter.Real)
+			conn.On("TransactionByHash", context.Background(), mock.Anything).Return(nil, false, nil)
+			conn.On("TransactionReceipt", context.Background(), mock.Anything).Return(
+				&ethereumTypes.Receipt{Status: tt.receiptStatus}, nil)
+
+			err := call(newInstance(conn))
+
+			//Assert on results
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Instance.%s() error = %v, wantErr %t", funcName, err, tt.wantErr)
+			}
+
+			//Assert on mock calls
+			if !conn.AssertNumberOfCalls(t, "SendTransaction", tt.wantSendCalls) {
+				t.Errorf("Instance.%s() - SendTransaction() not called expected number of times", funcName)
+			}
+			if !conn.AssertNumberOfCalls(t, "TransactionReceipt", tt.wantReceiptCalls) {
+				t.Errorf("Instance.%s() - TransactionReceipt() not called expected number of times", funcName)
+			}
+		})
+	}
+}
+
+func Test_Instance_Refund_mock(t *testing.T) {
+	testTransactionCall_mock(t, "Refund", func(inst *Instance) error {
+		return inst.Refund()
+	})
+}
+
+func Test_Instance_Close_mock(t *testing.T) {
+	testTransactionCall_mock(t, "Close", func(inst *Instance) error {
+		return inst.Close()
+	})
+}
+
+func Test_Instance_FinalizeRegister_mock(t *testing.T) {
+	testTransactionCall_mock(t, "FinalizeRegister", func(inst *Instance) error {
+		return inst.FinalizeRegister()
+	})
+}
+
+func Test_Instance_FinalizeClose_mock(t *testing.T) {
+	testTransactionCall_mock(t, "FinalizeClose", func(inst *Instance) error {
+		return inst.FinalizeClose()
+	})
+}
+
+func Test_Instance_VPCFinalize_mock(t *testing.T) {
+	testTransactionCall_mock(t, "VPCFinalize", func(inst *Instance) error {
+		return inst.VPCFinalize(big.NewInt(10), aliceID.OnChainID, bobID.OnChainID)
+	})
+}
+
+func Test_Instance_ReadOnlyCalls_mock(t *testing.T) {
+
+	contractAddr := types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D")
+
+	tests := []struct {
+		name string
+		call func(inst *Instance) error
+	}{
+		{"Status", func(inst *Instance) error {
+			_, err := inst.Status()
+			return err
+		}},
+		{"Timeout", func(inst *Instance) error {
+			_, err := inst.Timeout()
+			return err
+		}},
+		{"Parties", func(inst *Instance) error {
+			_, _, err := inst.Parties()
+			return err
+		}},
+		{"InternalContract", func(inst *Instance) error {
+			_, err := inst.InternalContract()
+			return err
+		}},
+		{"VPCStates", func(inst *Instance) error {
+			_, err := inst.VPCStates([32]byte{})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"_CallContract_Error", func(t *testing.T) {
+
+			//Setup mock
+			conn := &MockContractBackend{}
+			conn.On("CallContract", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("call error"))
+
+			vpcInst, _ := contract.NewVPC(contractAddr.Address, conn)
+			msContractInst, _ := contract.NewMSContract(contractAddr.Address, conn)
+			inst := &Instance{
+				Conn:           conn,
+				OwnerID:        aliceID,
+				MSContractInst: msContractInst,
+				VPCInst:        vpcInst,
+			}
+
+			err := tt.call(inst)
+
+			//Assert on results
+			if err == nil {
+				t.Errorf("Instance.%s() error = nil, want non nil", tt.name)
+			}
+			if !conn.AssertNumberOfCalls(t, "CallContract", 1) {
+				t.Errorf("Instance.%s() - CallContract() was not called", tt.name)
+			}
+		})
+	}
+}
+
+func Test_MSCStatus_String(t *testing.T) {
+
+	tests := []struct {
+		status MSCStatus
+		want   string
+	}{
+		{MSCStatusInit, "Init"},
+		{MSCStatusOpen, "Open"},
+		{MSCStatusInConflict, "InConflict"},
+		{MSCStatusSettled, "Settled"},
+		{MSCStatusWaitingToClose, "WaitingToClose"},
+		{MSCStatusReadyToClose, "ReadyToClose"},
+		{MSCStatus(10), "Unknown(10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.status.String(); got != tt.want {
+				t.Errorf("MSCStatus.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
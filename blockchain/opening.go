@@ -0,0 +1,653 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// OpeningStep is a step in the procedure for opening a channel.
+type OpeningStep string
+
+// Enumeration of steps in the procedure for opening a channel, in the order in which they are performed.
+const (
+	OpeningStepNewChannel    OpeningStep = OpeningStep("new-channel")    //Connecting to the peer and exchanging new channel request
+	OpeningStepSessionID     OpeningStep = OpeningStep("session-id")     //Exchanging the session id
+	OpeningStepContracts     OpeningStep = OpeningStep("contracts")      //Deploying and sharing the addresses of contracts
+	OpeningStepDeposit       OpeningStep = OpeningStep("deposit")        //Confirming the deposit in mscontract
+	OpeningStepMSCBaseState  OpeningStep = OpeningStep("msc-base-state") //Exchanging the signatures on msc base state
+	OpeningStepStateRegister OpeningStep = OpeningStep("state-register") //Registering the msc base state in mscontract
+)
+
+// MSCConfirmTimeout is the duration after the deployment of mscontract, within which both users should confirm their deposits.
+// It is fixed in the mscontract, so the confirm timeout in the terms of a channel should not be shorter than this.
+const MSCConfirmTimeout = 100 * time.Minute
+
+// OpeningError is returned when the procedure for opening a channel fails.
+//
+// Step is the step at which the procedure failed. If DepositLocked is true, the deposit of this user was confirmed
+// before the failure and remains locked in the mscontract until it is refunded after the timeout.
+// Blockchain instance used for opening the channel can be tracked by a Scheduler to make the refund automatically.
+type OpeningError struct {
+	Step          OpeningStep
+	DepositLocked bool
+	Err           error
+}
+
+func (e *OpeningError) Error() string {
+	return fmt.Sprintf("channel opening failed at step %s - %v", e.Step, e.Err)
+}
+
+// OpeningPolicy is consulted by AcceptChannel before accepting the requests made by the peer,
+// in addition to the validations done by AcceptChannel itself.
+// NewChannel is called with the terms proposed by the peer, so that the deposits and timeouts can be checked against local limits.
+// Each method returns nil to accept the request or an error describing why it is declined.
+type OpeningPolicy interface {
+	NewChannel(peerID identity.OffChainID, msgProtocolVersion string, contractStoreVersion []byte, terms channel.Terms) error
+	MSCBaseState(peerID identity.OffChainID, state channel.MSCBaseState) error
+}
+
+// OpenChannel establishes a new offchain channel with the peer using adapterType and opens it with the proposed terms.
+// The owner of bcInst is used as the identity of this user in the channel and for making the transactions.
+// See SetupChannel for the sequence of steps performed after the connection is established.
+//
+// If any step fails, the channel is closed and an *OpeningError is returned.
+func OpenChannel(ctx context.Context, bcInst *Instance, peerID identity.OffChainID, adapterType channel.AdapterType,
+	terms channel.Terms) (ch *channel.Instance, err error) {
+
+	ch, err = channel.NewChannel(bcInst.OwnerID, peerID, adapterType)
+	if err != nil {
+		return nil, &OpeningError{Step: OpeningStepNewChannel, Err: err}
+	}
+
+	err = SetupChannel(ctx, ch, bcInst, terms)
+	if err != nil {
+		if ch.Connected() {
+			if errClose := ch.Close(); errClose != nil {
+				logger.Error("Error closing channel -", errClose)
+			}
+		}
+		return nil, err
+	}
+	return ch, nil
+}
+
+// SetupChannel performs the procedure for opening a channel as the sender on the connected channel ch,
+// proposing terms to the peer. The peer should call AcceptChannel on its side.
+//
+// The new channel request with the terms and session id are exchanged with the peer. Vpc and mscontract are deployed
+// using bcInst and their addresses shared along with the libSignatures address already set in bcInst.
+// After both users confirm the agreed deposits, msc base state with the confirmed amounts is signed by both users and
+// registered in the mscontract.
+//
+// The status of the channel is moved from PreSetup through Setup and Init to Open as the procedure progresses.
+// ctx bounds the time spent waiting for the peer and for contract events.
+// If any step fails, the channel is closed, its status is set to Closed and an *OpeningError is returned.
+// If the failure is due to the peer aborting a request, Err of the *OpeningError is a *channel.AbortError.
+// If the channel is not a new channel or terms are invalid, the channel is not modified.
+func SetupChannel(ctx context.Context, ch *channel.Instance, bcInst *Instance, terms channel.Terms) (err error) {
+
+	if err = checkTerms(terms, SystemClock()); err != nil {
+		return &OpeningError{Step: OpeningStepNewChannel, Err: err}
+	}
+	if err = checkOpeningPreconditions(ch, terms.DepositSender); err != nil {
+		return err
+	}
+	opening := &channelOpening{ch: ch, bcInst: bcInst, step: OpeningStepNewChannel}
+	defer func() {
+		if err != nil {
+			err = opening.abort(err)
+		}
+	}()
+
+	status, reason, err := ch.NewChannelRequestContext(ctx, channel.Version, contract.Store.SHA256Sum(), terms)
+	if err != nil {
+		return err
+	}
+	if status != channel.MessageStatusAccept {
+		return fmt.Errorf("new channel request declined by peer - %s", reason)
+	}
+	if err = ch.SetTerms(terms); err != nil {
+		return err
+	}
+	ch.SetContractStore(contract.Store)
+
+	opening.step = OpeningStepSessionID
+	sid := channel.NewSessionID(ch.SenderID().OnChainID, ch.ReceiverID().OnChainID)
+	err = sid.GenerateSenderPart(ch.SenderID().OnChainID)
+	if err != nil {
+		return err
+	}
+	sid, status, err = ch.SessionIDRequestContext(ctx, sid)
+	if err != nil {
+		return err
+	}
+	if status != channel.MessageStatusAccept {
+		return fmt.Errorf("session id declined by peer")
+	}
+	err = ch.SetSessionID(sid)
+	if err != nil {
+		return err
+	}
+	ch.SetStatus(channel.Setup)
+
+	opening.step = OpeningStepContracts
+	if err = opening.deployAndShareContracts(ctx); err != nil {
+		return err
+	}
+	ch.SetStatus(channel.Init)
+
+	opening.step = OpeningStepDeposit
+	cashSender, cashReceiver, err := opening.confirmDeposit(ctx, SystemClock)
+	if err != nil {
+		return err
+	}
+
+	opening.step = OpeningStepMSCBaseState
+	if terms.Expired(SystemClock()) {
+		return fmt.Errorf("channel terms expired before msc base state was signed")
+	}
+	baseStatePartial := channel.MSCBaseStateSigned{
+		MSContractBaseState: channel.MSCBaseState{
+			VpcAddress:      bcInst.VPCAddr(),
+			Sid:             sid.SidComplete,
+			BlockedSender:   cashSender,
+			BlockedReceiver: cashReceiver,
+			Version:         big.NewInt(1),
+		},
+	}
+	if err = baseStatePartial.AddSign(bcInst.OwnerID, channel.Sender); err != nil {
+		return err
+	}
+	baseState, status, err := ch.NewMSCBaseStateRequestContext(ctx, baseStatePartial)
+	if err != nil {
+		return err
+	}
+	if status != channel.MessageStatusAccept {
+		return fmt.Errorf("msc base state declined by peer")
+	}
+	if err = ch.SetMSCBaseState(baseState); err != nil {
+		return err
+	}
+
+	opening.step = OpeningStepStateRegister
+	if err = opening.stateRegister(ctx, baseState, false); err != nil {
+		return err
+	}
+
+	ch.SetStatus(channel.Open)
+	logger.Info("Channel opened with", ch.PeerID())
+	return nil
+}
+
+// AcceptChannel performs the procedure for opening a channel as the receiver on the connected channel ch,
+// with deposit (in Wei) as the amount to be blocked by this user. It responds to the requests made by SetupChannel on the peer side.
+//
+// The new channel request is accepted only if the message protocol version and contract store version match that of this node
+// and the proposed terms are valid, have not expired and require this user to deposit exactly deposit.
+// Addresses of the contracts are accepted only if the contracts at those addresses are valid and the mscontract is deployed
+// for the users in this channel. Msc base state is signed only if it matches the session id, vpc address and the amounts
+// confirmed in the mscontract. Requests that do not satisfy these conditions are declined.
+// If policy is not nil, the new channel request and msc base state are also declined if the policy does not accept them.
+// New channel requests with a different version or not accepted by the policy are aborted with
+// channel.AbortVersionMismatch or channel.AbortPolicyRejection respectively, instead of being declined.
+//
+// The status of the channel is moved from PreSetup through Setup and Init to Open as the procedure progresses.
+// ctx bounds the time spent waiting for the peer and for contract events.
+// If any step fails, the channel is closed, its status is set to Closed and an *OpeningError is returned.
+// If the channel is not a new channel or deposit is invalid, the channel is not modified.
+func AcceptChannel(ctx context.Context, ch *channel.Instance, bcInst *Instance, deposit *big.Int,
+	policy OpeningPolicy) (err error) {
+
+	if err = checkOpeningPreconditions(ch, deposit); err != nil {
+		return err
+	}
+	opening := &channelOpening{ch: ch, bcInst: bcInst, step: OpeningStepNewChannel}
+	defer func() {
+		if err != nil {
+			err = opening.abort(err)
+		}
+	}()
+
+	msgProtocolVersion, contractStoreVersion, terms, err := ch.NewChannelReadContext(ctx)
+	if err != nil {
+		return err
+	}
+	var reason string
+	var abortCode channel.AbortCode //Set if the request is to be aborted instead of declined
+	switch {
+	case msgProtocolVersion != channel.Version:
+		reason = fmt.Sprintf("message protocol version %s not supported, want %s", msgProtocolVersion, channel.Version)
+		abortCode = channel.AbortVersionMismatch
+	case !bytes.Equal(contractStoreVersion, contract.Store.SHA256Sum()):
+		reason = fmt.Sprintf("contract store version 0x%x not supported, want 0x%x", contractStoreVersion, contract.Store.SHA256Sum())
+		abortCode = channel.AbortVersionMismatch
+	default:
+		if errTerms := checkTerms(terms, SystemClock()); errTerms != nil {
+			reason = errTerms.Error()
+		} else if terms.DepositReceiver.Cmp(deposit) != 0 {
+			reason = fmt.Sprintf("deposit %v proposed for receiver, want %v", terms.DepositReceiver, deposit)
+		} else if policy != nil {
+			if errPolicy := policy.NewChannel(ch.PeerID(), msgProtocolVersion, contractStoreVersion, terms); errPolicy != nil {
+				reason = errPolicy.Error()
+				abortCode = channel.AbortPolicyRejection
+			}
+		}
+	}
+	if abortCode != "" {
+		if err = ch.Abort(channel.MsgNewChannelRequest, abortCode, reason); err != nil {
+			return err
+		}
+		return fmt.Errorf("new channel request aborted with code %s - %s", abortCode, reason)
+	}
+	if reason != "" {
+		err = ch.NewChannelRespond(msgProtocolVersion, contractStoreVersion, terms, channel.MessageStatusDecline, reason)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("new channel request declined - %s", reason)
+	}
+	if err = ch.SetTerms(terms); err != nil {
+		return err
+	}
+	err = ch.NewChannelRespond(msgProtocolVersion, contractStoreVersion, terms, channel.MessageStatusAccept, "")
+	if err != nil {
+		return err
+	}
+	ch.SetContractStore(contract.Store)
+
+	opening.step = OpeningStepSessionID
+	sid, err := ch.SessionIDReadContext(ctx)
+	if err != nil {
+		return err
+	}
+	err = sid.GenerateReceiverPart(ch.ReceiverID().OnChainID)
+	if err == nil {
+		err = sid.GenerateCompleteSid()
+	}
+	if err == nil {
+		err = ch.SetSessionID(sid)
+	}
+	if err != nil {
+		if errRespond := ch.SessionIDRespond(sid, channel.MessageStatusDecline); errRespond != nil {
+			logger.Error("Error declining session id -", errRespond)
+		}
+		return err
+	}
+	if err = ch.SessionIDRespond(sid, channel.MessageStatusAccept); err != nil {
+		return err
+	}
+	ch.SetStatus(channel.Setup)
+
+	opening.step = OpeningStepContracts
+	if err = opening.acceptContracts(ctx); err != nil {
+		return err
+	}
+	ch.SetStatus(channel.Init)
+
+	opening.step = OpeningStepDeposit
+	cashSender, cashReceiver, err := opening.confirmDeposit(ctx, SystemClock)
+	if err != nil {
+		return err
+	}
+
+	opening.step = OpeningStepMSCBaseState
+	baseState, err := ch.NewMSCBaseStateReadContext(ctx)
+	if err != nil {
+		return err
+	}
+	err = validateMSCBaseState(ch, baseState.MSContractBaseState, bcInst.VPCAddr(), cashSender, cashReceiver, SystemClock())
+	if err == nil && policy != nil {
+		err = policy.MSCBaseState(ch.PeerID(), baseState.MSContractBaseState)
+	}
+	if err == nil {
+		err = baseState.AddSign(bcInst.OwnerID, channel.Receiver)
+	}
+	if err == nil {
+		err = ch.SetMSCBaseState(baseState)
+	}
+	if err != nil {
+		if errRespond := ch.NewMSCBaseStateRespond(baseState, channel.MessageStatusDecline); errRespond != nil {
+			logger.Error("Error declining msc base state -", errRespond)
+		}
+		return err
+	}
+	if err = ch.NewMSCBaseStateRespond(baseState, channel.MessageStatusAccept); err != nil {
+		return err
+	}
+
+	opening.step = OpeningStepStateRegister
+	if err = opening.stateRegister(ctx, baseState, true); err != nil {
+		return err
+	}
+
+	ch.SetStatus(channel.Open)
+	logger.Info("Channel opened with", ch.PeerID())
+	return nil
+}
+
+// checkTerms checks if the terms are valid and can be honoured by the contracts at now.
+func checkTerms(terms channel.Terms, now time.Time) error {
+
+	if err := terms.Validate(); err != nil {
+		return err
+	}
+	if terms.Expired(now) {
+		return fmt.Errorf("channel terms expired at %s", time.Unix(terms.Expiry, 0).UTC().Format(time.RFC3339))
+	}
+	if time.Duration(terms.ConfirmTimeout)*time.Second < MSCConfirmTimeout {
+		return fmt.Errorf("confirm timeout %ds shorter than %s fixed in mscontract", terms.ConfirmTimeout, MSCConfirmTimeout)
+	}
+	return nil
+}
+
+// checkOpeningPreconditions checks if the deposit is valid and sets the status of the channel to PreSetup.
+// An error is returned if the channel is not a new channel.
+func checkOpeningPreconditions(ch *channel.Instance, deposit *big.Int) error {
+
+	if deposit == nil || deposit.Sign() < 0 {
+		return &OpeningError{Step: OpeningStepNewChannel, Err: fmt.Errorf("deposit should be a non negative amount")}
+	}
+	if !ch.SetStatus(channel.PreSetup) {
+		return &OpeningError{Step: OpeningStepNewChannel, Err: fmt.Errorf("channel status is %s, want new channel", ch.Status())}
+	}
+	return nil
+}
+
+// channelOpening holds the progress of the procedure for opening a channel.
+type channelOpening struct {
+	ch     *channel.Instance
+	bcInst *Instance
+
+	step          OpeningStep //Step currently being performed
+	depositLocked bool        //True if the deposit of this user has been confirmed in mscontract
+}
+
+// abort closes the channel after a failure in the opening procedure and returns err annotated with the current step.
+func (opening *channelOpening) abort(err error) error {
+
+	openingErr := &OpeningError{Step: opening.step, DepositLocked: opening.depositLocked, Err: err}
+	logger.Error(openingErr)
+
+	opening.ch.SetStatus(channel.Closed)
+	if opening.ch.Connected() {
+		if errClose := opening.ch.Close(); errClose != nil {
+			logger.Error("Error closing channel -", errClose)
+		}
+	}
+	opening.bcInst.EventsChan.Unsubscribe()
+
+	return openingErr
+}
+
+// deployAndShareContracts deploys the vpc and mscontract and shares their addresses
+// along with the libSignatures address with the peer.
+func (opening *channelOpening) deployAndShareContracts(ctx context.Context) (err error) {
+
+	ch, bcInst := opening.ch, opening.bcInst
+
+	if bcInst.LibSignatures() == types.HexToAddress("") {
+		return fmt.Errorf("libSignatures address not set in blockchain instance")
+	}
+	if err = opening.shareContractAddr(ctx, bcInst.LibSignatures(), contract.Store.LibSignatures()); err != nil {
+		return err
+	}
+
+	if err = bcInst.DeployVPC(); err != nil {
+		return err
+	}
+	if err = ch.SetVPCAddr(bcInst.VPCAddr()); err != nil {
+		return err
+	}
+	if err = opening.shareContractAddr(ctx, bcInst.VPCAddr(), contract.Store.VPC()); err != nil {
+		return err
+	}
+
+	if err = bcInst.DeployMSContract(ch.SenderID().OnChainID, ch.ReceiverID().OnChainID); err != nil {
+		return err
+	}
+	if err = ch.SetMSContractAddr(bcInst.MSContractAddr()); err != nil {
+		return err
+	}
+	return opening.shareContractAddr(ctx, bcInst.MSContractAddr(), contract.Store.MSContract())
+}
+
+func (opening *channelOpening) shareContractAddr(ctx context.Context, addr types.Address, id contract.Handler) (err error) {
+
+	status, err := opening.ch.ContractAddrRequestContext(ctx, addr, id)
+	if err != nil {
+		return err
+	}
+	if status != channel.MessageStatusAccept {
+		return fmt.Errorf("%s contract address %s declined by peer", id.Name, addr.Hex())
+	}
+	return nil
+}
+
+// acceptContracts reads and validates the addresses of libSignatures, vpc and mscontract shared by the peer
+// and sets them in the blockchain instance. It also initialises the events channel for the contracts.
+func (opening *channelOpening) acceptContracts(ctx context.Context) (err error) {
+
+	ch, bcInst := opening.ch, opening.bcInst
+
+	err = opening.acceptContractAddr(ctx, contract.Store.LibSignatures(), bcInst.SetLibSignatures)
+	if err != nil {
+		return err
+	}
+
+	err = opening.acceptContractAddr(ctx, contract.Store.VPC(), func(addr types.Address) (err error) {
+		if err = attachVPC(bcInst, addr); err != nil {
+			return err
+		}
+		return ch.SetVPCAddr(addr)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = opening.acceptContractAddr(ctx, contract.Store.MSContract(), func(addr types.Address) (err error) {
+		if err = attachMSContract(bcInst, ch, addr); err != nil {
+			return err
+		}
+		return ch.SetMSContractAddr(addr)
+	})
+	if err != nil {
+		return err
+	}
+
+	bcInst.EventsChan, err = bcInst.InitializeEventsChan()
+	if err != nil {
+		return fmt.Errorf("initializing events channel error - %v", err)
+	}
+	return nil
+}
+
+// attachVPC validates the vpc contract at addr, sets it in the blockchain instance and instantiates it.
+func attachVPC(bcInst *Instance, addr types.Address) (err error) {
+
+	if err = bcInst.SetVPCAddr(addr); err != nil {
+		return err
+	}
+	bcInst.VPCInst, err = contract.NewVPC(addr.Address, bcInst.Conn)
+	if err != nil {
+		return fmt.Errorf("instantiate vpc error - %v", err)
+	}
+	return nil
+}
+
+// attachMSContract validates the mscontract at addr, sets it in the blockchain instance and instantiates it.
+// It also checks that the parties of the mscontract are the users of the channel ch.
+func attachMSContract(bcInst *Instance, ch *channel.Instance, addr types.Address) (err error) {
+
+	if err = bcInst.SetMSContractAddr(addr); err != nil {
+		return err
+	}
+	bcInst.MSContractInst, err = contract.NewMSContract(addr.Address, bcInst.Conn)
+	if err != nil {
+		return fmt.Errorf("instantiate MSContract error - %v", err)
+	}
+	alice, bob, err := bcInst.Parties()
+	if err != nil {
+		return err
+	}
+	if alice.ID != ch.SenderID().OnChainID || bob.ID != ch.ReceiverID().OnChainID {
+		return fmt.Errorf("mscontract parties (%s, %s) do not match channel users", alice.ID.Hex(), bob.ID.Hex())
+	}
+	return nil
+}
+
+// acceptContractAddr reads the address of the contract shared by the peer and responds with accept
+// if the contract matches wantID and it is successfully set using setAddr, else with decline.
+func (opening *channelOpening) acceptContractAddr(ctx context.Context, wantID contract.Handler,
+	setAddr func(types.Address) error) (err error) {
+
+	addr, id, err := opening.ch.ContractAddrReadContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !id.Equal(wantID) {
+		err = fmt.Errorf("got contract %s, want %s", id.Name, wantID.Name)
+	} else {
+		err = setAddr(addr)
+	}
+	if err != nil {
+		if errRespond := opening.ch.ContractAddrRespond(addr, id, channel.MessageStatusDecline); errRespond != nil {
+			logger.Error("Error declining contract address -", errRespond)
+		}
+		return fmt.Errorf("%s contract address %s declined - %v", wantID.Name, addr.Hex(), err)
+	}
+	return opening.ch.ContractAddrRespond(addr, id, channel.MessageStatusAccept)
+}
+
+// confirmDeposit confirms the deposit agreed in the terms of the channel in the mscontract after it is initializing
+// and waits until the peer also confirms. It returns the amounts confirmed by both the users.
+//
+// Deposit is confirmed only if the terms have not expired and the confirm deadline in mscontract is within the
+// agreed confirm timeout, as determined using clock. An error is returned if the peer confirms an amount other than agreed.
+func (opening *channelOpening) confirmDeposit(ctx context.Context, clock Clock) (
+	cashSender, cashReceiver *big.Int, err error) {
+
+	events := opening.bcInst.EventsChan
+	terms := opening.ch.Terms()
+
+	select {
+	case <-events.MSCInitializingChan:
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("waiting for mscontract initializing event - %v", ctx.Err())
+	}
+
+	deadline, err := opening.bcInst.Timeout()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = checkConfirmDeadline(terms, deadline, clock()); err != nil {
+		return nil, nil, err
+	}
+
+	if err = opening.bcInst.Confirm(terms.Deposit(opening.ch.RoleChannel())); err != nil {
+		return nil, nil, err
+	}
+	opening.depositLocked = true
+
+	select {
+	case event := <-events.MSCInitializedChan:
+		cashSender, cashReceiver = event.CashAlice, event.CashBob
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("waiting for peer to confirm deposit - %v", ctx.Err())
+	}
+
+	if cashSender.Cmp(terms.DepositSender) != 0 || cashReceiver.Cmp(terms.DepositReceiver) != 0 {
+		return nil, nil, fmt.Errorf("confirmed amounts (%v, %v) do not match the agreed deposits (%v, %v)",
+			cashSender, cashReceiver, terms.DepositSender, terms.DepositReceiver)
+	}
+	return cashSender, cashReceiver, nil
+}
+
+// checkConfirmDeadline checks if the terms have not expired and the confirm deadline set in the mscontract
+// (unix time in seconds) is not later than the confirm timeout in the terms from now.
+func checkConfirmDeadline(terms channel.Terms, deadline *big.Int, now time.Time) error {
+
+	if terms.Expired(now) {
+		return fmt.Errorf("channel terms expired before deposit was confirmed")
+	}
+	maxDeadline := big.NewInt(now.Add(time.Duration(terms.ConfirmTimeout) * time.Second).Unix())
+	if deadline == nil || deadline.Sign() <= 0 || deadline.Cmp(maxDeadline) > 0 {
+		return fmt.Errorf("mscontract confirm deadline %v exceeds agreed confirm timeout %ds", deadline, terms.ConfirmTimeout)
+	}
+	return nil
+}
+
+// stateRegister registers the doubly signed msc base state in the mscontract and waits until it is registered by both users.
+// If afterPeer is true, this user registers the state only after the peer has registered it.
+func (opening *channelOpening) stateRegister(ctx context.Context, baseState channel.MSCBaseStateSigned, afterPeer bool) (err error) {
+
+	events := opening.bcInst.EventsChan
+
+	if afterPeer {
+		select {
+		case <-events.MSCStateRegisteringChan:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for peer to register msc base state - %v", ctx.Err())
+		}
+	}
+
+	state := baseState.MSContractBaseState
+	err = opening.bcInst.StateRegister(state.Sid, state.Version, state.BlockedSender, state.BlockedReceiver,
+		baseState.SignSender, baseState.SignReceiver)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-events.MSCStateRegisteredChan:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for msc base state to be registered - %v", ctx.Err())
+	}
+}
+
+// validateMSCBaseState checks if the msc base state proposed by the peer matches the session id of the channel,
+// the vpc address and the amounts confirmed in mscontract. The terms of the channel should not have expired at now.
+func validateMSCBaseState(ch *channel.Instance, state channel.MSCBaseState, vpcAddr types.Address,
+	cashSender, cashReceiver *big.Int, now time.Time) (err error) {
+
+	switch {
+	case ch.Terms().Expired(now):
+		return fmt.Errorf("channel terms expired before msc base state was signed")
+	case state.VpcAddress != vpcAddr:
+		return fmt.Errorf("msc base state vpc address %s, want %s", state.VpcAddress.Hex(), vpcAddr.Hex())
+	case state.Sid == nil || state.Sid.Cmp(ch.SessionID().SidComplete) != 0:
+		return fmt.Errorf("msc base state session id does not match channel")
+	case state.Version == nil || state.Version.Cmp(big.NewInt(1)) != 0:
+		return fmt.Errorf("msc base state version %v, want 1", state.Version)
+	case state.BlockedSender == nil || state.BlockedSender.Cmp(cashSender) != 0:
+		return fmt.Errorf("msc base state blocked sender %v, want confirmed amount %v", state.BlockedSender, cashSender)
+	case state.BlockedReceiver == nil || state.BlockedReceiver.Cmp(cashReceiver) != 0:
+		return fmt.Errorf("msc base state blocked receiver %v, want confirmed amount %v", state.BlockedReceiver, cashReceiver)
+	}
+	return nil
+}
@@ -0,0 +1,432 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/adapter"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// openingTestIDs returns the identities of alice and bob with credentials set and listener addresses
+// different from those used in the tests of other packages, so that tests can be run in parallel.
+func openingTestIDs() (alice, bob identity.OffChainID) {
+
+	alice, bob = aliceID, bobID
+	alice.ListenerIPAddr = "localhost:9621"
+	bob.ListenerIPAddr = "localhost:9622"
+	alice.SetCredentials(testKeyStore, alicePassword)
+	bob.SetCredentials(testKeyStore, bobPassword)
+	return alice, bob
+}
+
+func Test_OpeningError(t *testing.T) {
+
+	var err error = &OpeningError{Step: OpeningStepContracts, Err: fmt.Errorf("declined by peer")}
+	if !strings.Contains(err.Error(), string(OpeningStepContracts)) || !strings.Contains(err.Error(), "declined by peer") {
+		t.Errorf("OpeningError.Error() = %s, want step and cause in message", err.Error())
+	}
+}
+
+// openingTestTerms returns valid terms for opening a channel, with deposit blocked by each user.
+func openingTestTerms(deposit *big.Int) channel.Terms {
+	return channel.Terms{
+		DepositSender:   deposit,
+		DepositReceiver: deposit,
+		ConfirmTimeout:  uint64(MSCConfirmTimeout / time.Second),
+	}
+}
+
+func Test_SetupChannel_Preconditions(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status channel.Status
+		terms  channel.Terms
+	}{
+		{"nil_deposit", channel.Status(""), channel.Terms{DepositReceiver: big.NewInt(10), ConfirmTimeout: 6000}},
+		{"negative_deposit", channel.Status(""), openingTestTerms(big.NewInt(-1))},
+		{"confirm_timeout_too_short", channel.Status(""), channel.Terms{DepositSender: big.NewInt(10), DepositReceiver: big.NewInt(10), ConfirmTimeout: 60}},
+		{"expired", channel.Status(""), channel.Terms{DepositSender: big.NewInt(10), DepositReceiver: big.NewInt(10), ConfirmTimeout: 6000, Expiry: 1}},
+		{"not_new_channel", channel.PreSetup, openingTestTerms(big.NewInt(10))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &channel.Instance{}
+			ch.SetStatus(tt.status)
+
+			err := SetupChannel(context.Background(), ch, &Instance{}, tt.terms)
+			checkPreconditionsError(t, ch, tt.status, err)
+		})
+	}
+}
+
+func Test_AcceptChannel_Preconditions(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		status  channel.Status
+		deposit *big.Int
+	}{
+		{"nil_deposit", channel.Status(""), nil},
+		{"negative_deposit", channel.Status(""), big.NewInt(-1)},
+		{"not_new_channel", channel.PreSetup, big.NewInt(10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &channel.Instance{}
+			ch.SetStatus(tt.status)
+
+			err := AcceptChannel(context.Background(), ch, &Instance{}, tt.deposit, nil)
+			checkPreconditionsError(t, ch, tt.status, err)
+		})
+	}
+}
+
+func checkPreconditionsError(t *testing.T, ch *channel.Instance, wantStatus channel.Status, err error) {
+
+	openingErr, ok := err.(*OpeningError)
+	if !ok {
+		t.Fatalf("error = %v, want *OpeningError", err)
+	}
+	if openingErr.Step != OpeningStepNewChannel || openingErr.DepositLocked {
+		t.Errorf("error = %+v, want step %s without deposit locked", openingErr, OpeningStepNewChannel)
+	}
+	if ch.Status() != wantStatus {
+		t.Errorf("channel status = %s, want unchanged %s", ch.Status(), wantStatus)
+	}
+}
+
+func Test_checkTerms(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name    string
+		modify  func(*channel.Terms)
+		wantErr bool
+	}{
+		{"valid", func(*channel.Terms) {}, false},
+		{"valid_longer_confirm_timeout", func(terms *channel.Terms) { terms.ConfirmTimeout *= 2 }, false},
+		{"valid_before_expiry", func(terms *channel.Terms) { terms.Expiry = 1100 }, false},
+		{"invalid", func(terms *channel.Terms) { terms.DepositSender = nil }, true},
+		{"expired", func(terms *channel.Terms) { terms.Expiry = 900 }, true},
+		{"confirm_timeout_too_short", func(terms *channel.Terms) { terms.ConfirmTimeout-- }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms := openingTestTerms(big.NewInt(10))
+			tt.modify(&terms)
+			if err := checkTerms(terms, now); (err != nil) != tt.wantErr {
+				t.Errorf("checkTerms() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkConfirmDeadline(t *testing.T) {
+
+	now := time.Unix(10000, 0)
+	terms := openingTestTerms(big.NewInt(10))
+	maxDeadline := now.Add(MSCConfirmTimeout).Unix()
+
+	tests := []struct {
+		name     string
+		expiry   int64
+		deadline *big.Int
+		wantErr  bool
+	}{
+		{"within_timeout", 0, big.NewInt(maxDeadline - 60), false},
+		{"at_timeout", 0, big.NewInt(maxDeadline), false},
+		{"after_timeout", 0, big.NewInt(maxDeadline + 1), true},
+		{"deadline_not_set", 0, big.NewInt(0), true},
+		{"deadline_nil", 0, nil, true},
+		{"expired", 9000, big.NewInt(maxDeadline), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms.Expiry = tt.expiry
+			if err := checkConfirmDeadline(terms, tt.deadline, now); (err != nil) != tt.wantErr {
+				t.Errorf("checkConfirmDeadline() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type dummyOpeningPolicy struct {
+	newChannelErr, mscBaseStateErr error
+}
+
+func (p dummyOpeningPolicy) NewChannel(peerID identity.OffChainID, msgProtocolVersion string, contractStoreVersion []byte,
+	terms channel.Terms) error {
+	return p.newChannelErr
+}
+
+func (p dummyOpeningPolicy) MSCBaseState(peerID identity.OffChainID, state channel.MSCBaseState) error {
+	return p.mscBaseStateErr
+}
+
+// startAcceptingPeer starts a listener for peerID and calls accept on the first incoming channel.
+// The channel and the error returned by accept are sent on the returned go channels.
+func startAcceptingPeer(t *testing.T, peerID identity.OffChainID, accept func(*channel.Instance) error) (
+	peerCh chan *channel.Instance, acceptErr chan error, listener channel.Shutdown) {
+
+	idVerifiedConn, listener, err := channel.NewSession(peerID, channel.WebSocket, 10)
+	if err != nil {
+		t.Fatalf("channel.NewSession() error = %v", err)
+	}
+
+	peerCh = make(chan *channel.Instance, 1)
+	acceptErr = make(chan error, 1)
+	go func() {
+		ch := <-idVerifiedConn
+		peerCh <- ch
+		acceptErr <- accept(ch)
+	}()
+	return peerCh, acceptErr, listener
+}
+
+func Test_OpenChannel_Rollback(t *testing.T) {
+
+	alice, bob := openingTestIDs()
+
+	tests := []struct {
+		name         string
+		policy       OpeningPolicy
+		peerDeposit  *big.Int //Deposit of the peer, if different from that proposed in the terms
+		wantStep     OpeningStep
+		wantAbort    channel.AbortCode //Code with which the peer aborts the request, if any
+		wantPeerStep OpeningStep
+		wantSid      bool
+	}{
+		{
+			//Opening fails after the session id is agreed, as libSignatures address is not set.
+			//Peer is waiting for contract addresses when the channel is closed.
+			name:         "libsignatures_not_set",
+			wantStep:     OpeningStepContracts,
+			wantPeerStep: OpeningStepContracts,
+			wantSid:      true,
+		},
+		{
+			name:         "declined_by_policy",
+			policy:       dummyOpeningPolicy{newChannelErr: fmt.Errorf("peer not known")},
+			wantStep:     OpeningStepNewChannel,
+			wantAbort:    channel.AbortPolicyRejection,
+			wantPeerStep: OpeningStepNewChannel,
+		},
+		{
+			name:         "deposit_not_matching_terms",
+			peerDeposit:  big.NewInt(20),
+			wantStep:     OpeningStepNewChannel,
+			wantPeerStep: OpeningStepNewChannel,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			peerChan, acceptErr, listener := startAcceptingPeer(t, bob, func(ch *channel.Instance) error {
+				deposit := big.NewInt(10)
+				if tt.peerDeposit != nil {
+					deposit = tt.peerDeposit
+				}
+				return AcceptChannel(ctx, ch, &Instance{OwnerID: bob}, deposit, tt.policy)
+			})
+			defer func() {
+				_ = listener.Shutdown(context.Background())
+			}()
+
+			ch, err := OpenChannel(ctx, &Instance{OwnerID: alice}, bob, channel.WebSocket, openingTestTerms(big.NewInt(10)))
+			if ch != nil {
+				t.Errorf("OpenChannel() channel = %v, want nil", ch)
+			}
+			openingErr, ok := err.(*OpeningError)
+			if !ok {
+				t.Fatalf("OpenChannel() error = %v, want *OpeningError", err)
+			}
+			if openingErr.Step != tt.wantStep || openingErr.DepositLocked {
+				t.Errorf("OpenChannel() error = %+v, want step %s without deposit locked", openingErr, tt.wantStep)
+			}
+			if tt.wantAbort != "" {
+				abortErr, ok := openingErr.Err.(*channel.AbortError)
+				if !ok || abortErr.Code != tt.wantAbort {
+					t.Errorf("OpenChannel() error = %v, want abort with code %s", openingErr.Err, tt.wantAbort)
+				}
+			}
+
+			err = <-acceptErr
+			openingErr, ok = err.(*OpeningError)
+			if !ok {
+				t.Fatalf("AcceptChannel() error = %v, want *OpeningError", err)
+			}
+			if openingErr.Step != tt.wantPeerStep {
+				t.Errorf("AcceptChannel() error step = %s, want %s", openingErr.Step, tt.wantPeerStep)
+			}
+			peerCh := <-peerChan
+			if peerCh.Status() != channel.Closed || peerCh.Connected() {
+				t.Errorf("AcceptChannel() channel status = %s, connected %v, want %s and not connected",
+					peerCh.Status(), peerCh.Connected(), channel.Closed)
+			}
+			if gotSid := peerCh.SessionID().SidComplete != nil; gotSid != tt.wantSid {
+				t.Errorf("AcceptChannel() session id set = %v, want %v", gotSid, tt.wantSid)
+			}
+		})
+	}
+}
+
+func Test_validateMSCBaseState(t *testing.T) {
+
+	sid := newTestSessionID(t)
+	ch := &channel.Instance{}
+	if err := ch.SetSessionID(sid); err != nil {
+		t.Fatalf("Error setting session id - %v", err)
+	}
+	vpcAddr := types.HexToAddress("0x847a3AC37aB4bB1f0C3be0B2B2Ed4B6cE3e1F2b4")
+
+	validState := func() channel.MSCBaseState {
+		return channel.MSCBaseState{
+			VpcAddress:      vpcAddr,
+			Sid:             sid.SidComplete,
+			BlockedSender:   big.NewInt(10),
+			BlockedReceiver: big.NewInt(20),
+			Version:         big.NewInt(1),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*channel.MSCBaseState)
+		wantErr bool
+	}{
+		{"valid", func(*channel.MSCBaseState) {}, false},
+		{"vpc_address_mismatch", func(s *channel.MSCBaseState) { s.VpcAddress = types.HexToAddress("") }, true},
+		{"sid_mismatch", func(s *channel.MSCBaseState) { s.Sid = big.NewInt(1) }, true},
+		{"sid_nil", func(s *channel.MSCBaseState) { s.Sid = nil }, true},
+		{"version_not_one", func(s *channel.MSCBaseState) { s.Version = big.NewInt(2) }, true},
+		{"blocked_sender_mismatch", func(s *channel.MSCBaseState) { s.BlockedSender = big.NewInt(11) }, true},
+		{"blocked_receiver_mismatch", func(s *channel.MSCBaseState) { s.BlockedReceiver = big.NewInt(19) }, true},
+		{"blocked_receiver_nil", func(s *channel.MSCBaseState) { s.BlockedReceiver = nil }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := validState()
+			tt.modify(&state)
+			err := validateMSCBaseState(ch, state, vpcAddr, big.NewInt(10), big.NewInt(20), time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateMSCBaseState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("terms_expired", func(t *testing.T) {
+		terms := channel.Terms{DepositSender: big.NewInt(10), DepositReceiver: big.NewInt(20), ConfirmTimeout: 6000, Expiry: 1000}
+		if err := ch.SetTerms(terms); err != nil {
+			t.Fatalf("Error setting terms - %v", err)
+		}
+		if err := validateMSCBaseState(ch, validState(), vpcAddr, big.NewInt(10), big.NewInt(20), time.Unix(1001, 0)); err == nil {
+			t.Errorf("validateMSCBaseState() error = nil, want non nil")
+		}
+	})
+}
+
+// openSimulatedChannel opens a channel between alice and bob on a simulated backend, with deposit blocked by each of them.
+// It returns the blockchain instances and channels of alice and bob. Cleanup should be called at the end of the test.
+func openSimulatedChannel(t *testing.T, deposit *big.Int) (aliceInst, bobInst *Instance,
+	ch, peerCh *channel.Instance, cleanup func()) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	alice, bob := openingTestIDs()
+	conn := adapter.NewSimulatedBackend(balanceList)
+
+	libSignAddr, err := setupContract(contract.Store.LibSignatures(), conn, alice)
+	if err != nil {
+		t.Fatalf("setupContract() error = %v", err)
+	}
+	conn.Commit()
+
+	bobInstance := NewInstance(conn, bob)
+	bobInst = &bobInstance
+	acceptCh, acceptErr, listener := startAcceptingPeer(t, bob, func(ch *channel.Instance) error {
+		return AcceptChannel(ctx, ch, bobInst, deposit, nil)
+	})
+	cleanup = func() {
+		_ = listener.Shutdown(context.Background())
+	}
+
+	aliceInstance := NewInstance(conn, alice)
+	aliceInst = &aliceInstance
+	if err = aliceInst.SetLibSignatures(libSignAddr); err != nil {
+		cleanup()
+		t.Fatalf("Instance.SetLibSignatures() error = %v", err)
+	}
+	ch, err = OpenChannel(ctx, aliceInst, bob, channel.WebSocket, openingTestTerms(deposit))
+	if err != nil {
+		cleanup()
+		t.Fatalf("OpenChannel() error = %v", err)
+	}
+	if err = <-acceptErr; err != nil {
+		aliceInst.EventsChan.Unsubscribe()
+		cleanup()
+		t.Fatalf("AcceptChannel() error = %v", err)
+	}
+	peerCh = <-acceptCh
+
+	cleanup = func() {
+		aliceInst.EventsChan.Unsubscribe()
+		bobInst.EventsChan.Unsubscribe()
+		_ = listener.Shutdown(context.Background())
+	}
+	return aliceInst, bobInst, ch, peerCh, cleanup
+}
+
+func Test_OpenChannel_Simulated(t *testing.T) {
+
+	deposit := types.EtherToWei(big.NewInt(10))
+	aliceInst, _, ch, peerCh, cleanup := openSimulatedChannel(t, deposit)
+	defer cleanup()
+
+	for _, inst := range []*channel.Instance{ch, peerCh} {
+		if inst.Status() != channel.Open {
+			t.Errorf("channel status = %s, want %s", inst.Status(), channel.Open)
+		}
+		state := inst.MscBaseState().MSContractBaseState
+		if state.BlockedSender.Cmp(deposit) != 0 || state.BlockedReceiver.Cmp(deposit) != 0 {
+			t.Errorf("msc base state = %v, want deposits of both users blocked", state)
+		}
+	}
+	if status, err := aliceInst.Status(); err != nil || status != MSCStatusOpen {
+		t.Errorf("Instance.Status() = %v, %v, want %v", status, err, MSCStatusOpen)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/adapter"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// RestoreInstance re-creates the blockchain instance for the channel ch restored from a store,
+// so that its contracts can be watched and transacted on again after a restart of the node.
+//
+// The vpc and mscontract at the addresses persisted in the channel are validated and instantiated, the parties
+// of the mscontract are checked against the users of the channel and the events channel is initialised.
+// Channel should have got past the contract deployment step of the opening, i.e in Init or a later status.
+func RestoreInstance(conn adapter.ContractBackend, ownerID identity.OffChainID, ch *channel.Instance) (
+	bcInst *Instance, err error) {
+
+	if ch.VPCAddr() == (types.Address{}) || ch.MSContractAddr() == (types.Address{}) {
+		return nil, fmt.Errorf("contract addresses not set in channel with %s", ch.PeerID().OnChainID.Hex())
+	}
+
+	inst := NewInstance(conn, ownerID)
+	if err = attachVPC(&inst, ch.VPCAddr()); err != nil {
+		return nil, err
+	}
+	if err = attachMSContract(&inst, ch, ch.MSContractAddr()); err != nil {
+		return nil, err
+	}
+
+	inst.EventsChan, err = inst.InitializeEventsChan()
+	if err != nil {
+		return nil, fmt.Errorf("initializing events channel error - %v", err)
+	}
+	return &inst, nil
+}
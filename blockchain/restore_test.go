@@ -0,0 +1,55 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+func Test_RestoreInstance(t *testing.T) {
+
+	vpcAddr := types.HexToAddress("de0B295669a9FD93d5F28D9Ec85E40f4cb697BAe")
+	msContractAddr := types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D")
+
+	t.Run("contracts_not_set", func(t *testing.T) {
+		conn := &MockContractBackend{}
+		ch := &channel.Instance{}
+		_ = ch.SetVPCAddr(vpcAddr)
+
+		if _, err := RestoreInstance(conn, aliceID, ch); err == nil {
+			t.Errorf("RestoreInstance() error = nil, want non nil")
+		}
+		conn.AssertNotCalled(t, "CodeAt", context.Background(), vpcAddr.Address, (*big.Int)(nil))
+	})
+	t.Run("vpc_code_mismatch", func(t *testing.T) {
+		conn := &MockContractBackend{}
+		ch := &channel.Instance{}
+		_ = ch.SetVPCAddr(vpcAddr)
+		_ = ch.SetMSContractAddr(msContractAddr)
+
+		conn.On("CodeAt", context.Background(), vpcAddr.Address, (*big.Int)(nil)).Return(dummyRuntimeBin, nil)
+		if _, err := RestoreInstance(conn, aliceID, ch); err == nil {
+			t.Errorf("RestoreInstance() error = nil, want non nil")
+		}
+		conn.AssertNotCalled(t, "CodeAt", context.Background(), msContractAddr.Address, (*big.Int)(nil))
+	})
+}
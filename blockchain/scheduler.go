@@ -0,0 +1,310 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+// Clock returns the current time as seen by the blockchain.
+// It is used by the scheduler to decide if the deadlines set in the contracts have passed.
+type Clock func() time.Time
+
+// SystemClock returns the current system time. It can be used as clock for real blockchain backends.
+func SystemClock() time.Time {
+	return time.Now()
+}
+
+type timeoutAction int
+
+// Enumeration of actions that can be taken by the scheduler after a deadline in the contracts has passed.
+const (
+	timeoutActionNone             timeoutAction = iota //Deadline not yet passed or nothing to do
+	timeoutActionRefund                                //Mscontract not confirmed by the other user in time
+	timeoutActionFinalizeRegister                      //State not registered by the other user in time
+	timeoutActionFinalizeClose                         //Close not called by the other user in time
+	timeoutActionVPCFinalize                           //Validity of the vpc state registered in vpc contract expired
+	timeoutActionExecute                               //Vpc closed, funds can be distributed according to the final vpc state
+)
+
+func (action timeoutAction) String() string {
+	switch action {
+	case timeoutActionRefund:
+		return "refund"
+	case timeoutActionFinalizeRegister:
+		return "finalizeRegister"
+	case timeoutActionFinalizeClose:
+		return "finalizeClose"
+	case timeoutActionVPCFinalize:
+		return "vpc finalize"
+	case timeoutActionExecute:
+		return "execute"
+	default:
+		return "none"
+	}
+}
+
+// scheduledChannel is a channel tracked by the scheduler along with the blockchain instance used for it.
+type scheduledChannel struct {
+	bcInst *Instance
+	ch     *channel.Instance
+}
+
+// Scheduler periodically checks the status and timeout of the mscontract (and vpc state, if registered)
+// of each tracked channel and makes the transaction required to proceed, once the deadline set in the contract has passed.
+//
+// In Init status, refund is called if the other user did not confirm in time.
+// In InConflict status, finalizeRegister is called if the other user did not register the state in time.
+// In WaitingToClose status, finalizeClose is called if the other user did not call close in time.
+// In Settled status, finalize is called on vpc contract once the extended validity of the vpc state has expired
+// and execute is called on mscontract once the vpc is closed.
+//
+// Channels are tracked until the mscontract is terminated. Channels being settled (see Settle) are skipped.
+type Scheduler struct {
+	clock    Clock
+	interval time.Duration
+
+	channels map[types.Address]scheduledChannel //Tracked channels, mapped by address of the mscontract
+	access   sync.Mutex                         //Access control for channels map
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewScheduler initialises a scheduler and starts it in the background.
+// Clock is used to obtain the current time and tracked channels are checked every interval.
+// If interval is not positive, a tenth of vpc validity timeout in the contract store is used.
+func NewScheduler(clock Clock, interval time.Duration) *Scheduler {
+
+	if interval <= 0 {
+		interval = contract.Store.TimeoutVPCValidity() / 10
+	}
+
+	scheduler := &Scheduler{
+		clock:    clock,
+		interval: interval,
+		channels: make(map[types.Address]scheduledChannel),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go scheduler.run()
+	return scheduler
+}
+
+// Track adds the channel ch to the scheduler. Transactions are made using bcInst,
+// which should have the mscontract of the channel set up.
+func (scheduler *Scheduler) Track(bcInst *Instance, ch *channel.Instance) {
+
+	scheduler.access.Lock()
+	defer scheduler.access.Unlock()
+
+	scheduler.channels[bcInst.MSContractAddr()] = scheduledChannel{bcInst: bcInst, ch: ch}
+}
+
+// Untrack removes the channel using bcInst from the scheduler.
+func (scheduler *Scheduler) Untrack(bcInst *Instance) {
+
+	scheduler.access.Lock()
+	defer scheduler.access.Unlock()
+
+	delete(scheduler.channels, bcInst.MSContractAddr())
+}
+
+// Tracked returns the number of channels tracked by the scheduler.
+func (scheduler *Scheduler) Tracked() int {
+
+	scheduler.access.Lock()
+	defer scheduler.access.Unlock()
+
+	return len(scheduler.channels)
+}
+
+// Stop stops the scheduler and waits until the background routine returns.
+func (scheduler *Scheduler) Stop() {
+	close(scheduler.quit)
+	<-scheduler.done
+}
+
+func (scheduler *Scheduler) run() {
+
+	defer close(scheduler.done)
+
+	ticker := time.NewTicker(scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			scheduler.checkAll()
+		case <-scheduler.quit:
+			return
+		}
+	}
+}
+
+// checkAll checks all the tracked channels once. Channels for which the mscontract is terminated are untracked.
+// Channels with the blockchain instance in use by a settlement are checked in the next round.
+func (scheduler *Scheduler) checkAll() {
+
+	scheduler.access.Lock()
+	channels := make([]scheduledChannel, 0, len(scheduler.channels))
+	for _, scheduled := range scheduler.channels {
+		channels = append(channels, scheduled)
+	}
+	scheduler.access.Unlock()
+
+	for _, scheduled := range channels {
+		terminated, err := scheduler.check(scheduled)
+		if err != nil {
+			logger.Error("Error checking timeouts for mscontract at", scheduled.bcInst.MSContractAddr().Hex(), "-", err)
+			continue
+		}
+		if terminated {
+			scheduler.Untrack(scheduled.bcInst)
+		}
+	}
+}
+
+// check reads the state of contracts of the channel and makes the transaction required after the deadline.
+// It returns true if the mscontract is terminated, either already or by the transaction made.
+// A transaction that is expected to terminate the mscontract may not do so (e.g. if execute could not pay out the funds),
+// hence termination is checked on the blockchain.
+func (scheduler *Scheduler) check(scheduled scheduledChannel) (terminated bool, err error) {
+
+	bcInst := scheduled.bcInst
+
+	if !bcInst.tryAcquire() {
+		logger.Debug("Mscontract at", bcInst.MSContractAddr().Hex(), "is being settled, skipping the check")
+		return false, nil
+	}
+	defer bcInst.release()
+
+	if terminated, err = bcInst.msContractTerminated(); err != nil || terminated {
+		return terminated, err
+	}
+
+	status, err := bcInst.Status()
+	if err != nil {
+		return false, err
+	}
+	timeout, err := bcInst.Timeout()
+	if err != nil {
+		return false, err
+	}
+
+	var vpcState *VPCState
+	if status == MSCStatusSettled {
+		var vpcStateID [32]byte
+		vpcStateID, err = scheduled.vpcStateID()
+		if err != nil {
+			return false, err
+		}
+		var state VPCState
+		state, err = bcInst.VPCStates(vpcStateID)
+		if err != nil {
+			return false, err
+		}
+		vpcState = &state
+	}
+
+	action := decideTimeoutAction(status, timeout, vpcState, scheduler.clock())
+	if action == timeoutActionNone {
+		return false, nil
+	}
+	logger.Info("Deadline passed for mscontract at", bcInst.MSContractAddr().Hex(), "in status", status, "- calling", action)
+
+	switch action {
+	case timeoutActionRefund:
+		err = bcInst.Refund()
+	case timeoutActionFinalizeRegister:
+		return false, bcInst.FinalizeRegister()
+	case timeoutActionFinalizeClose:
+		err = bcInst.FinalizeClose()
+	case timeoutActionVPCFinalize:
+		return false, bcInst.VPCFinalize(scheduled.ch.SessionID().SidComplete,
+			scheduled.ch.SenderID().OnChainID, scheduled.ch.ReceiverID().OnChainID)
+	case timeoutActionExecute:
+		err = bcInst.Execute(scheduled.ch.SenderID().OnChainID, scheduled.ch.ReceiverID().OnChainID)
+	}
+	if err != nil {
+		return false, err
+	}
+	return bcInst.msContractTerminated()
+}
+
+// vpcStateID returns the id of the vpc state of the channel in the vpc contract.
+func (scheduled scheduledChannel) vpcStateID() (id [32]byte, err error) {
+	return channelVPCStateID(scheduled.ch)
+}
+
+// channelVPCStateID returns the id of the vpc state of the channel ch in the vpc contract.
+func channelVPCStateID(ch *channel.Instance) (id [32]byte, err error) {
+
+	if ch == nil || ch.SessionID().SidComplete == nil {
+		return id, fmt.Errorf("session id not set for the channel")
+	}
+	vpcStateID := channel.VPCStateID{
+		AddSender:    ch.SenderID().OnChainID,
+		AddrReceiver: ch.ReceiverID().OnChainID,
+		SID:          ch.SessionID().SidComplete,
+	}
+	copy(id[:], vpcStateID.SoliditySHA3())
+	return id, nil
+}
+
+// decideTimeoutAction returns the action to be taken based on the status and timeout of the mscontract,
+// the state registered in vpc contract (only required in Settled status) and the current time.
+func decideTimeoutAction(status MSCStatus, timeout *big.Int, vpcState *VPCState, now time.Time) timeoutAction {
+
+	switch status {
+	case MSCStatusInit:
+		if deadlinePassed(timeout, now) {
+			return timeoutActionRefund
+		}
+	case MSCStatusInConflict:
+		if deadlinePassed(timeout, now) {
+			return timeoutActionFinalizeRegister
+		}
+	case MSCStatusWaitingToClose:
+		if deadlinePassed(timeout, now) {
+			return timeoutActionFinalizeClose
+		}
+	case MSCStatusSettled:
+		if vpcState == nil || !vpcState.Init {
+			return timeoutActionNone
+		}
+		if !vpcState.Open {
+			return timeoutActionExecute
+		}
+		if deadlinePassed(vpcState.ExtendedValidity, now) {
+			return timeoutActionVPCFinalize
+		}
+	}
+	return timeoutActionNone
+}
+
+// deadlinePassed returns true if deadline (unix time in seconds, as set in the contracts) is set and has passed at now.
+func deadlinePassed(deadline *big.Int, now time.Time) bool {
+	return deadline != nil && deadline.Sign() > 0 && big.NewInt(now.Unix()).Cmp(deadline) > 0
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/adapter"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_decideTimeoutAction(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	past, future := big.NewInt(900), big.NewInt(1100)
+	vpcState := func(open bool, extendedValidity *big.Int) *VPCState {
+		return &VPCState{Init: true, Open: open, ExtendedValidity: extendedValidity}
+	}
+
+	tests := []struct {
+		name     string
+		status   MSCStatus
+		timeout  *big.Int
+		vpcState *VPCState
+		want     timeoutAction
+	}{
+		{"init_before_timeout", MSCStatusInit, future, nil, timeoutActionNone},
+		{"init_after_timeout", MSCStatusInit, past, nil, timeoutActionRefund},
+		{"open", MSCStatusOpen, big.NewInt(0), nil, timeoutActionNone},
+		{"in_conflict_before_timeout", MSCStatusInConflict, future, nil, timeoutActionNone},
+		{"in_conflict_after_timeout", MSCStatusInConflict, past, nil, timeoutActionFinalizeRegister},
+		{"waiting_to_close_before_timeout", MSCStatusWaitingToClose, future, nil, timeoutActionNone},
+		{"waiting_to_close_after_timeout", MSCStatusWaitingToClose, past, nil, timeoutActionFinalizeClose},
+		{"waiting_to_close_timeout_not_set", MSCStatusWaitingToClose, nil, nil, timeoutActionNone},
+		{"settled_vpc_not_registered", MSCStatusSettled, big.NewInt(0), &VPCState{}, timeoutActionNone},
+		{"settled_vpc_state_not_read", MSCStatusSettled, big.NewInt(0), nil, timeoutActionNone},
+		{"settled_vpc_open_before_validity", MSCStatusSettled, big.NewInt(0), vpcState(true, future), timeoutActionNone},
+		{"settled_vpc_open_after_validity", MSCStatusSettled, big.NewInt(0), vpcState(true, past), timeoutActionVPCFinalize},
+		{"settled_vpc_closed", MSCStatusSettled, big.NewInt(0), vpcState(false, future), timeoutActionExecute},
+		{"ready_to_close", MSCStatusReadyToClose, past, nil, timeoutActionNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideTimeoutAction(tt.status, tt.timeout, tt.vpcState, now)
+			if got != tt.want {
+				t.Errorf("decideTimeoutAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Scheduler_Track(t *testing.T) {
+
+	scheduler := NewScheduler(SystemClock, time.Hour)
+	defer scheduler.Stop()
+
+	bcInst1 := &Instance{msContractAddr: types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D")}
+	bcInst2 := &Instance{msContractAddr: types.HexToAddress("0x847a3AC00D3D4E4e4e2e2D0B0B6B2b3b5e6A3a5c")}
+
+	scheduler.Track(bcInst1, &channel.Instance{})
+	scheduler.Track(bcInst2, &channel.Instance{})
+	scheduler.Track(bcInst1, &channel.Instance{})
+	if got := scheduler.Tracked(); got != 2 {
+		t.Errorf("Scheduler.Tracked() = %d, want 2", got)
+	}
+
+	scheduler.Untrack(bcInst1)
+	if got := scheduler.Tracked(); got != 1 {
+		t.Errorf("Scheduler.Tracked() after Untrack() = %d, want 1", got)
+	}
+}
+
+func Test_Scheduler_Stop(t *testing.T) {
+
+	scheduler := NewScheduler(SystemClock, time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Scheduler.Stop() did not return")
+	}
+}
+
+func Test_Scheduler_checkAll_mock(t *testing.T) {
+
+	contractAddr := types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D")
+
+	tests := []struct {
+		name             string
+		code             []byte
+		settling         bool
+		wantTracked      int
+		wantCodeAtCalls  int
+		wantContractCall int
+	}{
+		//Channel should be tracked further after an error, so that it is checked again in the next round
+		{name: "call_error", code: []byte{0x60}, wantTracked: 1, wantCodeAtCalls: 1, wantContractCall: 1},
+		{name: "terminated", code: []byte{}, wantTracked: 0, wantCodeAtCalls: 1, wantContractCall: 0},
+		{name: "settling", code: []byte{0x60}, settling: true, wantTracked: 1, wantCodeAtCalls: 0, wantContractCall: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			//Setup mock
+			conn := &MockContractBackend{}
+			conn.On("CodeAt", mock.Anything, mock.Anything, mock.Anything).Return(tt.code, nil)
+			conn.On("CallContract", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("call error"))
+
+			msContractInst, _ := contract.NewMSContract(contractAddr.Address, conn)
+			bcInst := &Instance{
+				Conn:           conn,
+				OwnerID:        aliceID,
+				msContractAddr: contractAddr,
+				MSContractInst: msContractInst,
+			}
+			if tt.settling {
+				bcInst.tryAcquire()
+			}
+
+			scheduler := NewScheduler(SystemClock, time.Hour)
+			defer scheduler.Stop()
+			scheduler.Track(bcInst, &channel.Instance{})
+
+			scheduler.checkAll()
+
+			if got := scheduler.Tracked(); got != tt.wantTracked {
+				t.Errorf("Scheduler.Tracked() = %d, want %d", got, tt.wantTracked)
+			}
+			conn.AssertNumberOfCalls(t, "CodeAt", tt.wantCodeAtCalls)
+			conn.AssertNumberOfCalls(t, "CallContract", tt.wantContractCall)
+			if !tt.settling && !bcInst.tryAcquire() {
+				t.Errorf("Scheduler.checkAll() - instance not released after check")
+			}
+		})
+	}
+}
+
+func Test_scheduledChannel_vpcStateID(t *testing.T) {
+
+	t.Run("session_id_not_set", func(t *testing.T) {
+		_, err := scheduledChannel{ch: &channel.Instance{}}.vpcStateID()
+		if err == nil {
+			t.Errorf("scheduledChannel.vpcStateID() error = nil, want non nil")
+		}
+	})
+	t.Run("valid", func(t *testing.T) {
+		ch := &channel.Instance{}
+		ch.SetRoleChannel(channel.Sender)
+		if err := ch.SetSessionID(newTestSessionID(t)); err != nil {
+			t.Fatalf("Error setting session id - %v", err)
+		}
+
+		got, err := scheduledChannel{ch: ch}.vpcStateID()
+		if err != nil {
+			t.Fatalf("scheduledChannel.vpcStateID() error = %v, want nil", err)
+		}
+		if got == [32]byte{} {
+			t.Errorf("scheduledChannel.vpcStateID() = empty id, want non empty")
+		}
+	})
+}
+
+func Test_Scheduler_Refund_Simulated(t *testing.T) {
+
+	ownerID := identity.OffChainID{
+		OnChainID: aliceID.OnChainID,
+		KeyStore:  testKeyStore,
+		Password:  alicePassword,
+	}
+	conn := adapter.NewSimulatedBackend(balanceList)
+
+	libSignAddr, err := setupContract(contract.Store.LibSignatures(), conn, ownerID)
+	if err != nil {
+		t.Fatalf("setupContract() error = %v", err)
+	}
+	conn.Commit()
+
+	inst := NewInstance(conn, ownerID)
+	if err = inst.SetLibSignatures(libSignAddr); err != nil {
+		t.Fatalf("Instance.SetLibSignatures() error = %v", err)
+	}
+	if err = inst.DeployMSContract(aliceID.OnChainID, bobID.OnChainID); err != nil {
+		t.Fatalf("Instance.DeployMSContract() error = %v", err)
+	}
+	defer inst.EventsChan.Unsubscribe()
+	if err = inst.Confirm(types.EtherToWei(big.NewInt(10))); err != nil {
+		t.Fatalf("Instance.Confirm() error = %v", err)
+	}
+
+	//Clock follows the time adjustments made on the simulated backend.
+	//Interval is long so that checks are made only when called in the test.
+	var offset time.Duration
+	clock := func() time.Time { return time.Now().Add(offset) }
+	scheduler := NewScheduler(clock, time.Hour)
+	defer scheduler.Stop()
+	scheduler.Track(&inst, &channel.Instance{})
+
+	scheduler.checkAll()
+	if got := scheduler.Tracked(); got != 1 {
+		t.Fatalf("Scheduler.Tracked() before timeout = %d, want 1", got)
+	}
+	if status, err := inst.Status(); err != nil || status != MSCStatusInit {
+		t.Fatalf("Instance.Status() before timeout = %v, %v, want %v", status, err, MSCStatusInit)
+	}
+
+	offset = contract.Store.TimeoutMSContract() + time.Minute
+	if err = conn.AdjustTime(offset); err != nil {
+		t.Fatalf("SimulatedBackend.AdjustTime() error = %v", err)
+	}
+	conn.Commit()
+
+	scheduler.checkAll()
+	if got := scheduler.Tracked(); got != 0 {
+		t.Errorf("Scheduler.Tracked() after refund = %d, want 0", got)
+	}
+	//Mscontract is terminated after refund
+	if _, err = inst.Status(); err == nil {
+		t.Errorf("Instance.Status() after refund error = nil, want non nil")
+	}
+}
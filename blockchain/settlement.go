@@ -0,0 +1,260 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+)
+
+// SettlementStep is a step in the procedure for settling a channel, after a state has been registered in the mscontract.
+type SettlementStep string
+
+// Enumeration of steps in the procedure for settling a channel, in the order in which they are performed.
+const (
+	SettlementStepVPCClose SettlementStep = SettlementStep("vpc-close") //Closing the vpc with the final state
+	SettlementStepVPCWait  SettlementStep = SettlementStep("vpc-wait")  //Waiting for the peer to close the vpc or for the timeout
+	SettlementStepExecute  SettlementStep = SettlementStep("execute")   //Executing the mscontract to distribute the funds
+	SettlementStepPayout   SettlementStep = SettlementStep("payout")    //Waiting for the mscontract to pay out the funds
+)
+
+// SettlementError is returned when the procedure for settling a channel fails.
+// Step is the step at which the procedure failed.
+type SettlementError struct {
+	Step SettlementStep
+	Err  error
+}
+
+func (e *SettlementError) Error() string {
+	return fmt.Sprintf("channel settlement failed at step %s - %v", e.Step, e.Err)
+}
+
+// Payout is the outcome of settling a channel on the blockchain.
+//
+// Sender and Receiver are the amounts (in Wei) paid out to the respective users of the channel.
+// If TimedOut is true, the peer did not close the vpc in time and it was closed with the state registered by this user.
+// If Closed is false, the mscontract could not send the funds to one of the users and is not terminated,
+// execute can be called on it again to retry the payout.
+type Payout struct {
+	Sender   *big.Int
+	Receiver *big.Int
+	TimedOut bool
+	Closed   bool
+}
+
+// settlementPollInterval is the interval at which the state of contracts is read, when waiting for the peer during settlement.
+var settlementPollInterval = 5 * time.Second
+
+type settlementAction int
+
+// Enumeration of actions that can be taken during settlement, based on the state of vpc contract.
+const (
+	settlementActionWait        settlementAction = iota //Wait for the peer to close the vpc or for the timeout
+	settlementActionVPCClose                            //Close the vpc with the final state
+	settlementActionVPCFinalize                         //Peer did not close the vpc in time, finalize it
+	settlementActionVPCClosed                           //Vpc is closed, proceed to execute
+)
+
+func (action settlementAction) String() string {
+	switch action {
+	case settlementActionVPCClose:
+		return "vpc close"
+	case settlementActionVPCFinalize:
+		return "vpc finalize"
+	case settlementActionVPCClosed:
+		return "vpc closed"
+	default:
+		return "wait"
+	}
+}
+
+// Settle settles the channel ch on the blockchain using bcInst, once a state has been registered in the mscontract
+// (it is in Settled status). finalState is the latest vpc state of the channel.
+//
+// Close is called on the vpc with finalState and the node waits for the peer to also call it. If the peer does not respond
+// before the extended validity of the vpc state, it is finalized with the registered state. Once the vpc is closed,
+// the sender calls execute on the mscontract immediately and the receiver calls it, if the funds are not paid out
+// within a poll interval. Steps already completed on the blockchain (e.g. when the peer initiated the settlement) are skipped.
+// The channel moves through VPCClosing and VPCClosed to Closed, if the funds were paid out.
+//
+// clock is used to decide if the validity of vpc state has passed. ctx bounds the time spent waiting for the peer and
+// for contract events. If any step fails, a *SettlementError is returned.
+//
+// The scheduler does not make transactions on the contracts of the channel while it is being settled,
+// and settlement starts only after any transaction being made by the scheduler is complete.
+func Settle(ctx context.Context, ch *channel.Instance, bcInst *Instance, finalState channel.VPCStateSigned,
+	clock Clock) (payout Payout, err error) {
+
+	vpcStateID, err := channelVPCStateID(ch)
+	if err != nil {
+		return payout, &SettlementError{Step: SettlementStepVPCClose, Err: err}
+	}
+
+	if err = bcInst.acquire(ctx); err != nil {
+		return payout, &SettlementError{Step: SettlementStepVPCClose, Err: err}
+	}
+	defer bcInst.release()
+
+	ch.SetStatus(channel.VPCClosing)
+	payout, err = settleVPC(ctx, ch, bcInst, finalState, vpcStateID, clock)
+	if err != nil {
+		return payout, err
+	}
+	ch.SetStatus(channel.VPCClosed)
+
+	payout.Closed, err = executeMSContract(ctx, ch, bcInst, payout.TimedOut)
+	if err != nil {
+		return payout, err
+	}
+	if payout.Closed {
+		ch.SetStatus(channel.Closed)
+	}
+	return payout, nil
+}
+
+// settleVPC makes the transactions on the vpc contract as decided by decideSettlementAction,
+// until the vpc state with vpcStateID is closed. It returns the amounts with which the vpc was closed.
+func settleVPC(ctx context.Context, ch *channel.Instance, bcInst *Instance, finalState channel.VPCStateSigned,
+	vpcStateID [32]byte, clock Clock) (payout Payout, err error) {
+
+	canClose := finalState.VPCState.Version != nil
+	sid := ch.SessionID().SidComplete
+	senderAddr, receiverAddr := ch.SenderID().OnChainID, ch.ReceiverID().OnChainID
+
+	ticker := time.NewTicker(settlementPollInterval)
+	defer ticker.Stop()
+
+	for {
+		state, err := bcInst.VPCStates(vpcStateID)
+		if err != nil {
+			return payout, &SettlementError{Step: SettlementStepVPCWait, Err: err}
+		}
+
+		action := decideSettlementAction(state, ch.RoleChannel(), canClose, clock())
+		switch action {
+		case settlementActionVPCClosed:
+			payout.Sender, payout.Receiver = state.AliceCash, state.BobCash
+			return payout, nil
+		case settlementActionVPCClose:
+			err = bcInst.VPCClose(sid, finalState.VPCState.Version, senderAddr, receiverAddr,
+				finalState.VPCState.BlockedSender, finalState.VPCState.BlockedReceiver,
+				finalState.SignSender, finalState.SignReceiver)
+			if err != nil {
+				return payout, &SettlementError{Step: SettlementStepVPCClose, Err: err}
+			}
+		case settlementActionVPCFinalize:
+			logger.Info("Peer did not close the vpc in time, finalizing it with the registered state")
+			payout.TimedOut = true
+			if err = bcInst.VPCFinalize(sid, senderAddr, receiverAddr); err != nil {
+				return payout, &SettlementError{Step: SettlementStepVPCWait, Err: err}
+			}
+		case settlementActionWait:
+			if !state.Init && !canClose {
+				err = fmt.Errorf("msc base state registered, but no vpc state to close the vpc with")
+				return payout, &SettlementError{Step: SettlementStepVPCClose, Err: err}
+			}
+		}
+
+		//Vpc contract is shared by all channels, ignore the events of other channels.
+		//State is read again after the poll interval, in case the event was missed.
+		select {
+		case event := <-bcInst.EventsChan.VPCVPCClosedChan:
+			if bytes.Equal(event.Id[:], vpcStateID[:]) {
+				payout.Sender, payout.Receiver = event.CashAlice, event.CashBob
+				return payout, nil
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = fmt.Errorf("waiting for peer to close vpc - %v", ctx.Err())
+			return payout, &SettlementError{Step: SettlementStepVPCWait, Err: err}
+		}
+	}
+}
+
+// executeMSContract calls execute on the mscontract to distribute the funds, once the vpc is closed.
+// The sender calls it immediately, as does the receiver if the vpc was closed after timeout (the peer is not responding).
+// Else the receiver calls it only if the funds are not paid out within a poll interval.
+// It returns true if the funds were paid out and the mscontract is terminated.
+func executeMSContract(ctx context.Context, ch *channel.Instance, bcInst *Instance, peerOffline bool) (closed bool, err error) {
+
+	execute := func() error {
+		err := bcInst.Execute(ch.SenderID().OnChainID, ch.ReceiverID().OnChainID)
+		if err != nil {
+			return &SettlementError{Step: SettlementStepExecute, Err: err}
+		}
+		return nil
+	}
+
+	executed := false
+	if ch.RoleChannel() == channel.Sender || peerOffline {
+		if err = execute(); err != nil {
+			return false, err
+		}
+		executed = true
+	}
+
+	ticker := time.NewTicker(settlementPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bcInst.EventsChan.MSCClosedChan:
+			return true, nil
+		case <-bcInst.EventsChan.MSCNotClosedChan:
+			logger.Error("Mscontract executed, but the funds could not be paid out to the users")
+			return false, nil
+		case <-ticker.C:
+			if !executed {
+				if err = execute(); err != nil {
+					return false, err
+				}
+				executed = true
+			}
+		case <-ctx.Done():
+			err = fmt.Errorf("waiting for mscontract to pay out the funds - %v", ctx.Err())
+			return false, &SettlementError{Step: SettlementStepPayout, Err: err}
+		}
+	}
+}
+
+// decideSettlementAction returns the action to be taken by the user with role, based on the vpc state registered in
+// vpc contract and the current time. canClose should be true if the user has a vpc state to close the vpc with.
+//
+// Close is called on the vpc if this user has not yet responded and the validity of the registered state
+// (if any) has not passed. Closes made after the validity are ignored by the contract,
+// so the vpc is finalized with the registered state once its extended validity has passed.
+func decideSettlementAction(state VPCState, role channel.Role, canClose bool, now time.Time) settlementAction {
+
+	if state.Init && !state.Open {
+		return settlementActionVPCClosed
+	}
+
+	waitingForSelf := !state.Init ||
+		(role == channel.Sender && state.WaitingForAlice) || (role == channel.Receiver && state.WaitingForBob)
+	if canClose && waitingForSelf && !deadlinePassed(state.Validity, now) {
+		return settlementActionVPCClose
+	}
+
+	if state.Init && deadlinePassed(state.ExtendedValidity, now) {
+		return settlementActionVPCFinalize
+	}
+	return settlementActionWait
+}
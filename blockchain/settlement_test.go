@@ -0,0 +1,179 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+func Test_decideSettlementAction(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	past, future := big.NewInt(900), big.NewInt(1100)
+	vpcState := func(waitingForAlice, waitingForBob bool, validity, extendedValidity *big.Int) VPCState {
+		return VPCState{Init: true, Open: true, WaitingForAlice: waitingForAlice, WaitingForBob: waitingForBob,
+			Validity: validity, ExtendedValidity: extendedValidity}
+	}
+
+	tests := []struct {
+		name     string
+		state    VPCState
+		role     channel.Role
+		canClose bool
+		want     settlementAction
+	}{
+		{"not_registered", VPCState{}, channel.Sender, true, settlementActionVPCClose},
+		{"not_registered_no_final_state", VPCState{}, channel.Sender, false, settlementActionWait},
+		{"sender_not_responded", vpcState(true, false, future, future), channel.Sender, true, settlementActionVPCClose},
+		{"sender_responded", vpcState(false, true, future, future), channel.Sender, true, settlementActionWait},
+		{"receiver_not_responded", vpcState(false, true, future, future), channel.Receiver, true, settlementActionVPCClose},
+		{"receiver_responded", vpcState(true, false, future, future), channel.Receiver, true, settlementActionWait},
+		{"not_responded_no_final_state", vpcState(true, false, future, future), channel.Sender, false, settlementActionWait},
+		{"not_responded_after_validity", vpcState(true, false, past, future), channel.Sender, true, settlementActionWait},
+		{"peer_offline_after_extended_validity", vpcState(false, true, past, past), channel.Sender, true, settlementActionVPCFinalize},
+		{"not_responded_after_extended_validity", vpcState(true, false, past, past), channel.Sender, true, settlementActionVPCFinalize},
+		{"closed", VPCState{Init: true, Open: false}, channel.Receiver, true, settlementActionVPCClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideSettlementAction(tt.state, tt.role, tt.canClose, now)
+			if got != tt.want {
+				t.Errorf("decideSettlementAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Settle_NoSessionID(t *testing.T) {
+
+	ch := &channel.Instance{}
+	_, err := Settle(context.Background(), ch, &Instance{}, channel.VPCStateSigned{}, SystemClock)
+	if settlementErr, ok := err.(*SettlementError); !ok || settlementErr.Step != SettlementStepVPCClose {
+		t.Errorf("Settle() error = %v, want *SettlementError at step %s", err, SettlementStepVPCClose)
+	}
+	if ch.Status() != channel.Status("") {
+		t.Errorf("Settle() channel status = %s, want unchanged", ch.Status())
+	}
+}
+
+func Test_executeMSContract(t *testing.T) {
+
+	//Receiver does not execute until the poll interval, so the events can be tested without a blockchain
+	ch := &channel.Instance{}
+	ch.SetRoleChannel(channel.Receiver)
+
+	newInstance := func() *Instance {
+		bcInst := &Instance{}
+		bcInst.EventsChan.MSCClosedChan = make(chan *contract.MSContractEventClosed, 1)
+		bcInst.EventsChan.MSCNotClosedChan = make(chan *contract.MSContractEventNotClosed, 1)
+		return bcInst
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		bcInst := newInstance()
+		bcInst.EventsChan.MSCClosedChan <- &contract.MSContractEventClosed{}
+
+		closed, err := executeMSContract(context.Background(), ch, bcInst, false)
+		if err != nil || !closed {
+			t.Errorf("executeMSContract() = %v, %v, want true, nil", closed, err)
+		}
+	})
+	t.Run("not_closed", func(t *testing.T) {
+		bcInst := newInstance()
+		bcInst.EventsChan.MSCNotClosedChan <- &contract.MSContractEventNotClosed{}
+
+		closed, err := executeMSContract(context.Background(), ch, bcInst, false)
+		if err != nil || closed {
+			t.Errorf("executeMSContract() = %v, %v, want false, nil", closed, err)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		bcInst := newInstance()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := executeMSContract(ctx, ch, bcInst, false)
+		if settlementErr, ok := err.(*SettlementError); !ok || settlementErr.Step != SettlementStepPayout {
+			t.Errorf("executeMSContract() error = %v, want *SettlementError at step %s", err, SettlementStepPayout)
+		}
+	})
+}
+
+func Test_Settle_Simulated(t *testing.T) {
+
+	deposit := types.EtherToWei(big.NewInt(10))
+	aliceInst, bobInst, ch, peerCh, cleanup := openSimulatedChannel(t, deposit)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	blockedSender, blockedReceiver := types.EtherToWei(big.NewInt(7)), types.EtherToWei(big.NewInt(13))
+	vpcStateID, err := channelVPCStateID(ch)
+	if err != nil {
+		t.Fatalf("channelVPCStateID() error = %v", err)
+	}
+	finalState := channel.VPCStateSigned{
+		VPCState: channel.VPCState{
+			ID:              vpcStateID[:],
+			Version:         big.NewInt(1),
+			BlockedSender:   blockedSender,
+			BlockedReceiver: blockedReceiver,
+		},
+	}
+	if err = finalState.AddSign(aliceInst.OwnerID, channel.Sender); err != nil {
+		t.Fatalf("AddSign() by sender error = %v", err)
+	}
+	if err = finalState.AddSign(bobInst.OwnerID, channel.Receiver); err != nil {
+		t.Fatalf("AddSign() by receiver error = %v", err)
+	}
+
+	peerPayout := make(chan Payout, 1)
+	peerErr := make(chan error, 1)
+	go func() {
+		payout, err := Settle(ctx, peerCh, bobInst, finalState, SystemClock)
+		peerPayout <- payout
+		peerErr <- err
+	}()
+
+	payout, err := Settle(ctx, ch, aliceInst, finalState, SystemClock)
+	if err != nil {
+		t.Fatalf("Settle() error = %v", err)
+	}
+	if err = <-peerErr; err != nil {
+		t.Fatalf("Settle() by peer error = %v", err)
+	}
+
+	for _, got := range []Payout{payout, <-peerPayout} {
+		if got.Sender.Cmp(blockedSender) != 0 || got.Receiver.Cmp(blockedReceiver) != 0 || !got.Closed || got.TimedOut {
+			t.Errorf("Settle() payout = %+v, want %v to sender, %v to receiver and closed", got, blockedSender, blockedReceiver)
+		}
+	}
+	for _, inst := range []*channel.Instance{ch, peerCh} {
+		if inst.Status() != channel.Closed {
+			t.Errorf("channel status = %s, want %s", inst.Status(), channel.Closed)
+		}
+	}
+}
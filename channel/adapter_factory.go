@@ -17,6 +17,7 @@
 package channel
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -27,22 +28,43 @@ import (
 // ReadWriteLogging to configure logging during channel read/write, for demonstration purposes only
 var ReadWriteLogging = false
 
+// Time within which the identity exchange on a new connection should complete.
+var identityExchangeTimeout = 10 * time.Second
+
 // AdapterType represents adapter type for off chain communication protocol
 type AdapterType string
 
-// Enumeration of allowed adapter types for off chain communication protocol
+// Enumeration of built-in adapter types for off chain communication protocol.
+// Adapter types for other transports can be added using RegisterAdapter.
+//
+// WebSocket and TCP adapters connect to the ListenerIPAddr of the peer.
+// Unix adapter connects to the unix domain socket at the path in ListenerEndpoint of the peer,
+// hence it can be used only for nodes on the same host.
+// Mock adapter connects in memory to the listener of the peer started in the same process,
+// at the ListenerIPAddr and ListenerEndpoint of the peer. It is intended for tests.
 const (
 	Mock      AdapterType = AdapterType("mock")
 	WebSocket AdapterType = AdapterType("websocket")
+	TCP       AdapterType = AdapterType("tcp")
+	Unix      AdapterType = AdapterType("unix")
 )
 
+// genericChannelAdapter implements the Read, Write and Close methods over a pair of read and write handlers.
+//
+// Read and write paths are independent, so that a Read blocked on waiting for a message from the peer
+// does not block a Write from another goroutine and vice versa.
+// Concurrent Reads (or concurrent Writes) are serialized. Close waits for an in-progress Write to complete
+// and unblocks any Read waiting for a message.
 type genericChannelAdapter struct {
-	connected bool //Status of the connection
+	connected bool          //Status of the connection
+	closed    chan struct{} //Closed when the connection is closed, to unblock pending reads
 
 	readHandlerPipe  handlerPipe //Set of channels to communicate with receive messagePipeHandlers
 	writeHandlerPipe handlerPipe //Set of channels to communicate with send messagePipeHandlers
 
-	access sync.Mutex //Access control when setting connection status
+	readAccess  sync.Mutex //Access control for reading from readHandlerPipe
+	writeAccess sync.Mutex //Access control for writing to writeHandlerPipe
+	access      sync.Mutex //Access control when setting connection status
 }
 
 // ReadWriteCloser is the interface that groups Read, Write, Close and Connected method.
@@ -72,18 +94,35 @@ type jsonMsgPacket struct {
 
 // Connected returns if the connection with the peer is active or not.
 func (ch *genericChannelAdapter) Connected() (isConnected bool) {
+
+	ch.access.Lock()
+	defer ch.access.Unlock()
+
 	return ch.connected
 }
 
+// closedSignal returns the channel that will be closed when the connection is closed.
+func (ch *genericChannelAdapter) closedSignal() <-chan struct{} {
+
+	ch.access.Lock()
+	defer ch.access.Unlock()
+
+	if ch.closed == nil {
+		ch.closed = make(chan struct{})
+	}
+	return ch.closed
+}
+
 // Read returns any new message that has been received by the read handler of this channel.
+// It blocks until a message is received or the connection is closed.
 //
 // If connection is not active, an error is returned.
 func (ch *genericChannelAdapter) Read() (message chMsgPkt, err error) {
 
-	ch.access.Lock()
-	defer ch.access.Unlock()
+	ch.readAccess.Lock()
+	defer ch.readAccess.Unlock()
 
-	if !ch.connected {
+	if !ch.Connected() {
 		err = fmt.Errorf("Channel already closed")
 		return chMsgPkt{}, err
 	}
@@ -93,6 +132,8 @@ func (ch *genericChannelAdapter) Read() (message chMsgPkt, err error) {
 	case msgPacket := <-ch.readHandlerPipe.msgPacket:
 		message = msgPacket.message
 		err = msgPacket.err
+	case <-ch.closedSignal():
+		err = fmt.Errorf("Channel closed while reading")
 	}
 
 	if err == nil && ReadWriteLogging {
@@ -104,26 +145,26 @@ func (ch *genericChannelAdapter) Read() (message chMsgPkt, err error) {
 }
 
 // Write sends the message to the write handler of this channel to be sent on the channel.
+// It blocks until the write handler has sent the message.
 //
 // If connection is not active, an error is returned.
 func (ch *genericChannelAdapter) Write(message chMsgPkt) (err error) {
 
-	ch.access.Lock()
-	defer ch.access.Unlock()
+	ch.writeAccess.Lock()
+	defer ch.writeAccess.Unlock()
 
-	if !ch.connected {
+	if !ch.Connected() {
 		err = fmt.Errorf("Channel already closed")
 		return err
 	}
 
 	//Send message if no handler error
+	zone, _ := time.LoadLocation("Local")
+	message.Timestamp = time.Now().In(zone)
 	select {
 	case err = <-ch.writeHandlerPipe.handlerError:
 		return err
-	default:
-		zone, _ := time.LoadLocation("Local")
-		message.Timestamp = time.Now().In(zone)
-		ch.writeHandlerPipe.msgPacket <- jsonMsgPacket{message, nil}
+	case ch.writeHandlerPipe.msgPacket <- jsonMsgPacket{message, nil}:
 	}
 
 	//Wait for response from writeHandler
@@ -142,15 +183,25 @@ func (ch *genericChannelAdapter) Write(message chMsgPkt) (err error) {
 }
 
 // Close closes the connection on this channel and also shuts the read and write handlers down.
+// Any Read waiting for a message returns with an error, while a Write in progress is allowed to complete.
 func (ch *genericChannelAdapter) Close() (err error) {
 
 	ch.access.Lock()
-	defer ch.access.Unlock()
-
 	if !ch.connected {
+		ch.access.Unlock()
 		err = fmt.Errorf("Channel already closed")
 		return err
 	}
+	ch.connected = false
+	if ch.closed == nil {
+		ch.closed = make(chan struct{})
+	}
+	close(ch.closed)
+	ch.access.Unlock()
+
+	//Wait for the write in progress, if any, as the write handler cannot be shut down in between
+	ch.writeAccess.Lock()
+	defer ch.writeAccess.Unlock()
 
 	//Note on closing mechanism - write handler during it's closure,
 	//will close the underlying websocket connection.
@@ -158,7 +209,6 @@ func (ch *genericChannelAdapter) Close() (err error) {
 	//and hence it will close with error. The error itself is unimportant
 	err = closeHandler(ch.writeHandlerPipe)
 
-	ch.connected = false
 	return nil
 }
 
@@ -204,51 +254,43 @@ func closeHandler(pipe handlerPipe) (err error) {
 func startListener(selfID identity.OffChainID, maxConn uint32, adapterType AdapterType) (idVerifiedConn chan *Instance,
 	listener Shutdown, err error) {
 
-	if adapterType != WebSocket {
-		return nil, nil, fmt.Errorf("Unsupported adapter type - %s", string(adapterType))
-	}
-
-	idVerifiedConn = make(chan *Instance, maxConn)
-
-	localAddr, err := selfID.ListenerLocalAddr()
+	entry, err := lookupAdapter(adapterType)
 	if err != nil {
-		logger.Error("Error in listening on address:", localAddr)
 		return nil, nil, err
 	}
 
-	//Only websocket adapter is supported currently
-	listener, inConn, err := wsStartListener(localAddr, selfID.ListenerEndpoint, maxConn)
+	listener, inConn, err := entry.listenerFactory(selfID, maxConn)
 	if err != nil {
 		logger.Debug("Error starting listen and serve,", err.Error())
 		return nil, nil, err
 	}
 
+	idVerifiedConn = make(chan *Instance, maxConn)
+
 	go func() {
 		for {
-			newConn := <-inConn
-			//Role of user in incoming connections is receiver
-			newConn.SetRoleChannel(Receiver)
-
-			peerID, err := newConn.IdentityRead()
-			if err != nil {
-				err2 := newConn.Close()
-				if err2 != nil {
-					logger.Error("Error reading peer id-", err, "connection dropped with error -", err2)
-				} else {
-					logger.Error("Error reading peer id-", err, "connection dropped with no error")
-				}
+			adapter, ok := <-inConn
+			if !ok {
 				return
 			}
+			newConn := &Instance{
+				adapter: adapter,
+			}
+			//Role of user in incoming connections is receiver
+			newConn.SetRoleChannel(Receiver)
 
-			err = newConn.IdentityRespond(selfID)
+			ctx, cancel := context.WithTimeout(context.Background(), identityExchangeTimeout)
+			peerID, err := acceptIdentity(ctx, newConn, selfID)
+			cancel()
 			if err != nil {
+				//Reject the connection and continue listening for others
 				err2 := newConn.Close()
 				if err2 != nil {
-					logger.Error("Error sending self id-", err, "connection dropped with error -", err2)
+					logger.Error(err, "- connection dropped with error -", err2)
 				} else {
-					logger.Error("Error sending self id-", err, "connection dropped with no error")
+					logger.Error(err, "- connection dropped with no error")
 				}
-				return
+				continue
 			}
 
 			//Set self and peer id and return connection to id verified connections channel
@@ -267,41 +309,55 @@ func startListener(selfID identity.OffChainID, maxConn uint32, adapterType Adapt
 // peerID is the offchain identity of the peer with whom the offchain channel needs to be established.
 //
 // An identity exchange is performed after establishing a connection between the two node software instances and
-// if it fails, an error is returned.
+// if it fails, an error is returned. In the exchange, each user proves the ownership of its on-chain id by signing
+// a nonce sent by the other. Hence credentials should be set in selfID.
+// If binding of tls certificates to ids is configured, the certificate of the peer is also verified.
 func NewChannel(selfID, peerID identity.OffChainID, adapterType AdapterType) (conn *Instance, err error) {
 
-	switch adapterType {
-	case WebSocket:
-		conn, err = newWsChannel(peerID.ListenerIPAddr, peerID.ListenerEndpoint)
-		if err != nil {
-			logger.Error("Websockets connection dial error:", err)
-			return nil, err
-		}
-		conn.SetRoleChannel(Sender)
-	case Mock:
-	default:
+	entry, err := lookupAdapter(adapterType)
+	if err != nil {
+		return nil, err
 	}
 
-	//Verify peer identity for all real adapter types
-	if adapterType != Mock {
+	adapter, err := entry.dialer(peerID)
+	if err != nil {
+		logger.Error("Connection dial error:", err)
+		return nil, err
+	}
+	conn = &Instance{
+		adapter: adapter,
+	}
+	conn.SetRoleChannel(Sender)
 
-		var gotPeerID identity.OffChainID
-		gotPeerID, err = conn.IdentityRequest(selfID)
-		if err != nil {
-			err = fmt.Errorf("Test connection failed")
-			return nil, err
+	//Verify peer identity
+	ctx, cancel := context.WithTimeout(context.Background(), identityExchangeTimeout)
+	var gotPeerID identity.OffChainID
+	gotPeerID, err = conn.IdentityRequestContext(ctx, selfID)
+	cancel()
+	if err != nil {
+		if errClose := conn.Close(); errClose != nil {
+			logger.Error("Error closing connection after failed id exchange -", errClose)
 		}
+		err = fmt.Errorf("Test connection failed - %s", err.Error())
+		return nil, err
+	}
 
-		if !identity.Equal(peerID, gotPeerID) {
-			errClose := conn.Close()
-			if errClose != nil {
-				err = fmt.Errorf("other id mismatch. error in closing conn - %s", errClose.Error())
-			} else {
-				err = fmt.Errorf("other id mismatch")
-			}
-			return nil, err
+	if !identity.Equal(peerID, gotPeerID) {
+		errClose := conn.Close()
+		if errClose != nil {
+			err = fmt.Errorf("other id mismatch. error in closing conn - %s", errClose.Error())
+		} else {
+			err = fmt.Errorf("other id mismatch")
 		}
+		return nil, err
+	}
 
+	err = verifyCertBinding(conn, gotPeerID)
+	if err != nil {
+		if errClose := conn.Close(); errClose != nil {
+			logger.Error("Error closing connection after failed certificate verification -", errClose)
+		}
+		return nil, fmt.Errorf("Peer certificate verification failed - %s", err.Error())
 	}
 
 	conn.setSelfID(selfID)
@@ -309,3 +365,34 @@ func NewChannel(selfID, peerID identity.OffChainID, adapterType AdapterType) (co
 
 	return conn, nil
 }
+
+// acceptIdentity performs the identity exchange on an incoming connection and returns the verified peer id.
+//
+// The peer sends its id and a nonce. A fresh nonce is sent back to the peer along with a signature on the transcript
+// of the exchange including both the nonces.
+// The connection is accepted only if the peer proves the ownership of the on-chain id it claimed,
+// by returning a valid signature on the transcript and, if configured, its tls certificate is bound to that id.
+func acceptIdentity(ctx context.Context, newConn *Instance, selfID identity.OffChainID) (
+	peerID identity.OffChainID, err error) {
+
+	peerID, peerNonce, err := newConn.IdentityReadContext(ctx)
+	if err != nil {
+		return peerID, fmt.Errorf("Error reading peer id - %s", err.Error())
+	}
+
+	nonce, err := newConn.IdentityRespond(selfID, peerID, peerNonce)
+	if err != nil {
+		return peerID, fmt.Errorf("Error sending self id - %s", err.Error())
+	}
+
+	err = newConn.IdentityProofReadContext(ctx, selfID, peerID, peerNonce, nonce)
+	if err != nil {
+		return peerID, fmt.Errorf("Error verifying peer id - %s", err.Error())
+	}
+
+	err = verifyCertBinding(newConn, peerID)
+	if err != nil {
+		return peerID, fmt.Errorf("Error verifying peer certificate - %s", err.Error())
+	}
+	return peerID, nil
+}
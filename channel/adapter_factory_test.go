@@ -323,6 +323,8 @@ func Test_newHandlerPipe(t *testing.T) {
 
 func Test_startListener(t *testing.T) {
 
+	alice, bob := idsWithCredentials()
+
 	t.Run("valid_websocket_adapter", func(t *testing.T) {
 
 		_ = exec.Command("fuser", "-k 9602/tcp").Run() //setup
@@ -330,7 +332,7 @@ func Test_startListener(t *testing.T) {
 			_ = exec.Command("fuser", "-k 9602/tcp").Run() //teardown
 		}()
 
-		inConnChannel, listener, err := startListener(bobID, 10, WebSocket)
+		inConnChannel, listener, err := startListener(bob, 10, WebSocket)
 		_, _ = inConnChannel, listener
 		if err != nil {
 			t.Fatalf("wsStartListener() err = %v, want nil", err)
@@ -345,7 +347,7 @@ func Test_startListener(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Test on startListener - newWsChannel() err = %v, want nil", err)
 		}
-		listenerID, err := ch.IdentityRequest(aliceID)
+		listenerID, err := ch.IdentityRequest(alice)
 		if err != nil {
 			t.Fatalf("Test on startListener - IdentityRequest() err = %v, want nil", err)
 		}
@@ -353,6 +355,86 @@ func Test_startListener(t *testing.T) {
 		if !identity.Equal(listenerID, bobID) {
 			t.Fatalf("Test on startListener - listenerID = %v, want %v", listenerID, bobID)
 		}
+
+		select {
+		case newConn := <-inConnChannel:
+			if !identity.Equal(newConn.PeerID(), aliceID) {
+				t.Errorf("Test on startListener - peerID = %v, want %v", newConn.PeerID(), aliceID)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Test on startListener - id verified connection not received")
+		}
+	})
+
+	t.Run("websocket_invalid_identity_proof", func(t *testing.T) {
+
+		//Client below does not support encryption
+		requireEncryption = false
+		defer func() {
+			requireEncryption = true
+		}()
+
+		_ = exec.Command("fuser", "-k 9602/tcp").Run() //setup
+		defer func() {
+			_ = exec.Command("fuser", "-k 9602/tcp").Run() //teardown
+		}()
+
+		inConnChannel, listener, err := startListener(bob, 10, WebSocket)
+		if err != nil {
+			t.Fatalf("wsStartListener() err = %v, want nil", err)
+		}
+		time.Sleep(200 * time.Millisecond) //Wait till the listener starts
+		defer func() {
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		//Claim to be alice, but sign the nonce from listener using the key of bob
+		impostor := aliceID
+		impostor.SetCredentials(testKeyStore, bobPassword)
+		impostor.OnChainID = bobID.OnChainID
+
+		ch, err := newWsChannel(bobID.ListenerIPAddr, bobID.ListenerEndpoint)
+		if err != nil {
+			t.Fatalf("Test on startListener - newWsChannel() err = %v, want nil", err)
+		}
+		nonce, _ := GenerateRandomNumber(identityNonceSize)
+		_ = ch.adapter.Write(chMsgPkt{Version: Version, MessageID: MsgIdentityRequest, Message: jsonMsgIdentity{ID: aliceID, Nonce: nonce}})
+		response, err := ch.adapter.Read()
+		if err != nil {
+			t.Fatalf("Test on startListener - Read() err = %v, want nil", err)
+		}
+		peerNonce := response.Message.(jsonMsgIdentity).Nonce
+		transcript := identityTranscript{
+			requester:      aliceID.OnChainID,
+			responder:      bobID.OnChainID,
+			requesterNonce: nonce,
+			responderNonce: peerNonce,
+		}
+		signature, err := identity.SignHashWithPasswordEth(impostor, transcript.hash(identityProofRequester))
+		if err != nil {
+			t.Fatalf("Test on startListener - SignHashWithPasswordEth() err = %v, want nil", err)
+		}
+		_ = ch.adapter.Write(chMsgPkt{Version: Version, MessageID: MsgIdentityProof, Message: jsonMsgIdentity{ID: aliceID, Signature: signature}})
+
+		select {
+		case <-inConnChannel:
+			t.Fatalf("Test on startListener - connection with invalid identity proof accepted")
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		//Listener should continue accepting new connections after rejecting one
+		ch, err = newWsChannel(bobID.ListenerIPAddr, bobID.ListenerEndpoint)
+		if err != nil {
+			t.Fatalf("Test on startListener - newWsChannel() err = %v, want nil", err)
+		}
+		if _, err = ch.IdentityRequest(alice); err != nil {
+			t.Fatalf("Test on startListener - IdentityRequest() err = %v, want nil", err)
+		}
+		select {
+		case <-inConnChannel:
+		case <-time.After(time.Second):
+			t.Errorf("Test on startListener - id verified connection not received")
+		}
 	})
 
 	t.Run("websocket_invalid_listener_address", func(t *testing.T) {
@@ -384,7 +466,7 @@ func Test_startListener(t *testing.T) {
 			_ = exec.Command("fuser", "-k 9602/tcp").Run() //teardown
 		}()
 
-		inConnChannel, listener, err := startListener(bobID, 10, WebSocket)
+		inConnChannel, listener, err := startListener(bob, 10, WebSocket)
 		_, _ = inConnChannel, listener
 		if err != nil {
 			t.Fatalf("wsStartListener() err = %v, want nil", err)
@@ -411,6 +493,8 @@ func Test_startListener(t *testing.T) {
 
 func Test_NewChannel(t *testing.T) {
 
+	alice, bob := idsWithCredentials()
+
 	t.Run("valid", func(t *testing.T) {
 
 		//Setup
@@ -429,9 +513,7 @@ func Test_NewChannel(t *testing.T) {
 			go func() {
 				for {
 					newConn := <-inConn
-					_, err := newConn.IdentityRead()
-					_ = err
-					err = newConn.IdentityRespond(bobID)
+					_, err := acceptIdentity(context.Background(), newConn, bob)
 					_ = err
 				}
 			}()
@@ -442,7 +524,7 @@ func Test_NewChannel(t *testing.T) {
 			_ = listener.Shutdown(context.Background())
 		}()
 
-		inst, err := NewChannel(aliceID, bobID, WebSocket)
+		inst, err := NewChannel(alice, bobID, WebSocket)
 		if err != nil {
 			t.Fatalf("NewChannel() err = %v, want nil", err)
 		}
@@ -469,9 +551,66 @@ func Test_NewChannel(t *testing.T) {
 			go func() {
 				for {
 					newConn := <-inConn
-					_, err := newConn.IdentityRead()
+					peerID, peerNonce, err := newConn.IdentityRead()
+					_ = err
+					_, err = newConn.IdentityRespond(alice, peerID, peerNonce)
+					_ = err
+				}
+			}()
+			return listener
+		}
+
+		listener := startListener()
+		defer func() {
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		inst, err := NewChannel(alice, bobID, WebSocket)
+		if err == nil {
+			t.Fatalf("NewChannel() err = nil, want non nil")
+		}
+		_ = inst
+		time.Sleep(200 * time.Millisecond)
+
+	})
+
+	t.Run("respond_invalid_proof", func(t *testing.T) {
+
+		//Setup
+		_ = exec.Command("fuser", "-k 9602/tcp").Run()
+
+		startListener := func() Shutdown {
+
+			localAddr, err := bobID.ListenerLocalAddr()
+			if err != nil {
+				t.Fatalf("ListenerLocalAddr() err = %v", err)
+			}
+			listener, inConn, err := wsStartListener(localAddr, bobID.ListenerEndpoint, 10)
+			if err != nil {
+				t.Fatalf("NewChannel setup - wsStartListener() err = %v", err)
+			}
+			go func() {
+				for {
+					//Claim to be bob, but sign the nonce using the key of alice
+					newConn := <-inConn
+					_, peerNonce, err := newConn.IdentityRead()
+					_ = err
+					nonce, err := GenerateRandomNumber(identityNonceSize)
+					_ = err
+					transcript := identityTranscript{
+						requester:      aliceID.OnChainID,
+						responder:      bobID.OnChainID,
+						requesterNonce: peerNonce,
+						responderNonce: nonce,
+						requesterKey:   newConn.keyExchange.peerKey,
+					}
+					signature, err := identity.SignHashWithPasswordEth(alice, transcript.hash(identityProofResponder))
 					_ = err
-					err = newConn.IdentityRespond(aliceID)
+					err = newConn.adapter.Write(chMsgPkt{
+						Version:   Version,
+						MessageID: MsgIdentityResponse,
+						Message:   jsonMsgIdentity{ID: bobID, Nonce: nonce, Signature: signature},
+					})
 					_ = err
 				}
 			}()
@@ -483,7 +622,7 @@ func Test_NewChannel(t *testing.T) {
 			_ = listener.Shutdown(context.Background())
 		}()
 
-		inst, err := NewChannel(aliceID, bobID, WebSocket)
+		inst, err := NewChannel(alice, bobID, WebSocket)
 		if err == nil {
 			t.Fatalf("NewChannel() err = nil, want non nil")
 		}
@@ -522,7 +661,7 @@ func Test_NewChannel(t *testing.T) {
 			_ = listener.Shutdown(context.Background())
 		}()
 
-		inst, err := NewChannel(aliceID, bobID, WebSocket)
+		inst, err := NewChannel(alice, bobID, WebSocket)
 		if err == nil {
 			t.Fatalf("NewChannel() err = nil, want non nil")
 		}
@@ -537,7 +676,7 @@ func Test_NewChannel(t *testing.T) {
 		_ = exec.Command("fuser", "-k 9602/tcp").Run()
 		_ = exec.Command("fuser", "-k 9602/tcp").Run() //Setup - kill active listeners
 
-		inst, err := NewChannel(aliceID, bobID, WebSocket)
+		inst, err := NewChannel(alice, bobID, WebSocket)
 		if err == nil {
 			t.Fatalf("NewChannel() err = nil, want non nil")
 		}
@@ -0,0 +1,237 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// MockLatency is the delay in delivery of each message on connections of Mock adapter type.
+// It can be set to simulate a network in tests, messages are delivered immediately by default.
+var MockLatency = time.Duration(0)
+
+// Number of messages that can be in transit in each direction on a mock connection.
+const mockLinkBufferSize = 100
+
+// mockListeners is the registry of listeners of Mock adapter type in this process, indexed by the listener address.
+var mockListeners = struct {
+	sync.Mutex
+	inConn map[string]chan *Instance
+}{inConn: make(map[string]chan *Instance)}
+
+// mockFrame is a message in transit on a mock connection.
+type mockFrame struct {
+	data      []byte    //Message encoded as json, so that the peer does not share any data with the sender
+	deliverAt time.Time //Time at which the message should be delivered to the peer
+}
+
+// mockLink connects the two ends of a mock connection.
+type mockLink struct {
+	aToB, bToA chan mockFrame
+	closed     chan struct{}
+	once       sync.Once
+}
+
+func (link *mockLink) close() {
+	link.once.Do(func() {
+		close(link.closed)
+	})
+}
+
+// mockChannel implements an in-process channel adapter, where the two ends of the connection are
+// connected by go channels instead of sockets. Messages are encoded as json as done by other adapters.
+type mockChannel struct {
+	*genericChannelAdapter
+	link *mockLink
+}
+
+// newMockPair returns the two ends of a new mock connection, with latency in delivery of messages.
+func newMockPair(latency time.Duration) (a, b *Instance) {
+
+	link := &mockLink{
+		aToB:   make(chan mockFrame, mockLinkBufferSize),
+		bToA:   make(chan mockFrame, mockLinkBufferSize),
+		closed: make(chan struct{}),
+	}
+	return newMockInstance(link, link.bToA, link.aToB, latency), newMockInstance(link, link.aToB, link.bToA, latency)
+}
+
+func newMockInstance(link *mockLink, in <-chan mockFrame, out chan<- mockFrame, latency time.Duration) *Instance {
+
+	ch := &mockChannel{
+		genericChannelAdapter: &genericChannelAdapter{
+			connected:        true,
+			writeHandlerPipe: newHandlerPipe(handlerPipeModeWrite),
+			readHandlerPipe:  newHandlerPipe(handlerPipeModeRead),
+		},
+		link: link,
+	}
+
+	//start read and write handler go routines
+	go mockWriteHandler(link, out, latency, ch.writeHandlerPipe)
+	go mockReadHandler(link, in, ch.readHandlerPipe, ch)
+
+	return &Instance{
+		adapter: ch,
+	}
+}
+
+// mockListener implements Shutdown interface for the listener of Mock adapter type.
+type mockListener struct {
+	addr string
+}
+
+// Shutdown removes the listener from the registry, so that no new connections are accepted.
+// Connections that were already accepted are not affected.
+func (l *mockListener) Shutdown(ctx context.Context) error {
+
+	mockListeners.Lock()
+	defer mockListeners.Unlock()
+
+	if _, present := mockListeners.inConn[l.addr]; !present {
+		return fmt.Errorf("Listener at %s already shutdown", l.addr)
+	}
+	delete(mockListeners.inConn, l.addr)
+	return nil
+}
+
+// mockStartListener registers a listener at addr in this process.
+// Only one listener can be registered at an address at a time.
+func mockStartListener(addr string, maxConn uint32) (sh Shutdown, inConn chan *Instance, err error) {
+
+	mockListeners.Lock()
+	defer mockListeners.Unlock()
+
+	if _, present := mockListeners.inConn[addr]; present {
+		return nil, nil, fmt.Errorf("Mock listener address already in use - %s", addr)
+	}
+	inConn = make(chan *Instance, maxConn)
+	mockListeners.inConn[addr] = inConn
+	return &mockListener{addr: addr}, inConn, nil
+}
+
+// newMockChannel establishes a new connection to the listener at addr in this process.
+func newMockChannel(addr string) (cha *Instance, err error) {
+
+	mockListeners.Lock()
+	inConn, present := mockListeners.inConn[addr]
+	mockListeners.Unlock()
+	if !present {
+		return nil, fmt.Errorf("No mock listener at %s", addr)
+	}
+
+	cha, peerCh := newMockPair(MockLatency)
+	select {
+	case inConn <- peerCh:
+	default:
+		_ = cha.Close()
+		_ = peerCh.Close()
+		return nil, fmt.Errorf("Mock listener at %s not accepting connections", addr)
+	}
+	return cha, nil
+}
+
+func mockWriteHandler(link *mockLink, out chan<- mockFrame, latency time.Duration, pipe handlerPipe) {
+
+	defer func() {
+		//Closing either end of the connection closes the link
+		link.close()
+		logger.Debug("Exiting messageSender")
+		pipe.quit <- true
+	}()
+
+	for {
+		select {
+		case msgPacket := <-pipe.msgPacket:
+			data, err := json.Marshal(msgPacket.message)
+			if err == nil {
+				select {
+				case out <- mockFrame{data: data, deliverAt: time.Now().Add(latency)}:
+				case <-link.closed:
+					err = fmt.Errorf("Connection closed by peer")
+				}
+			}
+			msgPacket.err = err
+			pipe.msgPacket <- msgPacket
+
+		case <-pipe.quit:
+			return
+		}
+	}
+}
+
+func mockReadHandler(link *mockLink, in <-chan mockFrame, pipe handlerPipe, ch *mockChannel) {
+
+	closed := ch.closedSignal()
+
+	for {
+		var frame mockFrame
+		select {
+		case frame = <-in:
+		case <-link.closed:
+			select {
+			case pipe.handlerError <- fmt.Errorf("Connection closed"):
+			default:
+			}
+
+			//Close the channel, if not closed by the user already
+			if ch.Connected() {
+				logger.Info("Connection closed by peer")
+				go func() {
+					if errClose := ch.Close(); errClose != nil {
+						logger.Error("Error closing channel-", errClose)
+					}
+				}()
+			}
+			logger.Debug("Exiting messageReceiver")
+			return
+		}
+
+		//Wait till the message is due for delivery
+		if wait := time.Until(frame.deliverAt); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-closed:
+				logger.Debug("Exiting messageReceiver")
+				return
+			}
+		}
+
+		//Decode each message into a new variable, as the previous message
+		//may still be in use by the reader of the pipe
+		var message chMsgPkt
+		err := json.Unmarshal(frame.data, &message)
+
+		select {
+		case pipe.msgPacket <- jsonMsgPacket{message, err}:
+		case <-closed:
+			logger.Debug("Exiting messageReceiver")
+			return
+		}
+	}
+}
+
+// mockAddr returns the address of the mock listener for id.
+func mockAddr(id identity.OffChainID) string {
+	return id.ListenerIPAddr + id.ListenerEndpoint
+}
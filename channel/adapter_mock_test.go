@@ -0,0 +1,230 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+func Test_newMockPair(t *testing.T) {
+
+	msg1 := chMsgPkt{Version: Version, MessageID: MsgVPCStateRequest,
+		Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusRequire}}
+	msg2 := chMsgPkt{Version: Version, MessageID: MsgVPCStateResponse,
+		Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusAccept}}
+
+	t.Run("messaging", func(t *testing.T) {
+		t.Parallel()
+
+		a, b := newMockPair(0)
+		defer func() {
+			_ = a.Close()
+		}()
+
+		if err := a.adapter.Write(msg1); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		if err := a.adapter.Write(msg2); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		for _, want := range []chMsgPkt{msg1, msg2} {
+			got, err := b.adapter.Read()
+			if err != nil {
+				t.Fatalf("Read() err = %v, want nil", err)
+			}
+			if got.MessageID != want.MessageID || !reflect.DeepEqual(got.Message, want.Message) {
+				t.Errorf("Read() = %+v, want %+v", got, want)
+			}
+		}
+
+		//Other direction
+		if err := b.adapter.Write(msg2); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		if got, err := a.adapter.Read(); err != nil || !reflect.DeepEqual(got.Message, msg2.Message) {
+			t.Errorf("Read() = %+v, %v, want %+v, nil", got, err, msg2)
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		t.Parallel()
+
+		latency := 200 * time.Millisecond
+		a, b := newMockPair(latency)
+		defer func() {
+			_ = a.Close()
+		}()
+
+		start := time.Now()
+		if err := a.adapter.Write(msg1); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		if elapsed := time.Since(start); elapsed >= latency {
+			t.Errorf("Write() took %v, want it not to wait for delivery", elapsed)
+		}
+		if _, err := b.adapter.Read(); err != nil {
+			t.Fatalf("Read() err = %v, want nil", err)
+		}
+		if elapsed := time.Since(start); elapsed < latency {
+			t.Errorf("Read() message delivered after %v, want at least %v", elapsed, latency)
+		}
+	})
+
+	t.Run("peer_closed", func(t *testing.T) {
+		t.Parallel()
+
+		a, b := newMockPair(0)
+
+		if err := a.Close(); err != nil {
+			t.Fatalf("Close() err = %v, want nil", err)
+		}
+		if err := a.adapter.Write(msg1); err == nil {
+			t.Errorf("Write() after close err = nil, want non nil")
+		}
+		if _, err := b.adapter.Read(); err == nil {
+			t.Errorf("Read() after peer closed err = nil, want non nil")
+		}
+		time.Sleep(100 * time.Millisecond)
+		if b.Connected() {
+			t.Errorf("Connected() after peer closed = true, want false")
+		}
+	})
+}
+
+func Test_mockStartListener_newMockChannel(t *testing.T) {
+
+	addr := "mock-listener-test/"
+
+	listener, inConn, err := mockStartListener(addr, 10)
+	if err != nil {
+		t.Fatalf("mockStartListener() err = %v, want nil", err)
+	}
+
+	if _, _, err = mockStartListener(addr, 10); err == nil {
+		t.Errorf("mockStartListener() on address in use err = nil, want non nil")
+	}
+
+	dialer, err := newMockChannel(addr)
+	if err != nil {
+		t.Fatalf("newMockChannel() err = %v, want nil", err)
+	}
+	defer func() {
+		_ = dialer.Close()
+	}()
+	select {
+	case accepted := <-inConn:
+		_ = accepted.Close()
+	case <-time.After(time.Second):
+		t.Errorf("mockStartListener() incoming connection not received")
+	}
+
+	if err = listener.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() err = %v, want nil", err)
+	}
+	if err = listener.Shutdown(context.Background()); err == nil {
+		t.Errorf("Shutdown() second time err = nil, want non nil")
+	}
+	if _, err = newMockChannel(addr); err == nil {
+		t.Errorf("newMockChannel() after listener shutdown err = nil, want non nil")
+	}
+
+	//Address can be reused after shutdown
+	listener, _, err = mockStartListener(addr, 10)
+	if err != nil {
+		t.Fatalf("mockStartListener() after shutdown err = %v, want nil", err)
+	}
+	_ = listener.Shutdown(context.Background())
+}
+
+func Test_NewChannel_mock(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+
+	//Connections of mock adapter do not use sockets, hence tests can run in parallel on different endpoints
+	for _, endpoint := range []string{"/mock-1", "/mock-2"} {
+		endpoint := endpoint
+		t.Run(endpoint, func(t *testing.T) {
+			t.Parallel()
+
+			bobListener := bob
+			bobListener.ListenerEndpoint = endpoint
+			peerBob := bobID
+			peerBob.ListenerEndpoint = endpoint
+
+			inConnChannel, listener, err := startListener(bobListener, 10, Mock)
+			if err != nil {
+				t.Fatalf("startListener() err = %v, want nil", err)
+			}
+			defer func() {
+				_ = listener.Shutdown(context.Background())
+			}()
+
+			conn, err := NewChannel(alice, peerBob, Mock)
+			if err != nil {
+				t.Fatalf("NewChannel() err = %v, want nil", err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			if conn.RoleChannel() != Sender || !conn.Encrypted() {
+				t.Errorf("NewChannel() role = %s, encrypted = %v, want %s, true", conn.RoleChannel(), conn.Encrypted(), Sender)
+			}
+
+			select {
+			case newConn := <-inConnChannel:
+				if !identity.Equal(newConn.PeerID(), aliceID) {
+					t.Errorf("startListener() peerID = %v, want %v", newConn.PeerID(), aliceID)
+				}
+				_ = newConn.Close()
+			case <-time.After(identityExchangeTimeout):
+				t.Errorf("startListener() id verified connection not received")
+			}
+
+			//Identity of the listener is verified
+			otherPeer := peerBob
+			otherPeer.OnChainID = aliceID.OnChainID
+			if _, err = NewChannel(alice, otherPeer, Mock); err == nil {
+				t.Errorf("NewChannel() with wrong peer id err = nil, want non nil")
+			}
+		})
+	}
+
+	t.Run("no_listener", func(t *testing.T) {
+		peer := bobID
+		peer.ListenerEndpoint = "/mock-no-listener"
+		if _, err := NewChannel(alice, peer, Mock); err == nil {
+			t.Errorf("NewChannel() err = nil, want non nil")
+		}
+	})
+}
+
+func Test_NewSession_mock(t *testing.T) {
+
+	_, bob := idsWithCredentials()
+	bob.ListenerEndpoint = "/mock-session"
+
+	_, listener, err := NewSession(bob, Mock, 10)
+	if err != nil {
+		t.Fatalf("NewSession() err = %v, want nil", err)
+	}
+	_ = listener.Shutdown(context.Background())
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// Dialer establishes a new connection to the listener of the peer and returns a channel adapter over it.
+type Dialer func(peerID identity.OffChainID) (ReadWriteCloser, error)
+
+// ListenerFactory starts listening for new connections on the listener address of selfID.
+// Adapters of the accepted connections should be sent on inConn, which can be closed when the listener is shutdown.
+// maxConn is the number of accepted connections that can be pending to be read from inConn.
+type ListenerFactory func(selfID identity.OffChainID, maxConn uint32) (listener Shutdown, inConn chan ReadWriteCloser, err error)
+
+// adapterEntry is the transport registered for an adapter type.
+type adapterEntry struct {
+	dialer          Dialer
+	listenerFactory ListenerFactory
+}
+
+// adapterRegistry holds the transports for all the adapter types that can be used in NewChannel and NewSession.
+var adapterRegistry = struct {
+	sync.RWMutex
+	entries map[AdapterType]adapterEntry
+}{entries: make(map[AdapterType]adapterEntry)}
+
+func init() {
+
+	//Built-in adapter types
+	mustRegisterAdapter(WebSocket, wsDialer, wsListenerFactory)
+	mustRegisterAdapter(TCP, netDialer(TCP), netListenerFactory(TCP))
+	mustRegisterAdapter(Unix, netDialer(Unix), netListenerFactory(Unix))
+	mustRegisterAdapter(Mock, mockDialer, mockListenerFactory)
+}
+
+// RegisterAdapter registers a transport for the adapterType, so that it can be used in NewChannel and NewSession.
+//
+// Transports of other packages can be plugged in this way, without any change to this package. Identity exchange
+// and encryption are done by this package on the adapters returned by dialer and listenerFactory, the same
+// way as for the built-in adapter types. NewStreamAdapter can be used to obtain an adapter over a stream connection.
+//
+// An adapter type can be registered only once.
+func RegisterAdapter(adapterType AdapterType, dialer Dialer, listenerFactory ListenerFactory) error {
+
+	if adapterType == "" {
+		return fmt.Errorf("Adapter type should not be empty")
+	}
+	if dialer == nil || listenerFactory == nil {
+		return fmt.Errorf("Dialer and listener factory should be non nil for adapter type - %s", string(adapterType))
+	}
+
+	adapterRegistry.Lock()
+	defer adapterRegistry.Unlock()
+
+	if _, present := adapterRegistry.entries[adapterType]; present {
+		return fmt.Errorf("Adapter type already registered - %s", string(adapterType))
+	}
+	adapterRegistry.entries[adapterType] = adapterEntry{dialer, listenerFactory}
+	return nil
+}
+
+// RegisteredAdapters returns the list of adapter types registered so far, in no particular order.
+func RegisteredAdapters() []AdapterType {
+
+	adapterRegistry.RLock()
+	defer adapterRegistry.RUnlock()
+
+	adapterTypes := make([]AdapterType, 0, len(adapterRegistry.entries))
+	for adapterType := range adapterRegistry.entries {
+		adapterTypes = append(adapterTypes, adapterType)
+	}
+	return adapterTypes
+}
+
+func mustRegisterAdapter(adapterType AdapterType, dialer Dialer, listenerFactory ListenerFactory) {
+	if err := RegisterAdapter(adapterType, dialer, listenerFactory); err != nil {
+		panic(err)
+	}
+}
+
+func lookupAdapter(adapterType AdapterType) (entry adapterEntry, err error) {
+
+	adapterRegistry.RLock()
+	defer adapterRegistry.RUnlock()
+
+	entry, present := adapterRegistry.entries[adapterType]
+	if !present {
+		return adapterEntry{}, fmt.Errorf("Unsupported adapter type - %s", string(adapterType))
+	}
+	return entry, nil
+}
+
+// instanceListener adapts the listeners of built-in adapter types, that return connections as instances,
+// to the ListenerFactory. It stops forwarding the connections when shutdown.
+type instanceListener struct {
+	listener Shutdown
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (l *instanceListener) Shutdown(ctx context.Context) error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return l.listener.Shutdown(ctx)
+}
+
+func adaptInstanceListener(sh Shutdown, inConn chan *Instance, maxConn uint32) (Shutdown, chan ReadWriteCloser) {
+
+	listener := &instanceListener{
+		listener: sh,
+		done:     make(chan struct{}),
+	}
+	inAdapters := make(chan ReadWriteCloser, maxConn)
+
+	go func() {
+		defer close(inAdapters)
+		for {
+			select {
+			case conn := <-inConn:
+				select {
+				case inAdapters <- conn.adapter:
+				case <-listener.done:
+					_ = conn.Close()
+					return
+				}
+			case <-listener.done:
+				return
+			}
+		}
+	}()
+	return listener, inAdapters
+}
+
+func adapterOf(conn *Instance, err error) (ReadWriteCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+	return conn.adapter, nil
+}
+
+func wsDialer(peerID identity.OffChainID) (ReadWriteCloser, error) {
+	return adapterOf(newWsChannel(peerID.ListenerIPAddr, peerID.ListenerEndpoint))
+}
+
+func wsListenerFactory(selfID identity.OffChainID, maxConn uint32) (Shutdown, chan ReadWriteCloser, error) {
+
+	localAddr, err := selfID.ListenerLocalAddr()
+	if err != nil {
+		return nil, nil, err
+	}
+	sh, inConn, err := wsStartListener(localAddr, selfID.ListenerEndpoint, maxConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, inAdapters := adaptInstanceListener(sh, inConn, maxConn)
+	return listener, inAdapters, nil
+}
+
+func netDialer(adapterType AdapterType) Dialer {
+	return func(peerID identity.OffChainID) (ReadWriteCloser, error) {
+		network, addr := "unix", peerID.ListenerEndpoint
+		if adapterType == TCP {
+			network, addr = "tcp", peerID.ListenerIPAddr
+		}
+		return adapterOf(newNetChannel(network, addr))
+	}
+}
+
+func netListenerFactory(adapterType AdapterType) ListenerFactory {
+	return func(selfID identity.OffChainID, maxConn uint32) (Shutdown, chan ReadWriteCloser, error) {
+
+		//Unix domain socket is at the path in listener endpoint
+		network, addr := "unix", selfID.ListenerEndpoint
+		if adapterType == TCP {
+			localAddr, err := selfID.ListenerLocalAddr()
+			if err != nil {
+				return nil, nil, err
+			}
+			network, addr = "tcp", localAddr
+		}
+		sh, inConn, err := netStartListener(network, addr, maxConn)
+		if err != nil {
+			return nil, nil, err
+		}
+		listener, inAdapters := adaptInstanceListener(sh, inConn, maxConn)
+		return listener, inAdapters, nil
+	}
+}
+
+func mockDialer(peerID identity.OffChainID) (ReadWriteCloser, error) {
+	return adapterOf(newMockChannel(mockAddr(peerID)))
+}
+
+func mockListenerFactory(selfID identity.OffChainID, maxConn uint32) (Shutdown, chan ReadWriteCloser, error) {
+
+	sh, inConn, err := mockStartListener(mockAddr(selfID), maxConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, inAdapters := adaptInstanceListener(sh, inConn, maxConn)
+	return listener, inAdapters, nil
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// pipeTransport is a custom transport over in-process pipes, used for testing the adapter registry.
+type pipeTransport struct {
+	access    sync.Mutex
+	listeners map[string]chan ReadWriteCloser
+}
+
+func (p *pipeTransport) dial(peerID identity.OffChainID) (ReadWriteCloser, error) {
+
+	p.access.Lock()
+	inConn, present := p.listeners[peerID.ListenerIPAddr]
+	p.access.Unlock()
+	if !present {
+		return nil, fmt.Errorf("no listener at %s", peerID.ListenerIPAddr)
+	}
+
+	local, remote := net.Pipe()
+	inConn <- NewStreamAdapter(remote)
+	return NewStreamAdapter(local), nil
+}
+
+func (p *pipeTransport) listen(selfID identity.OffChainID, maxConn uint32) (Shutdown, chan ReadWriteCloser, error) {
+
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	inConn := make(chan ReadWriteCloser, maxConn)
+	p.listeners[selfID.ListenerIPAddr] = inConn
+	return &pipeListener{p, selfID.ListenerIPAddr}, inConn, nil
+}
+
+type pipeListener struct {
+	transport *pipeTransport
+	addr      string
+}
+
+func (l *pipeListener) Shutdown(ctx context.Context) error {
+
+	l.transport.access.Lock()
+	defer l.transport.access.Unlock()
+
+	close(l.transport.listeners[l.addr])
+	delete(l.transport.listeners, l.addr)
+	return nil
+}
+
+func Test_RegisterAdapter(t *testing.T) {
+
+	transport := &pipeTransport{listeners: make(map[string]chan ReadWriteCloser)}
+
+	tests := []struct {
+		name            string
+		adapterType     AdapterType
+		dialer          Dialer
+		listenerFactory ListenerFactory
+		wantErr         bool
+	}{
+		{"valid", AdapterType("test-register-valid"), transport.dial, transport.listen, false},
+		{"empty_type", AdapterType(""), transport.dial, transport.listen, true},
+		{"nil_dialer", AdapterType("test-register-nil-dialer"), nil, transport.listen, true},
+		{"nil_listener_factory", AdapterType("test-register-nil-listener"), transport.dial, nil, true},
+		{"built_in_type", WebSocket, transport.dial, transport.listen, true},
+		{"registered_type", AdapterType("test-register-valid"), transport.dial, transport.listen, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterAdapter(tt.adapterType, tt.dialer, tt.listenerFactory)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterAdapter() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_RegisteredAdapters(t *testing.T) {
+
+	registered := make(map[AdapterType]bool)
+	for _, adapterType := range RegisteredAdapters() {
+		registered[adapterType] = true
+	}
+	for _, want := range []AdapterType{WebSocket, TCP, Unix, Mock} {
+		if !registered[want] {
+			t.Errorf("RegisteredAdapters() does not contain built-in adapter type %s", want)
+		}
+	}
+}
+
+func Test_NewChannel_customAdapter(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+	bob.ListenerIPAddr = "pipe-bob"
+	peerBob := bobID
+	peerBob.ListenerIPAddr = "pipe-bob"
+
+	adapterType := AdapterType("test-pipe")
+	transport := &pipeTransport{listeners: make(map[string]chan ReadWriteCloser)}
+	if err := RegisterAdapter(adapterType, transport.dial, transport.listen); err != nil {
+		t.Fatalf("RegisterAdapter() err = %v, want nil", err)
+	}
+
+	inConnChannel, listener, err := startListener(bob, 10, adapterType)
+	if err != nil {
+		t.Fatalf("startListener() err = %v, want nil", err)
+	}
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	conn, err := NewChannel(alice, peerBob, adapterType)
+	if err != nil {
+		t.Fatalf("NewChannel() err = %v, want nil", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if conn.RoleChannel() != Sender || !conn.Encrypted() {
+		t.Errorf("NewChannel() role = %s, encrypted = %v, want %s, true", conn.RoleChannel(), conn.Encrypted(), Sender)
+	}
+
+	select {
+	case newConn := <-inConnChannel:
+		if !identity.Equal(newConn.PeerID(), aliceID) || newConn.RoleChannel() != Receiver {
+			t.Errorf("startListener() peerID, role = %v, %s, want %v, %s", newConn.PeerID(), newConn.RoleChannel(), aliceID, Receiver)
+		}
+		_ = newConn.Close()
+	case <-time.After(identityExchangeTimeout):
+		t.Errorf("startListener() id verified connection not received")
+	}
+
+	//Identity of the listener is verified for custom adapters too
+	otherPeer := peerBob
+	otherPeer.OnChainID = aliceID.OnChainID
+	if _, err = NewChannel(alice, otherPeer, adapterType); err == nil {
+		t.Errorf("NewChannel() with wrong peer id err = nil, want non nil")
+	}
+
+	t.Run("unregistered_adapter", func(t *testing.T) {
+		if _, err := NewChannel(alice, peerBob, AdapterType("test-unregistered")); err == nil {
+			t.Errorf("NewChannel() err = nil, want non nil")
+		}
+		if _, _, err := startListener(bob, 10, AdapterType("test-unregistered")); err == nil {
+			t.Errorf("startListener() err = nil, want non nil")
+		}
+	})
+}
+
+func Test_adaptInstanceListener(t *testing.T) {
+
+	sh, inConn, err := mockStartListener("adapt-instance-listener-test/", 10)
+	if err != nil {
+		t.Fatalf("mockStartListener() err = %v, want nil", err)
+	}
+	listener, inAdapters := adaptInstanceListener(sh, inConn, 10)
+
+	dialer, err := newMockChannel("adapt-instance-listener-test/")
+	if err != nil {
+		t.Fatalf("newMockChannel() err = %v, want nil", err)
+	}
+	defer func() {
+		_ = dialer.Close()
+	}()
+
+	select {
+	case adapter := <-inAdapters:
+		if adapter == nil || !adapter.Connected() {
+			t.Errorf("adaptInstanceListener() adapter = %v, want connected adapter", adapter)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("adaptInstanceListener() incoming connection not received")
+	}
+
+	if err = listener.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() err = %v, want nil", err)
+	}
+	select {
+	case _, ok := <-inAdapters:
+		if ok {
+			t.Errorf("adaptInstanceListener() received connection after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("adaptInstanceListener() connections channel not closed after shutdown")
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type netConfigType struct {
+	writeWait       time.Duration
+	keepAlivePeriod time.Duration
+	maxMessageSize  uint32
+}
+
+var netConfig = netConfigType{
+	writeWait:       10 * time.Second,
+	keepAlivePeriod: 3 * time.Minute,
+	maxMessageSize:  2048, //Same as websocket adapter
+}
+
+// Size (in bytes) of the length prefix sent before each message.
+const netFrameHeaderSize = 4
+
+// netChannel implements a lean channel adapter over a stream connection (tcp, unix domain socket or custom).
+//
+// Each message is encoded as json and sent as a frame, prefixed by its length as 4 byte big endian integer.
+// Liveness of tcp connections is checked by keep alive probes of the operating system, hence
+// no ping messages are sent as in the websocket adapter.
+type netChannel struct {
+	*genericChannelAdapter
+	conn io.ReadWriteCloser
+}
+
+// netListener implements Shutdown interface for the listener of stream connections.
+type netListener struct {
+	ln       net.Listener
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+// Shutdown stops the listener from accepting new connections.
+// Connections that were already accepted are not affected.
+func (l *netListener) Shutdown(ctx context.Context) (err error) {
+	l.once.Do(func() {
+		close(l.shutdown)
+		err = l.ln.Close()
+	})
+	return err
+}
+
+// netStartListener starts listening for connections on addr of the network ("tcp" or "unix").
+// For unix network, addr is the path of the socket file, which is removed when the listener is shutdown.
+func netStartListener(network, addr string, maxConn uint32) (sh Shutdown, inConn chan *Instance, err error) {
+
+	if network != "tcp" && network != "unix" {
+		return nil, nil, fmt.Errorf("Unsupported network - %s", network)
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener := &netListener{
+		ln:       ln,
+		shutdown: make(chan struct{}),
+	}
+	inConn = make(chan *Instance, maxConn)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				select {
+				case <-listener.shutdown:
+					logger.Info("Listener at ", addr, " shutdown successfully")
+				default:
+					logger.Error("Listener at ", addr, " shutdown with error -", err.Error())
+				}
+				return
+			}
+
+			err = setKeepAlive(conn)
+			if err != nil {
+				logger.Error("Error setting keep alive on incoming connection -", err)
+				_ = conn.Close()
+				continue
+			}
+			inConn <- newNetInstance(conn)
+		}
+	}()
+
+	return listener, inConn, nil
+}
+
+// newNetChannel establishes a new connection to the listener at addr of the network ("tcp" or "unix").
+func newNetChannel(network, addr string) (cha *Instance, err error) {
+
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("Unsupported network - %s", network)
+	}
+
+	conn, err := net.DialTimeout(network, addr, netConfig.writeWait)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setKeepAlive(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return newNetInstance(conn), nil
+}
+
+// NewStreamAdapter returns a channel adapter over a stream connection, framing the messages the same way as
+// the TCP adapter. It can be used by the Dialer and ListenerFactory of a custom transport.
+// Closing the adapter closes the connection.
+func NewStreamAdapter(conn io.ReadWriteCloser) ReadWriteCloser {
+	return newNetInstance(conn).adapter
+}
+
+func newNetInstance(conn io.ReadWriteCloser) *Instance {
+
+	ch := &netChannel{
+		genericChannelAdapter: &genericChannelAdapter{
+			connected:        true,
+			writeHandlerPipe: newHandlerPipe(handlerPipeModeWrite),
+			readHandlerPipe:  newHandlerPipe(handlerPipeModeRead),
+		},
+		conn: conn,
+	}
+
+	//start read and write handler go routines
+	go netWriteHandler(netConfig, ch.conn, ch.writeHandlerPipe)
+	go netReadHandler(netConfig, ch.conn, ch.readHandlerPipe, ch)
+
+	return &Instance{
+		adapter: ch,
+	}
+}
+
+// setKeepAlive enables keep alive on tcp connections, so that dead connections are detected eventually.
+// Unix domain socket connections are not affected.
+func setKeepAlive(conn net.Conn) (err error) {
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	err = tcpConn.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(netConfig.keepAlivePeriod)
+}
+
+// writeFrame writes the data prefixed by its length as a single frame.
+func writeFrame(w io.Writer, data []byte, maxSize uint32) (err error) {
+
+	if uint64(len(data)) > uint64(maxSize) {
+		return fmt.Errorf("Message size (%d bytes) exceeds the limit (%d bytes)", len(data), maxSize)
+	}
+
+	frame := make([]byte, netFrameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[netFrameHeaderSize:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame reads a frame and returns the data in it.
+// Frames larger than maxSize are rejected, as the connection cannot be used after that.
+func readFrame(r io.Reader, maxSize uint32) (data []byte, err error) {
+
+	header := make([]byte, netFrameHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxSize {
+		return nil, fmt.Errorf("Message size (%d bytes) exceeds the limit (%d bytes)", size, maxSize)
+	}
+
+	data = make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func netReadHandler(netConfig netConfigType, conn io.Reader, pipe handlerPipe, ch *netChannel) {
+
+	closed := ch.closedSignal()
+
+	for {
+		data, err := readFrame(conn, netConfig.maxMessageSize)
+		if err != nil {
+			//Connection cannot be used after a read error, as the frame boundaries are lost
+			select {
+			case pipe.handlerError <- err:
+			default:
+			}
+
+			//Close the channel, if not closed by the user already
+			if ch.Connected() {
+				logger.Info("Connection closed by peer -", err)
+				go func() {
+					if errClose := ch.Close(); errClose != nil {
+						logger.Error("Error closing channel-", errClose)
+					}
+				}()
+			}
+			logger.Debug("Exiting messageReceiver")
+			return
+		}
+
+		//Decode each message into a new variable, as the previous message
+		//may still be in use by the reader of the pipe
+		var message chMsgPkt
+		err = json.Unmarshal(data, &message)
+
+		//Do not block on a pending message when the channel is closed
+		select {
+		case pipe.msgPacket <- jsonMsgPacket{message, err}:
+		case <-closed:
+			logger.Debug("Exiting messageReceiver")
+			return
+		}
+	}
+}
+
+// writeDeadliner is implemented by connections that support write deadline, such as net.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+func netWriteHandler(netConfig netConfigType, conn io.WriteCloser, pipe handlerPipe) {
+
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			logger.Info("error already closed by peer -", err)
+		}
+		logger.Debug("Exiting messageSender")
+		pipe.quit <- true
+	}()
+
+	//Write handler runs until asked to quit, even if the connection has failed,
+	//so that the closing mechanism of the generic adapter works
+	for {
+		select {
+		case msgPacket := <-pipe.msgPacket:
+			data, err := json.Marshal(msgPacket.message)
+			if deadliner, ok := conn.(writeDeadliner); ok && err == nil {
+				err = deadliner.SetWriteDeadline(time.Now().Add(netConfig.writeWait))
+			}
+			if err == nil {
+				err = writeFrame(conn, data, netConfig.maxMessageSize)
+			}
+			msgPacket.err = err
+			pipe.msgPacket <- msgPacket
+
+		case <-pipe.quit:
+			return
+		}
+	}
+}
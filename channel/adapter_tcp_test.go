@@ -0,0 +1,318 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// testNetAddr returns the address for the listener of bob for the network,
+// along with a function to cleanup the address after the test.
+func testNetAddr(t *testing.T, network string) (addr string, cleanup func()) {
+
+	switch network {
+	case "tcp":
+		_ = exec.Command("fuser", "-k 9602/tcp").Run()
+		return "localhost:9602", func() {}
+	default:
+		dir, err := ioutil.TempDir("", "dst-go-unix-test")
+		if err != nil {
+			t.Fatalf("Setup - TempDir() err = %v", err)
+		}
+		return filepath.Join(dir, "bob.sock"), func() { _ = os.RemoveAll(dir) }
+	}
+}
+
+func Test_netStartListener_newNetChannel(t *testing.T) {
+
+	msg1 := chMsgPkt{Version: Version, MessageID: MsgVPCStateRequest,
+		Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusRequire}}
+	msg2 := chMsgPkt{Version: Version, MessageID: MsgVPCStateResponse,
+		Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusAccept}}
+
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+
+			addr, cleanup := testNetAddr(t, network)
+			defer cleanup()
+
+			listener, inConn, err := netStartListener(network, addr, 10)
+			if err != nil {
+				t.Fatalf("netStartListener() err = %v, want nil", err)
+			}
+			defer func() {
+				_ = listener.Shutdown(context.Background())
+			}()
+
+			dialer, err := newNetChannel(network, addr)
+			if err != nil {
+				t.Fatalf("newNetChannel() err = %v, want nil", err)
+			}
+			var accepted *Instance
+			select {
+			case accepted = <-inConn:
+			case <-time.After(time.Second):
+				t.Fatalf("netStartListener() incoming connection not received")
+			}
+
+			if err = dialer.adapter.Write(msg1); err != nil {
+				t.Fatalf("Write() err = %v, want nil", err)
+			}
+			if err = dialer.adapter.Write(msg2); err != nil {
+				t.Fatalf("Write() err = %v, want nil", err)
+			}
+			for _, want := range []chMsgPkt{msg1, msg2} {
+				got, err := accepted.adapter.Read()
+				if err != nil {
+					t.Fatalf("Read() err = %v, want nil", err)
+				}
+				if got.MessageID != want.MessageID || !reflect.DeepEqual(got.Message, want.Message) {
+					t.Errorf("Read() = %+v, want %+v", got, want)
+				}
+			}
+
+			//Other direction
+			if err = accepted.adapter.Write(msg2); err != nil {
+				t.Fatalf("Write() err = %v, want nil", err)
+			}
+			if got, err := dialer.adapter.Read(); err != nil || !reflect.DeepEqual(got.Message, msg2.Message) {
+				t.Errorf("Read() = %+v, %v, want %+v, nil", got, err, msg2)
+			}
+
+			//Closing one end should close the other
+			if err = dialer.Close(); err != nil {
+				t.Fatalf("Close() err = %v, want nil", err)
+			}
+			if _, err = accepted.adapter.Read(); err == nil {
+				t.Errorf("Read() after peer closed err = nil, want non nil")
+			}
+			time.Sleep(100 * time.Millisecond)
+			if accepted.Connected() {
+				t.Errorf("Connected() after peer closed = true, want false")
+			}
+		})
+	}
+
+	t.Run("unsupported_network", func(t *testing.T) {
+		if _, _, err := netStartListener("udp", "localhost:9602", 10); err == nil {
+			t.Errorf("netStartListener() err = nil, want non nil")
+		}
+		if _, err := newNetChannel("udp", "localhost:9602"); err == nil {
+			t.Errorf("newNetChannel() err = nil, want non nil")
+		}
+	})
+
+	t.Run("dial_error", func(t *testing.T) {
+		if _, err := newNetChannel("unix", filepath.Join(os.TempDir(), "dst-go-missing.sock")); err == nil {
+			t.Errorf("newNetChannel() err = nil, want non nil")
+		}
+	})
+}
+
+func Test_netReadHandler_invalidFrames(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		frame func() []byte
+	}{
+		{
+			name: "oversized_frame",
+			frame: func() []byte {
+				header := make([]byte, netFrameHeaderSize)
+				binary.BigEndian.PutUint32(header, netConfig.maxMessageSize+1)
+				return header
+			},
+		},
+		{
+			name: "truncated_frame",
+			frame: func() []byte {
+				header := make([]byte, netFrameHeaderSize)
+				binary.BigEndian.PutUint32(header, 100)
+				return append(header, []byte("less than 100 bytes")...)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			local, remote := net.Pipe()
+			ch := newNetInstance(local)
+
+			go func() {
+				_, _ = remote.Write(tt.frame())
+				_ = remote.Close()
+			}()
+
+			if _, err := ch.adapter.Read(); err == nil {
+				t.Errorf("Read() err = nil, want non nil")
+			}
+			time.Sleep(100 * time.Millisecond)
+			if ch.Connected() {
+				t.Errorf("Connected() = true, want false after invalid frame")
+			}
+		})
+	}
+
+	t.Run("invalid_json", func(t *testing.T) {
+
+		local, remote := net.Pipe()
+		ch := newNetInstance(local)
+		defer func() {
+			_ = ch.Close()
+		}()
+
+		go func() {
+			buf := &bytes.Buffer{}
+			_ = writeFrame(buf, []byte("invalid json"), netConfig.maxMessageSize)
+			_, _ = remote.Write(buf.Bytes())
+		}()
+
+		if _, err := ch.adapter.Read(); err == nil {
+			t.Errorf("Read() err = nil, want non nil")
+		}
+		if !ch.Connected() {
+			t.Errorf("Connected() = false, want true as frame boundaries are intact")
+		}
+	})
+}
+
+func Test_writeFrame_readFrame(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	data := []byte("message data")
+	if err := writeFrame(buf, data, 100); err != nil {
+		t.Fatalf("writeFrame() err = %v, want nil", err)
+	}
+	if buf.Len() != netFrameHeaderSize+len(data) {
+		t.Errorf("writeFrame() frame size = %d, want %d", buf.Len(), netFrameHeaderSize+len(data))
+	}
+	got, err := readFrame(buf, 100)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("readFrame() = %s, %v, want %s, nil", got, err, data)
+	}
+
+	if err = writeFrame(&bytes.Buffer{}, data, uint32(len(data)-1)); err == nil {
+		t.Errorf("writeFrame() oversized err = nil, want non nil")
+	}
+}
+
+func Test_NewChannel_netAdapters(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+
+	tests := []struct {
+		adapterType AdapterType
+		network     string
+	}{
+		{TCP, "tcp"},
+		{Unix, "unix"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.adapterType), func(t *testing.T) {
+
+			addr, cleanup := testNetAddr(t, tt.network)
+			defer cleanup()
+
+			bobListener := bob
+			peerBob := bobID
+			if tt.adapterType == Unix {
+				bobListener.ListenerEndpoint = addr
+				peerBob.ListenerEndpoint = addr
+			}
+
+			inConnChannel, listener, err := startListener(bobListener, 10, tt.adapterType)
+			if err != nil {
+				t.Fatalf("startListener() err = %v, want nil", err)
+			}
+			defer func() {
+				_ = listener.Shutdown(context.Background())
+			}()
+
+			conn, err := NewChannel(alice, peerBob, tt.adapterType)
+			if err != nil {
+				t.Fatalf("NewChannel() err = %v, want nil", err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			if conn.RoleChannel() != Sender || !conn.Encrypted() {
+				t.Errorf("NewChannel() role = %s, encrypted = %v, want %s, true", conn.RoleChannel(), conn.Encrypted(), Sender)
+			}
+
+			select {
+			case newConn := <-inConnChannel:
+				if !identity.Equal(newConn.PeerID(), aliceID) {
+					t.Errorf("startListener() peerID = %v, want %v", newConn.PeerID(), aliceID)
+				}
+				_ = newConn.Close()
+			case <-time.After(identityExchangeTimeout):
+				t.Errorf("startListener() id verified connection not received")
+			}
+
+			//Identity of the listener is verified
+			otherPeer := peerBob
+			otherPeer.OnChainID = aliceID.OnChainID
+			if _, err = NewChannel(alice, otherPeer, tt.adapterType); err == nil {
+				t.Errorf("NewChannel() with wrong peer id err = nil, want non nil")
+			}
+		})
+	}
+
+	t.Run("unsupported_adapter", func(t *testing.T) {
+		if _, err := NewChannel(alice, bobID, AdapterType("invalid")); err == nil {
+			t.Errorf("NewChannel() err = nil, want non nil")
+		}
+	})
+}
+
+func Test_NewSession_netAdapters(t *testing.T) {
+
+	_, bob := idsWithCredentials()
+
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+
+			addr, cleanup := testNetAddr(t, network)
+			defer cleanup()
+
+			selfID := bob
+			adapterType := TCP
+			if network == "unix" {
+				selfID.ListenerEndpoint = addr
+				adapterType = Unix
+			}
+
+			_, listener, err := NewSession(selfID, adapterType, 10)
+			if err != nil {
+				t.Fatalf("NewSession() err = %v, want nil", err)
+			}
+			_ = listener.Shutdown(context.Background())
+		})
+	}
+}
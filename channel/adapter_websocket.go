@@ -18,6 +18,8 @@ package channel
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"net/http"
 	"net/url"
@@ -50,12 +52,26 @@ var wsConfig = wsConfigType{
 	writeWait:      10 * time.Second,
 	pongWait:       60 * time.Second,
 	pingPeriod:     ((60 * time.Second) * 9) / 10, //ping period = (pongWait * 9)/10
-	maxMessageSize: 1024,
+	maxMessageSize: 2048,                          //Encrypted messages are about 1.5 times the size of plain messages
 }
 
 type wsChannel struct {
 	*genericChannelAdapter
-	wsConn *websocket.Conn
+	wsConn   *websocket.Conn
+	peerCert *x509.Certificate //Certificate presented by the peer, nil if tls is not used
+}
+
+// peerCertificate returns the certificate presented by the peer during the tls handshake, if any.
+func (ch *wsChannel) peerCertificate() *x509.Certificate {
+	return ch.peerCert
+}
+
+// leafCertificate returns the leaf certificate of the peer from the tls connection state, if any.
+func leafCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
 }
 
 //Shutdown enforces the specific adapter to provide a mechanism to shutdown listener
@@ -89,8 +105,14 @@ func wsStartListener(addr, endpoint string, maxConn uint32) (
 		return srv, nil, err
 	}
 
+	//Connections are encrypted if tls is configured for the module
+	var srvListener net.Listener = tcpKeepAliveListener{ln.(*net.TCPListener)}
+	if tlsConfig.enabled {
+		srvListener = tls.NewListener(srvListener, tlsConfig.server)
+	}
+
 	go func() {
-		err := srv.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
+		err := srv.Serve(srvListener)
 		if err != nil {
 			//ErrServerClosed is returned when the server is shutdown by user intentionally
 			if err == http.ErrServerClosed {
@@ -122,7 +144,8 @@ func wsConnHandler(inConn chan *Instance, w http.ResponseWriter, r *http.Request
 			writeHandlerPipe: newHandlerPipe(handlerPipeModeWrite),
 			readHandlerPipe:  newHandlerPipe(handlerPipeModeRead),
 		},
-		wsConn: conn,
+		wsConn:   conn,
+		peerCert: leafCertificate(r.TLS),
 	}
 
 	//start read and write handler go routines
@@ -139,19 +162,31 @@ func wsConnHandler(inConn chan *Instance, w http.ResponseWriter, r *http.Request
 func newWsChannel(addr, endpoint string) (cha *Instance, err error) {
 
 	peerURL := url.URL{Scheme: "ws", Host: addr, Path: endpoint}
+	dialer := *websocket.DefaultDialer
+	if tlsConfig.enabled {
+		peerURL.Scheme = "wss"
+		dialer.TLSClientConfig = tlsConfig.client
+	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(peerURL.String(), nil)
+	conn, _, err := dialer.Dial(peerURL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
+	var peerCert *x509.Certificate
+	if tlsConn, ok := conn.UnderlyingConn().(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		peerCert = leafCertificate(&state)
+	}
+
 	ch := &wsChannel{
 		genericChannelAdapter: &genericChannelAdapter{
 			connected:        true,
 			writeHandlerPipe: newHandlerPipe(handlerPipeModeWrite),
 			readHandlerPipe:  newHandlerPipe(handlerPipeModeRead),
 		},
-		wsConn: conn,
+		wsConn:   conn,
+		peerCert: peerCert,
 	}
 
 	//start read and write handler go routines
@@ -186,39 +221,39 @@ func wsReadHandler(wsConfig wsConfigType, wsConn wsConnInterface, pipe handlerPi
 		return wsConn.SetReadDeadline(time.Now().Add(wsConfig.pongWait))
 	})
 
-	var message chMsgPkt
-
-	//Timeperiod to do repeat reads
-	ticker := time.NewTicker(100 * time.Millisecond)
+	//Read messages as they arrive, ReadJSON blocks until a message is received or the connection fails.
+	//Closing the connection (done by write handler when channel is closed) unblocks the read.
 	for {
+		//Decode each message into a new variable, as the previous message
+		//may still be in use by the reader of the pipe
+		var message chMsgPkt
+
+		//ReadJSON caused only two types of error
+		//1. Close error - when websocket connections is closed. It is permanent
+		//2. io.UnexpectedEOF error - due to json parsing
+		err := wsConn.ReadJSON(&message)
+
+		if err != nil && websocket.IsUnexpectedCloseError(err) {
+			//Websocket connection closed
+			logger.Info("Connection closed by peer -", err)
+			//If receiver has obtained lock, signal handler error it so that it exists
+			//And Lock will be available for Close()
+			pipe.handlerError <- err
+			go func() {
+				err := ch.Close()
+				if err != nil {
+					logger.Error("Error closing channel-", err)
+				}
+			}()
+			return
+		}
+
+		//Do not block on a pending message when asked to quit
+		msgPacket := jsonMsgPacket{message, err}
 		select {
+		case pipe.msgPacket <- msgPacket:
 		case <-pipe.quit:
-			ticker.Stop()
 			return
-		case <-ticker.C:
-			//ReadJSON caused only two types of error
-			//1. Close error - when websocket connections is closed. It is permanent
-			//2. io.UnexpectedEOF error - due to json parsing
-			err := wsConn.ReadJSON(&message)
-
-			if err != nil && websocket.IsUnexpectedCloseError(err) {
-				//Websocket connection closed
-				logger.Info("Connection closed by peer -", err)
-				ticker.Stop()
-				//If receiver has obtained lock, signal handler error it so that it exists
-				//And Lock will be available for Close()
-				pipe.handlerError <- err
-				go func() {
-					err := ch.Close()
-					if err != nil {
-						logger.Error("Error closing channel-", err)
-					}
-				}()
-				return
-			}
-
-			msgPacket := jsonMsgPacket{message, err}
-			pipe.msgPacket <- msgPacket
 		}
 	}
 }
@@ -77,6 +77,12 @@ func Test_wsStartListener(t *testing.T) {
 func Test_wsConnHandler(t *testing.T) {
 
 	t.Run("valid_client", func(t *testing.T) {
+
+		//Client below does not support encryption
+		requireEncryption = false
+		defer func() {
+			requireEncryption = true
+		}()
 		validClient := func(t *testing.T, addr, endpoint string, bobID identity.OffChainID) {
 
 			u := url.URL{Scheme: "ws", Host: addr, Path: endpoint}
@@ -89,15 +95,14 @@ func Test_wsConnHandler(t *testing.T) {
 				_ = c.Close()
 			}()
 
+			nonce, err := GenerateRandomNumber(identityNonceSize)
+			if err != nil {
+				t.Fatalf("GenerateRandomNumber() error = %v", err)
+			}
 			handshakeRequest := chMsgPkt{
 				Version:   "0.1",
 				MessageID: MsgIdentityRequest,
-				Message:   jsonMsgIdentity{bobID},
-			}
-			wantHandshakeResponse := chMsgPkt{
-				Version:   "0.1",
-				MessageID: MsgIdentityResponse,
-				Message:   jsonMsgIdentity{aliceID},
+				Message:   jsonMsgIdentity{ID: bobID, Nonce: nonce},
 			}
 			gotHandshakeResponse := chMsgPkt{}
 
@@ -111,10 +116,31 @@ func Test_wsConnHandler(t *testing.T) {
 				t.Fatalf("Error reading response from listner : %v", err)
 			}
 
-			//Reset timestamp to nil before comparison.
-			gotHandshakeResponse.Timestamp = time.Time{}
-			if !reflect.DeepEqual(gotHandshakeResponse, wantHandshakeResponse) {
-				t.Fatalf("Test signature mismatch.want %v, got %v", wantHandshakeResponse, gotHandshakeResponse)
+			response, ok := gotHandshakeResponse.Message.(jsonMsgIdentity)
+			if gotHandshakeResponse.MessageID != MsgIdentityResponse || !ok || !reflect.DeepEqual(response.ID, aliceID) {
+				t.Fatalf("Test signature mismatch.want %s from %v, got %v", MsgIdentityResponse, aliceID, gotHandshakeResponse)
+			}
+			transcript := identityTranscript{
+				requester:      bobID.OnChainID,
+				responder:      aliceID.OnChainID,
+				requesterNonce: nonce,
+				responderNonce: response.Nonce,
+			}
+			if err = verifyIdentityProof(response.Signature, identityProofResponder, transcript); err != nil {
+				t.Fatalf("Identity proof of listener invalid - %v", err)
+			}
+
+			signature, err := signIdentityProof(bobID, identityProofRequester, transcript)
+			if err != nil {
+				t.Fatalf("signIdentityProof() error = %v", err)
+			}
+			err = c.WriteJSON(chMsgPkt{
+				Version:   "0.1",
+				MessageID: MsgIdentityProof,
+				Message:   jsonMsgIdentity{ID: bobID, Signature: signature},
+			})
+			if err != nil {
+				t.Fatalf("Error writing proof to listner : %v", err)
 			}
 		}
 
@@ -123,7 +149,8 @@ func Test_wsConnHandler(t *testing.T) {
 
 		maxConn := uint32(100)
 
-		cs, listener, err := startListener(aliceID, maxConn, WebSocket)
+		alice, bob := idsWithCredentials()
+		cs, listener, err := startListener(alice, maxConn, WebSocket)
 		if err != nil {
 			t.Fatalf("startListener error - %v, want nil", err.Error())
 		}
@@ -133,9 +160,8 @@ func Test_wsConnHandler(t *testing.T) {
 
 		gotConnections := 0
 		for i := 1; i < 4; i++ {
+			validClient(t, addr, endpoint, bob)
 			ticker := time.After(500 * time.Millisecond)
-
-			validClient(t, addr, endpoint, bobID)
 			select {
 			case <-cs:
 				gotConnections = gotConnections + 1
@@ -904,3 +930,200 @@ func Test_wsWriteHandler(t *testing.T) {
 
 	})
 }
+
+func setupWsChannelPair(t testing.TB) (sender, receiver *Instance, listener Shutdown) {
+
+	listenerAddress, err := aliceID.ListenerLocalAddr()
+	if err != nil {
+		t.Fatalf("ListenerLocalAddr() err = %v, want nil", err)
+	}
+	listener, inConn, err := wsStartListener(listenerAddress, aliceID.ListenerEndpoint, 1)
+	if err != nil {
+		t.Fatalf("wsStartListener() err = %v, want nil", err)
+	}
+
+	sender, err = newWsChannel(aliceID.ListenerIPAddr, aliceID.ListenerEndpoint)
+	if err != nil {
+		_ = listener.Shutdown(context.Background())
+		t.Fatalf("newWsChannel() err = %v, want nil", err)
+	}
+
+	select {
+	case receiver = <-inConn:
+	case <-time.After(time.Second):
+		_ = listener.Shutdown(context.Background())
+		t.Fatalf("wsStartListener() - incoming connection not received")
+	}
+	return sender, receiver, listener
+}
+
+func Test_wsChannel_FullDuplex(t *testing.T) {
+
+	t.Run("write_while_read_pending", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		//Read on sender blocks until receiver responds
+		readResult := make(chan error, 1)
+		go func() {
+			msg, err := sender.adapter.Read()
+			if err == nil && msg.MessageID != MsgIdentityResponse {
+				err = fmt.Errorf("got message id %s, want %s", msg.MessageID, MsgIdentityResponse)
+			}
+			readResult <- err
+		}()
+
+		writeResult := make(chan error, 1)
+		go func() {
+			writeResult <- sender.adapter.Write(chMsgPkt{Version: "0.1", MessageID: MsgIdentityRequest, Message: jsonMsgIdentity{ID: aliceID}})
+		}()
+		select {
+		case err := <-writeResult:
+			if err != nil {
+				t.Fatalf("Write() err = %v, want nil", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Write() blocked by pending Read()")
+		}
+
+		msg, err := receiver.adapter.Read()
+		if err != nil || msg.MessageID != MsgIdentityRequest {
+			t.Fatalf("Read() = %v, %v, want %s", msg.MessageID, err, MsgIdentityRequest)
+		}
+		if err = receiver.adapter.Write(chMsgPkt{Version: "0.1", MessageID: MsgIdentityResponse, Message: jsonMsgIdentity{ID: aliceID}}); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+
+		select {
+		case err := <-readResult:
+			if err != nil {
+				t.Errorf("Read() err = %v, want nil", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Read() did not return after response was sent")
+		}
+
+		_ = sender.Close()
+		_ = receiver.Close()
+	})
+
+	t.Run("concurrent_read_write", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		msgCount := 10
+		errs := make(chan error, 4*msgCount)
+
+		//Each side writes messages from multiple goroutines while reading the messages of the other side
+		for _, ch := range []*Instance{sender, receiver} {
+			for i := 0; i < msgCount; i++ {
+				go func(ch *Instance) {
+					errs <- ch.adapter.Write(chMsgPkt{Version: "0.1", MessageID: MsgIdentityRequest, Message: jsonMsgIdentity{ID: aliceID}})
+				}(ch)
+			}
+			go func(ch *Instance) {
+				for i := 0; i < msgCount; i++ {
+					msg, err := ch.adapter.Read()
+					if err == nil && msg.MessageID != MsgIdentityRequest {
+						err = fmt.Errorf("got message id %s, want %s", msg.MessageID, MsgIdentityRequest)
+					}
+					errs <- err
+				}
+			}(ch)
+		}
+
+		for i := 0; i < 4*msgCount; i++ {
+			select {
+			case err := <-errs:
+				if err != nil {
+					t.Errorf("Read()/Write() err = %v, want nil", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Read()/Write() did not complete")
+			}
+		}
+
+		_ = sender.Close()
+		_ = receiver.Close()
+	})
+
+	t.Run("close_while_read_pending", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		readResult := make(chan error, 1)
+		go func() {
+			_, err := sender.adapter.Read()
+			readResult <- err
+		}()
+
+		//Give the read some time to start waiting for a message
+		time.Sleep(100 * time.Millisecond)
+		if err := sender.Close(); err != nil {
+			t.Fatalf("Close() err = %v, want nil", err)
+		}
+
+		select {
+		case err := <-readResult:
+			if err == nil {
+				t.Errorf("Read() err = nil, want non nil after close")
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Read() did not return after close")
+		}
+		if sender.Connected() {
+			t.Errorf("Connected() = true, want false after close")
+		}
+
+		_ = receiver.Close()
+	})
+}
+
+// BenchmarkWsChannel_NewVPCStateRoundTrip measures the round trip latency of a vpc state request
+// and its response over a websocket channel.
+//
+// With the earlier read handler that polled the connection every 100ms, a round trip took about 100ms.
+// With the blocking read loop, it is in the order of tens of microseconds on a local connection.
+func BenchmarkWsChannel_NewVPCStateRoundTrip(b *testing.B) {
+
+	sender, receiver, listener := setupWsChannelPair(b)
+	defer func() {
+		_ = sender.Close()
+		_ = receiver.Close()
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	//Receiver accepts every vpc state request
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			state, err := receiver.NewVPCStateRead()
+			if err == nil {
+				err = receiver.NewVPCStateRespond(state, MessageStatusAccept)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, status, err := sender.NewVPCStateRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			select {
+			case errRead := <-errs:
+				b.Fatalf("NewVPCStateRead()/NewVPCStateRespond() err = %v", errRead)
+			default:
+			}
+			b.Fatalf("NewVPCStateRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+	}
+}
@@ -33,11 +33,20 @@ func SetLogger(moduleLogger log.LoggerInterface) {
 type Config struct {
 	Logger  log.Config
 	maxConn uint64
+
+	tlsCertFile   string //Certificate for tls, tls is disabled if not set
+	tlsKeyFile    string //Private key of the tls certificate
+	tlsCAFile     string //CA bundle to verify the peer certificates, system roots are used if not set
+	tlsClientAuth bool   //Require and present certificates for both listener and dialer
+	tlsBindID     bool   //Require the peer certificate to be issued for its on-chain id
+
+	requireEncryption bool //Reject peers that do not support end to end encryption of messages
 }
 
 // ConfigDefault represents the default configuration for this module.
 var ConfigDefault = Config{
-	maxConn: 100,
+	maxConn:           100,
+	requireEncryption: true,
 }
 
 // GetFlagSet initializes and returns a flagset with flags for configuring this module.
@@ -51,6 +60,18 @@ func GetFlagSet() *pflag.FlagSet {
 		"channelLogLevel", "", "Log level for channel module")
 	chFlags.String(
 		"channelLogBackend", "", "Log Backend for channel module")
+	chFlags.String(
+		"channelTLSCert", "", "TLS certificate file for channel connections, tls is disabled if not set")
+	chFlags.String(
+		"channelTLSKey", "", "TLS private key file for channel connections")
+	chFlags.String(
+		"channelTLSCA", "", "CA bundle to verify certificates of peers, system roots are used if not set")
+	chFlags.Bool(
+		"channelTLSClientAuth", false, "Require certificates from peers on incoming channel connections")
+	chFlags.Bool(
+		"channelTLSBindID", false, "Require certificate of peer to be issued for its on-chain id (enables client auth)")
+	chFlags.Bool(
+		"channelRequireEncryption", true, "Reject peers that do not support end to end encryption of channel messages")
 	return &chFlags
 }
 
@@ -61,6 +82,12 @@ func ParseFlags(flagSet *pflag.FlagSet, cfg *Config) (err error) {
 		{Name: "channelLogLevel", Ptr: &cfg.Logger.Level},
 		{Name: "channelLogBackend", Ptr: &cfg.Logger.Backend},
 		{Name: "maxChConn", Ptr: &cfg.maxConn},
+		{Name: "channelTLSCert", Ptr: &cfg.tlsCertFile},
+		{Name: "channelTLSKey", Ptr: &cfg.tlsKeyFile},
+		{Name: "channelTLSCA", Ptr: &cfg.tlsCAFile},
+		{Name: "channelTLSClientAuth", Ptr: &cfg.tlsClientAuth},
+		{Name: "channelTLSBindID", Ptr: &cfg.tlsBindID},
+		{Name: "channelRequireEncryption", Ptr: &cfg.requireEncryption},
 	}
 
 	return config.LookUpMultiple(flagSet, flagsToParse)
@@ -23,7 +23,9 @@ import (
 func Test_FlagSet(t *testing.T) {
 
 	flagSet := GetFlagSet()
-	requiredFlags := []string{"channelLogLevel", "channelLogBackend", "maxChConn"}
+	requiredFlags := []string{"channelLogLevel", "channelLogBackend", "maxChConn",
+		"channelTLSCert", "channelTLSKey", "channelTLSCA", "channelTLSClientAuth", "channelTLSBindID",
+		"channelRequireEncryption"}
 
 	failed := false
 	t.Run("GetFlagset", func(t *testing.T) {
@@ -40,9 +42,14 @@ func Test_FlagSet(t *testing.T) {
 	}
 
 	sampleValues := map[string]string{
-		"channelLogLevel":   "Debug",
-		"channelLogBackend": "stdout",
-		"maxChConn":         "100",
+		"channelLogLevel":          "Debug",
+		"channelLogBackend":        "stdout",
+		"maxChConn":                "100",
+		"channelTLSCert":           "cert.pem",
+		"channelTLSKey":            "key.pem",
+		"channelTLSCA":             "ca.pem",
+		"channelTLSBindID":         "true",
+		"channelRequireEncryption": "false",
 	}
 	for key, value := range sampleValues {
 		err := flagSet.Set(key, value)
@@ -51,4 +58,20 @@ func Test_FlagSet(t *testing.T) {
 		}
 	}
 
+	t.Run("ParseFlags", func(t *testing.T) {
+		cfg := ConfigDefault
+		if err := ParseFlags(flagSet, &cfg); err != nil {
+			t.Fatalf("ParseFlags() err = %v, want nil", err)
+		}
+		if cfg.tlsCertFile != "cert.pem" || cfg.tlsKeyFile != "key.pem" || cfg.tlsCAFile != "ca.pem" {
+			t.Errorf("ParseFlags() tls files = %s, %s, %s, want cert.pem, key.pem, ca.pem", cfg.tlsCertFile, cfg.tlsKeyFile, cfg.tlsCAFile)
+		}
+		if !cfg.tlsBindID || cfg.tlsClientAuth {
+			t.Errorf("ParseFlags() tlsBindID = %v, tlsClientAuth = %v, want true, false", cfg.tlsBindID, cfg.tlsClientAuth)
+		}
+		if cfg.requireEncryption {
+			t.Errorf("ParseFlags() requireEncryption = true, want false")
+		}
+	})
+
 }
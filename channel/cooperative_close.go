@@ -0,0 +1,149 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+// ProposeFinalState proposes the latest vpc state of the channel as the final state to the peer using a close channel request,
+// as the first step in closing the channel cooperatively. It returns the final state, signed by both the users,
+// that should be used to settle the channel on the blockchain.
+//
+// If no vpc state has been set yet, a vpc state with version 1 and the amounts blocked in msc base state is proposed
+// and set as the current vpc state on acceptance. If msc base state is also not set, an empty state is proposed,
+// as there is nothing to be settled using the vpc.
+// An error is returned if the channel is not open or the peer declines the request.
+func (inst *Instance) ProposeFinalState(ctx context.Context) (finalState VPCStateSigned, err error) {
+
+	if inst.Status() != Open {
+		return VPCStateSigned{}, fmt.Errorf("Channel status is %s, want %s", inst.Status(), Open)
+	}
+
+	proposal, isNew, err := inst.finalState()
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	if isNew {
+		if err = proposal.AddSign(inst.selfID, inst.RoleChannel()); err != nil {
+			return VPCStateSigned{}, err
+		}
+	}
+
+	finalState, status, reason, err := inst.CloseChannelRequestContext(ctx, proposal)
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	if status != MessageStatusAccept {
+		return VPCStateSigned{}, fmt.Errorf("Close channel request declined by peer - %s", reason)
+	}
+	if !equalVPCStates(proposal.VPCState, finalState.VPCState) {
+		return VPCStateSigned{}, fmt.Errorf("Final state modified by peer")
+	}
+
+	if isNew {
+		if err = inst.SetCurrentVPCState(finalState); err != nil {
+			return VPCStateSigned{}, err
+		}
+	}
+	return finalState, nil
+}
+
+// AgreeFinalState checks if the final state proposed by the peer in a close channel request matches the latest vpc state
+// of the channel (as described in ProposeFinalState) and responds with accept along with the final state signed by both the users.
+// Else it responds with decline and returns an error.
+func (inst *Instance) AgreeFinalState(proposal VPCStateSigned) (finalState VPCStateSigned, err error) {
+
+	finalState, err = inst.agreeFinalState(proposal)
+	if err != nil {
+		if errRespond := inst.CloseChannelRespond(proposal, MessageStatusDecline, err.Error()); errRespond != nil {
+			logger.Error("Error declining close channel request -", errRespond)
+		}
+		return VPCStateSigned{}, fmt.Errorf("Close channel request declined - %s", err.Error())
+	}
+	return finalState, inst.CloseChannelRespond(finalState, MessageStatusAccept, "")
+}
+
+func (inst *Instance) agreeFinalState(proposal VPCStateSigned) (finalState VPCStateSigned, err error) {
+
+	if inst.Status() != Open {
+		return VPCStateSigned{}, fmt.Errorf("Channel status is %s, want %s", inst.Status(), Open)
+	}
+
+	want, isNew, err := inst.finalState()
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	if !equalVPCStates(want.VPCState, proposal.VPCState) {
+		return VPCStateSigned{}, fmt.Errorf("Final state with version %v does not match the latest state with version %v",
+			proposal.VPCState.Version, want.VPCState.Version)
+	}
+	if !isNew {
+		return want, nil
+	}
+
+	//Signature of the peer is verified when the state is set
+	if err = proposal.AddSign(inst.selfID, inst.RoleChannel()); err != nil {
+		return VPCStateSigned{}, err
+	}
+	if err = inst.SetCurrentVPCState(proposal); err != nil {
+		return VPCStateSigned{}, err
+	}
+	return proposal, nil
+}
+
+// finalState returns the vpc state with which the channel should be settled, as seen by this user.
+// If no vpc state has been set yet, an unsigned state with version 1 and the amounts blocked in msc base state
+// is returned and isNew is set to true. If msc base state is also not set, an empty state is returned.
+func (inst *Instance) finalState() (state VPCStateSigned, isNew bool, err error) {
+
+	if current := inst.CurrentVpcState(); current.VPCState.Version != nil {
+		return current, false, nil
+	}
+
+	base := inst.MscBaseState().MSContractBaseState
+	if base.Version == nil {
+		return VPCStateSigned{}, false, nil
+	}
+	id, err := inst.vpcStateID()
+	if err != nil {
+		return VPCStateSigned{}, false, err
+	}
+	state = VPCStateSigned{
+		VPCState: VPCState{
+			ID:              id,
+			Version:         big.NewInt(1),
+			BlockedSender:   new(big.Int).Set(base.BlockedSender),
+			BlockedReceiver: new(big.Int).Set(base.BlockedReceiver),
+		},
+	}
+	return state, true, nil
+}
+
+// equalVPCStates returns true if both the states are empty or if they have the same contents.
+func equalVPCStates(a, b VPCState) bool {
+
+	complete := func(state VPCState) bool {
+		return state.Version != nil && state.BlockedSender != nil && state.BlockedReceiver != nil
+	}
+	if !complete(a) || !complete(b) {
+		return a.Version == nil && b.Version == nil
+	}
+	return a.Equal(b)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+// setOpen moves the status of the new channel ch through the opening procedure to Open.
+func setOpen(t *testing.T, ch *Instance) {
+	for _, status := range []Status{PreSetup, Setup, Init, Open} {
+		if !ch.SetStatus(status) {
+			t.Fatalf("Instance.SetStatus(%s) = false, want true", status)
+		}
+	}
+}
+
+// agreeFinalState reads the close channel request on ch and responds to it using AgreeFinalState.
+// If modify is not nil, it is applied to the proposed state before responding.
+func agreeFinalState(ch *Instance, modify func(*VPCStateSigned)) (finalState VPCStateSigned, err error) {
+
+	proposal, err := ch.CloseChannelRead()
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	if modify != nil {
+		modify(&proposal)
+	}
+	return ch.AgreeFinalState(proposal)
+}
+
+func Test_Instance_ProposeFinalState(t *testing.T) {
+
+	sender, receiver, listener := setupPaymentChannels(t, 10, 20)
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	type result struct {
+		state VPCStateSigned
+		err   error
+	}
+	agreed := make(chan result, 1)
+
+	//Not open, request is not sent to the peer
+	if _, err := sender.ProposeFinalState(context.Background()); err == nil {
+		t.Fatalf("Instance.ProposeFinalState() on channel not open error = nil, want non nil")
+	}
+	setOpen(t, sender)
+	setOpen(t, receiver)
+
+	//Modified by the peer, declined
+	go func() {
+		state, err := agreeFinalState(receiver, func(proposal *VPCStateSigned) {
+			proposal.VPCState.BlockedSender = big.NewInt(0)
+			proposal.VPCState.BlockedReceiver = big.NewInt(30)
+		})
+		agreed <- result{state, err}
+	}()
+	if _, err := sender.ProposeFinalState(context.Background()); err == nil {
+		t.Errorf("Instance.ProposeFinalState() declined by peer error = nil, want non nil")
+	}
+	if got := <-agreed; got.err == nil {
+		t.Errorf("Instance.AgreeFinalState() with modified state error = nil, want non nil")
+	}
+	if sender.CurrentVpcState().VPCState.Version != nil || receiver.CurrentVpcState().VPCState.Version != nil {
+		t.Errorf("Instance.ProposeFinalState() declined by peer - current vpc state set")
+	}
+
+	//No vpc state, initial state with the amounts in msc base state is agreed
+	go func() {
+		state, err := agreeFinalState(receiver, nil)
+		agreed <- result{state, err}
+	}()
+	finalState, err := sender.ProposeFinalState(context.Background())
+	if err != nil {
+		t.Fatalf("Instance.ProposeFinalState() error = %v, want nil", err)
+	}
+	got := <-agreed
+	if got.err != nil {
+		t.Fatalf("Instance.AgreeFinalState() error = %v, want nil", got.err)
+	}
+	if finalState.VPCState.Version.Cmp(big.NewInt(1)) != 0 || finalState.VPCState.BlockedSender.Cmp(big.NewInt(10)) != 0 ||
+		finalState.VPCState.BlockedReceiver.Cmp(big.NewInt(20)) != 0 {
+		t.Errorf("Instance.ProposeFinalState() = %v, want version 1 with blocked 10, 20", finalState.VPCState)
+	}
+	if !got.state.Equal(finalState) {
+		t.Errorf("Instance.AgreeFinalState() = %v, want %v", got.state, finalState)
+	}
+	if current := sender.CurrentVpcState(); !current.Equal(finalState) {
+		t.Errorf("Instance.ProposeFinalState() current vpc state of sender not updated")
+	}
+	if current := receiver.CurrentVpcState(); !current.Equal(finalState) {
+		t.Errorf("Instance.AgreeFinalState() current vpc state of receiver not updated")
+	}
+
+	//Latest vpc state is agreed as it is
+	respondErr := make(chan error, 1)
+	go func() {
+		_, err := respondVPCState(receiver, MessageStatusAccept)
+		respondErr <- err
+	}()
+	latest, err := sender.Pay(big.NewInt(4))
+	if err != nil {
+		t.Fatalf("Instance.Pay() error = %v, want nil", err)
+	}
+	if err = <-respondErr; err != nil {
+		t.Fatalf("respondVPCState() error = %v", err)
+	}
+
+	go func() {
+		state, err := agreeFinalState(receiver, nil)
+		agreed <- result{state, err}
+	}()
+	finalState, err = sender.ProposeFinalState(context.Background())
+	if err != nil {
+		t.Fatalf("Instance.ProposeFinalState() error = %v, want nil", err)
+	}
+	if got = <-agreed; got.err != nil {
+		t.Fatalf("Instance.AgreeFinalState() error = %v, want nil", got.err)
+	}
+	if !finalState.Equal(latest) || !got.state.Equal(latest) {
+		t.Errorf("Instance.ProposeFinalState() = %v, want latest state %v", finalState, latest)
+	}
+}
+
+func Test_equalVPCStates(t *testing.T) {
+
+	state := VPCState{
+		ID:              []byte("some-valid-id"),
+		Version:         big.NewInt(1),
+		BlockedSender:   big.NewInt(10),
+		BlockedReceiver: big.NewInt(20),
+	}
+	otherVersion := state
+	otherVersion.Version = big.NewInt(2)
+	incomplete := state
+	incomplete.BlockedSender = nil
+
+	tests := []struct {
+		name string
+		a, b VPCState
+		want bool
+	}{
+		{"both-empty", VPCState{}, VPCState{}, true},
+		{"same", state, state, true},
+		{"different-version", state, otherVersion, false},
+		{"one-empty", state, VPCState{}, false},
+		{"incomplete", state, incomplete, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := equalVPCStates(tt.a, tt.b); got != tt.want {
+				t.Errorf("equalVPCStates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
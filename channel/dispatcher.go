@@ -0,0 +1,300 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+// Dispatcher continuously reads the messages on a channel and passes each message to the handler
+// registered for its message id.
+//
+// Handlers can be registered for request messages. Messages for which no handler is registered
+// (including the responses to requests made on the channel) are buffered, so that they can be read by
+// the Read and Request methods of the channel as usual. If the buffer is full, the message is rejected:
+// request messages are aborted with code AbortInternalError and other messages are dropped.
+//
+// Handlers are called one at a time in the order in which the messages were received, in a routine separate from
+// the one reading the messages. So a handler can make a request on the channel and wait for its response.
+// If a handler returns an error without responding to the request (with a response or an abort), the request is
+// aborted with code AbortInternalError, so that the peer does not wait for the response until it times out.
+//
+// Dispatcher runs until the channel is closed. If an error occurs when reading a message
+// (e.g invalid message from peer), the channel is closed as the message sequence can no longer be relied upon.
+type Dispatcher struct {
+	ch *Instance
+
+	handlers  map[MessageID]func(chMsgPkt) error //Handlers mapped by message id of the request
+	responded bool                               //Set when a response is sent on the channel, while a handler is running
+	access    sync.Mutex                         //Access control for handlers map and responded
+
+	pending  chan chMsgPkt //Messages without handler, to be read by Read and Request methods of the channel
+	handling chan chMsgPkt //Messages to be passed to the handlers
+
+	err  error         //Error due to which the dispatcher stopped, set before done is closed
+	done chan struct{} //Closed when the dispatcher stops
+}
+
+// NewDispatcher initialises a dispatcher for the channel ch. Upto bufferSize messages without handler and bufferSize
+// messages waiting to be handled are buffered. Handlers should be registered and dispatcher should be started
+// by calling Start.
+func NewDispatcher(ch *Instance, bufferSize int) *Dispatcher {
+	return &Dispatcher{
+		ch:       ch,
+		handlers: make(map[MessageID]func(chMsgPkt) error),
+		pending:  make(chan chMsgPkt, bufferSize),
+		handling: make(chan chMsgPkt, bufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// HandleNewChannelRequest registers the handler for new channel requests.
+// Handler is called with the message protocol version, contract store version and terms in the request
+// and is expected to respond using NewChannelRespond.
+func (d *Dispatcher) HandleNewChannelRequest(handler func(msgProtocolVersion string, contractStoreVersion []byte, terms Terms) error) {
+	d.register(MsgNewChannelRequest, func(message chMsgPkt) error {
+		msg, ok := message.Message.(jsonMsgNewChannel)
+		if !ok || !containsStatus(RequestStatusList, msg.Status) {
+			return fmt.Errorf("Invalid new channel request")
+		}
+		return handler(msg.MsgProtocolVersion, msg.ContractStoreVersion, msg.Terms)
+	})
+}
+
+// HandleSessionIDRequest registers the handler for session id requests.
+// Handler is called with the session id in the request and is expected to respond using SessionIDRespond.
+func (d *Dispatcher) HandleSessionIDRequest(handler func(sid SessionID) error) {
+	d.register(MsgSessionIDRequest, func(message chMsgPkt) error {
+		msg, ok := message.Message.(jsonMsgSessionID)
+		if !ok || !containsStatus(RequestStatusList, msg.Status) {
+			return fmt.Errorf("Invalid session id request")
+		}
+		return handler(msg.Sid)
+	})
+}
+
+// HandleContractAddrRequest registers the handler for contract address requests.
+// Handler is called with the address and type of contract in the request and is expected to respond using ContractAddrRespond.
+func (d *Dispatcher) HandleContractAddrRequest(handler func(addr types.Address, id contract.Handler) error) {
+	d.register(MsgContractAddrRequest, func(message chMsgPkt) error {
+		msg, ok := message.Message.(jsonMsgContractAddr)
+		if !ok || !containsStatus(RequestStatusList, msg.Status) {
+			return fmt.Errorf("Invalid contract address request")
+		}
+		return handler(msg.Addr, msg.ContractType)
+	})
+}
+
+// HandleMSCBaseStateRequest registers the handler for new msc base state requests.
+// Handler is called with the state in the request and is expected to respond using NewMSCBaseStateRespond.
+func (d *Dispatcher) HandleMSCBaseStateRequest(handler func(state MSCBaseStateSigned) error) {
+	d.register(MsgMSCBaseStateRequest, func(message chMsgPkt) error {
+		msg, ok := message.Message.(jsonMsgMSCBaseState)
+		if !ok || !containsStatus(RequestStatusList, msg.Status) {
+			return fmt.Errorf("Invalid msc base state request")
+		}
+		return handler(msg.SignedStateVal)
+	})
+}
+
+// HandleVPCStateRequest registers the handler for new vpc state requests.
+// Handler is called with the state in the request and is expected to respond using NewVPCStateRespond.
+func (d *Dispatcher) HandleVPCStateRequest(handler func(state VPCStateSigned) error) {
+	d.register(MsgVPCStateRequest, func(message chMsgPkt) error {
+		msg, ok := message.Message.(jsonMsgVPCState)
+		if !ok || !containsStatus(RequestStatusList, msg.Status) {
+			return fmt.Errorf("Invalid vpc state request")
+		}
+		return handler(msg.SignedStateVal)
+	})
+}
+
+// HandleCloseChannelRequest registers the handler for close channel requests.
+// Handler is called with the final vpc state in the request and is expected to respond using CloseChannelRespond.
+func (d *Dispatcher) HandleCloseChannelRequest(handler func(finalState VPCStateSigned) error) {
+	d.register(MsgCloseChannelRequest, func(message chMsgPkt) error {
+		msg, ok := message.Message.(jsonMsgCloseChannel)
+		if !ok || !containsStatus(RequestStatusList, msg.Status) {
+			return fmt.Errorf("Invalid close channel request")
+		}
+		return handler(msg.FinalState)
+	})
+}
+
+func (d *Dispatcher) register(id MessageID, handler func(chMsgPkt) error) {
+
+	d.access.Lock()
+	defer d.access.Unlock()
+
+	d.handlers[id] = handler
+}
+
+// setResponded records if a response was sent on the channel, since the current handler was called.
+func (d *Dispatcher) setResponded(responded bool) {
+
+	d.access.Lock()
+	defer d.access.Unlock()
+
+	d.responded = responded
+}
+
+func (d *Dispatcher) hasResponded() bool {
+
+	d.access.Lock()
+	defer d.access.Unlock()
+
+	return d.responded
+}
+
+func (d *Dispatcher) handler(id MessageID) (handler func(chMsgPkt) error, present bool) {
+
+	d.access.Lock()
+	defer d.access.Unlock()
+
+	handler, present = d.handlers[id]
+	return handler, present
+}
+
+// Start attaches the dispatcher to the channel and starts reading messages in the background.
+// Only one dispatcher can be attached to a channel.
+func (d *Dispatcher) Start() (err error) {
+
+	if !d.ch.Connected() {
+		return fmt.Errorf("Channel not connected")
+	}
+
+	d.ch.access.Lock()
+	if d.ch.dispatcher != nil {
+		d.ch.access.Unlock()
+		return fmt.Errorf("Dispatcher already running on the channel")
+	}
+	d.ch.dispatcher = d
+	d.ch.access.Unlock()
+
+	go d.readLoop()
+	go d.handleLoop()
+	return nil
+}
+
+// Done returns a channel that is closed when the dispatcher stops.
+func (d *Dispatcher) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the error due to which the dispatcher stopped. It returns nil if the dispatcher is still running.
+func (d *Dispatcher) Err() error {
+	select {
+	case <-d.done:
+		return d.err
+	default:
+		return nil
+	}
+}
+
+func (d *Dispatcher) readLoop() {
+
+	for {
+		message, err := d.ch.adapter.Read()
+		if err != nil {
+			if d.ch.Connected() {
+				logger.Error("Error reading message, closing channel with", d.ch.PeerID(), "-", err)
+				if errClose := d.ch.Close(); errClose != nil {
+					logger.Error("Error closing channel -", errClose)
+				}
+			}
+			d.err = err
+			close(d.done)
+			return
+		}
+
+		queue := d.pending
+		if _, present := d.handler(message.MessageID); present {
+			queue = d.handling
+		}
+		select {
+		case queue <- message:
+		default:
+			d.reject(message)
+		}
+	}
+}
+
+func (d *Dispatcher) handleLoop() {
+
+	for {
+		select {
+		case message := <-d.handling:
+			handler, _ := d.handler(message.MessageID)
+			d.setResponded(false)
+			if err := handler(message); err != nil {
+				logger.Error("Error handling", message.MessageID, "from", d.ch.PeerID(), "-", err)
+				if !d.hasResponded() {
+					d.abort(message, err.Error())
+				}
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// reject aborts the message if it is a request, else drops it.
+func (d *Dispatcher) reject(message chMsgPkt) {
+
+	logger.Info("Message buffer full, rejecting", message.MessageID, "from", d.ch.PeerID())
+	d.abort(message, "message buffer full")
+}
+
+// abort aborts the message with code internal error and reason, if it is a request.
+//
+// Abort is written directly on the adapter, as it is not a response from the handler that may be running
+// when a message is rejected.
+func (d *Dispatcher) abort(message chMsgPkt, reason string) {
+
+	if !isRequest(message.MessageID) {
+		return
+	}
+	logger.Debug("Aborting", message.MessageID, "with code", AbortInternalError, "-", reason)
+	if err := d.ch.adapter.Write(abortMessage(message.MessageID, AbortInternalError, reason)); err != nil {
+		logger.Error("Error aborting", message.MessageID, "-", err)
+	}
+}
+
+// read returns the next message without a handler, waiting only until ctx is done.
+// Behaviour when ctx is done is same as that of readContext method of the channel.
+func (d *Dispatcher) read(ctx context.Context, op string) (message chMsgPkt, err error) {
+
+	select {
+	case message = <-d.pending:
+		return message, nil
+	case <-d.done:
+		//Messages received before the dispatcher stopped can still be read
+		select {
+		case message = <-d.pending:
+			return message, nil
+		default:
+			return chMsgPkt{}, d.err
+		}
+	case <-ctx.Done():
+		return chMsgPkt{}, d.ch.timeout(ctx, op)
+	}
+}
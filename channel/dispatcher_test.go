@@ -0,0 +1,297 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_Dispatcher(t *testing.T) {
+
+	t.Run("handled_request", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		dispatcher := NewDispatcher(receiver, 1)
+		dispatcher.HandleVPCStateRequest(func(state VPCStateSigned) error {
+			return receiver.NewVPCStateRespond(state, MessageStatusAccept)
+		})
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			_, status, err := sender.NewVPCStateRequest(testVPCState)
+			if err != nil || status != MessageStatusAccept {
+				t.Fatalf("NewVPCStateRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+			}
+		}
+	})
+
+	t.Run("request_from_handler", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		//On receiving a vpc state request, receiver makes its own request before responding.
+		//Response to its request should be available to the handler while the dispatcher is running.
+		dispatcher := NewDispatcher(receiver, 1)
+		dispatcher.HandleVPCStateRequest(func(state VPCStateSigned) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, status, err := receiver.NewMSCBaseStateRequestContext(ctx, MSCBaseStateSigned{})
+			if err != nil {
+				return err
+			}
+			return receiver.NewVPCStateRespond(state, status)
+		})
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			state, err := sender.NewMSCBaseStateRead()
+			if err == nil {
+				err = sender.NewMSCBaseStateRespond(state, MessageStatusAccept)
+			}
+			errs <- err
+		}()
+
+		_, status, err := sender.NewVPCStateRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			t.Fatalf("NewVPCStateRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+		if err = <-errs; err != nil {
+			t.Errorf("NewMSCBaseStateRead()/NewMSCBaseStateRespond() err = %v, want nil", err)
+		}
+	})
+
+	t.Run("unhandled_request_buffered", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		dispatcher := NewDispatcher(receiver, 1)
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			state, err := receiver.NewVPCStateRead()
+			if err == nil {
+				err = receiver.NewVPCStateRespond(state, MessageStatusAccept)
+			}
+			errs <- err
+		}()
+
+		_, status, err := sender.NewVPCStateRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			t.Fatalf("NewVPCStateRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+		if err = <-errs; err != nil {
+			t.Errorf("NewVPCStateRead()/NewVPCStateRespond() err = %v, want nil", err)
+		}
+	})
+
+	t.Run("unhandled_request_rejected", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		//No buffer, so request without handler is aborted
+		dispatcher := NewDispatcher(receiver, 0)
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		_, _, err := sender.NewVPCStateRequest(testVPCState)
+		if abortErr, ok := err.(*AbortError); !ok || abortErr.Code != AbortInternalError {
+			t.Fatalf("NewVPCStateRequest() err = %v, want *AbortError with code %v", err, AbortInternalError)
+		}
+	})
+
+	t.Run("handler_error", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		//First request fails before responding and the second one after responding
+		requests := 0
+		dispatcher := NewDispatcher(receiver, 1)
+		dispatcher.HandleCloseChannelRequest(func(finalState VPCStateSigned) error {
+			requests++
+			if requests == 1 {
+				return fmt.Errorf("handler error")
+			}
+			if err := receiver.CloseChannelRespond(finalState, MessageStatusAccept, ""); err != nil {
+				return err
+			}
+			return fmt.Errorf("handler error after response")
+		})
+		dispatcher.HandleVPCStateRequest(func(state VPCStateSigned) error {
+			return receiver.NewVPCStateRespond(state, MessageStatusAccept)
+		})
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		_, _, _, err := sender.CloseChannelRequest(testVPCState)
+		abortErr, ok := err.(*AbortError)
+		if !ok || abortErr.Code != AbortInternalError || abortErr.Reason != "handler error" {
+			t.Fatalf("CloseChannelRequest() err = %v, want *AbortError with code %v and reason %q", err,
+				AbortInternalError, "handler error")
+		}
+		_, status, _, err := sender.CloseChannelRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			t.Fatalf("CloseChannelRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+
+		//No abort is sent after the response, so the next response is for the next request
+		_, status, err = sender.NewVPCStateRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			t.Fatalf("NewVPCStateRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+	})
+
+	t.Run("abort_from_handler", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		//First request is aborted by the handler, which then returns an error
+		requests := 0
+		dispatcher := NewDispatcher(receiver, 1)
+		dispatcher.HandleVPCStateRequest(func(state VPCStateSigned) error {
+			requests++
+			if requests == 1 {
+				if err := receiver.Abort(MsgVPCStateRequest, AbortPolicyRejection, "rejected"); err != nil {
+					return err
+				}
+				return fmt.Errorf("handler error after abort")
+			}
+			return receiver.NewVPCStateRespond(state, MessageStatusAccept)
+		})
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		_, _, err := sender.NewVPCStateRequest(testVPCState)
+		abortErr, ok := err.(*AbortError)
+		if !ok || abortErr.Code != AbortPolicyRejection {
+			t.Fatalf("NewVPCStateRequest() err = %v, want *AbortError with code %v", err, AbortPolicyRejection)
+		}
+
+		//Only the abort is sent for the first request, so the next response is for the next request
+		_, status, err := sender.NewVPCStateRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			t.Fatalf("NewVPCStateRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+	})
+
+	t.Run("close_channel_request", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = receiver.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		dispatcher := NewDispatcher(receiver, 0)
+		dispatcher.HandleCloseChannelRequest(func(finalState VPCStateSigned) error {
+			return receiver.CloseChannelRespond(finalState, MessageStatusAccept, "")
+		})
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+
+		_, status, _, err := sender.CloseChannelRequest(testVPCState)
+		if err != nil || status != MessageStatusAccept {
+			t.Fatalf("CloseChannelRequest() = %v, %v, want %v, nil", status, err, MessageStatusAccept)
+		}
+
+		//Request without handler is aborted, as there is no buffer
+		_, _, err = sender.NewVPCStateRequest(testVPCState)
+		if abortErr, ok := err.(*AbortError); !ok || abortErr.Code != AbortInternalError {
+			t.Fatalf("NewVPCStateRequest() err = %v, want *AbortError with code %v", err, AbortInternalError)
+		}
+	})
+
+	t.Run("stop_on_close", func(t *testing.T) {
+		sender, receiver, listener := setupWsChannelPair(t)
+		defer func() {
+			_ = sender.Close()
+			_ = listener.Shutdown(context.Background())
+		}()
+
+		dispatcher := NewDispatcher(receiver, 1)
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Dispatcher.Start() err = %v, want nil", err)
+		}
+		if err := dispatcher.Err(); err != nil {
+			t.Errorf("Dispatcher.Err() = %v, want nil while running", err)
+		}
+		if err := NewDispatcher(receiver, 1).Start(); err == nil {
+			t.Errorf("Dispatcher.Start() second dispatcher err = nil, want non nil")
+		}
+
+		_ = receiver.Close()
+		select {
+		case <-dispatcher.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Dispatcher did not stop after channel was closed")
+		}
+		if err := dispatcher.Err(); err == nil {
+			t.Errorf("Dispatcher.Err() = nil, want non nil after stop")
+		}
+		if _, err := receiver.NewVPCStateRead(); err == nil {
+			t.Errorf("NewVPCStateRead() err = nil, want non nil after dispatcher stopped")
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		_, adapter := setupMockChannel()
+		ch := &Instance{adapter: adapter}
+
+		if err := NewDispatcher(ch, 1).Start(); err == nil {
+			t.Errorf("Dispatcher.Start() err = nil, want non nil")
+		}
+	})
+}
@@ -18,5 +18,17 @@
 //
 // It defines the required primitives, message packets & its parsers as well the adapter implementations.
 // The adapter provides functions for initialising listeners that will handle new incoming connections
-// and to initiate outgoing connections.
+// and to initiate outgoing connections. Transports other than the built-in ones can be plugged in
+// by registering an adapter type with RegisterAdapter.
+//
+// Identities of the users are verified when a connection is established. Ephemeral keys exchanged along with the
+// identities are used to encrypt all further messages, irrespective of the adapter used for the connection.
+//
+// A Dispatcher can be run on a channel to handle the requests from the peer as they arrive,
+// instead of reading a specific message at a time.
+//
+// An open channel is closed cooperatively by agreeing on the final vpc state with the peer using ProposeFinalState
+// and AgreeFinalState, after which it can be settled on the blockchain.
+//
+// The state of channels can be persisted in a Store, so that the channels can be restored after a restart of the node.
 package channel
@@ -0,0 +1,238 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/direct-state-transfer/dst-go/ethereum/keystore"
+)
+
+// requireEncryption configures if connections with peers that do not support encryption should be rejected.
+// It is enabled by default, so that a connection cannot be downgraded to unencrypted by a peer or an attacker in between.
+var requireEncryption = true
+
+// Labels used for deriving the key for each direction of communication from the shared secret.
+var (
+	keyLabelRequesterToResponder = []byte("dst-go channel key requester to responder")
+	keyLabelResponderToRequester = []byte("dst-go channel key responder to requester")
+)
+
+// keyExchange holds the ephemeral keys used for key agreement during the identity exchange.
+//
+// Each user generates a fresh secp256k1 key pair for the connection and sends the public key in the identity
+// messages. Public keys of both the users are included in the identity proofs. Hence they are authenticated by
+// the on-chain ids of the users, without the need for a certificate authority.
+type keyExchange struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  []byte //Byte representation of the ephemeral public key sent to the peer
+	peerKey    []byte //Byte representation of the ephemeral public key received from the peer
+}
+
+func newKeyExchange() (*keyExchange, error) {
+
+	privateKey, err := keystore.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("Error generating ephemeral key - %s", err.Error())
+	}
+	return &keyExchange{
+		privateKey: privateKey,
+		publicKey:  keystore.FromECDSAPub(&privateKey.PublicKey),
+	}, nil
+}
+
+// sessionKeys derives the keys for sending and receiving messages from the shared secret of the ephemeral keys.
+// Separate keys are used for each direction, so that the messages sent by one user cannot be reflected back to it.
+func (kx *keyExchange) sessionKeys(isRequester bool) (sendKey, receiveKey []byte, err error) {
+
+	peerKey, err := keystore.UnmarshalPubkey(kx.peerKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid ephemeral key from peer - %s", err.Error())
+	}
+	secret, err := keystore.SharedSecret(kx.privateKey, peerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requesterKey, responderKey := kx.publicKey, kx.peerKey
+	if !isRequester {
+		requesterKey, responderKey = kx.peerKey, kx.publicKey
+	}
+	toResponder := keystore.Keccak256(secret, keyLabelRequesterToResponder, requesterKey, responderKey)
+	toRequester := keystore.Keccak256(secret, keyLabelResponderToRequester, requesterKey, responderKey)
+
+	if isRequester {
+		return toResponder, toRequester, nil
+	}
+	return toRequester, toResponder, nil
+}
+
+// enableEncryption wraps the adapter of the channel, so that all further messages are encrypted using the keys
+// agreed upon in the key exchange. It should be called only after the identity exchange is complete.
+func (ch *Instance) enableEncryption(kx *keyExchange, isRequester bool) (err error) {
+
+	sendKey, receiveKey, err := kx.sessionKeys(isRequester)
+	if err != nil {
+		return err
+	}
+	adapter, err := newEncryptedAdapter(ch.adapter, sendKey, receiveKey)
+	if err != nil {
+		return err
+	}
+
+	ch.access.Lock()
+	ch.adapter = adapter
+	ch.access.Unlock()
+	return nil
+}
+
+// Encrypted returns if the messages on the channel are encrypted end to end.
+func (ch *Instance) Encrypted() bool {
+
+	ch.access.Lock()
+	defer ch.access.Unlock()
+
+	_, ok := ch.adapter.(*encryptedAdapter)
+	return ok
+}
+
+// encryptedAdapter encrypts the messages sent over any channel adapter using AES-GCM.
+//
+// Each message is encoded as json and sent as the cipher text in a MsgEncrypted message. Nonce for encryption
+// is the sequence number of the message in each direction, hence messages that are replayed, reordered or
+// dropped by an attacker are detected as decryption failure.
+type encryptedAdapter struct {
+	ReadWriteCloser
+
+	sendCipher    cipher.AEAD
+	receiveCipher cipher.AEAD
+	sendSeq       uint64 //Sequence number of the next message to be sent
+	receiveSeq    uint64 //Sequence number of the next message expected from the peer
+
+	sendAccess    sync.Mutex //Access control for encrypting the outgoing messages in sequence
+	receiveAccess sync.Mutex //Access control for decrypting the incoming messages in sequence
+}
+
+func newEncryptedAdapter(adapter ReadWriteCloser, sendKey, receiveKey []byte) (*encryptedAdapter, error) {
+
+	sendCipher, err := newAEAD(sendKey)
+	if err != nil {
+		return nil, err
+	}
+	receiveCipher, err := newAEAD(receiveKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedAdapter{
+		ReadWriteCloser: adapter,
+		sendCipher:      sendCipher,
+		receiveCipher:   receiveCipher,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Error initialising cipher - %s", err.Error())
+	}
+	return cipher.NewGCM(block)
+}
+
+func sequenceNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// Write encrypts the message and sends it on the underlying adapter.
+func (ch *encryptedAdapter) Write(message chMsgPkt) (err error) {
+
+	ch.sendAccess.Lock()
+	defer ch.sendAccess.Unlock()
+
+	plainText, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("Error encoding message for encryption - %s", err.Error())
+	}
+
+	//Sequence number is incremented even if the write fails, as a nonce should never be reused
+	nonce := sequenceNonce(ch.sendCipher, ch.sendSeq)
+	ch.sendSeq++
+	cipherText := ch.sendCipher.Seal(nil, nonce, plainText, []byte(message.Version))
+
+	encryptedMsg := chMsgPkt{
+		Version:   message.Version,
+		MessageID: MsgEncrypted,
+		Message: jsonMsgEncrypted{
+			CipherText: cipherText,
+		},
+	}
+	return ch.ReadWriteCloser.Write(encryptedMsg)
+}
+
+// Read reads the next message from the underlying adapter and decrypts it.
+// Messages that are not encrypted or cannot be decrypted are rejected with an error.
+func (ch *encryptedAdapter) Read() (message chMsgPkt, err error) {
+
+	ch.receiveAccess.Lock()
+	defer ch.receiveAccess.Unlock()
+
+	encryptedMsg, err := ch.ReadWriteCloser.Read()
+	if err != nil {
+		return chMsgPkt{}, err
+	}
+
+	if encryptedMsg.MessageID != MsgEncrypted {
+		return chMsgPkt{}, fmt.Errorf("Unencrypted message (%s) received on encrypted channel", encryptedMsg.MessageID)
+	}
+	msg, ok := encryptedMsg.Message.(jsonMsgEncrypted)
+	if !ok {
+		return chMsgPkt{}, fmt.Errorf("Message packet type error")
+	}
+
+	nonce := sequenceNonce(ch.receiveCipher, ch.receiveSeq)
+	plainText, err := ch.receiveCipher.Open(nil, nonce, msg.CipherText, []byte(encryptedMsg.Version))
+	if err != nil {
+		return chMsgPkt{}, fmt.Errorf("Error decrypting message - %s", err.Error())
+	}
+	ch.receiveSeq++
+
+	if err = json.Unmarshal(plainText, &message); err != nil {
+		return chMsgPkt{}, fmt.Errorf("Error decoding decrypted message - %s", err.Error())
+	}
+	if message.MessageID == MsgEncrypted {
+		return chMsgPkt{}, fmt.Errorf("Nested encrypted message received")
+	}
+	message.Timestamp = encryptedMsg.Timestamp
+	return message, nil
+}
+
+// peerCertificate returns the certificate of the peer from the underlying adapter, if it supports certificates.
+func (ch *encryptedAdapter) peerCertificate() *x509.Certificate {
+	if provider, ok := ch.ReadWriteCloser.(peerCertificateProvider); ok {
+		return provider.peerCertificate()
+	}
+	return nil
+}
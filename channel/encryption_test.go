@@ -0,0 +1,531 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// jsonPipeAdapter is a ReadWriteCloser that sends the messages as json to its peer in the same process.
+// Messages are encoded and decoded as done by the websocket adapter, so that the messages on the wire can be inspected.
+type jsonPipeAdapter struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func newJSONPipe() (a, b *jsonPipeAdapter) {
+	aToB, bToA := make(chan []byte, 10), make(chan []byte, 10)
+	return &jsonPipeAdapter{in: bToA, out: aToB}, &jsonPipeAdapter{in: aToB, out: bToA}
+}
+
+func (p *jsonPipeAdapter) Connected() bool { return true }
+func (p *jsonPipeAdapter) Close() error    { return nil }
+
+func (p *jsonPipeAdapter) Write(message chMsgPkt) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	p.out <- data
+	return nil
+}
+
+func (p *jsonPipeAdapter) Read() (message chMsgPkt, err error) {
+	select {
+	case data := <-p.in:
+		err = json.Unmarshal(data, &message)
+		return message, err
+	case <-time.After(identityExchangeTimeout):
+		return chMsgPkt{}, fmt.Errorf("read timed out")
+	}
+}
+
+// newEncryptedPair returns two encrypted adapters connected to each other,
+// along with the underlying pipes for inspecting and injecting the messages on the wire.
+func newEncryptedPair(t *testing.T) (requester, responder *encryptedAdapter, requesterPipe, responderPipe *jsonPipeAdapter) {
+
+	requesterKx, err := newKeyExchange()
+	if err != nil {
+		t.Fatalf("newKeyExchange() err = %v", err)
+	}
+	responderKx, err := newKeyExchange()
+	if err != nil {
+		t.Fatalf("newKeyExchange() err = %v", err)
+	}
+	requesterKx.peerKey, responderKx.peerKey = responderKx.publicKey, requesterKx.publicKey
+
+	requesterPipe, responderPipe = newJSONPipe()
+	newAdapter := func(kx *keyExchange, isRequester bool, pipe *jsonPipeAdapter) *encryptedAdapter {
+		sendKey, receiveKey, err := kx.sessionKeys(isRequester)
+		if err != nil {
+			t.Fatalf("sessionKeys() err = %v", err)
+		}
+		adapter, err := newEncryptedAdapter(pipe, sendKey, receiveKey)
+		if err != nil {
+			t.Fatalf("newEncryptedAdapter() err = %v", err)
+		}
+		return adapter
+	}
+	return newAdapter(requesterKx, true, requesterPipe), newAdapter(responderKx, false, responderPipe),
+		requesterPipe, responderPipe
+}
+
+func Test_keyExchange_sessionKeys(t *testing.T) {
+
+	requesterKx, err := newKeyExchange()
+	if err != nil {
+		t.Fatalf("newKeyExchange() err = %v", err)
+	}
+	responderKx, err := newKeyExchange()
+	if err != nil {
+		t.Fatalf("newKeyExchange() err = %v", err)
+	}
+	requesterKx.peerKey, responderKx.peerKey = responderKx.publicKey, requesterKx.publicKey
+
+	requesterSend, requesterReceive, err := requesterKx.sessionKeys(true)
+	if err != nil {
+		t.Fatalf("sessionKeys() err = %v", err)
+	}
+	responderSend, responderReceive, err := responderKx.sessionKeys(false)
+	if err != nil {
+		t.Fatalf("sessionKeys() err = %v", err)
+	}
+
+	if !bytes.Equal(requesterSend, responderReceive) || !bytes.Equal(responderSend, requesterReceive) {
+		t.Errorf("sessionKeys() keys of requester and responder do not match")
+	}
+	if bytes.Equal(requesterSend, requesterReceive) {
+		t.Errorf("sessionKeys() same key for both directions, want different")
+	}
+	if len(requesterSend) != 32 {
+		t.Errorf("sessionKeys() key length = %d, want 32", len(requesterSend))
+	}
+
+	t.Run("invalid_peer_key", func(t *testing.T) {
+		requesterKx.peerKey = []byte("invalid-key")
+		if _, _, err := requesterKx.sessionKeys(true); err == nil {
+			t.Errorf("sessionKeys() err = nil, want non nil")
+		}
+	})
+}
+
+func Test_encryptedAdapter(t *testing.T) {
+
+	msg1 := chMsgPkt{Version: Version, MessageID: MsgVPCStateRequest,
+		Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusRequire}}
+	msg2 := chMsgPkt{Version: Version, MessageID: MsgVPCStateResponse,
+		Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusAccept}}
+
+	t.Run("valid", func(t *testing.T) {
+
+		requester, responder, _, responderPipe := newEncryptedPair(t)
+
+		for _, msg := range []chMsgPkt{msg1, msg2, msg1} {
+			if err := requester.Write(msg); err != nil {
+				t.Fatalf("Write() err = %v, want nil", err)
+			}
+			got, err := responder.Read()
+			if err != nil {
+				t.Fatalf("Read() err = %v, want nil", err)
+			}
+			if got.MessageID != msg.MessageID || !reflect.DeepEqual(got.Message, msg.Message) {
+				t.Errorf("Read() = %+v, want %+v", got, msg)
+			}
+		}
+
+		//Other direction
+		if err := responder.Write(msg2); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		if got, err := requester.Read(); err != nil || !reflect.DeepEqual(got.Message, msg2.Message) {
+			t.Errorf("Read() = %+v, %v, want %+v, nil", got, err, msg2)
+		}
+
+		//Messages on the wire should not contain the plain message
+		if err := requester.Write(msg1); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		wire := <-responderPipe.in
+		if bytes.Contains(wire, []byte(MsgVPCStateRequest)) || bytes.Contains(wire, []byte("signed_state_val")) {
+			t.Errorf("Write() message on wire not encrypted - %s", wire)
+		}
+	})
+
+	t.Run("replayed_message", func(t *testing.T) {
+
+		requester, responder, _, responderPipe := newEncryptedPair(t)
+
+		if err := requester.Write(msg1); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		wire := <-responderPipe.in
+		responderPipe.in <- wire
+		responderPipe.in <- wire
+
+		if _, err := responder.Read(); err != nil {
+			t.Fatalf("Read() err = %v, want nil", err)
+		}
+		if _, err := responder.Read(); err == nil {
+			t.Errorf("Read() replayed message err = nil, want non nil")
+		}
+	})
+
+	t.Run("reflected_message", func(t *testing.T) {
+
+		requester, _, requesterPipe, responderPipe := newEncryptedPair(t)
+
+		if err := requester.Write(msg1); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		requesterPipe.in <- <-responderPipe.in
+		if _, err := requester.Read(); err == nil {
+			t.Errorf("Read() reflected message err = nil, want non nil")
+		}
+	})
+
+	t.Run("tampered_message", func(t *testing.T) {
+
+		requester, responder, _, responderPipe := newEncryptedPair(t)
+
+		if err := requester.Write(msg1); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		var encryptedMsg chMsgPkt
+		if err := json.Unmarshal(<-responderPipe.in, &encryptedMsg); err != nil {
+			t.Fatalf("Unmarshal() err = %v, want nil", err)
+		}
+		cipherText := encryptedMsg.Message.(jsonMsgEncrypted).CipherText
+		cipherText[0] ^= 0xff
+		wire, _ := json.Marshal(encryptedMsg)
+		responderPipe.in <- wire
+
+		if _, err := responder.Read(); err == nil {
+			t.Errorf("Read() tampered message err = nil, want non nil")
+		}
+	})
+
+	t.Run("unencrypted_message", func(t *testing.T) {
+
+		_, responder, _, responderPipe := newEncryptedPair(t)
+
+		wire, _ := json.Marshal(msg1)
+		responderPipe.in <- wire
+		if _, err := responder.Read(); err == nil {
+			t.Errorf("Read() unencrypted message err = nil, want non nil")
+		}
+	})
+
+	t.Run("invalid_key", func(t *testing.T) {
+		if _, err := newEncryptedAdapter(&jsonPipeAdapter{}, []byte("short-key"), []byte("short-key")); err == nil {
+			t.Errorf("newEncryptedAdapter() err = nil, want non nil")
+		}
+	})
+}
+
+func Test_IdentityExchange_encryption(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+
+	//exchange performs the identity exchange between alice as requester and bob as responder over a json pipe
+	exchange := func() (requester, responder *Instance, errRequest, errRespond error) {
+
+		requesterPipe, responderPipe := newJSONPipe()
+		requester, responder = &Instance{adapter: requesterPipe}, &Instance{adapter: responderPipe}
+
+		result := make(chan error, 1)
+		go func() {
+			peerID, peerNonce, err := responder.IdentityRead()
+			if err == nil {
+				var nonce []byte
+				nonce, err = responder.IdentityRespond(bob, peerID, peerNonce)
+				if err == nil {
+					err = responder.IdentityProofRead(bob, peerID, peerNonce, nonce)
+				}
+			}
+			result <- err
+		}()
+
+		_, errRequest = requester.IdentityRequest(alice)
+		return requester, responder, errRequest, <-result
+	}
+
+	t.Run("negotiated", func(t *testing.T) {
+
+		requester, responder, errRequest, errRespond := exchange()
+		if errRequest != nil || errRespond != nil {
+			t.Fatalf("identity exchange err = %v, %v, want nil", errRequest, errRespond)
+		}
+		if !requester.Encrypted() || !responder.Encrypted() {
+			t.Fatalf("Encrypted() = %v, %v, want true", requester.Encrypted(), responder.Encrypted())
+		}
+
+		msg := chMsgPkt{Version: Version, MessageID: MsgVPCStateRequest,
+			Message: jsonMsgVPCState{SignedStateVal: testVPCState, Status: MessageStatusRequire}}
+		if err := requester.adapter.Write(msg); err != nil {
+			t.Fatalf("Write() err = %v, want nil", err)
+		}
+		got, err := responder.adapter.Read()
+		if err != nil || !reflect.DeepEqual(got.Message, msg.Message) {
+			t.Errorf("Read() = %+v, %v, want %+v, nil", got, err, msg)
+		}
+	})
+
+	t.Run("not_supported_by_requester", func(t *testing.T) {
+
+		requireEncryption = false
+		defer func() {
+			requireEncryption = true
+		}()
+
+		//Request without ephemeral key, as sent by a peer that does not support encryption
+		requesterPipe, responderPipe := newJSONPipe()
+		nonce, _ := GenerateRandomNumber(identityNonceSize)
+		_ = requesterPipe.Write(chMsgPkt{Version: Version, MessageID: MsgIdentityRequest,
+			Message: jsonMsgIdentity{ID: alice, Nonce: nonce}})
+
+		responder := &Instance{adapter: responderPipe}
+		peerID, peerNonce, err := responder.IdentityRead()
+		if err != nil {
+			t.Fatalf("IdentityRead() err = %v, want nil", err)
+		}
+		if _, err = responder.IdentityRespond(bob, peerID, peerNonce); err != nil {
+			t.Fatalf("IdentityRespond() err = %v, want nil", err)
+		}
+		response, err := requesterPipe.Read()
+		if err != nil {
+			t.Fatalf("Read() err = %v, want nil", err)
+		}
+		responseMsg := response.Message.(jsonMsgIdentity)
+		if len(responseMsg.EphemeralKey) != 0 {
+			t.Errorf("IdentityRespond() ephemeral key sent, want not sent as requester does not support encryption")
+		}
+		transcript := identityTranscript{
+			requester:      alice.OnChainID,
+			responder:      bob.OnChainID,
+			requesterNonce: nonce,
+			responderNonce: responseMsg.Nonce,
+		}
+		if err = verifyIdentityProof(responseMsg.Signature, identityProofResponder, transcript); err != nil {
+			t.Errorf("IdentityRespond() proof invalid - %v", err)
+		}
+	})
+
+	t.Run("required_not_supported_by_requester", func(t *testing.T) {
+
+		responderPipe := &jsonPipeAdapter{in: make(chan []byte, 1)}
+		nonce, _ := GenerateRandomNumber(identityNonceSize)
+		wire, _ := json.Marshal(chMsgPkt{Version: Version, MessageID: MsgIdentityRequest,
+			Message: jsonMsgIdentity{ID: alice, Nonce: nonce}})
+		responderPipe.in <- wire
+
+		responder := &Instance{adapter: responderPipe}
+		if _, _, err := responder.IdentityRead(); err == nil {
+			t.Errorf("IdentityRead() err = nil, want non nil")
+		}
+	})
+
+	t.Run("required_not_supported_by_responder", func(t *testing.T) {
+
+		requesterPipe, responderPipe := newJSONPipe()
+		go func() {
+			//Respond without ephemeral key, as sent by a peer that does not support encryption
+			var request chMsgPkt
+			_ = json.Unmarshal(<-responderPipe.in, &request)
+			requestMsg := request.Message.(jsonMsgIdentity)
+			nonce, _ := GenerateRandomNumber(identityNonceSize)
+			signature, _ := signIdentityProof(bob, identityProofResponder, identityTranscript{
+				requester:      alice.OnChainID,
+				responder:      bob.OnChainID,
+				requesterNonce: requestMsg.Nonce,
+				responderNonce: nonce,
+				requesterKey:   requestMsg.EphemeralKey,
+			})
+			_ = responderPipe.Write(chMsgPkt{Version: Version, MessageID: MsgIdentityResponse,
+				Message: jsonMsgIdentity{ID: bob, Nonce: nonce, Signature: signature}})
+		}()
+
+		requester := &Instance{adapter: requesterPipe}
+		if _, err := requester.IdentityRequest(alice); err == nil {
+			t.Errorf("IdentityRequest() err = nil, want non nil")
+		}
+	})
+
+	t.Run("ephemeral_key_stripped", func(t *testing.T) {
+
+		//Encryption is not required, so that a stripped key is detected only from the identity proofs
+		requireEncryption = false
+		defer func() {
+			requireEncryption = true
+		}()
+
+		//exchangeStripped performs the identity exchange with an attacker in between, that removes the
+		//ephemeral key in the request or in the response
+		exchangeStripped := func(stripRequest bool) (errRequest, errRespond error) {
+			requesterToAttacker, attackerToResponder := make(chan []byte, 1), make(chan []byte, 1)
+			responderToAttacker, attackerToRequester := make(chan []byte, 1), make(chan []byte, 1)
+			requesterPipe := &jsonPipeAdapter{in: attackerToRequester, out: requesterToAttacker}
+			responderPipe := &jsonPipeAdapter{in: attackerToResponder, out: responderToAttacker}
+			relay := func(from <-chan []byte, to chan<- []byte, strip bool) {
+				wire := <-from
+				if strip {
+					var msg chMsgPkt
+					_ = json.Unmarshal(wire, &msg)
+					identityMsg := msg.Message.(jsonMsgIdentity)
+					identityMsg.EphemeralKey = nil
+					msg.Message = identityMsg
+					wire, _ = json.Marshal(msg)
+				}
+				to <- wire
+			}
+			go relay(requesterToAttacker, attackerToResponder, stripRequest)
+			go relay(responderToAttacker, attackerToRequester, !stripRequest)
+
+			responder := &Instance{adapter: responderPipe}
+			result := make(chan error, 1)
+			go func() {
+				peerID, peerNonce, err := responder.IdentityRead()
+				if err == nil {
+					_, err = responder.IdentityRespond(bob, peerID, peerNonce)
+				}
+				result <- err
+			}()
+
+			requester := &Instance{adapter: requesterPipe}
+			_, errRequest = requester.IdentityRequest(alice)
+			return errRequest, <-result
+		}
+
+		tests := []struct {
+			name         string
+			stripRequest bool
+		}{
+			{name: "from_request", stripRequest: true},
+			{name: "from_response", stripRequest: false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				errRequest, errRespond := exchangeStripped(tt.stripRequest)
+				if errRespond != nil {
+					t.Fatalf("IdentityRespond() err = %v, want nil", errRespond)
+				}
+				if errRequest == nil || !strings.Contains(errRequest.Error(), "Identity proof") {
+					t.Errorf("IdentityRequest() err = %v, want identity proof invalid", errRequest)
+				}
+			})
+		}
+	})
+
+	t.Run("ephemeral_key_replaced", func(t *testing.T) {
+
+		attackerKx, err := newKeyExchange()
+		if err != nil {
+			t.Fatalf("newKeyExchange() err = %v", err)
+		}
+
+		//Attacker in between replaces the ephemeral key in the request with its own key
+		requesterToAttacker, attackerToResponder, responderToRequester := make(chan []byte, 1), make(chan []byte, 1), make(chan []byte, 1)
+		requesterPipe := &jsonPipeAdapter{in: responderToRequester, out: requesterToAttacker}
+		responderPipe := &jsonPipeAdapter{in: attackerToResponder, out: responderToRequester}
+		go func() {
+			var request chMsgPkt
+			_ = json.Unmarshal(<-requesterToAttacker, &request)
+			requestMsg := request.Message.(jsonMsgIdentity)
+			requestMsg.EphemeralKey = attackerKx.publicKey
+			request.Message = requestMsg
+			wire, _ := json.Marshal(request)
+			attackerToResponder <- wire
+		}()
+
+		responder := &Instance{adapter: responderPipe}
+		go func() {
+			peerID, peerNonce, err := responder.IdentityRead()
+			if err == nil {
+				_, _ = responder.IdentityRespond(bob, peerID, peerNonce)
+			}
+		}()
+
+		requester := &Instance{adapter: requesterPipe}
+		_, err = requester.IdentityRequest(alice)
+		if err == nil || !strings.Contains(err.Error(), "Identity proof") {
+			t.Errorf("IdentityRequest() err = %v, want identity proof invalid", err)
+		}
+	})
+}
+
+func Test_NewChannel_encrypted(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+
+	_ = exec.Command("fuser", "-k 9602/tcp").Run() //setup
+	defer func() {
+		_ = exec.Command("fuser", "-k 9602/tcp").Run() //teardown
+	}()
+
+	inConnChannel, listener, err := startListener(bob, 10, WebSocket)
+	if err != nil {
+		t.Fatalf("startListener() err = %v, want nil", err)
+	}
+	time.Sleep(200 * time.Millisecond) //Wait till the listener starts
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	aliceConn, err := NewChannel(alice, bobID, WebSocket)
+	if err != nil {
+		t.Fatalf("NewChannel() err = %v, want nil", err)
+	}
+	defer func() {
+		_ = aliceConn.Close()
+	}()
+
+	var bobConn *Instance
+	select {
+	case bobConn = <-inConnChannel:
+	case <-time.After(identityExchangeTimeout):
+		t.Fatalf("startListener() id verified connection not received")
+	}
+	defer func() {
+		_ = bobConn.Close()
+	}()
+
+	if !aliceConn.Encrypted() || !bobConn.Encrypted() {
+		t.Fatalf("Encrypted() = %v, %v, want true", aliceConn.Encrypted(), bobConn.Encrypted())
+	}
+	if !identity.Equal(bobConn.PeerID(), aliceID) {
+		t.Errorf("PeerID() = %v, want %v", bobConn.PeerID(), aliceID)
+	}
+
+	msg := chMsgPkt{Version: Version, MessageID: MsgMSCBaseStateRequest,
+		Message: jsonMsgMSCBaseState{SignedStateVal: testMSCBaseState, Status: MessageStatusRequire}}
+	if err = aliceConn.adapter.Write(msg); err != nil {
+		t.Fatalf("Write() err = %v, want nil", err)
+	}
+	got, err := bobConn.adapter.Read()
+	if err != nil || !reflect.DeepEqual(got.Message, msg.Message) {
+		t.Errorf("Read() = %+v, %v, want %+v, nil", got, err, msg)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
 	"github.com/direct-state-transfer/dst-go/identity"
 	"github.com/direct-state-transfer/dst-go/log"
 )
@@ -62,6 +63,17 @@ const (
 	ClosingModeAutoImmediate ClosingMode = ClosingMode("auto-immediate")
 )
 
+// ParseClosingMode returns the closing mode with the given name.
+// Error is returned if name is not one of the predefined closing modes.
+func ParseClosingMode(name string) (ClosingMode, error) {
+	switch closingMode := ClosingMode(name); closingMode {
+	case ClosingModeManual, ClosingModeAutoNormal, ClosingModeAutoImmediate:
+		return closingMode, nil
+	default:
+		return "", fmt.Errorf("unknown closing mode - %s", name)
+	}
+}
+
 // Status of the channel.
 type Status string
 
@@ -80,7 +92,7 @@ const (
 )
 
 // InitModule initializes this module with provided configuration.
-// The logger is initialized.
+// The logger, the tls configuration and the encryption policy for channel connections are initialized.
 func InitModule(cfg *Config) (err error) {
 
 	logger, err = log.NewLogger(cfg.Logger.Level, cfg.Logger.Backend, packageName)
@@ -92,6 +104,16 @@ func InitModule(cfg *Config) (err error) {
 	//Initialise connection
 	logger.Debug("Initialising Channel module")
 
+	tlsConfig, err = newTLSConfig(cfg)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if !tlsConfig.enabled {
+		logger.Info("TLS not configured, channel connections will not be encrypted")
+	}
+	requireEncryption = cfg.requireEncryption
+
 	return nil
 
 }
@@ -112,9 +134,23 @@ type Instance struct {
 	status        Status             //Status of the channel
 	contractStore contract.StoreType //ContractStore used for this channel
 	sessionID     SessionID          //Session Id agreed for this offchain transaction
+	terms         Terms              //Terms agreed in the new channel handshake
 	mscBaseState  MSCBaseStateSigned //MSContract Base state to use for state register
 	vpcStatesList []VPCStateSigned   //List of all vpc state
 
+	msContractAddr types.Address //Address of the deployed MSContract for this channel
+	vpcAddr        types.Address //Address of the VPC contract used for this channel
+
+	store    Store  //Store to persist the channel state, nil if persistence is not required
+	recordID []byte //Id under which the channel state is persisted in the store, see channelKeyPrefix
+
+	stateAccess   sync.Mutex //Access control for mscBaseState, vpcStatesList, recordID and writes to the store
+	requestAccess sync.Mutex //Held by this user for the whole exchange of a request on the channel and its response
+
+	dispatcher *Dispatcher //Dispatcher reading the messages on the channel, nil if not running
+
+	keyExchange *keyExchange //Ephemeral keys while responding to an identity exchange, nil otherwise
+
 	access sync.Mutex //Access control when setting connection status
 
 }
@@ -140,6 +176,7 @@ func (inst *Instance) Close() (err error) {
 func (inst *Instance) SetClosingMode(closingMode ClosingMode) {
 	if closingMode == ClosingModeManual || closingMode == ClosingModeAutoNormal || closingMode == ClosingModeAutoImmediate {
 		inst.closingMode = closingMode
+		inst.logPersistRecord()
 	}
 }
 
@@ -211,6 +248,7 @@ func (inst *Instance) RoleChannel() Role {
 func (inst *Instance) SetRoleClosing(role Role) {
 	if role == Sender || role == Receiver {
 		inst.roleClosing = role
+		inst.logPersistRecord()
 	}
 }
 
@@ -224,16 +262,27 @@ func (inst *Instance) RoleClosing() Role {
 //
 // Only specific status changes are allowed. For example, new status can be set to Setup only when the current status is PreSetup,
 // if not, the status change will not occur and false is returned.
+// A new channel starts in PreSetup and moves through Setup and Init to Open as it is being opened.
+// If opening fails, it can be set to Closed from any of these intermediate status.
+// When closed cooperatively, an open channel moves through VPCClosing and VPCClosed (or WaitingToClose, if no vpc is used) to Closed.
 func (inst *Instance) SetStatus(status Status) bool {
 
 	inst.access.Lock()
 	defer inst.access.Unlock()
 
 	switch status {
+	case PreSetup:
+		if inst.status != Status("") {
+			return false
+		}
 	case Setup:
 		if inst.status != PreSetup {
 			return false
 		}
+	case Init:
+		if inst.status != Setup {
+			return false
+		}
 	case Open:
 		if inst.status != Init {
 			return false
@@ -251,7 +300,7 @@ func (inst *Instance) SetStatus(status Status) bool {
 			return false
 		}
 	case VPCClosing:
-		if inst.status != Settled {
+		if !((inst.status == Open) || (inst.status == Settled)) {
 			return false
 		}
 	case VPCClosed:
@@ -259,13 +308,15 @@ func (inst *Instance) SetStatus(status Status) bool {
 			return false
 		}
 	case Closed:
-		if !((inst.status == Init) || (inst.status == VPCClosing) || (inst.status == VPCClosed) || (inst.status == WaitingToClose)) {
+		if !((inst.status == PreSetup) || (inst.status == Setup) || (inst.status == Init) ||
+			(inst.status == VPCClosing) || (inst.status == VPCClosed) || (inst.status == WaitingToClose)) {
 			return false
 		}
 	default:
 		return false
 	}
 	inst.status = status
+	inst.logPersistRecord()
 	return true
 }
 
@@ -281,7 +332,12 @@ func (inst *Instance) SetSessionID(sessionID SessionID) (err error) {
 	if !isValid {
 		return fmt.Errorf("Session id invalid - %v", err.Error())
 	}
+	previousSessionID := inst.sessionID
 	inst.sessionID = sessionID
+	if err = inst.persistRecord(); err != nil {
+		inst.sessionID = previousSessionID
+		return err
+	}
 	return nil
 }
 
@@ -290,10 +346,31 @@ func (inst *Instance) SessionID() SessionID {
 	return inst.sessionID
 }
 
+// SetTerms validates the terms agreed in the new channel handshake and if successful, sets them in the channel.
+// Once set, the msc base state of the channel should block the deposits in the terms.
+func (inst *Instance) SetTerms(terms Terms) (err error) {
+	if err = terms.Validate(); err != nil {
+		return fmt.Errorf("Terms invalid - %v", err.Error())
+	}
+	previousTerms := inst.terms
+	inst.terms = terms
+	if err = inst.persistRecord(); err != nil {
+		inst.terms = previousTerms
+		return err
+	}
+	return nil
+}
+
+// Terms returns the terms agreed for the channel. Deposits are nil if the terms have not been set.
+func (inst *Instance) Terms() Terms {
+	return inst.terms
+}
+
 // SetContractStore sets contract store in the channel instance.
 // ContractStore is set of contracts and its properties according that facilitates this offchain channel.
 func (inst *Instance) SetContractStore(contractStore contract.StoreType) {
 	inst.contractStore = contractStore
+	inst.logPersistRecord()
 }
 
 // ContractStore returns the contract store that is configured in the channel instance.
@@ -301,9 +378,52 @@ func (inst *Instance) ContractStore() contract.StoreType {
 	return inst.contractStore
 }
 
+// SetMSContractAddr sets the address of the MSContract deployed for this channel.
+func (inst *Instance) SetMSContractAddr(addr types.Address) (err error) {
+	previousAddr := inst.msContractAddr
+	inst.msContractAddr = addr
+	if err = inst.persistRecord(); err != nil {
+		inst.msContractAddr = previousAddr
+		return err
+	}
+	return nil
+}
+
+// MSContractAddr returns the address of the MSContract deployed for this channel.
+func (inst *Instance) MSContractAddr() types.Address {
+	return inst.msContractAddr
+}
+
+// SetVPCAddr sets the address of the VPC contract used for this channel.
+func (inst *Instance) SetVPCAddr(addr types.Address) (err error) {
+	previousAddr := inst.vpcAddr
+	inst.vpcAddr = addr
+	if err = inst.persistRecord(); err != nil {
+		inst.vpcAddr = previousAddr
+		return err
+	}
+	return nil
+}
+
+// VPCAddr returns the address of the VPC contract used for this channel.
+func (inst *Instance) VPCAddr() types.Address {
+	return inst.vpcAddr
+}
+
 // SetMSCBaseState validates the integrity of newState and if successful, sets the msc base state of the channel.
+// If terms are set for the channel, the amounts blocked in newState should be the agreed deposits.
+// If a store is set, the state is persisted before it is set and an error is returned if it fails.
 func (inst *Instance) SetMSCBaseState(newState MSCBaseStateSigned) (err error) {
 
+	if inst.terms.DepositSender != nil {
+		state := newState.MSContractBaseState
+		if !equalAmounts(state.BlockedSender, inst.terms.DepositSender) ||
+			!equalAmounts(state.BlockedReceiver, inst.terms.DepositReceiver) {
+			return fmt.Errorf("Amounts blocked in MSCBaseState (%v, %v) do not match the agreed deposits (%v, %v)",
+				state.BlockedSender, state.BlockedReceiver, inst.terms.DepositSender, inst.terms.DepositReceiver)
+		}
+	}
+
 	//Validate integrity of the sender signature on the state
 	isValidSender, err := newState.VerifySign(inst.SenderID(), Sender)
 	if err != nil {
@@ -321,17 +441,32 @@ func (inst *Instance) SetMSCBaseState(newState MSCBaseStateSigned) (err error) {
 	if !isValidReceiver {
 		return fmt.Errorf("Receiver signature on MSCBaseState invalid")
 	}
-	logger.Debug("New MSC base state set")
+
+	inst.stateAccess.Lock()
+	defer inst.stateAccess.Unlock()
+
+	previousState := inst.mscBaseState
 	inst.mscBaseState = newState
+	if err = inst.writeRecord(); err != nil {
+		inst.mscBaseState = previousState
+		return err
+	}
+	logger.Debug("New MSC base state set")
 	return nil
 }
 
 // MscBaseState returns the msc base state of the channel.
 func (inst *Instance) MscBaseState() MSCBaseStateSigned {
+
+	inst.stateAccess.Lock()
+	defer inst.stateAccess.Unlock()
+
 	return inst.mscBaseState
 }
 
 // SetCurrentVPCState validates the integrity of newState and if successful, sets the current vpc state of the channel.
+// Besides the signatures, the contents of the state are validated as described in ValidateVPCState.
+// If a store is set, the state is persisted before it is set and an error is returned if it fails.
 func (inst *Instance) SetCurrentVPCState(newState VPCStateSigned) (err error) {
 
 	//Validate integrity of the sender signature on the state
@@ -352,13 +487,20 @@ func (inst *Instance) SetCurrentVPCState(newState VPCStateSigned) (err error) {
 		return fmt.Errorf("Receiver signature on VPCState invalid")
 	}
 
-	if lastVpcStateIndex := len(inst.vpcStatesList) - 1; lastVpcStateIndex != -1 {
+	//Validate against the current state and set it without releasing the lock, so that the states set
+	//concurrently are also validated against each other
+	inst.stateAccess.Lock()
+	defer inst.stateAccess.Unlock()
 
-		//when previous state exists, check if the current version number is greater than previous
-		lastValidStateVersion := inst.vpcStatesList[lastVpcStateIndex].VPCState.Version
-		if newState.VPCState.Version.Cmp(lastValidStateVersion) != 1 {
-			return fmt.Errorf("Current Version number (%s) less than previous (%s)", newState.VPCState.Version.String(), lastValidStateVersion.String())
-		}
+	//Validate id, version and the blocked amounts in the state
+	err = inst.validateVPCState(newState.VPCState, inst.currentVPCState().VPCState, inst.mscBaseState.MSContractBaseState)
+	if err != nil {
+		return err
+	}
+
+	//Persist the state before it is set, so that it is not lost if the node stops after acknowledging it
+	if err = inst.persistVPCState(newState); err != nil {
+		return err
 	}
 	logger.Debug("New MSC base state set")
 	inst.vpcStatesList = append(inst.vpcStatesList, newState)
@@ -366,7 +508,20 @@ func (inst *Instance) SetCurrentVPCState(newState VPCStateSigned) (err error) {
 }
 
 // CurrentVpcState returns the current vpc state of the channel.
+// If no vpc state has been set yet, an empty state is returned.
 func (inst *Instance) CurrentVpcState() VPCStateSigned {
+
+	inst.stateAccess.Lock()
+	defer inst.stateAccess.Unlock()
+
+	return inst.currentVPCState()
+}
+
+// currentVPCState is same as CurrentVpcState, but should be called with stateAccess held.
+func (inst *Instance) currentVPCState() VPCStateSigned {
+	if len(inst.vpcStatesList) == 0 {
+		return VPCStateSigned{}
+	}
 	return inst.vpcStatesList[len(inst.vpcStatesList)-1]
 }
 
@@ -374,6 +529,8 @@ func (inst *Instance) CurrentVpcState() VPCStateSigned {
 // Channel session has a listener running in the background with defined adapterType.
 // All new incoming connections are processed by the session and if successful made available on idVerifiedConn channel.
 // The higher layers of code can listen for new connections on this idVerifiedConn channel and use it for further communications.
+// Peers in incoming connections should prove the ownership of their on-chain id as described in NewChannel,
+// before they are made available. Hence credentials should be set in selfID.
 func NewSession(selfID identity.OffChainID, adapterType AdapterType, maxConn uint32) (idVerifiedConn chan *Instance,
 	listener Shutdown, err error) {
 
@@ -385,7 +542,7 @@ func NewSession(selfID identity.OffChainID, adapterType AdapterType, maxConn uin
 	}
 
 	//Do a loopback test
-	ch, err := NewChannel(selfID, selfID, WebSocket)
+	ch, err := NewChannel(selfID, selfID, adapterType)
 	if err != nil {
 		logger.Error("Channel self check - Error in outgoing connection -", err)
 		return nil, nil, err
@@ -147,6 +147,32 @@ func Test_Instance_Close(t *testing.T) {
 	})
 }
 
+func Test_ParseClosingMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		want    ClosingMode
+		wantErr bool
+	}{
+		{name: "manual", arg: "manual", want: ClosingModeManual},
+		{name: "auto-normal", arg: "auto-normal", want: ClosingModeAutoNormal},
+		{name: "auto-immediate", arg: "auto-immediate", want: ClosingModeAutoImmediate},
+		{name: "empty", arg: "", wantErr: true},
+		{name: "unknown", arg: "auto", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClosingMode(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClosingMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseClosingMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_Instance_SetClosingMode(t *testing.T) {
 	type args struct {
 		closingMode ClosingMode
@@ -652,6 +678,24 @@ func Test_Instance_SetStatus(t *testing.T) {
 		args     args
 		wantSet  bool
 	}{
+		{
+			name:     "valid-new-to-presetup",
+			instance: &Instance{},
+			args: args{
+				status: PreSetup,
+			},
+			wantSet: true,
+		},
+		{
+			name: "invalid-open-to-presetup",
+			instance: &Instance{
+				status: Open,
+			},
+			args: args{
+				status: PreSetup,
+			},
+			wantSet: false,
+		},
 		{
 			name: "valid-presetup-to-setup",
 			instance: &Instance{
@@ -672,6 +716,26 @@ func Test_Instance_SetStatus(t *testing.T) {
 			},
 			wantSet: false,
 		},
+		{
+			name: "valid-setup-to-init",
+			instance: &Instance{
+				status: Setup,
+			},
+			args: args{
+				status: Init,
+			},
+			wantSet: true,
+		},
+		{
+			name: "invalid-presetup-to-init",
+			instance: &Instance{
+				status: PreSetup,
+			},
+			args: args{
+				status: Init,
+			},
+			wantSet: false,
+		},
 		{
 			name: "valid-init-to-open",
 			instance: &Instance{
@@ -772,6 +836,16 @@ func Test_Instance_SetStatus(t *testing.T) {
 			},
 			wantSet: true,
 		},
+		{
+			name: "valid-open-to-vpcclosing",
+			instance: &Instance{
+				status: Open,
+			},
+			args: args{
+				status: VPCClosing,
+			},
+			wantSet: true,
+		},
 		{
 			name: "invalid-init-to-vpcclosing",
 			instance: &Instance{
@@ -802,6 +876,26 @@ func Test_Instance_SetStatus(t *testing.T) {
 			},
 			wantSet: false,
 		},
+		{
+			name: "valid-presetup-to-closed",
+			instance: &Instance{
+				status: PreSetup,
+			},
+			args: args{
+				status: Closed,
+			},
+			wantSet: true,
+		},
+		{
+			name: "valid-setup-to-closed",
+			instance: &Instance{
+				status: Setup,
+			},
+			args: args{
+				status: Closed,
+			},
+			wantSet: true,
+		},
 		{
 			name: "valid-init-to-closed",
 			instance: &Instance{
@@ -997,6 +1091,30 @@ func Test_Instance_SessionID(t *testing.T) {
 	}
 }
 
+func Test_Instance_SetTerms(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		terms   Terms
+		wantErr bool
+	}{
+		{"valid", termsForTest, false},
+		{"invalid", Terms{DepositSender: big.NewInt(10)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &Instance{}
+			err := instance.SetTerms(tt.terms)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Instance.SetTerms() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotSet := instance.Terms().Equal(tt.terms); gotSet == tt.wantErr {
+				t.Errorf("Instance.Terms() = %v, want set %v", instance.Terms(), !tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_Instance_SetContractStore(t *testing.T) {
 	type args struct {
 		contractStore contract.StoreType
@@ -1084,6 +1202,58 @@ func Test_Instance_SetMSCBaseState(t *testing.T) {
 			wantErr: false,
 			wantSet: true,
 		},
+		{
+			name: "valid-matching-terms",
+			instance: &Instance{
+				selfID:      aliceID,
+				peerID:      bobID,
+				roleChannel: Sender,
+				terms:       termsForTest,
+			},
+			args: args{
+				mscBaseState: MSCBaseStateSigned{
+					MSContractBaseState: MSCBaseState{
+						VpcAddress:      aliceID.OnChainID,
+						Sid:             big.NewInt(123456),
+						BlockedSender:   big.NewInt(10),
+						BlockedReceiver: big.NewInt(20),
+						Version:         big.NewInt(1),
+					},
+					SignSender:   types.Hex2Bytes("2be8ccd7928d47e38a2bc04377817d2f7364391ef0d39b516f64f4d036b499a00a4f50da3b87d12fed65532e51b401c507713507cea97b9d3e68e07defd531241c"),
+					SignReceiver: types.Hex2Bytes("f53a6a46f3d6a94b035b9bc5fb17d0fc762cbf5119e91d3c86515e9db2499d9d5676e333069ebc7b7c9edc2c216cc3dfc15f3b480ba6aa1a5157dd7c28d7a9c61c"),
+				},
+			},
+			wantErr: false,
+			wantSet: true,
+		},
+		{
+			name: "invalid-deposits-not-matching-terms",
+			instance: &Instance{
+				selfID:      aliceID,
+				peerID:      bobID,
+				roleChannel: Sender,
+				terms: Terms{
+					DepositSender:   big.NewInt(20),
+					DepositReceiver: big.NewInt(10),
+					ConfirmTimeout:  termsForTest.ConfirmTimeout,
+				},
+			},
+			args: args{
+				mscBaseState: MSCBaseStateSigned{
+					MSContractBaseState: MSCBaseState{
+						VpcAddress:      aliceID.OnChainID,
+						Sid:             big.NewInt(123456),
+						BlockedSender:   big.NewInt(10),
+						BlockedReceiver: big.NewInt(20),
+						Version:         big.NewInt(1),
+					},
+					SignSender:   types.Hex2Bytes("2be8ccd7928d47e38a2bc04377817d2f7364391ef0d39b516f64f4d036b499a00a4f50da3b87d12fed65532e51b401c507713507cea97b9d3e68e07defd531241c"),
+					SignReceiver: types.Hex2Bytes("f53a6a46f3d6a94b035b9bc5fb17d0fc762cbf5119e91d3c86515e9db2499d9d5676e333069ebc7b7c9edc2c216cc3dfc15f3b480ba6aa1a5157dd7c28d7a9c61c"),
+				},
+			},
+			wantErr: true,
+			wantSet: false,
+		},
 		{
 			name:     "invalid-sender-signature",
 			instance: &Instance{},
@@ -1248,21 +1418,14 @@ func Test_Instance_SetVPCState(t *testing.T) {
 		{
 			name: "valid-1",
 			instance: &Instance{
-				selfID:      aliceID,
-				peerID:      bobID,
-				roleChannel: Sender,
+				selfID:       aliceID,
+				peerID:       bobID,
+				roleChannel:  Sender,
+				sessionID:    testSessionID,
+				mscBaseState: testMSCBaseState,
 			},
 			args: args{
-				vpcState: VPCStateSigned{
-					VPCState: VPCState{
-						ID:              []byte("sample-id"),
-						Version:         big.NewInt(1),
-						BlockedSender:   big.NewInt(10),
-						BlockedReceiver: big.NewInt(20),
-					},
-					SignSender:   types.Hex2Bytes("14c5811728aed81bc8f7eb1fb71f45d7e7364561f88987da73b9c209b3ec240f2f56f83ad507b425ed096dfbbcacdc2558b6f47c13d91da413ab84f801ee49f61c"),
-					SignReceiver: types.Hex2Bytes("1172ed9142808860222ae220d99203a14ab6756ee65de9f091868905dafb195606239f0962886d54b029c08ee26551f057e97254ed3c78a728ac38bf1865ea1f1b"),
-				},
+				vpcState: testVPCState,
 			},
 			wantErr: false,
 			wantSet: true,
@@ -1270,9 +1433,11 @@ func Test_Instance_SetVPCState(t *testing.T) {
 		{
 			name: "valid-2",
 			instance: &Instance{
-				selfID:      aliceID,
-				peerID:      bobID,
-				roleChannel: Sender,
+				selfID:       aliceID,
+				peerID:       bobID,
+				roleChannel:  Sender,
+				sessionID:    testSessionID,
+				mscBaseState: testMSCBaseState,
 				vpcStatesList: []VPCStateSigned{{
 					VPCState: VPCState{
 						ID:              []byte("sample-id"),
@@ -1285,16 +1450,7 @@ func Test_Instance_SetVPCState(t *testing.T) {
 				}},
 			},
 			args: args{
-				vpcState: VPCStateSigned{
-					VPCState: VPCState{
-						ID:              []byte("sample-id"),
-						Version:         big.NewInt(1),
-						BlockedSender:   big.NewInt(10),
-						BlockedReceiver: big.NewInt(20),
-					},
-					SignSender:   types.Hex2Bytes("14c5811728aed81bc8f7eb1fb71f45d7e7364561f88987da73b9c209b3ec240f2f56f83ad507b425ed096dfbbcacdc2558b6f47c13d91da413ab84f801ee49f61c"),
-					SignReceiver: types.Hex2Bytes("1172ed9142808860222ae220d99203a14ab6756ee65de9f091868905dafb195606239f0962886d54b029c08ee26551f057e97254ed3c78a728ac38bf1865ea1f1b"),
-				},
+				vpcState: testVPCState,
 			},
 			wantErr: false,
 			wantSet: true,
@@ -1302,9 +1458,11 @@ func Test_Instance_SetVPCState(t *testing.T) {
 		{
 			name: "invalid-version",
 			instance: &Instance{
-				selfID:      aliceID,
-				peerID:      bobID,
-				roleChannel: Sender,
+				selfID:       aliceID,
+				peerID:       bobID,
+				roleChannel:  Sender,
+				sessionID:    testSessionID,
+				mscBaseState: testMSCBaseState,
 				vpcStatesList: []VPCStateSigned{{
 					VPCState: VPCState{
 						ID:              []byte("sample-id"),
@@ -1317,16 +1475,7 @@ func Test_Instance_SetVPCState(t *testing.T) {
 				}},
 			},
 			args: args{
-				vpcState: VPCStateSigned{
-					VPCState: VPCState{
-						ID:              []byte("sample-id"),
-						Version:         big.NewInt(1),
-						BlockedSender:   big.NewInt(10),
-						BlockedReceiver: big.NewInt(20),
-					},
-					SignSender:   types.Hex2Bytes("14c5811728aed81bc8f7eb1fb71f45d7e7364561f88987da73b9c209b3ec240f2f56f83ad507b425ed096dfbbcacdc2558b6f47c13d91da413ab84f801ee49f61c"),
-					SignReceiver: types.Hex2Bytes("1172ed9142808860222ae220d99203a14ab6756ee65de9f091868905dafb195606239f0962886d54b029c08ee26551f057e97254ed3c78a728ac38bf1865ea1f1b"),
-				},
+				vpcState: testVPCState,
 			},
 			wantErr: true,
 			wantSet: false,
@@ -1496,6 +1645,8 @@ func Test_NewSession(t *testing.T) {
 					OnChainID:        bobID.OnChainID,
 					ListenerIPAddr:   bobID.ListenerIPAddr,
 					ListenerEndpoint: "/listen-new-session-test-1",
+					KeyStore:         testKeyStore,
+					Password:         bobPassword,
 				},
 				adapterType: WebSocket,
 				maxConn:     100,
@@ -18,6 +18,7 @@ package channel
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -61,6 +62,21 @@ var (
 	ResponseStatusList = []MessageStatus{MessageStatusAccept, MessageStatusDecline}
 )
 
+// AbortCode is the machine readable code in an abort message, describing why the peer aborted a request.
+type AbortCode string
+
+// Enumeration of allowed values for abort code
+var (
+	AbortVersionMismatch     = AbortCode("version_mismatch")
+	AbortInvalidSignature    = AbortCode("invalid_signature")
+	AbortInsufficientBalance = AbortCode("insufficient_balance")
+	AbortPolicyRejection     = AbortCode("policy_rejection")
+	AbortInternalError       = AbortCode("internal_error")
+
+	AbortCodeList = []AbortCode{AbortVersionMismatch, AbortInvalidSignature, AbortInsufficientBalance,
+		AbortPolicyRejection, AbortInternalError}
+)
+
 // Enumeration of allowed values for message id.
 const (
 	// MsgIdentityRequest is the id for "identity request" message.
@@ -69,6 +85,9 @@ const (
 	// MsgIdentityResponse is the id for "identity response" message.
 	MsgIdentityResponse MessageID = "MsgIdentityResponse"
 
+	// MsgIdentityProof is the id for "identity proof" message.
+	MsgIdentityProof MessageID = "MsgIdentityProof"
+
 	// MsgNewChannelRequest is the id for "new channel request" message.
 	MsgNewChannelRequest MessageID = "MsgNewChannelRequest"
 
@@ -98,16 +117,37 @@ const (
 
 	// MsgVPCStateResponse is the id for "VPC state response" message.
 	MsgVPCStateResponse MessageID = "MsgVPCStateResponse"
+
+	// MsgResyncRequest is the id for "resync request" message.
+	MsgResyncRequest MessageID = "MsgResyncRequest"
+
+	// MsgResyncResponse is the id for "resync response" message.
+	MsgResyncResponse MessageID = "MsgResyncResponse"
+
+	// MsgCloseChannelRequest is the id for "close channel request" message.
+	MsgCloseChannelRequest MessageID = "MsgCloseChannelRequest"
+
+	// MsgCloseChannelResponse is the id for "close channel response" message.
+	MsgCloseChannelResponse MessageID = "MsgCloseChannelResponse"
+
+	// MsgAbort is the id for "abort" message, that can be sent as response to any request.
+	MsgAbort MessageID = "MsgAbort"
+
+	// MsgEncrypted is the id for "encrypted" message, that carries any other message in encrypted form.
+	MsgEncrypted MessageID = "MsgEncrypted"
 )
 
 type jsonMsgIdentity struct {
-	ID identity.OffChainID `json:"id"`
+	ID           identity.OffChainID `json:"id"`
+	Nonce        []byte              `json:"nonce,omitempty"`         //Challenge to be signed by the peer
+	Signature    []byte              `json:"signature,omitempty"`     //Signature on the challenge received from the peer
+	EphemeralKey []byte              `json:"ephemeral_key,omitempty"` //Public key for key agreement, if encryption is supported
 }
 
 type jsonMsgNewChannel struct {
-	//TODO : Check if contract lock in amount also need to be added
 	ContractStoreVersion []byte        `json:"contract_store_version"`
 	MsgProtocolVersion   string        `json:"msg_protocol_version"`
+	Terms                Terms         `json:"terms"`
 	Status               MessageStatus `json:"status"`
 	Reason               string        `json:"reason"`
 }
@@ -133,6 +173,28 @@ type jsonMsgVPCState struct {
 	Status         MessageStatus  `json:"status"`
 }
 
+type jsonMsgResync struct {
+	Sid         SessionID      `json:"sid"`
+	LatestState VPCStateSigned `json:"latest_state"` //Latest fully signed vpc state, empty if none
+	Status      MessageStatus  `json:"status"`
+}
+
+type jsonMsgCloseChannel struct {
+	FinalState VPCStateSigned `json:"final_state"` //Final vpc state to settle the channel with, empty if none
+	Status     MessageStatus  `json:"status"`
+	Reason     string         `json:"reason"`
+}
+
+type jsonMsgAbort struct {
+	Request MessageID `json:"request"` //Id of the request being aborted
+	Code    AbortCode `json:"code"`
+	Reason  string    `json:"reason"`
+}
+
+type jsonMsgEncrypted struct {
+	CipherText []byte `json:"cipher_text"`
+}
+
 // UnmarshalJSON implements json.Unmarshaller interface.
 //
 // The json message is first unmarshalled retaining the message as raw json.
@@ -147,7 +209,7 @@ func (msgPkt *chMsgPkt) UnmarshalJSON(data []byte) (err error) {
 
 	//Unmarshal the message to appropriate format depending upon message id
 	switch rawMsgPkt.MessageID {
-	case MsgIdentityRequest, MsgIdentityResponse:
+	case MsgIdentityRequest, MsgIdentityResponse, MsgIdentityProof:
 
 		var msg jsonMsgIdentity
 		if err = json.Unmarshal(rawMsgPkt.Message, &msg); err != nil {
@@ -191,6 +253,34 @@ func (msgPkt *chMsgPkt) UnmarshalJSON(data []byte) (err error) {
 		}
 		msgPkt.Message = msg
 
+	case MsgResyncRequest, MsgResyncResponse:
+		var msg jsonMsgResync
+		if err = json.Unmarshal(rawMsgPkt.Message, &msg); err != nil {
+			return err
+		}
+		msgPkt.Message = msg
+
+	case MsgCloseChannelRequest, MsgCloseChannelResponse:
+		var msg jsonMsgCloseChannel
+		if err = json.Unmarshal(rawMsgPkt.Message, &msg); err != nil {
+			return err
+		}
+		msgPkt.Message = msg
+
+	case MsgAbort:
+		var msg jsonMsgAbort
+		if err = json.Unmarshal(rawMsgPkt.Message, &msg); err != nil {
+			return err
+		}
+		msgPkt.Message = msg
+
+	case MsgEncrypted:
+		var msg jsonMsgEncrypted
+		if err = json.Unmarshal(rawMsgPkt.Message, &msg); err != nil {
+			return err
+		}
+		msgPkt.Message = msg
+
 	default:
 		err = fmt.Errorf("Unsupported message id - " + string(rawMsgPkt.MessageID))
 		return err
@@ -204,25 +294,183 @@ func (msgPkt *chMsgPkt) UnmarshalJSON(data []byte) (err error) {
 	return nil
 }
 
+// TimeoutError is returned by the context aware request and read methods of the channel,
+// when ctx is done before the message from the peer is received.
+type TimeoutError struct {
+	Op  string //Method in which the timeout occurred
+	Err error  //Error from the context, context.DeadlineExceeded or context.Canceled
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out - %s", e.Op, e.Err.Error())
+}
+
+// IsTimeoutError returns true if err is a *TimeoutError.
+func IsTimeoutError(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
+// AbortError is returned by the request methods of the channel, when the peer responds to the request
+// with an abort message instead of the response.
+type AbortError struct {
+	Op     string    //Method in which the abort was received
+	Code   AbortCode //Machine readable code describing why the request was aborted
+	Reason string    //Human readable reason sent by the peer
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("%s aborted by peer with code %s - %s", e.Op, e.Code, e.Reason)
+}
+
+// IsAbortError returns true if err is an *AbortError.
+func IsAbortError(err error) bool {
+	_, ok := err.(*AbortError)
+	return ok
+}
+
+// abortError returns the abort in the response as *AbortError, if it is an abort message. Else it returns nil.
+func abortError(op string, response chMsgPkt) error {
+
+	if response.MessageID != MsgAbort {
+		return nil
+	}
+	msg, ok := response.Message.(jsonMsgAbort)
+	if !ok {
+		return fmt.Errorf("Message packet type error")
+	}
+	return &AbortError{Op: op, Code: msg.Code, Reason: msg.Reason}
+}
+
+// readContext reads the next message from the channel, waiting only until ctx is done.
+//
+// If ctx is done before a message is received, the channel is closed and a *TimeoutError is returned.
+// Closing the channel unblocks the pending read and ensures that a message arriving late
+// (e.g response to the timed out request) is not taken as the response to any later request.
+//
+// If a dispatcher is running on the channel, the next message not taken by the handlers of the dispatcher is returned.
+func (ch *Instance) readContext(ctx context.Context, op string) (message chMsgPkt, err error) {
+
+	ch.access.Lock()
+	dispatcher := ch.dispatcher
+	ch.access.Unlock()
+	if dispatcher != nil {
+		return dispatcher.read(ctx, op)
+	}
+
+	//Context that can never be done, read without the additional routine
+	if ctx.Done() == nil {
+		return ch.adapter.Read()
+	}
+
+	type readResult struct {
+		message chMsgPkt
+		err     error
+	}
+	result := make(chan readResult, 1)
+	go func() {
+		message, err := ch.adapter.Read()
+		result <- readResult{message, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.message, r.err
+	case <-ctx.Done():
+		return chMsgPkt{}, ch.timeout(ctx, op)
+	}
+}
+
+// timeout closes the channel as op timed out due to ctx being done and returns the timeout error.
+func (ch *Instance) timeout(ctx context.Context, op string) error {
+
+	logger.Info("Closing channel with", ch.PeerID(), "as", op, "timed out -", ctx.Err())
+	if errClose := ch.Close(); errClose != nil {
+		logger.Error("Error closing channel after timeout -", errClose)
+	}
+	return &TimeoutError{Op: op, Err: ctx.Err()}
+}
+
+// writeContext sends the message on the channel, if ctx is not yet done.
+//
+// If ctx is already done, message is not sent and a *TimeoutError is returned. The channel is not modified in this case.
+// Once started, the write is not interrupted as it is bounded by the write timeout of the adapter.
+func (ch *Instance) writeContext(ctx context.Context, op string, message chMsgPkt) (err error) {
+
+	if err = ctx.Err(); err != nil {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	return ch.adapter.Write(message)
+}
+
+// writeResponse writes the response to a request from the peer. If a dispatcher is running on the channel, the response
+// is recorded, so that the dispatcher does not decline the request once the handler returns.
+func (ch *Instance) writeResponse(message chMsgPkt) (err error) {
+
+	if err = ch.adapter.Write(message); err != nil {
+		return err
+	}
+
+	ch.access.Lock()
+	dispatcher := ch.dispatcher
+	ch.access.Unlock()
+	if dispatcher != nil {
+		dispatcher.setResponded(true)
+	}
+	return nil
+}
+
 // IdentityRequest sends an identity request and waits for identity response from the peer node.
-// If response is successfully received, it returns the peer id in the response message.
+//
+// A fresh nonce is sent along with the request as challenge. The peer should respond with its own nonce and
+// a signature, using the key of its on-chain id, on the transcript of the exchange (ids, nonces and ephemeral keys
+// of both the users) in the role of the responder. If the signature is valid, the transcript is signed in the role of
+// the requester using the credentials in selfID and sent to the peer as proof of self identity.
+// If the exchange is successful, it returns the peer id in the response message.
+//
+// An ephemeral key is sent along with the request to negotiate encryption. If the peer responds with its
+// ephemeral key, all further messages on the channel are encrypted using the keys derived from them.
+// As the keys are part of the signed transcript, a key stripped or replaced in between invalidates the proofs.
+// If the peer does not support encryption, the exchange fails unless encryption is configured as not required.
 func (ch *Instance) IdentityRequest(selfID identity.OffChainID) (peerID identity.OffChainID, err error) {
+	return ch.IdentityRequestContext(context.Background(), selfID)
+}
+
+// IdentityRequestContext is same as IdentityRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) IdentityRequestContext(ctx context.Context, selfID identity.OffChainID) (peerID identity.OffChainID, err error) {
+
+	nonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		return peerID, err
+	}
+	kx, err := newKeyExchange()
+	if err != nil {
+		return peerID, err
+	}
 
 	idRequestMsg := chMsgPkt{
 		Version:   Version,
 		MessageID: MsgIdentityRequest,
-		Message:   jsonMsgIdentity{selfID},
+		Message: jsonMsgIdentity{
+			ID:           selfID,
+			Nonce:        nonce,
+			EphemeralKey: kx.publicKey,
+		},
 	}
 
-	err = ch.adapter.Write(idRequestMsg)
+	err = ch.writeContext(ctx, "IdentityRequest", idRequestMsg)
 	if err != nil {
 		return peerID, err
 	}
 
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "IdentityRequest")
 	if err != nil {
 		return peerID, err
 	}
+	if err = abortError("IdentityRequest", response); err != nil {
+		return peerID, err
+	}
 
 	if response.MessageID != MsgIdentityResponse {
 		errMsg := ("Invalid response received for id request")
@@ -235,53 +483,212 @@ func (ch *Instance) IdentityRequest(selfID identity.OffChainID) (peerID identity
 		return peerID, fmt.Errorf(errMsg)
 	}
 
+	transcript := identityTranscript{
+		requester:      selfID.OnChainID,
+		responder:      msg.ID.OnChainID,
+		requesterNonce: nonce,
+		responderNonce: msg.Nonce,
+		requesterKey:   kx.publicKey,
+		responderKey:   msg.EphemeralKey,
+	}
+	err = verifyIdentityProof(msg.Signature, identityProofResponder, transcript)
+	if err != nil {
+		return peerID, err
+	}
+	if len(msg.EphemeralKey) == 0 && requireEncryption {
+		return peerID, fmt.Errorf("Peer does not support encryption")
+	}
+
+	signature, err := signIdentityProof(selfID, identityProofRequester, transcript)
+	if err != nil {
+		return peerID, err
+	}
+	proofMsg := chMsgPkt{
+		Version:   Version,
+		MessageID: MsgIdentityProof,
+		Message: jsonMsgIdentity{
+			ID:        selfID,
+			Signature: signature,
+		},
+	}
+	err = ch.writeContext(ctx, "IdentityRequest", proofMsg)
+	if err != nil {
+		return peerID, err
+	}
+
+	//Proof is sent unencrypted, as the peer switches to encryption only after verifying it
+	if len(msg.EphemeralKey) != 0 {
+		kx.peerKey = msg.EphemeralKey
+		if err = ch.enableEncryption(kx, true); err != nil {
+			return peerID, err
+		}
+	}
+
 	peerID = msg.ID
 	return peerID, nil
 }
 
-// IdentityRead reads the identity request sent by the peer node and returns the peer id in the message.
-func (ch *Instance) IdentityRead() (peerID identity.OffChainID, err error) {
+// IdentityRead reads the identity request sent by the peer node.
+// It returns the peer id and the nonce in the message, that should be signed in the response.
+// Ephemeral key of the peer in the request, if any, is retained for negotiating encryption in the response.
+func (ch *Instance) IdentityRead() (peerID identity.OffChainID, peerNonce []byte, err error) {
+	return ch.IdentityReadContext(context.Background())
+}
+
+// IdentityReadContext is same as IdentityRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) IdentityReadContext(ctx context.Context) (peerID identity.OffChainID, peerNonce []byte, err error) {
 
-	msg, err := ch.adapter.Read()
+	msg, err := ch.readContext(ctx, "IdentityRead")
+	if IsTimeoutError(err) {
+		return peerID, nil, err
+	}
 	if err != nil {
 		errMsg := "Error waiting for id request - connection dropped -" + err.Error()
-		return peerID, fmt.Errorf(errMsg)
+		return peerID, nil, fmt.Errorf(errMsg)
 	}
 
 	if msg.MessageID != MsgIdentityRequest {
 		errMsg := "First message is not id request"
-		return peerID, fmt.Errorf(errMsg)
+		return peerID, nil, fmt.Errorf(errMsg)
 	}
 
 	idRequestMsg, ok := msg.Message.(jsonMsgIdentity)
 	if !ok {
 		errMsg := ("Message packet type error")
-		return peerID, fmt.Errorf(errMsg)
+		return peerID, nil, fmt.Errorf(errMsg)
+	}
+
+	ch.keyExchange = nil
+	if len(idRequestMsg.EphemeralKey) != 0 {
+		ch.keyExchange = &keyExchange{peerKey: idRequestMsg.EphemeralKey}
+	} else if requireEncryption {
+		return peerID, nil, fmt.Errorf("Peer does not support encryption")
 	}
 
 	peerID = idRequestMsg.ID
-	return peerID, nil
+	return peerID, idRequestMsg.Nonce, nil
 }
 
 // IdentityRespond sends an identity response to the peer node with self id in the message.
-func (ch *Instance) IdentityRespond(selfID identity.OffChainID) (err error) {
+//
+// A fresh nonce is sent along as challenge for the peer, with a signature using the credentials in selfID on the
+// transcript of the exchange (including the peerNonce received in the identity request) in the role of the responder.
+// The nonce is returned, so that the proof from the peer can be verified using IdentityProofRead.
+//
+// If the peer sent an ephemeral key in the request, an ephemeral key is also sent in the response, so that
+// messages on the channel are encrypted once the proof from the peer is verified.
+func (ch *Instance) IdentityRespond(selfID, peerID identity.OffChainID, peerNonce []byte) (nonce []byte, err error) {
+
+	var selfKey, peerKey []byte
+	if ch.keyExchange != nil {
+		kx, err := newKeyExchange()
+		if err != nil {
+			return nil, err
+		}
+		kx.peerKey = ch.keyExchange.peerKey
+		ch.keyExchange = kx
+		selfKey, peerKey = kx.publicKey, kx.peerKey
+	}
+
+	nonce, err = GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		return nil, err
+	}
+	transcript := identityTranscript{
+		requester:      peerID.OnChainID,
+		responder:      selfID.OnChainID,
+		requesterNonce: peerNonce,
+		responderNonce: nonce,
+		requesterKey:   peerKey,
+		responderKey:   selfKey,
+	}
+	signature, err := signIdentityProof(selfID, identityProofResponder, transcript)
+	if err != nil {
+		return nil, err
+	}
 
 	selfIDMsg := chMsgPkt{
 		Version:   Version,
 		MessageID: MsgIdentityResponse,
-		Message:   jsonMsgIdentity{selfID},
+		Message: jsonMsgIdentity{
+			ID:           selfID,
+			Nonce:        nonce,
+			Signature:    signature,
+			EphemeralKey: selfKey,
+		},
 	}
 	err = ch.adapter.Write(selfIDMsg)
 	if err != nil {
 		errMsg := "Error responding to id request" + err.Error()
+		return nil, fmt.Errorf(errMsg)
+	}
+	return nonce, nil
+}
+
+// IdentityProofRead reads the identity proof sent by the peer node and verifies that it is a valid signature by peerID,
+// in the role of the requester, on the transcript of the exchange with peerNonce received in the identity request and
+// nonce sent in the identity response.
+// If encryption was negotiated, all further messages on the channel are encrypted once the proof is verified.
+func (ch *Instance) IdentityProofRead(selfID, peerID identity.OffChainID, peerNonce, nonce []byte) (err error) {
+	return ch.IdentityProofReadContext(context.Background(), selfID, peerID, peerNonce, nonce)
+}
+
+// IdentityProofReadContext is same as IdentityProofRead, but waits for the proof only until ctx is done.
+// If ctx is done before the proof is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) IdentityProofReadContext(ctx context.Context, selfID, peerID identity.OffChainID,
+	peerNonce, nonce []byte) (err error) {
+
+	msg, err := ch.readContext(ctx, "IdentityProofRead")
+	if err != nil {
+		return err
+	}
+
+	if msg.MessageID != MsgIdentityProof {
+		errMsg := "Invalid message received for id proof"
 		return fmt.Errorf(errMsg)
 	}
-	return nil
+
+	proofMsg, ok := msg.Message.(jsonMsgIdentity)
+	if !ok {
+		errMsg := ("Message packet type error")
+		return fmt.Errorf(errMsg)
+	}
+
+	if !identity.Equal(proofMsg.ID, peerID) {
+		return fmt.Errorf("Id in proof (%s) does not match the id in request (%s)", proofMsg.ID, peerID)
+	}
+
+	transcript := identityTranscript{
+		requester:      peerID.OnChainID,
+		responder:      selfID.OnChainID,
+		requesterNonce: peerNonce,
+		responderNonce: nonce,
+	}
+	kx := ch.keyExchange
+	ch.keyExchange = nil
+	if kx == nil || kx.privateKey == nil {
+		return verifyIdentityProof(proofMsg.Signature, identityProofRequester, transcript)
+	}
+
+	transcript.requesterKey, transcript.responderKey = kx.peerKey, kx.publicKey
+	err = verifyIdentityProof(proofMsg.Signature, identityProofRequester, transcript)
+	if err != nil {
+		return err
+	}
+	return ch.enableEncryption(kx, false)
 }
 
-// NewChannelRequest sends an new channel request and waits for new channel response from the peer node.
+// NewChannelRequest sends an new channel request with the proposed terms and waits for new channel response from the peer node.
 // If response is successfully received, it returns the acceptance status and reason in the response message.
-func (ch *Instance) NewChannelRequest(msgProtocolVersion string, contractStoreVersion []byte) (accept MessageStatus, reason string, err error) {
+func (ch *Instance) NewChannelRequest(msgProtocolVersion string, contractStoreVersion []byte, terms Terms) (accept MessageStatus, reason string, err error) {
+	return ch.NewChannelRequestContext(context.Background(), msgProtocolVersion, contractStoreVersion, terms)
+}
+
+// NewChannelRequestContext is same as NewChannelRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) NewChannelRequestContext(ctx context.Context, msgProtocolVersion string, contractStoreVersion []byte,
+	terms Terms) (accept MessageStatus, reason string, err error) {
 
 	idRequestMsg := chMsgPkt{
 		Version:   Version,
@@ -289,19 +696,23 @@ func (ch *Instance) NewChannelRequest(msgProtocolVersion string, contractStoreVe
 		Message: jsonMsgNewChannel{
 			MsgProtocolVersion:   msgProtocolVersion,
 			ContractStoreVersion: contractStoreVersion,
+			Terms:                terms,
 			Status:               MessageStatusRequire,
 		},
 	}
 	logger.Debug("Requesting new channel with the other node")
-	err = ch.adapter.Write(idRequestMsg)
+	err = ch.writeContext(ctx, "NewChannelRequest", idRequestMsg)
 	if err != nil {
 		return MessageStatusUnknown, "", err
 	}
 
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "NewChannelRequest")
 	if err != nil {
 		return MessageStatusUnknown, "", err
 	}
+	if err = abortError("NewChannelRequest", response); err != nil {
+		return MessageStatusUnknown, "", err
+	}
 
 	if response.MessageID != MsgNewChannelResponse {
 		errMsg := ("Invalid response received for id request")
@@ -324,41 +735,56 @@ func (ch *Instance) NewChannelRequest(msgProtocolVersion string, contractStoreVe
 		return MessageStatusUnknown, "", fmt.Errorf(errMsg)
 	}
 
+	if !terms.Equal(msg.Terms) {
+		errMsg := ("Channel terms modified by peer")
+		return MessageStatusUnknown, "", fmt.Errorf(errMsg)
+	}
+
 	accept = msg.Status
 	reason = msg.Reason
 
 	return accept, reason, nil
 }
 
-// NewChannelRead reads the new channel request sent by the peer node and returns the message protocol version and contract store version in the message.
-func (ch *Instance) NewChannelRead() (msgProtocolVersion string, contractStoreVersion []byte, err error) {
+// NewChannelRead reads the new channel request sent by the peer node and returns the message protocol version,
+// contract store version and the proposed terms in the message. Terms should be validated before accepting the request.
+func (ch *Instance) NewChannelRead() (msgProtocolVersion string, contractStoreVersion []byte, terms Terms, err error) {
+	return ch.NewChannelReadContext(context.Background())
+}
+
+// NewChannelReadContext is same as NewChannelRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) NewChannelReadContext(ctx context.Context) (msgProtocolVersion string, contractStoreVersion []byte,
+	terms Terms, err error) {
 	logger.Debug("Reading new channel request from other node")
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "NewChannelRead")
 	if err != nil {
-		return "", contractStoreVersion, err
+		return "", contractStoreVersion, terms, err
 	}
 
 	if response.MessageID != MsgNewChannelRequest {
 		errMsg := ("Invalid response received for id request")
-		return "", contractStoreVersion, fmt.Errorf(errMsg)
+		return "", contractStoreVersion, terms, fmt.Errorf(errMsg)
 	}
 
 	msg, ok := response.Message.(jsonMsgNewChannel)
 	if !ok {
 		errMsg := ("Message packet type error")
-		return "", contractStoreVersion, fmt.Errorf(errMsg)
+		return "", contractStoreVersion, terms, fmt.Errorf(errMsg)
 	}
 
 	if !containsStatus(RequestStatusList, msg.Status) {
 		errMsg := fmt.Sprintf("Invalid status received - %v. Use %v ", msg.Status, RequestStatusList)
-		return "", contractStoreVersion, fmt.Errorf(errMsg)
+		return "", contractStoreVersion, terms, fmt.Errorf(errMsg)
 	}
 
-	return msg.MsgProtocolVersion, msg.ContractStoreVersion, nil
+	return msg.MsgProtocolVersion, msg.ContractStoreVersion, msg.Terms, nil
 }
 
 // NewChannelRespond sends an new channel response to the peer node with acceptance status in the message.
-func (ch *Instance) NewChannelRespond(msgProtocolVersion string, contractStoreVersion []byte, accept MessageStatus, reason string) (err error) {
+// The terms in the request should be sent back unmodified.
+func (ch *Instance) NewChannelRespond(msgProtocolVersion string, contractStoreVersion []byte, terms Terms,
+	accept MessageStatus, reason string) (err error) {
 
 	responsePkt := chMsgPkt{
 		Version:   Version,
@@ -366,18 +792,24 @@ func (ch *Instance) NewChannelRespond(msgProtocolVersion string, contractStoreVe
 		Message: jsonMsgNewChannel{
 			MsgProtocolVersion:   msgProtocolVersion,
 			ContractStoreVersion: contractStoreVersion,
+			Terms:                terms,
 			Status:               accept,
 			Reason:               reason,
 		},
 	}
 	logger.Debug("Sending response to new channel request")
-	err = ch.adapter.Write(responsePkt)
-	return err
+	return ch.writeResponse(responsePkt)
 }
 
 // SessionIDRequest sends an sessiod id request with partial session id and waits for sessiod id response from the peer node.
 // If response is successfully received, it returns the complete sid and acceptance status in the response message.
 func (ch *Instance) SessionIDRequest(sid SessionID) (gotSid SessionID, status MessageStatus, err error) {
+	return ch.SessionIDRequestContext(context.Background(), sid)
+}
+
+// SessionIDRequestContext is same as SessionIDRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) SessionIDRequestContext(ctx context.Context, sid SessionID) (gotSid SessionID, status MessageStatus, err error) {
 
 	idRequestMsg := chMsgPkt{
 		Version:   Version,
@@ -388,15 +820,18 @@ func (ch *Instance) SessionIDRequest(sid SessionID) (gotSid SessionID, status Me
 		},
 	}
 	logger.Debug("Requesting session ID")
-	err = ch.adapter.Write(idRequestMsg)
+	err = ch.writeContext(ctx, "SessionIDRequest", idRequestMsg)
 	if err != nil {
 		return gotSid, "", err
 	}
 
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "SessionIDRequest")
 	if err != nil {
 		return gotSid, "", err
 	}
+	if err = abortError("SessionIDRequest", response); err != nil {
+		return gotSid, "", err
+	}
 
 	if response.MessageID != MsgSessionIDResponse {
 		errMsg := ("Invalid response received for id request")
@@ -419,8 +854,14 @@ func (ch *Instance) SessionIDRequest(sid SessionID) (gotSid SessionID, status Me
 
 // SessionIDRead reads the session id request sent by the peer node and returns the session id in the message.
 func (ch *Instance) SessionIDRead() (sid SessionID, err error) {
+	return ch.SessionIDReadContext(context.Background())
+}
+
+// SessionIDReadContext is same as SessionIDRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) SessionIDReadContext(ctx context.Context) (sid SessionID, err error) {
 	logger.Debug("Reading session ID request")
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "SessionIDRead")
 	if err != nil {
 		return sid, err
 	}
@@ -462,13 +903,18 @@ func (ch *Instance) SessionIDRespond(sid SessionID, status MessageStatus) (err e
 		},
 	}
 	logger.Debug("Responding to session ID request")
-	err = ch.adapter.Write(idRequestMsg)
-	return err
+	return ch.writeResponse(idRequestMsg)
 }
 
 // ContractAddrRequest sends a contract id request with details of deployed contract and waits for contract address response from the peer node.
 // If response is successfully received, it returns the acceptance status in the response message.
 func (ch *Instance) ContractAddrRequest(addr types.Address, id contract.Handler) (status MessageStatus, err error) {
+	return ch.ContractAddrRequestContext(context.Background(), addr, id)
+}
+
+// ContractAddrRequestContext is same as ContractAddrRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) ContractAddrRequestContext(ctx context.Context, addr types.Address, id contract.Handler) (status MessageStatus, err error) {
 
 	idRequestMsg := chMsgPkt{
 		Version:   Version,
@@ -480,15 +926,18 @@ func (ch *Instance) ContractAddrRequest(addr types.Address, id contract.Handler)
 		},
 	}
 	logger.Debug("Requesting Contract Address")
-	err = ch.adapter.Write(idRequestMsg)
+	err = ch.writeContext(ctx, "ContractAddrRequest", idRequestMsg)
 	if err != nil {
 		return "", err
 	}
 
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "ContractAddrRequest")
 	if err != nil {
 		return "", err
 	}
+	if err = abortError("ContractAddrRequest", response); err != nil {
+		return "", err
+	}
 
 	if response.MessageID != MsgContractAddrResponse {
 		errMsg := ("Invalid response received for id request")
@@ -511,8 +960,14 @@ func (ch *Instance) ContractAddrRequest(addr types.Address, id contract.Handler)
 
 // ContractAddrRead reads the contract address request sent by the peer node and returns the contract address and handler in the message.
 func (ch *Instance) ContractAddrRead() (addr types.Address, id contract.Handler, err error) {
+	return ch.ContractAddrReadContext(context.Background())
+}
+
+// ContractAddrReadContext is same as ContractAddrRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) ContractAddrReadContext(ctx context.Context) (addr types.Address, id contract.Handler, err error) {
 	logger.Debug("Reading Contract Address request")
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "ContractAddrRead")
 	if err != nil {
 		return addr, id, err
 	}
@@ -555,13 +1010,18 @@ func (ch *Instance) ContractAddrRespond(addr types.Address, id contract.Handler,
 		},
 	}
 	logger.Debug("Responding to Contract Address request")
-	err = ch.adapter.Write(idRequestMsg)
-	return err
+	return ch.writeResponse(idRequestMsg)
 }
 
 // NewMSCBaseStateRequest sends a new msc base request with partial signature and waits for msc base state response from the peer node.
 // If response is successfully received, it returns the fully signed msc base state and acceptance status in the response message.
 func (ch *Instance) NewMSCBaseStateRequest(newSignedState MSCBaseStateSigned) (responseState MSCBaseStateSigned, status MessageStatus, err error) {
+	return ch.NewMSCBaseStateRequestContext(context.Background(), newSignedState)
+}
+
+// NewMSCBaseStateRequestContext is same as NewMSCBaseStateRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) NewMSCBaseStateRequestContext(ctx context.Context, newSignedState MSCBaseStateSigned) (responseState MSCBaseStateSigned, status MessageStatus, err error) {
 
 	requestMsg := chMsgPkt{
 		Version:   Version,
@@ -572,15 +1032,18 @@ func (ch *Instance) NewMSCBaseStateRequest(newSignedState MSCBaseStateSigned) (r
 		},
 	}
 	logger.Debug("Requesting new MSC base state")
-	err = ch.adapter.Write(requestMsg)
+	err = ch.writeContext(ctx, "NewMSCBaseStateRequest", requestMsg)
 	if err != nil {
 		return responseState, "", err
 	}
 
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "NewMSCBaseStateRequest")
 	if err != nil {
 		return responseState, "", err
 	}
+	if err = abortError("NewMSCBaseStateRequest", response); err != nil {
+		return responseState, "", err
+	}
 
 	if response.MessageID != MsgMSCBaseStateResponse {
 		errMsg := ("Invalid response received for msc base state request")
@@ -603,8 +1066,14 @@ func (ch *Instance) NewMSCBaseStateRequest(newSignedState MSCBaseStateSigned) (r
 
 // NewMSCBaseStateRead reads the new msc base state request sent by the peer node and returns the msc base state in the message.
 func (ch *Instance) NewMSCBaseStateRead() (state MSCBaseStateSigned, err error) {
+	return ch.NewMSCBaseStateReadContext(context.Background())
+}
+
+// NewMSCBaseStateReadContext is same as NewMSCBaseStateRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) NewMSCBaseStateReadContext(ctx context.Context) (state MSCBaseStateSigned, err error) {
 	logger.Debug("Reading new MSC base state request")
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "NewMSCBaseStateRead")
 	if err != nil {
 		return state, err
 	}
@@ -645,13 +1114,18 @@ func (ch *Instance) NewMSCBaseStateRespond(state MSCBaseStateSigned, status Mess
 		},
 	}
 	logger.Debug("Responding to new MSC base state request")
-	err = ch.adapter.Write(response)
-	return err
+	return ch.writeResponse(response)
 }
 
 // NewVPCStateRequest sends a new vpc request with partial signature and waits for vpc state response from the peer node.
 // If response is successfully received, it returns the fully signed vpc state and acceptance status in the response message.
 func (ch *Instance) NewVPCStateRequest(newStateSigned VPCStateSigned) (responseState VPCStateSigned, status MessageStatus, err error) {
+	return ch.NewVPCStateRequestContext(context.Background(), newStateSigned)
+}
+
+// NewVPCStateRequestContext is same as NewVPCStateRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) NewVPCStateRequestContext(ctx context.Context, newStateSigned VPCStateSigned) (responseState VPCStateSigned, status MessageStatus, err error) {
 
 	requestMsg := chMsgPkt{
 		Version:   Version,
@@ -662,15 +1136,18 @@ func (ch *Instance) NewVPCStateRequest(newStateSigned VPCStateSigned) (responseS
 		},
 	}
 	logger.Debug("Requesting new VPC state")
-	err = ch.adapter.Write(requestMsg)
+	err = ch.writeContext(ctx, "NewVPCStateRequest", requestMsg)
 	if err != nil {
 		return responseState, "", err
 	}
 
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "NewVPCStateRequest")
 	if err != nil {
 		return responseState, "", err
 	}
+	if err = abortError("NewVPCStateRequest", response); err != nil {
+		return responseState, "", err
+	}
 
 	if response.MessageID != MsgVPCStateResponse {
 		errMsg := ("Invalid response received for vpc state request")
@@ -693,8 +1170,14 @@ func (ch *Instance) NewVPCStateRequest(newStateSigned VPCStateSigned) (responseS
 
 // NewVPCStateRead reads the new vpc state request sent by the peer node and returns the vpc state in the message.
 func (ch *Instance) NewVPCStateRead() (state VPCStateSigned, err error) {
+	return ch.NewVPCStateReadContext(context.Background())
+}
+
+// NewVPCStateReadContext is same as NewVPCStateRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) NewVPCStateReadContext(ctx context.Context) (state VPCStateSigned, err error) {
 	logger.Debug("Reading new VPC state request")
-	response, err := ch.adapter.Read()
+	response, err := ch.readContext(ctx, "NewVPCStateRead")
 	if err != nil {
 		return state, err
 	}
@@ -735,8 +1218,264 @@ func (ch *Instance) NewVPCStateRespond(state VPCStateSigned, status MessageStatu
 		},
 	}
 	logger.Debug("Responding to new VPC state request")
-	err = ch.adapter.Write(response)
-	return err
+	return ch.writeResponse(response)
+}
+
+// ResyncRequest sends a resync request with the session id and the latest vpc state of the channel and waits for
+// the resync response from the peer node, when resuming a channel on a new connection.
+// If response is successfully received, it returns the latest vpc state of the peer and acceptance status in the response message.
+func (ch *Instance) ResyncRequest(sid SessionID, latestState VPCStateSigned) (peerState VPCStateSigned, status MessageStatus, err error) {
+	return ch.ResyncRequestContext(context.Background(), sid, latestState)
+}
+
+// ResyncRequestContext is same as ResyncRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) ResyncRequestContext(ctx context.Context, sid SessionID, latestState VPCStateSigned) (peerState VPCStateSigned, status MessageStatus, err error) {
+
+	requestMsg := chMsgPkt{
+		Version:   Version,
+		MessageID: MsgResyncRequest,
+		Message: jsonMsgResync{
+			Sid:         sid,
+			LatestState: latestState,
+			Status:      MessageStatusRequire,
+		},
+	}
+	logger.Debug("Requesting resync")
+	err = ch.writeContext(ctx, "ResyncRequest", requestMsg)
+	if err != nil {
+		return peerState, "", err
+	}
+
+	response, err := ch.readContext(ctx, "ResyncRequest")
+	if err != nil {
+		return peerState, "", err
+	}
+	if err = abortError("ResyncRequest", response); err != nil {
+		return peerState, "", err
+	}
+
+	if response.MessageID != MsgResyncResponse {
+		errMsg := ("Invalid response received for resync request")
+		return peerState, "", fmt.Errorf(errMsg)
+	}
+
+	msg, ok := response.Message.(jsonMsgResync)
+	if !ok {
+		errMsg := ("Message packet type error")
+		return peerState, "", fmt.Errorf(errMsg)
+	}
+
+	if !sid.Equal(msg.Sid) {
+		errMsg := ("Session id modified by peer")
+		return peerState, "", fmt.Errorf(errMsg)
+	}
+
+	return msg.LatestState, msg.Status, nil
+}
+
+// ResyncRead reads the resync request sent by the peer node and returns the session id and latest vpc state in the message.
+func (ch *Instance) ResyncRead() (sid SessionID, peerState VPCStateSigned, err error) {
+	return ch.ResyncReadContext(context.Background())
+}
+
+// ResyncReadContext is same as ResyncRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) ResyncReadContext(ctx context.Context) (sid SessionID, peerState VPCStateSigned, err error) {
+	logger.Debug("Reading resync request")
+	request, err := ch.readContext(ctx, "ResyncRead")
+	if err != nil {
+		return sid, peerState, err
+	}
+
+	if request.MessageID != MsgResyncRequest {
+		errMsg := ("Invalid message received for resync request")
+		return sid, peerState, fmt.Errorf(errMsg)
+	}
+
+	msg, ok := request.Message.(jsonMsgResync)
+	if !ok {
+		errMsg := ("Message packet type error")
+		return sid, peerState, fmt.Errorf(errMsg)
+	}
+
+	if !containsStatus(RequestStatusList, msg.Status) {
+		errMsg := fmt.Sprintf("Invalid status received - %v. Use %v ", msg.Status, RequestStatusList)
+		return sid, peerState, fmt.Errorf(errMsg)
+	}
+
+	return msg.Sid, msg.LatestState, nil
+}
+
+// ResyncRespond sends a resync response to the peer node with the session id, latest vpc state of the channel
+// and acceptance status in the message.
+func (ch *Instance) ResyncRespond(sid SessionID, latestState VPCStateSigned, status MessageStatus) (err error) {
+
+	if !containsStatus(ResponseStatusList, status) {
+		errMsg := fmt.Sprintf("Invalid status received - %v. Use %v ", status, ResponseStatusList)
+		return fmt.Errorf(errMsg)
+	}
+
+	response := chMsgPkt{
+		Version:   Version,
+		MessageID: MsgResyncResponse,
+		Message: jsonMsgResync{
+			Sid:         sid,
+			LatestState: latestState,
+			Status:      status,
+		},
+	}
+	logger.Debug("Responding to resync request")
+	return ch.writeResponse(response)
+}
+
+// CloseChannelRequest sends a close channel request with the final vpc state proposed by this user and
+// waits for close channel response from the peer node.
+// It returns the final state in the response, signed by the peer, along with the status and reason for decline, if any.
+func (ch *Instance) CloseChannelRequest(finalState VPCStateSigned) (responseState VPCStateSigned, status MessageStatus, reason string, err error) {
+	return ch.CloseChannelRequestContext(context.Background(), finalState)
+}
+
+// CloseChannelRequestContext is same as CloseChannelRequest, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) CloseChannelRequestContext(ctx context.Context, finalState VPCStateSigned) (responseState VPCStateSigned, status MessageStatus, reason string, err error) {
+
+	requestMsg := chMsgPkt{
+		Version:   Version,
+		MessageID: MsgCloseChannelRequest,
+		Message: jsonMsgCloseChannel{
+			FinalState: finalState,
+			Status:     MessageStatusRequire,
+		},
+	}
+	logger.Debug("Requesting close channel")
+	err = ch.writeContext(ctx, "CloseChannelRequest", requestMsg)
+	if err != nil {
+		return responseState, "", "", err
+	}
+
+	response, err := ch.readContext(ctx, "CloseChannelRequest")
+	if err != nil {
+		return responseState, "", "", err
+	}
+	if err = abortError("CloseChannelRequest", response); err != nil {
+		return responseState, "", "", err
+	}
+
+	if response.MessageID != MsgCloseChannelResponse {
+		errMsg := ("Invalid response received for close channel request")
+		return responseState, "", "", fmt.Errorf(errMsg)
+	}
+
+	msg, ok := response.Message.(jsonMsgCloseChannel)
+	if !ok {
+		errMsg := ("Message packet type error")
+		return responseState, "", "", fmt.Errorf(errMsg)
+	}
+
+	return msg.FinalState, msg.Status, msg.Reason, nil
+}
+
+// CloseChannelRead reads the close channel request sent by the peer node and returns the final vpc state in the message.
+func (ch *Instance) CloseChannelRead() (finalState VPCStateSigned, err error) {
+	return ch.CloseChannelReadContext(context.Background())
+}
+
+// CloseChannelReadContext is same as CloseChannelRead, but waits for the request only until ctx is done.
+// If ctx is done before the request is received, the channel is closed and a *TimeoutError is returned.
+func (ch *Instance) CloseChannelReadContext(ctx context.Context) (finalState VPCStateSigned, err error) {
+	logger.Debug("Reading close channel request")
+	request, err := ch.readContext(ctx, "CloseChannelRead")
+	if err != nil {
+		return finalState, err
+	}
+
+	if request.MessageID != MsgCloseChannelRequest {
+		errMsg := ("Invalid message received for close channel request")
+		return finalState, fmt.Errorf(errMsg)
+	}
+
+	msg, ok := request.Message.(jsonMsgCloseChannel)
+	if !ok {
+		errMsg := ("Message packet type error")
+		return finalState, fmt.Errorf(errMsg)
+	}
+
+	if !containsStatus(RequestStatusList, msg.Status) {
+		errMsg := fmt.Sprintf("Invalid status received - %v. Use %v ", msg.Status, RequestStatusList)
+		return finalState, fmt.Errorf(errMsg)
+	}
+
+	return msg.FinalState, nil
+}
+
+// CloseChannelRespond sends a close channel response to the peer node with the final vpc state,
+// acceptance status and reason for decline (if any) in the message.
+func (ch *Instance) CloseChannelRespond(finalState VPCStateSigned, status MessageStatus, reason string) (err error) {
+
+	if !containsStatus(ResponseStatusList, status) {
+		errMsg := fmt.Sprintf("Invalid status received - %v. Use %v ", status, ResponseStatusList)
+		return fmt.Errorf(errMsg)
+	}
+
+	response := chMsgPkt{
+		Version:   Version,
+		MessageID: MsgCloseChannelResponse,
+		Message: jsonMsgCloseChannel{
+			FinalState: finalState,
+			Status:     status,
+			Reason:     reason,
+		},
+	}
+	logger.Debug("Responding to close channel request")
+	return ch.writeResponse(response)
+}
+
+// Abort sends an abort message to the peer node as response to the request with id requestID, instead of the
+// response message of the request. The request method of the peer returns an *AbortError with the code and reason.
+func (ch *Instance) Abort(requestID MessageID, code AbortCode, reason string) (err error) {
+
+	if !containsAbortCode(AbortCodeList, code) {
+		errMsg := fmt.Sprintf("Invalid abort code - %v. Use %v ", code, AbortCodeList)
+		return fmt.Errorf(errMsg)
+	}
+
+	logger.Debug("Aborting", requestID, "with code", code, "-", reason)
+	return ch.writeResponse(abortMessage(requestID, code, reason))
+}
+
+// abortMessage returns the abort message for the request with id requestID.
+func abortMessage(requestID MessageID, code AbortCode, reason string) chMsgPkt {
+	return chMsgPkt{
+		Version:   Version,
+		MessageID: MsgAbort,
+		Message: jsonMsgAbort{
+			Request: requestID,
+			Code:    code,
+			Reason:  reason,
+		},
+	}
+}
+
+// isRequest checks if the message id is that of a request, that can be aborted.
+func isRequest(id MessageID) bool {
+
+	switch id {
+	case MsgIdentityRequest, MsgNewChannelRequest, MsgSessionIDRequest, MsgContractAddrRequest,
+		MsgMSCBaseStateRequest, MsgVPCStateRequest, MsgResyncRequest, MsgCloseChannelRequest:
+		return true
+	}
+	return false
+}
+
+// containsAbortCode checks if the required value of abort code is present in the list.
+func containsAbortCode(list []AbortCode, requiredValue AbortCode) bool {
+	for _, value := range list {
+		if value == requiredValue {
+			return true
+		}
+	}
+	return false
 }
 
 // containsStatus checks of the required value of staus is present in the list.
@@ -17,6 +17,8 @@
 package channel
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -27,6 +29,7 @@ import (
 	"github.com/direct-state-transfer/dst-go/ethereum/contract"
 	"github.com/direct-state-transfer/dst-go/ethereum/types"
 	"github.com/direct-state-transfer/dst-go/identity"
+	"github.com/stretchr/testify/mock"
 )
 
 var testTime time.Time
@@ -202,6 +205,32 @@ func Test_chMsgPkt_UnmarshalJSON(t *testing.T) {
 						Password:         ""},
 				}},
 		},
+		{
+			name: "valid_MsgIdentityProof",
+			args: args{
+				data: []byte(`{
+				"version":"1.0",
+				"message_id":"MsgIdentityProof",
+				"message":{
+					"id":{
+						"on_chain_id":"0x932a74da117eb9288ea759487360cd700e7777e1",
+						"listener_ip_addr":"http://localhost:1250",
+						"listener_endpoint":"/state-channel"},
+					"signature":"c2lnbmF0dXJl"},
+				"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: false,
+			wantMsgPkt: chMsgPkt{
+				Version:   "1.0",
+				MessageID: MsgIdentityProof,
+				Message: jsonMsgIdentity{
+					ID: identity.OffChainID{
+						OnChainID:        types.HexToAddress("932a74da117eb9288ea759487360cd700e7777e1"),
+						ListenerIPAddr:   "http://localhost:1250",
+						ListenerEndpoint: "/state-channel"},
+					Signature: []byte("signature"),
+				}},
+		},
 		{
 			name: "invalid_MsgIdentityResponse",
 			args: args{
@@ -543,6 +572,144 @@ func Test_chMsgPkt_UnmarshalJSON(t *testing.T) {
 					Status: "require",
 				}},
 		},
+		{
+			name: "valid_MsgResyncRequest",
+			args: args{
+				data: []byte(`{
+					"version":"1.0",
+					"message_id":"MsgResyncRequest",
+					"message":{
+						"sid":{"sid_complete":100},
+						"latest_state":{
+							"vpc_state":{
+								"id":"c2FtcGxlLWlk",
+								"version":1,
+								"blocked_alice":10,
+								"blocked_bob":20
+							},
+							"sign_sender":"c2lnbi1zZW5kZXI=",
+							"sign_receiver":"c2lnbi1yZWNlaXZlcg=="
+						},
+						"status":"require"
+					},
+					"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: false,
+			wantMsgPkt: chMsgPkt{
+				Version:   "1.0",
+				MessageID: MsgResyncRequest,
+				Message: jsonMsgResync{
+					Sid: SessionID{SidComplete: big.NewInt(100)},
+					LatestState: VPCStateSigned{
+						VPCState: VPCState{
+							ID:              []byte("sample-id"),
+							Version:         big.NewInt(1),
+							BlockedSender:   big.NewInt(10),
+							BlockedReceiver: big.NewInt(20),
+						},
+						SignSender:   []byte("sign-sender"),
+						SignReceiver: []byte("sign-receiver"),
+					},
+					Status: "require",
+				}},
+		},
+		{
+			name: "valid_MsgCloseChannelResponse",
+			args: args{
+				data: []byte(`{
+					"version":"1.0",
+					"message_id":"MsgCloseChannelResponse",
+					"message":{
+						"final_state":{
+							"vpc_state":{
+								"id":"c2FtcGxlLWlk",
+								"version":1,
+								"blocked_alice":10,
+								"blocked_bob":20
+							},
+							"sign_sender":"c2lnbi1zZW5kZXI=",
+							"sign_receiver":"c2lnbi1yZWNlaXZlcg=="
+						},
+						"status":"decline",
+						"reason":"some-reason"
+					},
+					"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: false,
+			wantMsgPkt: chMsgPkt{
+				Version:   "1.0",
+				MessageID: MsgCloseChannelResponse,
+				Message: jsonMsgCloseChannel{
+					FinalState: VPCStateSigned{
+						VPCState: VPCState{
+							ID:              []byte("sample-id"),
+							Version:         big.NewInt(1),
+							BlockedSender:   big.NewInt(10),
+							BlockedReceiver: big.NewInt(20),
+						},
+						SignSender:   []byte("sign-sender"),
+						SignReceiver: []byte("sign-receiver"),
+					},
+					Status: "decline",
+					Reason: "some-reason",
+				}},
+		},
+		{
+			name: "invalid_MsgCloseChannelRequest",
+			args: args{
+				data: []byte(`{
+					"version":"1.0",
+					"message_id":"MsgCloseChannelRequest",
+					"message":{"final_state":"invalid"},
+					"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid_MsgResyncResponse",
+			args: args{
+				data: []byte(`{
+					"version":"1.0",
+					"message_id":"MsgResyncResponse",
+					"message":{"sid":"invalid"},
+					"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid_MsgAbort",
+			args: args{
+				data: []byte(`{
+					"version":"1.0",
+					"message_id":"MsgAbort",
+					"message":{
+						"request":"MsgNewChannelRequest",
+						"code":"version_mismatch",
+						"reason":"some-reason"
+					},
+					"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: false,
+			wantMsgPkt: chMsgPkt{
+				Version:   "1.0",
+				MessageID: MsgAbort,
+				Message: jsonMsgAbort{
+					Request: MsgNewChannelRequest,
+					Code:    AbortVersionMismatch,
+					Reason:  "some-reason",
+				}},
+		},
+		{
+			name: "invalid_MsgAbort",
+			args: args{
+				data: []byte(`{
+					"version":"1.0",
+					"message_id":"MsgAbort",
+					"message":{"code":10},
+					"timestamp":"0001-01-01T00:00:00Z"}`),
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid_MsgMSCBaseStateRequest",
 			args: args{
@@ -637,122 +804,238 @@ func Test_chMsgPkt_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+//idsWithCredentials returns copies of alice and bob ids with the credentials set for signing
+func idsWithCredentials() (alice, bob identity.OffChainID) {
+	alice, bob = aliceID, bobID
+	alice.SetCredentials(testKeyStore, alicePassword)
+	bob.SetCredentials(testKeyStore, bobPassword)
+	return alice, bob
+}
+
+//ChWriteCaptureMock waits for a message write to occur, responds to it and sends the written message on written.
+//It returns without waiting for the write, once done is closed.
+//It takes an initialized channel and should be invoked as go-routine
+func ChWriteCaptureMock(ch *genericChannelAdapter, respondWithErr error, written chan<- chMsgPkt, done <-chan struct{}) {
+
+	select {
+	case inMsg := <-ch.writeHandlerPipe.msgPacket:
+		inMsg.err = respondWithErr
+		ch.writeHandlerPipe.msgPacket <- inMsg
+		written <- inMsg.message
+	case <-done:
+	}
+}
+
+//ChIdentityPeerMock waits for the identity request to be written and sends the response returned by respond.
+//The identity proof written after that, if any, is sent on proofs.
+//It takes an initialized channel and should be invoked as go-routine
+func ChIdentityPeerMock(ch *genericChannelAdapter, respond func(request jsonMsgIdentity) jsonMsgPacket, respondWithErr error,
+	proofs chan<- chMsgPkt, done <-chan struct{}) {
+
+	inMsg := <-ch.writeHandlerPipe.msgPacket
+	inMsg.err = respondWithErr
+	ch.writeHandlerPipe.msgPacket <- inMsg
+	if respondWithErr != nil {
+		return
+	}
+
+	request, _ := inMsg.message.Message.(jsonMsgIdentity)
+	ch.readHandlerPipe.msgPacket <- respond(request)
+
+	ChWriteCaptureMock(ch, nil, proofs, done)
+}
+
 func Test_channel_IdentityRequest(t *testing.T) {
-	type args struct {
-		selfID identity.OffChainID
+
+	//Mocked peer does not support encryption, encrypted exchange is tested in Test_IdentityExchange_encryption
+	requireEncryption = false
+	defer func() {
+		requireEncryption = true
+	}()
+
+	alice, bob := idsWithCredentials()
+	peerNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
 	}
-	tests := []struct {
-		name              string
-		args              args
-		expectRequest     chMsgPkt
-		expectMatchInMock bool
-		mockResponse      jsonMsgPacket
-		responseError     error
-		wantErr           bool
-		wantPeerID        identity.OffChainID
-	}{
-		{
-			name: "valid-1",
-			args: args{
-				selfID: aliceID,
-			},
-			expectRequest: chMsgPkt{
-				MessageID: MsgIdentityRequest,
-				Message:   jsonMsgIdentity{aliceID},
-			},
-			expectMatchInMock: true,
-			mockResponse: jsonMsgPacket{
+
+	//Nonce and ephemeral key in the last identity request, the response does not include a key and
+	//hence encryption is not enabled
+	var requestNonce, requestKey []byte
+
+	//response returns a function that responds to the identity request with claimedID as id and the signature by signer
+	//in the role on the transcript with the nonce in request (if nonce is nil), claimedID and verifier
+	response := func(signer, claimedID identity.OffChainID, nonce []byte, verifier identity.OffChainID,
+		role identityProofRole) func(request jsonMsgIdentity) jsonMsgPacket {
+		return func(request jsonMsgIdentity) jsonMsgPacket {
+			if nonce == nil {
+				nonce = request.Nonce
+			}
+			requestNonce, requestKey = request.Nonce, request.EphemeralKey
+			transcript := identityTranscript{
+				requester:      verifier.OnChainID,
+				responder:      claimedID.OnChainID,
+				requesterNonce: nonce,
+				responderNonce: peerNonce,
+				requesterKey:   request.EphemeralKey,
+			}
+			signature, err := identity.SignHashWithPasswordEth(signer, transcript.hash(role))
+			if err != nil {
+				t.Errorf("SignHashWithPasswordEth() error = %v", err)
+			}
+			return jsonMsgPacket{
 				message: chMsgPkt{
 					MessageID: MsgIdentityResponse,
 					Message: jsonMsgIdentity{
-						ID: aliceID,
+						ID:        claimedID,
+						Nonce:     peerNonce,
+						Signature: signature,
 					},
-				}},
-			wantErr:    false,
-			wantPeerID: aliceID,
+				}}
+		}
+	}
+	fixedResponse := func(response jsonMsgPacket) func(request jsonMsgIdentity) jsonMsgPacket {
+		return func(request jsonMsgIdentity) jsonMsgPacket {
+			return response
+		}
+	}
+
+	tests := []struct {
+		name          string
+		selfID        identity.OffChainID
+		respond       func(request jsonMsgIdentity) jsonMsgPacket
+		responseError error
+		wantErr       bool
+	}{
+		{
+			name:    "valid-1",
+			selfID:  alice,
+			respond: response(bob, bob, nil, alice, identityProofResponder),
+			wantErr: false,
 		},
 		{
-			name: "invalid-message-id",
-			args: args{
-				selfID: aliceID,
-			},
-			expectRequest: chMsgPkt{
-				MessageID: MsgIdentityRequest,
-				Message: jsonMsgIdentity{
-					ID: aliceID,
-				}},
-			expectMatchInMock: true,
-			mockResponse: jsonMsgPacket{
+			name:    "signed-by-other-key",
+			selfID:  alice,
+			respond: response(alice, bob, nil, alice, identityProofResponder),
+			wantErr: true,
+		},
+		{
+			name:    "signed-on-other-nonce",
+			selfID:  alice,
+			respond: response(bob, bob, peerNonce, alice, identityProofResponder),
+			wantErr: true,
+		},
+		{
+			name:    "signed-for-other-verifier",
+			selfID:  alice,
+			respond: response(bob, bob, nil, bob, identityProofResponder),
+			wantErr: true,
+		},
+		{
+			name:    "signed-in-requester-role",
+			selfID:  alice,
+			respond: response(bob, bob, nil, alice, identityProofRequester),
+			wantErr: true,
+		},
+		{
+			name:    "self-credentials-not-set",
+			selfID:  aliceID,
+			respond: response(bob, bob, nil, alice, identityProofResponder),
+			wantErr: true,
+		},
+		{
+			name:   "invalid-message-id",
+			selfID: alice,
+			respond: fixedResponse(jsonMsgPacket{
 				message: chMsgPkt{
 					MessageID: MessageID("invalid-message-id"),
-				}},
+				}}),
 			wantErr: true,
 		},
 		{
-			name: "invalid-message-id",
-			args: args{
-				selfID: aliceID,
-			},
-			expectRequest: chMsgPkt{
-				MessageID: MsgIdentityRequest,
-				Message: jsonMsgIdentity{
-					ID: aliceID,
-				}},
-			expectMatchInMock: true,
-			mockResponse: jsonMsgPacket{
+			name:   "invalid-message",
+			selfID: alice,
+			respond: fixedResponse(jsonMsgPacket{
 				message: chMsgPkt{
 					MessageID: MsgIdentityResponse,
 					Message:   nil,
-				}},
+				}}),
 			wantErr: true,
 		},
 		{
 			name:          "write-error",
-			args:          args{},
+			selfID:        alice,
 			responseError: fmt.Errorf("write-error"),
 			wantErr:       true,
 		},
 		{
-			name: "read-error",
-			args: args{},
-			mockResponse: jsonMsgPacket{
+			name:   "read-error",
+			selfID: alice,
+			respond: fixedResponse(jsonMsgPacket{
 				message: chMsgPkt{},
-				err:     fmt.Errorf("read-error")},
+				err:     fmt.Errorf("read-error")}),
 			wantErr: true,
 		},
 	}
-	wg := &sync.WaitGroup{}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
 			ch, adapter := setupMockChannel()
 			adapter.connected = true
 
-			wg.Add(1)
-			go ChWriteReadMock(t, adapter, tt.expectRequest, tt.mockResponse, tt.responseError, tt.expectMatchInMock, wg)
+			proofs := make(chan chMsgPkt, 1)
+			done := make(chan struct{})
+			defer close(done)
+			go ChIdentityPeerMock(adapter, tt.respond, tt.responseError, proofs, done)
 
-			gotPeerID, err := ch.IdentityRequest(tt.args.selfID)
-			if err != nil {
-				t.Logf("channel.IdentityRequest() error = %v, wantErr %v", err, tt.wantErr)
-				if !tt.wantErr {
-					t.Fail()
-				}
+			gotPeerID, err := ch.IdentityRequest(tt.selfID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("channel.IdentityRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
 				return
 			}
-			if !reflect.DeepEqual(gotPeerID, tt.wantPeerID) {
-				t.Errorf("channel.IdentityRequest() = %v, want %v", gotPeerID, tt.wantPeerID)
+			if !reflect.DeepEqual(gotPeerID, bob) {
+				t.Errorf("channel.IdentityRequest() = %v, want %v", gotPeerID, bob)
+			}
+
+			proofMsg := <-proofs
+			proof, ok := proofMsg.Message.(jsonMsgIdentity)
+			if proofMsg.MessageID != MsgIdentityProof || !ok {
+				t.Fatalf("channel.IdentityRequest() proof = %+v, want %s message", proofMsg, MsgIdentityProof)
+			}
+			transcript := identityTranscript{
+				requester:      alice.OnChainID,
+				responder:      bob.OnChainID,
+				requesterNonce: requestNonce,
+				responderNonce: peerNonce,
+				requesterKey:   requestKey,
+			}
+			if err = verifyIdentityProof(proof.Signature, identityProofRequester, transcript); err != nil {
+				t.Errorf("channel.IdentityRequest() proof invalid - %v", err)
+			}
+			if ch.Encrypted() {
+				t.Errorf("channel.IdentityRequest() encryption enabled, want disabled as peer did not send ephemeral key")
 			}
-			wg.Wait() //Wait for mock object to exit
 		})
 	}
 }
 func Test_channel_IdentityRead(t *testing.T) {
+
+	//Mocked peer does not support encryption, encrypted exchange is tested in Test_IdentityExchange_encryption
+	requireEncryption = false
+	defer func() {
+		requireEncryption = true
+	}()
+
+	nonce := []byte("32-bytes-nonce-from-the-peer-xyz")
 	tests := []struct {
 		name            string
 		mockResponse    jsonMsgPacket
 		wantErr         bool
 		wantPeerID      identity.OffChainID
 		wantPeerIDMatch bool
+		wantNonce       []byte
 	}{
 		{
 			name: "valid-1",
@@ -760,12 +1043,14 @@ func Test_channel_IdentityRead(t *testing.T) {
 				message: chMsgPkt{
 					MessageID: MsgIdentityRequest,
 					Message: jsonMsgIdentity{
-						ID: aliceID,
+						ID:    aliceID,
+						Nonce: nonce,
 					},
 				}},
 			wantErr:         false,
 			wantPeerID:      aliceID,
 			wantPeerIDMatch: true,
+			wantNonce:       nonce,
 		},
 		{
 			name: "read-error",
@@ -819,7 +1104,7 @@ func Test_channel_IdentityRead(t *testing.T) {
 			wg.Add(1)
 			go ChReadMock(adapter, tt.mockResponse, wg)
 
-			gotPeerID, err := ch.IdentityRead()
+			gotPeerID, gotNonce, err := ch.IdentityRead()
 			if err != nil {
 				t.Logf("channel.IdentityRead() error = %v, wantErr %v", err, tt.wantErr)
 				if !tt.wantErr {
@@ -830,6 +1115,9 @@ func Test_channel_IdentityRead(t *testing.T) {
 			if !reflect.DeepEqual(gotPeerID, tt.wantPeerID) && tt.wantPeerIDMatch {
 				t.Errorf("channel.IdentityRead() = %v, want %v", gotPeerID, tt.wantPeerID)
 			}
+			if !bytes.Equal(gotNonce, tt.wantNonce) {
+				t.Errorf("channel.IdentityRead() nonce = %x, want %x", gotNonce, tt.wantNonce)
+			}
 
 			wg.Wait()
 		})
@@ -837,81 +1125,163 @@ func Test_channel_IdentityRead(t *testing.T) {
 }
 
 func Test_channel_IdentityRespond(t *testing.T) {
-	type args struct {
-		selfID identity.OffChainID
+
+	alice, bob := idsWithCredentials()
+	peerNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
 	}
+
 	tests := []struct {
-		name              string
-		args              args
-		expectResponse    chMsgPkt
-		expectMatchInMock bool
-		responseError     error
-		wantErr           bool
+		name          string
+		selfID        identity.OffChainID
+		peerNonce     []byte
+		responseError error
+		wantErr       bool
 	}{
 		{
-			name: "valid-1",
-			args: args{
-				selfID: aliceID,
-			},
-			expectResponse: chMsgPkt{
-				MessageID: MsgIdentityResponse,
-				Message: jsonMsgIdentity{
-					ID: aliceID,
-				},
-			},
-			expectMatchInMock: true,
-			responseError:     nil,
-			wantErr:           true,
+			name:      "valid-1",
+			selfID:    bob,
+			peerNonce: peerNonce,
+			wantErr:   false,
 		},
 		{
-			name: "id-mismatch",
-			args: args{
-				selfID: bobID,
-			},
-			expectResponse: chMsgPkt{
-				MessageID: MsgIdentityResponse,
-				Message: jsonMsgIdentity{
-					ID: aliceID,
-				},
-			},
-			expectMatchInMock: false,
-			responseError:     nil,
-			wantErr:           true,
+			name:      "credentials-not-set",
+			selfID:    bobID,
+			peerNonce: peerNonce,
+			wantErr:   true,
 		},
 		{
-			name: "wrong-msg-id",
-			args: args{
-				selfID: aliceID,
-			},
-			expectResponse: chMsgPkt{
-				MessageID: MsgIDForTest,
-			},
-			expectMatchInMock: false,
-			responseError:     nil,
-			wantErr:           true,
+			name:      "invalid-peer-nonce",
+			selfID:    bob,
+			peerNonce: []byte("less-than-32-bytes"),
+			wantErr:   true,
 		},
 		{
-			name: "wrong-message-packet-type",
-			args: args{
-				selfID: aliceID,
-			},
-			expectResponse: chMsgPkt{
-				MessageID: MsgIdentityResponse,
-				Message:   jsonMsgTypeForTest{},
-			},
-			expectMatchInMock: false,
-			responseError:     nil,
-			wantErr:           true,
-		},
-		{
-			name: "write-error",
-			args: args{
-				selfID: aliceID,
-			},
+			name:          "write-error",
+			selfID:        bob,
+			peerNonce:     peerNonce,
 			responseError: fmt.Errorf("write-error"),
 			wantErr:       true,
 		},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			written := make(chan chMsgPkt, 1)
+			done := make(chan struct{})
+			defer close(done)
+			go ChWriteCaptureMock(adapter, tt.responseError, written, done)
+
+			gotNonce, err := ch.IdentityRespond(tt.selfID, alice, tt.peerNonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("channel.IdentityRespond() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			responseMsg := <-written
+			response, ok := responseMsg.Message.(jsonMsgIdentity)
+			if responseMsg.MessageID != MsgIdentityResponse || !ok {
+				t.Fatalf("channel.IdentityRespond() response = %+v, want %s message", responseMsg, MsgIdentityResponse)
+			}
+			if !identity.Equal(response.ID, bob) {
+				t.Errorf("channel.IdentityRespond() id = %v, want %v", response.ID, bob)
+			}
+			if len(gotNonce) != identityNonceSize || !bytes.Equal(response.Nonce, gotNonce) {
+				t.Errorf("channel.IdentityRespond() nonce = %x, sent %x, want equal and %d bytes", gotNonce, response.Nonce, identityNonceSize)
+			}
+			transcript := identityTranscript{
+				requester:      alice.OnChainID,
+				responder:      bob.OnChainID,
+				requesterNonce: tt.peerNonce,
+				responderNonce: gotNonce,
+			}
+			if err = verifyIdentityProof(response.Signature, identityProofResponder, transcript); err != nil {
+				t.Errorf("channel.IdentityRespond() proof invalid - %v", err)
+			}
+		})
+	}
+}
+
+func Test_channel_IdentityProofRead(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+	peerNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	nonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	otherNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+
+	transcript := identityTranscript{
+		requester:      alice.OnChainID,
+		responder:      bob.OnChainID,
+		requesterNonce: peerNonce,
+		responderNonce: nonce,
+	}
+	otherNonceTranscript := transcript
+	otherNonceTranscript.responderNonce = otherNonce
+	otherPeerNonceTranscript := transcript
+	otherPeerNonceTranscript.requesterNonce = otherNonce
+
+	validProof, err := signIdentityProof(alice, identityProofRequester, transcript)
+	if err != nil {
+		t.Fatalf("signIdentityProof() error = %v", err)
+	}
+	otherNonceProof, err := signIdentityProof(alice, identityProofRequester, otherNonceTranscript)
+	if err != nil {
+		t.Fatalf("signIdentityProof() error = %v", err)
+	}
+	otherPeerNonceProof, err := signIdentityProof(alice, identityProofRequester, otherPeerNonceTranscript)
+	if err != nil {
+		t.Fatalf("signIdentityProof() error = %v", err)
+	}
+	otherKeyProof, err := identity.SignHashWithPasswordEth(bob, transcript.hash(identityProofRequester))
+	if err != nil {
+		t.Fatalf("SignHashWithPasswordEth() error = %v", err)
+	}
+	otherRoleProof, err := identity.SignHashWithPasswordEth(alice, transcript.hash(identityProofResponder))
+	if err != nil {
+		t.Fatalf("SignHashWithPasswordEth() error = %v", err)
+	}
+
+	proofMsg := func(id identity.OffChainID, signature []byte) jsonMsgPacket {
+		return jsonMsgPacket{
+			message: chMsgPkt{
+				MessageID: MsgIdentityProof,
+				Message: jsonMsgIdentity{
+					ID:        id,
+					Signature: signature,
+				},
+			}}
+	}
+
+	tests := []struct {
+		name         string
+		mockResponse jsonMsgPacket
+		wantErr      bool
+	}{
+		{"valid-1", proofMsg(aliceID, validProof), false},
+		{"signed-on-other-nonce", proofMsg(aliceID, otherNonceProof), true},
+		{"signed-on-other-peer-nonce", proofMsg(aliceID, otherPeerNonceProof), true},
+		{"signed-by-other-key", proofMsg(aliceID, otherKeyProof), true},
+		{"signed-in-responder-role", proofMsg(aliceID, otherRoleProof), true},
+		{"id-mismatch", proofMsg(bobID, validProof), true},
+		{"invalid-message-id", jsonMsgPacket{message: chMsgPkt{MessageID: MsgIdentityResponse}}, true},
+		{"invalid-message", jsonMsgPacket{message: chMsgPkt{MessageID: MsgIdentityProof, Message: nil}}, true},
+		{"read-error", jsonMsgPacket{message: chMsgPkt{}, err: fmt.Errorf("read-error")}, true},
+	}
 	wg := &sync.WaitGroup{}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -920,25 +1290,71 @@ func Test_channel_IdentityRespond(t *testing.T) {
 			adapter.connected = true
 
 			wg.Add(1)
-			go ChWriteMock(t, adapter, tt.expectResponse, tt.expectMatchInMock, tt.responseError, wg)
+			go ChReadMock(adapter, tt.mockResponse, wg)
 
-			err := ch.IdentityRespond(tt.args.selfID)
-			if err != nil {
-				t.Logf("channel.RespondToContractAddr() error = %v, wantErr %v", err, tt.wantErr)
-				if !tt.wantErr {
-					t.Fail()
-				}
-				return
+			err := ch.IdentityProofRead(bob, aliceID, peerNonce, nonce)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("channel.IdentityProofRead() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			wg.Wait()
 		})
 	}
 }
 
+func Test_channel_IdentityProofRead_ReplayedResponse(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+
+	//respond makes the listener with selfID respond to an identity request from peerID with peerNonce and
+	//returns the response sent by it
+	respond := func(selfID, peerID identity.OffChainID, peerNonce []byte) (ch *Instance, adapter *genericChannelAdapter,
+		response jsonMsgIdentity) {
+
+		ch, adapter = setupMockChannel()
+		adapter.connected = true
+
+		written := make(chan chMsgPkt, 1)
+		done := make(chan struct{})
+		defer close(done)
+		go ChWriteCaptureMock(adapter, nil, written, done)
+
+		if _, err := ch.IdentityRespond(selfID, peerID, peerNonce); err != nil {
+			t.Fatalf("channel.IdentityRespond() error = %v", err)
+		}
+		responseMsg := <-written
+		return ch, adapter, responseMsg.Message.(jsonMsgIdentity)
+	}
+
+	//Mallory dials bob claiming to be alice and gets the challenge nonce of bob
+	malloryNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	bobCh, bobAdapter, bobResponse := respond(bob, aliceID, malloryNonce)
+
+	//Mallory dials alice claiming to be bob, with the nonce of bob as challenge
+	_, _, aliceResponse := respond(alice, bobID, bobResponse.Nonce)
+
+	//Signature in the response of alice is passed back to bob as the proof of alice
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go ChReadMock(bobAdapter, jsonMsgPacket{message: chMsgPkt{
+		MessageID: MsgIdentityProof,
+		Message:   jsonMsgIdentity{ID: aliceID, Signature: aliceResponse.Signature},
+	}}, wg)
+
+	err = bobCh.IdentityProofRead(bob, aliceID, malloryNonce, bobResponse.Nonce)
+	wg.Wait()
+	if err == nil {
+		t.Errorf("channel.IdentityProofRead() error = nil, want non nil as the proof is the replayed response of the peer")
+	}
+}
+
 func Test_channel_NewChannelRequest(t *testing.T) {
 	type args struct {
 		msgProtocolVersion   string
 		contractStoreVersion []byte
+		terms                Terms
 	}
 	tests := []struct {
 		name              string
@@ -1063,6 +1479,72 @@ func Test_channel_NewChannelRequest(t *testing.T) {
 				}},
 			wantErr: true,
 		},
+		{
+			name: "accept-with-terms",
+			args: args{
+				msgProtocolVersion:   "1.0",
+				contractStoreVersion: []byte("v1.0"),
+				terms:                termsForTest,
+			},
+			expectRequest: chMsgPkt{
+				MessageID: MsgNewChannelRequest,
+				Message: jsonMsgNewChannel{
+					MsgProtocolVersion:   "1.0",
+					ContractStoreVersion: []byte("v1.0"),
+					Terms:                termsForTest,
+					Status:               MessageStatusRequire,
+				},
+			},
+			expectMatchInMock: true,
+			mockResponse: jsonMsgPacket{
+				message: chMsgPkt{
+					MessageID: MsgNewChannelResponse,
+					Message: jsonMsgNewChannel{
+						MsgProtocolVersion:   "1.0",
+						ContractStoreVersion: []byte("v1.0"),
+						Terms:                termsForTest,
+						Status:               MessageStatusAccept,
+						Reason:               "",
+					},
+				}},
+			wantErr:    false,
+			wantAccept: MessageStatusAccept,
+			wantReason: "",
+		},
+		{
+			name: "terms-modified-by-peer",
+			args: args{
+				msgProtocolVersion:   "1.0",
+				contractStoreVersion: []byte("v1.0"),
+				terms:                termsForTest,
+			},
+			expectRequest: chMsgPkt{
+				MessageID: MsgNewChannelRequest,
+				Message: jsonMsgNewChannel{
+					MsgProtocolVersion:   "1.0",
+					ContractStoreVersion: []byte("v1.0"),
+					Terms:                termsForTest,
+					Status:               MessageStatusRequire,
+				},
+			},
+			expectMatchInMock: true,
+			mockResponse: jsonMsgPacket{
+				message: chMsgPkt{
+					MessageID: MsgNewChannelResponse,
+					Message: jsonMsgNewChannel{
+						MsgProtocolVersion:   "1.0",
+						ContractStoreVersion: []byte("v1.0"),
+						Terms: Terms{
+							DepositSender:   termsForTest.DepositSender,
+							DepositReceiver: big.NewInt(0),
+							ConfirmTimeout:  termsForTest.ConfirmTimeout,
+						},
+						Status: MessageStatusAccept,
+						Reason: "",
+					},
+				}},
+			wantErr: true,
+		},
 		{
 			name: "invalid-message-id",
 			args: args{
@@ -1133,7 +1615,7 @@ func Test_channel_NewChannelRequest(t *testing.T) {
 			wg.Add(1)
 			go ChWriteReadMock(t, adapter, tt.expectRequest, tt.mockResponse, tt.responseError, tt.expectMatchInMock, wg)
 
-			gotAccept, gotReason, err := ch.NewChannelRequest(tt.args.msgProtocolVersion, tt.args.contractStoreVersion)
+			gotAccept, gotReason, err := ch.NewChannelRequest(tt.args.msgProtocolVersion, tt.args.contractStoreVersion, tt.args.terms)
 			if err != nil {
 				t.Logf("channel.NewChannelRequest() error = %v, wantErr %v", err, tt.wantErr)
 				if !tt.wantErr {
@@ -1159,6 +1641,7 @@ func Test_channel_NewChannelRead(t *testing.T) {
 		wantErr                  bool
 		wantMsgProtocolVersion   string
 		wantContractStoreVersion []byte
+		wantTerms                Terms
 	}{
 		{
 			name: "valid-1",
@@ -1168,12 +1651,14 @@ func Test_channel_NewChannelRead(t *testing.T) {
 					Message: jsonMsgNewChannel{
 						MsgProtocolVersion:   "1.0",
 						ContractStoreVersion: contractStoreVersionForTest,
+						Terms:                termsForTest,
 						Status:               MessageStatusRequire,
 					},
 				}},
 			wantErr:                  false,
 			wantMsgProtocolVersion:   "1.0",
 			wantContractStoreVersion: contractStoreVersionForTest,
+			wantTerms:                termsForTest,
 		},
 		{
 			name: "read-error",
@@ -1226,7 +1711,7 @@ func Test_channel_NewChannelRead(t *testing.T) {
 			wg.Add(1)
 			go ChReadMock(adapter, tt.mockResponse, wg)
 
-			msgProtocolVersion, contractStoreVersion, err := ch.NewChannelRead()
+			msgProtocolVersion, contractStoreVersion, terms, err := ch.NewChannelRead()
 			if err != nil {
 				t.Logf("channel.NewChannelRead() error = %v, wantErr %v", err, tt.wantErr)
 				if !tt.wantErr {
@@ -1243,6 +1728,10 @@ func Test_channel_NewChannelRead(t *testing.T) {
 				t.Errorf("channel.NewChannelRead() msgProtocolVersion = %v, wantMsgProtocolVersion %v", msgProtocolVersion, tt.wantMsgProtocolVersion)
 			}
 
+			if !terms.Equal(tt.wantTerms) {
+				t.Errorf("channel.NewChannelRead() terms = %v, wantTerms %v", terms, tt.wantTerms)
+			}
+
 			wg.Wait()
 		})
 	}
@@ -1252,6 +1741,7 @@ func Test_channel_NewChannelRespond(t *testing.T) {
 	type args struct {
 		msgProtocolVersion   string
 		contractStoreVersion []byte
+		terms                Terms
 		accept               MessageStatus
 		reason               string
 	}
@@ -1284,6 +1774,29 @@ func Test_channel_NewChannelRespond(t *testing.T) {
 			responseError:     nil,
 			wantErr:           false,
 		},
+		{
+			name: "accept-with-terms",
+			args: args{
+				msgProtocolVersion:   "1.0",
+				contractStoreVersion: contractStoreVersionForTest,
+				terms:                termsForTest,
+				accept:               MessageStatusAccept,
+				reason:               "",
+			},
+			expectResponse: chMsgPkt{
+				MessageID: MsgNewChannelResponse,
+				Message: jsonMsgNewChannel{
+					MsgProtocolVersion:   "1.0",
+					ContractStoreVersion: contractStoreVersionForTest,
+					Terms:                termsForTest,
+					Status:               MessageStatusAccept,
+					Reason:               "",
+				},
+			},
+			expectMatchInMock: true,
+			responseError:     nil,
+			wantErr:           false,
+		},
 		{
 			name: "decline",
 			args: args{
@@ -1348,7 +1861,7 @@ func Test_channel_NewChannelRespond(t *testing.T) {
 			wg.Add(1)
 			go ChWriteMock(t, adapter, tt.expectResponse, tt.expectMatchInMock, tt.responseError, wg)
 
-			err := ch.NewChannelRespond(tt.args.msgProtocolVersion, tt.args.contractStoreVersion, tt.args.accept, tt.args.reason)
+			err := ch.NewChannelRespond(tt.args.msgProtocolVersion, tt.args.contractStoreVersion, tt.args.terms, tt.args.accept, tt.args.reason)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("channel.NewChannelRespond() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -3342,3 +3855,656 @@ func Test_channel_SessionIdRespond(t *testing.T) {
 		})
 	}
 }
+
+func Test_channel_ResyncRequest(t *testing.T) {
+
+	sid := SessionID{SidComplete: big.NewInt(100)}
+	ownState := VPCStateSigned{
+		VPCState: VPCState{
+			ID:              []byte("some-valid-id"),
+			BlockedSender:   big.NewInt(10),
+			BlockedReceiver: big.NewInt(10),
+			Version:         big.NewInt(10),
+		},
+		SignSender:   []byte("sender-signature"),
+		SignReceiver: []byte("receiver-signature"),
+	}
+	peerState := ownState
+	peerState.VPCState.Version = big.NewInt(11)
+
+	request := chMsgPkt{
+		MessageID: MsgResyncRequest,
+		Message:   jsonMsgResync{Sid: sid, LatestState: ownState, Status: MessageStatusRequire},
+	}
+	response := func(sid SessionID, status MessageStatus) jsonMsgPacket {
+		return jsonMsgPacket{message: chMsgPkt{
+			MessageID: MsgResyncResponse,
+			Message:   jsonMsgResync{Sid: sid, LatestState: peerState, Status: status},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		mockResponse  jsonMsgPacket
+		responseError error
+		wantErr       bool
+		wantState     VPCStateSigned
+		wantStatus    MessageStatus
+	}{
+		{"valid-accept", response(sid, MessageStatusAccept), nil, false, peerState, MessageStatusAccept},
+		{"valid-decline", response(sid, MessageStatusDecline), nil, false, peerState, MessageStatusDecline},
+		{"sid-modified", response(SessionID{SidComplete: big.NewInt(101)}, MessageStatusAccept), nil, true, VPCStateSigned{}, ""},
+		{"invalid-message-id", jsonMsgPacket{message: chMsgPkt{MessageID: MsgVPCStateResponse}}, nil, true, VPCStateSigned{}, ""},
+		{"invalid-message", jsonMsgPacket{message: chMsgPkt{MessageID: MsgResyncResponse}}, nil, true, VPCStateSigned{}, ""},
+		{"read-error", jsonMsgPacket{err: fmt.Errorf("read-error")}, nil, true, VPCStateSigned{}, ""},
+		{"write-error", jsonMsgPacket{}, fmt.Errorf("write-error"), true, VPCStateSigned{}, ""},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			wg.Add(1)
+			go ChWriteReadMock(t, adapter, request, tt.mockResponse, tt.responseError, true, wg)
+
+			gotState, gotStatus, err := ch.ResyncRequest(sid, ownState)
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("channel.ResyncRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotState.Equal(tt.wantState) || gotStatus != tt.wantStatus {
+				t.Errorf("channel.ResyncRequest() = %v, %v, want %v, %v", gotState, gotStatus, tt.wantState, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_channel_ResyncRead(t *testing.T) {
+
+	sid := SessionID{SidComplete: big.NewInt(100)}
+	state := VPCStateSigned{
+		VPCState: VPCState{
+			ID:              []byte("some-valid-id"),
+			BlockedSender:   big.NewInt(10),
+			BlockedReceiver: big.NewInt(10),
+			Version:         big.NewInt(10),
+		},
+		SignSender:   []byte("sender-signature"),
+		SignReceiver: []byte("receiver-signature"),
+	}
+	request := func(status MessageStatus) jsonMsgPacket {
+		return jsonMsgPacket{message: chMsgPkt{
+			MessageID: MsgResyncRequest,
+			Message:   jsonMsgResync{Sid: sid, LatestState: state, Status: status},
+		}}
+	}
+
+	tests := []struct {
+		name         string
+		mockResponse jsonMsgPacket
+		wantErr      bool
+	}{
+		{"valid", request(MessageStatusRequire), false},
+		{"invalid-status-accept", request(MessageStatusAccept), true},
+		{"invalid-message-id", jsonMsgPacket{message: chMsgPkt{MessageID: MsgVPCStateRequest}}, true},
+		{"invalid-message", jsonMsgPacket{message: chMsgPkt{MessageID: MsgResyncRequest}}, true},
+		{"read-error", jsonMsgPacket{err: fmt.Errorf("read-error")}, true},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			wg.Add(1)
+			go ChReadMock(adapter, tt.mockResponse, wg)
+
+			gotSid, gotState, err := ch.ResyncRead()
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("channel.ResyncRead() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotSid.Equal(sid) || !gotState.Equal(state) {
+				t.Errorf("channel.ResyncRead() = %v, %v, want %v, %v", gotSid, gotState, sid, state)
+			}
+		})
+	}
+}
+
+func Test_channel_ResyncRespond(t *testing.T) {
+
+	sid := SessionID{SidComplete: big.NewInt(100)}
+
+	tests := []struct {
+		name          string
+		status        MessageStatus
+		responseError error
+		wantErr       bool
+	}{
+		{"valid-accept", MessageStatusAccept, nil, false},
+		{"valid-decline", MessageStatusDecline, nil, false},
+		{"invalid-status", MessageStatusRequire, nil, true},
+		{"write-error", MessageStatusAccept, fmt.Errorf("write-error"), true},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			expectResponse := chMsgPkt{
+				MessageID: MsgResyncResponse,
+				Message:   jsonMsgResync{Sid: sid, Status: tt.status},
+			}
+			if tt.status == MessageStatusRequire {
+				//Invalid status is rejected before writing
+				err := ch.ResyncRespond(sid, VPCStateSigned{}, tt.status)
+				if err == nil {
+					t.Errorf("channel.ResyncRespond() error = nil, want non nil")
+				}
+				return
+			}
+
+			wg.Add(1)
+			go ChWriteMock(t, adapter, expectResponse, true, tt.responseError, wg)
+
+			err := ch.ResyncRespond(sid, VPCStateSigned{}, tt.status)
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("channel.ResyncRespond() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_channel_CloseChannelRequest(t *testing.T) {
+
+	ownState := VPCStateSigned{
+		VPCState: VPCState{
+			ID:              []byte("some-valid-id"),
+			BlockedSender:   big.NewInt(10),
+			BlockedReceiver: big.NewInt(10),
+			Version:         big.NewInt(10),
+		},
+		SignSender: []byte("sender-signature"),
+	}
+	peerState := ownState
+	peerState.SignReceiver = []byte("receiver-signature")
+
+	request := chMsgPkt{
+		MessageID: MsgCloseChannelRequest,
+		Message:   jsonMsgCloseChannel{FinalState: ownState, Status: MessageStatusRequire},
+	}
+	response := func(status MessageStatus, reason string) jsonMsgPacket {
+		return jsonMsgPacket{message: chMsgPkt{
+			MessageID: MsgCloseChannelResponse,
+			Message:   jsonMsgCloseChannel{FinalState: peerState, Status: status, Reason: reason},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		mockResponse  jsonMsgPacket
+		responseError error
+		wantErr       bool
+		wantStatus    MessageStatus
+		wantReason    string
+	}{
+		{"valid-accept", response(MessageStatusAccept, ""), nil, false, MessageStatusAccept, ""},
+		{"valid-decline", response(MessageStatusDecline, "some-reason"), nil, false, MessageStatusDecline, "some-reason"},
+		{"invalid-message-id", jsonMsgPacket{message: chMsgPkt{MessageID: MsgVPCStateResponse}}, nil, true, "", ""},
+		{"invalid-message", jsonMsgPacket{message: chMsgPkt{MessageID: MsgCloseChannelResponse}}, nil, true, "", ""},
+		{"read-error", jsonMsgPacket{err: fmt.Errorf("read-error")}, nil, true, "", ""},
+		{"write-error", jsonMsgPacket{}, fmt.Errorf("write-error"), true, "", ""},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			wg.Add(1)
+			go ChWriteReadMock(t, adapter, request, tt.mockResponse, tt.responseError, true, wg)
+
+			gotState, gotStatus, gotReason, err := ch.CloseChannelRequest(ownState)
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("channel.CloseChannelRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotState.Equal(peerState) || gotStatus != tt.wantStatus || gotReason != tt.wantReason {
+				t.Errorf("channel.CloseChannelRequest() = %v, %v, %v, want %v, %v, %v",
+					gotState, gotStatus, gotReason, peerState, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_channel_CloseChannelRead(t *testing.T) {
+
+	state := VPCStateSigned{
+		VPCState: VPCState{
+			ID:              []byte("some-valid-id"),
+			BlockedSender:   big.NewInt(10),
+			BlockedReceiver: big.NewInt(10),
+			Version:         big.NewInt(10),
+		},
+		SignSender:   []byte("sender-signature"),
+		SignReceiver: []byte("receiver-signature"),
+	}
+	request := func(status MessageStatus) jsonMsgPacket {
+		return jsonMsgPacket{message: chMsgPkt{
+			MessageID: MsgCloseChannelRequest,
+			Message:   jsonMsgCloseChannel{FinalState: state, Status: status},
+		}}
+	}
+
+	tests := []struct {
+		name         string
+		mockResponse jsonMsgPacket
+		wantErr      bool
+	}{
+		{"valid", request(MessageStatusRequire), false},
+		{"invalid-status-accept", request(MessageStatusAccept), true},
+		{"invalid-message-id", jsonMsgPacket{message: chMsgPkt{MessageID: MsgVPCStateRequest}}, true},
+		{"invalid-message", jsonMsgPacket{message: chMsgPkt{MessageID: MsgCloseChannelRequest}}, true},
+		{"read-error", jsonMsgPacket{err: fmt.Errorf("read-error")}, true},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			wg.Add(1)
+			go ChReadMock(adapter, tt.mockResponse, wg)
+
+			gotState, err := ch.CloseChannelRead()
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("channel.CloseChannelRead() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotState.Equal(state) {
+				t.Errorf("channel.CloseChannelRead() = %v, want %v", gotState, state)
+			}
+		})
+	}
+}
+
+func Test_channel_CloseChannelRespond(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		status        MessageStatus
+		reason        string
+		responseError error
+		wantErr       bool
+	}{
+		{"valid-accept", MessageStatusAccept, "", nil, false},
+		{"valid-decline", MessageStatusDecline, "some-reason", nil, false},
+		{"invalid-status", MessageStatusRequire, "", nil, true},
+		{"write-error", MessageStatusAccept, "", fmt.Errorf("write-error"), true},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			expectResponse := chMsgPkt{
+				MessageID: MsgCloseChannelResponse,
+				Message:   jsonMsgCloseChannel{Status: tt.status, Reason: tt.reason},
+			}
+			if tt.status == MessageStatusRequire {
+				//Invalid status is rejected before writing
+				err := ch.CloseChannelRespond(VPCStateSigned{}, tt.status, tt.reason)
+				if err == nil {
+					t.Errorf("channel.CloseChannelRespond() error = nil, want non nil")
+				}
+				return
+			}
+
+			wg.Add(1)
+			go ChWriteMock(t, adapter, expectResponse, true, tt.responseError, wg)
+
+			err := ch.CloseChannelRespond(VPCStateSigned{}, tt.status, tt.reason)
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("channel.CloseChannelRespond() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_channel_RequestContext(t *testing.T) {
+
+	//Context aware request and read methods, called with the given context
+	tests := []struct {
+		name string
+		call func(ctx context.Context, ch *Instance) error
+	}{
+		{"IdentityRequest", func(ctx context.Context, ch *Instance) error {
+			_, err := ch.IdentityRequestContext(ctx, aliceID)
+			return err
+		}},
+		{"IdentityRead", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.IdentityReadContext(ctx)
+			return err
+		}},
+		{"IdentityProofRead", func(ctx context.Context, ch *Instance) error {
+			return ch.IdentityProofReadContext(ctx, bobID, aliceID, nil, nil)
+		}},
+		{"NewChannelRequest", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.NewChannelRequestContext(ctx, Version, contractStoreVersionForTest, termsForTest)
+			return err
+		}},
+		{"NewChannelRead", func(ctx context.Context, ch *Instance) error {
+			_, _, _, err := ch.NewChannelReadContext(ctx)
+			return err
+		}},
+		{"SessionIDRequest", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.SessionIDRequestContext(ctx, SessionID{})
+			return err
+		}},
+		{"SessionIDRead", func(ctx context.Context, ch *Instance) error {
+			_, err := ch.SessionIDReadContext(ctx)
+			return err
+		}},
+		{"ContractAddrRequest", func(ctx context.Context, ch *Instance) error {
+			_, err := ch.ContractAddrRequestContext(ctx, types.Address{}, contract.Handler{})
+			return err
+		}},
+		{"ContractAddrRead", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.ContractAddrReadContext(ctx)
+			return err
+		}},
+		{"NewMSCBaseStateRequest", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.NewMSCBaseStateRequestContext(ctx, MSCBaseStateSigned{})
+			return err
+		}},
+		{"NewMSCBaseStateRead", func(ctx context.Context, ch *Instance) error {
+			_, err := ch.NewMSCBaseStateReadContext(ctx)
+			return err
+		}},
+		{"NewVPCStateRequest", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.NewVPCStateRequestContext(ctx, VPCStateSigned{})
+			return err
+		}},
+		{"NewVPCStateRead", func(ctx context.Context, ch *Instance) error {
+			_, err := ch.NewVPCStateReadContext(ctx)
+			return err
+		}},
+		{"ResyncRequest", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.ResyncRequestContext(ctx, SessionID{}, VPCStateSigned{})
+			return err
+		}},
+		{"ResyncRead", func(ctx context.Context, ch *Instance) error {
+			_, _, err := ch.ResyncReadContext(ctx)
+			return err
+		}},
+		{"CloseChannelRequest", func(ctx context.Context, ch *Instance) error {
+			_, _, _, err := ch.CloseChannelRequestContext(ctx, VPCStateSigned{})
+			return err
+		}},
+		{"CloseChannelRead", func(ctx context.Context, ch *Instance) error {
+			_, err := ch.CloseChannelReadContext(ctx)
+			return err
+		}},
+	}
+
+	//newBlockingAdapter returns an adapter on which read blocks until it is closed
+	newBlockingAdapter := func() *MockReadWriteCloser {
+		closed := make(chan struct{})
+		adapter := &MockReadWriteCloser{}
+		adapter.On("Write", mock.Anything).Return(nil)
+		adapter.On("Read").Run(func(args mock.Arguments) {
+			<-closed
+		}).Return(chMsgPkt{}, fmt.Errorf("channel closed"))
+		adapter.On("Close").Run(func(args mock.Arguments) {
+			close(closed)
+		}).Return(nil).Once()
+		return adapter
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"_deadline_exceeded", func(t *testing.T) {
+			adapter := newBlockingAdapter()
+			ch := &Instance{adapter: adapter}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			err := tt.call(ctx, ch)
+			if !IsTimeoutError(err) {
+				t.Fatalf("%sContext() error = %v, want timeout error", tt.name, err)
+			}
+			if err.(*TimeoutError).Err != context.DeadlineExceeded {
+				t.Errorf("%sContext() timeout error cause = %v, want %v", tt.name, err.(*TimeoutError).Err, context.DeadlineExceeded)
+			}
+			//Channel should be closed after timeout
+			adapter.AssertNumberOfCalls(t, "Close", 1)
+		})
+		t.Run(tt.name+"_cancelled_before_call", func(t *testing.T) {
+			adapter := newBlockingAdapter()
+			ch := &Instance{adapter: adapter}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := tt.call(ctx, ch)
+			if !IsTimeoutError(err) {
+				t.Fatalf("%sContext() error = %v, want timeout error", tt.name, err)
+			}
+			//Request should not be sent once the context is done
+			adapter.AssertNotCalled(t, "Write", mock.Anything)
+		})
+	}
+}
+
+func Test_channel_readContext(t *testing.T) {
+
+	t.Run("message_before_deadline", func(t *testing.T) {
+		wantMsg := chMsgPkt{Version: Version, MessageID: MsgIdentityRequest}
+		adapter := &MockReadWriteCloser{}
+		adapter.On("Read").Return(wantMsg, nil)
+		ch := &Instance{adapter: adapter}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		gotMsg, err := ch.readContext(ctx, "test")
+		if err != nil {
+			t.Fatalf("readContext() error = %v, want nil", err)
+		}
+		if !reflect.DeepEqual(gotMsg, wantMsg) {
+			t.Errorf("readContext() = %v, want %v", gotMsg, wantMsg)
+		}
+		adapter.AssertNotCalled(t, "Close")
+	})
+	t.Run("read_error", func(t *testing.T) {
+		readErr := fmt.Errorf("read error")
+		adapter := &MockReadWriteCloser{}
+		adapter.On("Read").Return(chMsgPkt{}, readErr)
+		ch := &Instance{adapter: adapter}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := ch.readContext(ctx, "test")
+		if err != readErr || IsTimeoutError(err) {
+			t.Errorf("readContext() error = %v, want %v", err, readErr)
+		}
+	})
+}
+
+func Test_IsTimeoutError(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout_error", &TimeoutError{Op: "test", Err: context.DeadlineExceeded}, true},
+		{"other_error", fmt.Errorf("test"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTimeoutError(tt.err); got != tt.want {
+				t.Errorf("IsTimeoutError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_channel_Abort(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		code          AbortCode
+		responseError error
+		wantErr       bool
+	}{
+		{"valid", AbortPolicyRejection, nil, false},
+		{"invalid-code", AbortCode("some-code"), nil, true},
+		{"write-error", AbortInternalError, fmt.Errorf("write-error"), true},
+	}
+	wg := &sync.WaitGroup{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			if !containsAbortCode(AbortCodeList, tt.code) {
+				//Invalid code is rejected before writing
+				err := ch.Abort(MsgVPCStateRequest, tt.code, "some-reason")
+				if err == nil {
+					t.Errorf("channel.Abort() error = nil, want non nil")
+				}
+				return
+			}
+
+			expectMsg := chMsgPkt{
+				MessageID: MsgAbort,
+				Message:   jsonMsgAbort{Request: MsgVPCStateRequest, Code: tt.code, Reason: "some-reason"},
+			}
+			wg.Add(1)
+			go ChWriteMock(t, adapter, expectMsg, true, tt.responseError, wg)
+
+			err := ch.Abort(MsgVPCStateRequest, tt.code, "some-reason")
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("channel.Abort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_channel_RequestAborted(t *testing.T) {
+
+	//Request methods, that should return the abort received from the peer as *AbortError
+	tests := []struct {
+		name string
+		call func(ch *Instance) error
+	}{
+		{"IdentityRequest", func(ch *Instance) error {
+			_, err := ch.IdentityRequest(aliceID)
+			return err
+		}},
+		{"NewChannelRequest", func(ch *Instance) error {
+			_, _, err := ch.NewChannelRequest(Version, contractStoreVersionForTest, termsForTest)
+			return err
+		}},
+		{"SessionIDRequest", func(ch *Instance) error {
+			_, _, err := ch.SessionIDRequest(SessionID{})
+			return err
+		}},
+		{"ContractAddrRequest", func(ch *Instance) error {
+			_, err := ch.ContractAddrRequest(types.Address{}, contract.Handler{})
+			return err
+		}},
+		{"NewMSCBaseStateRequest", func(ch *Instance) error {
+			_, _, err := ch.NewMSCBaseStateRequest(MSCBaseStateSigned{})
+			return err
+		}},
+		{"NewVPCStateRequest", func(ch *Instance) error {
+			_, _, err := ch.NewVPCStateRequest(VPCStateSigned{})
+			return err
+		}},
+		{"ResyncRequest", func(ch *Instance) error {
+			_, _, err := ch.ResyncRequest(SessionID{}, VPCStateSigned{})
+			return err
+		}},
+		{"CloseChannelRequest", func(ch *Instance) error {
+			_, _, _, err := ch.CloseChannelRequest(VPCStateSigned{})
+			return err
+		}},
+	}
+	abort := jsonMsgPacket{message: chMsgPkt{
+		MessageID: MsgAbort,
+		Message:   jsonMsgAbort{Code: AbortInsufficientBalance, Reason: "some-reason"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ch, adapter := setupMockChannel()
+			adapter.connected = true
+
+			go func() {
+				request := <-adapter.writeHandlerPipe.msgPacket
+				adapter.writeHandlerPipe.msgPacket <- request
+				adapter.readHandlerPipe.msgPacket <- abort
+			}()
+
+			err := tt.call(ch)
+			abortErr, ok := err.(*AbortError)
+			if !ok {
+				t.Fatalf("%s() error = %v, want *AbortError", tt.name, err)
+			}
+			if abortErr.Op != tt.name || abortErr.Code != AbortInsufficientBalance || abortErr.Reason != "some-reason" {
+				t.Errorf("%s() error = %+v, want op %s, code %s and reason some-reason",
+					tt.name, abortErr, tt.name, AbortInsufficientBalance)
+			}
+		})
+	}
+}
+
+func Test_IsAbortError(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"abort_error", &AbortError{Op: "test", Code: AbortInternalError}, true},
+		{"timeout_error", &TimeoutError{Op: "test", Err: context.DeadlineExceeded}, false},
+		{"other_error", fmt.Errorf("test"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAbortError(tt.err); got != tt.want {
+				t.Errorf("IsAbortError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
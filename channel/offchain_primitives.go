@@ -31,6 +31,9 @@ import (
 // Size of nonce (in bytes) for session id generation.
 var sessionIDNonceSize = int(32)
 
+// Size of nonce (in bytes) used as challenge in the identity exchange.
+var identityNonceSize = int(32)
+
 // SessionID represents the unique identification of offchain channel.
 type SessionID struct {
 
@@ -437,3 +440,80 @@ func GenerateRandomNumber(sizeInBytes int) ([]byte, error) {
 
 	return randomnBytes, nil
 }
+
+// identityProofRole is the role of the signer of an identity proof in the identity exchange.
+// It is included in the proof as domain separator, so that the signature by a user in one role
+// cannot be used as its proof in the other role.
+type identityProofRole string
+
+// Enumeration of allowed values for the role of the signer of an identity proof.
+const (
+	identityProofRequester identityProofRole = "dst-go/id/requester"
+	identityProofResponder identityProofRole = "dst-go/id/responder"
+)
+
+// identityTranscript holds the values exchanged between the requester and the responder in the identity exchange.
+// Identity proofs by both the users are signatures on the transcript.
+//
+// Both the nonces are included, so that a proof is valid only for the exchange in which it was made. Both the
+// addresses are included, so that a proof obtained by one user cannot be replayed by it to another user.
+// Ephemeral keys for key agreement are also included (nil, if not sent), so that the keys cannot be replaced or
+// removed by an attacker without invalidating the proof.
+type identityTranscript struct {
+	requester, responder           types.Address
+	requesterNonce, responderNonce []byte
+	requesterKey, responderKey     []byte
+}
+
+// hash returns the hash to be signed as proof of identity by the user in the given role.
+func (t identityTranscript) hash(role identityProofRole) []byte {
+	return solsha3.SoliditySHA3(
+		solsha3.Bytes32(keystore.Keccak256([]byte(role))),
+		solsha3.Bytes32(t.requesterNonce),
+		solsha3.Bytes32(t.responderNonce),
+		solsha3.Address(t.requester.Address),
+		solsha3.Address(t.responder.Address),
+		solsha3.Bytes32(keystore.Keccak256(t.requesterKey)),
+		solsha3.Bytes32(keystore.Keccak256(t.responderKey)),
+	)
+}
+
+// signer returns the address of the user expected to sign the proof in the given role.
+func (t identityTranscript) signer(role identityProofRole) types.Address {
+	if role == identityProofRequester {
+		return t.requester
+	}
+	return t.responder
+}
+
+// signIdentityProof signs the transcript in the given role using the credentials set in signerID.
+func signIdentityProof(signerID identity.OffChainID, role identityProofRole, t identityTranscript) (signature []byte, err error) {
+
+	for _, nonce := range [][]byte{t.requesterNonce, t.responderNonce} {
+		if len(nonce) != identityNonceSize {
+			return nil, fmt.Errorf("Invalid nonce for identity proof - got %d bytes, want %d", len(nonce), identityNonceSize)
+		}
+	}
+	if signerID.OnChainID != t.signer(role) {
+		return nil, fmt.Errorf("Signer %s is not the %s in the transcript", signerID.OnChainID.Hex(), role)
+	}
+	signature, err = identity.SignHashWithPasswordEth(signerID, t.hash(role))
+	if err != nil {
+		return nil, fmt.Errorf("Error signing identity proof - %s", err.Error())
+	}
+	return signature, nil
+}
+
+// verifyIdentityProof checks if signature is a valid proof on the transcript by the user in the given role.
+func verifyIdentityProof(signature []byte, role identityProofRole, t identityTranscript) (err error) {
+
+	signer := t.signer(role)
+	isValid, err := identity.VerifySignatureEth(t.hash(role), signature, signer.Bytes())
+	if err != nil {
+		return fmt.Errorf("Identity proof of %s invalid - %s", signer.Hex(), err.Error())
+	}
+	if !isValid {
+		return fmt.Errorf("Identity proof of %s invalid - signature not by the claimed on-chain id", signer.Hex())
+	}
+	return nil
+}
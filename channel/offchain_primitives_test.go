@@ -1790,3 +1790,105 @@ func Test_GenerateRandomNumber(t *testing.T) {
 		t.Errorf("GenerateRandomNumber() randomNumber of length = %v, want length %v", gotRandomNumberSize, randomNumberSize)
 	}
 }
+
+func Test_verifyIdentityProof(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+	nonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	peerNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	otherNonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	aliceKey, bobKey, otherKey := []byte("alice-ephemeral-key"), []byte("bob-ephemeral-key"), []byte("other-ephemeral-key")
+	transcript := identityTranscript{
+		requester:      alice.OnChainID,
+		responder:      bob.OnChainID,
+		requesterNonce: nonce,
+		responderNonce: peerNonce,
+		requesterKey:   aliceKey,
+		responderKey:   bobKey,
+	}
+	signature, err := signIdentityProof(alice, identityProofRequester, transcript)
+	if err != nil {
+		t.Fatalf("signIdentityProof() error = %v, want nil", err)
+	}
+
+	//modified returns a copy of the transcript modified by modify
+	modified := func(modify func(t *identityTranscript)) identityTranscript {
+		modifiedTranscript := transcript
+		modify(&modifiedTranscript)
+		return modifiedTranscript
+	}
+
+	tests := []struct {
+		name       string
+		signature  []byte
+		role       identityProofRole
+		transcript identityTranscript
+		wantErr    bool
+	}{
+		{"valid", signature, identityProofRequester, transcript, false},
+		{"other-role", signature, identityProofResponder, transcript, true},
+		{"other-requester-nonce", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.requesterNonce = otherNonce }), true},
+		{"other-responder-nonce", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.responderNonce = otherNonce }), true},
+		{"nonces-swapped", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.requesterNonce, t.responderNonce = peerNonce, nonce }), true},
+		{"other-requester", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.requester = bob.OnChainID }), true},
+		{"other-responder", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.responder = alice.OnChainID }), true},
+		{"other-requester-key", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.requesterKey = otherKey }), true},
+		{"other-responder-key", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.responderKey = otherKey }), true},
+		{"keys-swapped", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.requesterKey, t.responderKey = bobKey, aliceKey }), true},
+		{"keys-removed", signature, identityProofRequester,
+			modified(func(t *identityTranscript) { t.requesterKey, t.responderKey = nil, nil }), true},
+		{"invalid-signature", []byte("less-than-65-bytes"), identityProofRequester, transcript, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyIdentityProof(tt.signature, tt.role, tt.transcript)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyIdentityProof() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_signIdentityProof(t *testing.T) {
+
+	alice, bob := idsWithCredentials()
+	nonce, err := GenerateRandomNumber(identityNonceSize)
+	if err != nil {
+		t.Fatalf("GenerateRandomNumber() error = %v", err)
+	}
+	transcript := identityTranscript{
+		requester:      alice.OnChainID,
+		responder:      bob.OnChainID,
+		requesterNonce: nonce,
+		responderNonce: nonce,
+	}
+	shortNonceTranscript := transcript
+	shortNonceTranscript.responderNonce = nonce[:16]
+
+	if _, err = signIdentityProof(aliceID, identityProofRequester, transcript); err == nil {
+		t.Errorf("signIdentityProof() without credentials error = nil, want non nil")
+	}
+	if _, err = signIdentityProof(alice, identityProofRequester, shortNonceTranscript); err == nil {
+		t.Errorf("signIdentityProof() with short nonce error = nil, want non nil")
+	}
+	if _, err = signIdentityProof(alice, identityProofResponder, transcript); err == nil {
+		t.Errorf("signIdentityProof() by user not in the role error = nil, want non nil")
+	}
+}
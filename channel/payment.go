@@ -0,0 +1,154 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+// Balances returns the amounts (in Wei) blocked by the sender and receiver in the latest state of the channel.
+// Latest state is the current vpc state if one has been set, else the msc base state.
+// Error is returned if neither of them has been set.
+func (inst *Instance) Balances() (blockedSender, blockedReceiver *big.Int, err error) {
+
+	if current := inst.CurrentVpcState(); current.VPCState.Version != nil {
+		return new(big.Int).Set(current.VPCState.BlockedSender), new(big.Int).Set(current.VPCState.BlockedReceiver), nil
+	}
+	if base := inst.MscBaseState(); base.MSContractBaseState.Version != nil {
+		return new(big.Int).Set(base.MSContractBaseState.BlockedSender), new(big.Int).Set(base.MSContractBaseState.BlockedReceiver), nil
+	}
+	return nil, nil, fmt.Errorf("Neither vpc state nor msc base state is set for the channel")
+}
+
+// Pay transfers amount (in Wei) from this user to the peer in the channel.
+//
+// A new vpc state with the amount moved from the balance of this user to the peer and the version incremented
+// is signed by this user and sent to the peer. If the peer accepts it, the doubly signed state is set as
+// the current vpc state of the channel and returned.
+// Error is returned if amount is not positive or exceeds the balance of this user.
+func (inst *Instance) Pay(amount *big.Int) (newState VPCStateSigned, err error) {
+	return inst.PayContext(context.Background(), amount)
+}
+
+// PayContext is same as Pay, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (inst *Instance) PayContext(ctx context.Context, amount *big.Int) (newState VPCStateSigned, err error) {
+	return inst.transfer(ctx, inst.RoleChannel(), amount)
+}
+
+// RequestPayment requests the peer to transfer amount (in Wei) to this user in the channel.
+//
+// A new vpc state with the amount moved from the balance of the peer to this user and the version incremented
+// is signed by this user and sent to the peer. If the peer accepts it, the doubly signed state is set as
+// the current vpc state of the channel and returned.
+// Error is returned if amount is not positive or exceeds the balance of the peer.
+func (inst *Instance) RequestPayment(amount *big.Int) (newState VPCStateSigned, err error) {
+	return inst.RequestPaymentContext(context.Background(), amount)
+}
+
+// RequestPaymentContext is same as RequestPayment, but waits for the response only until ctx is done.
+// If ctx is done before the response is received, the channel is closed and a *TimeoutError is returned.
+func (inst *Instance) RequestPaymentContext(ctx context.Context, amount *big.Int) (newState VPCStateSigned, err error) {
+
+	payer := Sender
+	if inst.RoleChannel() == Sender {
+		payer = Receiver
+	}
+	return inst.transfer(ctx, payer, amount)
+}
+
+// transfer proposes a new vpc state to the peer, in which amount is moved from the balance of the payer
+// to the other user. If the peer accepts it, it is set as the current vpc state.
+//
+// Transfers on the channel are made one at a time, so that each new state follows the one set by the previous transfer
+// and the response to each request is read only by the transfer that made it.
+func (inst *Instance) transfer(ctx context.Context, payer Role, amount *big.Int) (newState VPCStateSigned, err error) {
+
+	inst.requestAccess.Lock()
+	defer inst.requestAccess.Unlock()
+
+	newStatePartial, err := inst.newTransferState(payer, amount)
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	if err = inst.ValidateVPCState(newStatePartial.VPCState); err != nil {
+		return VPCStateSigned{}, err
+	}
+	if err = newStatePartial.AddSign(inst.selfID, inst.RoleChannel()); err != nil {
+		return VPCStateSigned{}, err
+	}
+
+	newState, status, err := inst.NewVPCStateRequestContext(ctx, newStatePartial)
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	if status != MessageStatusAccept {
+		return VPCStateSigned{}, fmt.Errorf("VPC state declined by peer")
+	}
+
+	if err = inst.SetCurrentVPCState(newState); err != nil {
+		return VPCStateSigned{}, err
+	}
+	return newState, nil
+}
+
+// newTransferState returns the unsigned vpc state that follows the latest state of the channel,
+// with amount moved from the balance of the payer to the other user.
+func (inst *Instance) newTransferState(payer Role, amount *big.Int) (state VPCStateSigned, err error) {
+
+	if amount == nil || amount.Sign() <= 0 {
+		return VPCStateSigned{}, fmt.Errorf("Amount to transfer should be positive")
+	}
+	role := inst.RoleChannel()
+	if role != Sender && role != Receiver {
+		return VPCStateSigned{}, fmt.Errorf("Role in channel not set")
+	}
+	id, err := inst.vpcStateID()
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+
+	blockedSender, blockedReceiver, err := inst.Balances()
+	if err != nil {
+		return VPCStateSigned{}, err
+	}
+	from, to := blockedSender, blockedReceiver
+	if payer == Receiver {
+		from, to = blockedReceiver, blockedSender
+	}
+	if from.Cmp(amount) < 0 {
+		return VPCStateSigned{}, fmt.Errorf("Insufficient balance for %s - available %s, required %s", payer, from.String(), amount.String())
+	}
+	from.Sub(from, amount)
+	to.Add(to, amount)
+
+	version := big.NewInt(1)
+	if current := inst.CurrentVpcState(); current.VPCState.Version != nil {
+		version.Add(current.VPCState.Version, big.NewInt(1))
+	}
+
+	return VPCStateSigned{
+		VPCState: VPCState{
+			ID:              id,
+			Version:         version,
+			BlockedSender:   blockedSender,
+			BlockedReceiver: blockedReceiver,
+		},
+	}, nil
+}
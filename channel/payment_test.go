@@ -0,0 +1,292 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// setupPaymentChannels returns a connected pair of channels with alice as sender and bob as receiver,
+// having a common session id and msc base state with the blocked amounts.
+func setupPaymentChannels(t *testing.T, blockedSender, blockedReceiver int64) (sender, receiver *Instance, listener Shutdown) {
+
+	sender, receiver, listener = setupWsChannelPair(t)
+	setupPaymentSession(t, sender, receiver, blockedSender, blockedReceiver)
+	return sender, receiver, listener
+}
+
+// setupPaymentSession sets up the connected channels with alice as sender and bob as receiver,
+// having a common session id and msc base state with the blocked amounts.
+func setupPaymentSession(t *testing.T, sender, receiver *Instance, blockedSender, blockedReceiver int64) {
+
+	alice, bob := aliceID, bobID
+	alice.SetCredentials(testKeyStore, alicePassword)
+	bob.SetCredentials(testKeyStore, bobPassword)
+
+	sid := NewSessionID(alice.OnChainID, bob.OnChainID)
+	if err := sid.GenerateSenderPart(alice.OnChainID); err != nil {
+		t.Fatalf("SessionID.GenerateSenderPart() error = %v", err)
+	}
+	if err := sid.GenerateReceiverPart(bob.OnChainID); err != nil {
+		t.Fatalf("SessionID.GenerateReceiverPart() error = %v", err)
+	}
+	if err := sid.GenerateCompleteSid(); err != nil {
+		t.Fatalf("SessionID.GenerateCompleteSid() error = %v", err)
+	}
+
+	baseState := MSCBaseStateSigned{
+		MSContractBaseState: MSCBaseState{
+			Sid:             sid.SidComplete,
+			BlockedSender:   big.NewInt(blockedSender),
+			BlockedReceiver: big.NewInt(blockedReceiver),
+			Version:         big.NewInt(1),
+		},
+	}
+
+	for _, ch := range []struct {
+		inst        *Instance
+		self, peer  identity.OffChainID
+		roleChannel Role
+	}{{sender, alice, bob, Sender}, {receiver, bob, alice, Receiver}} {
+		ch.inst.setSelfID(ch.self)
+		ch.inst.setPeerID(ch.peer)
+		ch.inst.SetRoleChannel(ch.roleChannel)
+		if err := ch.inst.SetSessionID(sid); err != nil {
+			t.Fatalf("Instance.SetSessionID() error = %v", err)
+		}
+		//Signatures on base state are not required for payments
+		ch.inst.mscBaseState = baseState
+	}
+}
+
+// respondVPCState reads the vpc state request on ch, signs it and responds with status.
+func respondVPCState(ch *Instance, status MessageStatus) (state VPCStateSigned, err error) {
+
+	state, err = ch.NewVPCStateRead()
+	if err != nil {
+		return state, err
+	}
+	if status == MessageStatusAccept {
+		if err = state.AddSign(ch.SelfID(), ch.RoleChannel()); err != nil {
+			return state, err
+		}
+		if err = ch.SetCurrentVPCState(state); err != nil {
+			return state, err
+		}
+	}
+	return state, ch.NewVPCStateRespond(state, status)
+}
+
+func Test_Instance_Balances(t *testing.T) {
+
+	baseState := MSCBaseStateSigned{MSContractBaseState: MSCBaseState{
+		BlockedSender: big.NewInt(10), BlockedReceiver: big.NewInt(20), Version: big.NewInt(1)}}
+
+	tests := []struct {
+		name         string
+		instance     *Instance
+		wantSender   *big.Int
+		wantReceiver *big.Int
+		wantErr      bool
+	}{
+		{"no_state", &Instance{}, nil, nil, true},
+		{"msc_base_state", &Instance{mscBaseState: baseState}, big.NewInt(10), big.NewInt(20), false},
+		{"vpc_state", &Instance{mscBaseState: baseState, vpcStatesList: []VPCStateSigned{{VPCState: VPCState{
+			Version: big.NewInt(2), BlockedSender: big.NewInt(4), BlockedReceiver: big.NewInt(26)}}}},
+			big.NewInt(4), big.NewInt(26), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSender, gotReceiver, err := tt.instance.Balances()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Instance.Balances() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotSender.Cmp(tt.wantSender) != 0 || gotReceiver.Cmp(tt.wantReceiver) != 0 {
+				t.Errorf("Instance.Balances() = %v, %v, want %v, %v", gotSender, gotReceiver, tt.wantSender, tt.wantReceiver)
+			}
+			//Returned values should not share memory with the state
+			gotSender.Add(gotSender, big.NewInt(1))
+			if gotSender2, _, _ := tt.instance.Balances(); gotSender2.Cmp(tt.wantSender) != 0 {
+				t.Errorf("Instance.Balances() modified state of channel")
+			}
+		})
+	}
+}
+
+func Test_Instance_newTransferState(t *testing.T) {
+
+	sender, receiver, listener := setupPaymentChannels(t, 10, 20)
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	tests := []struct {
+		name         string
+		instance     *Instance
+		payer        Role
+		amount       *big.Int
+		wantSender   *big.Int
+		wantReceiver *big.Int
+		wantErr      bool
+	}{
+		{"sender_pays", sender, Sender, big.NewInt(3), big.NewInt(7), big.NewInt(23), false},
+		{"receiver_pays", receiver, Receiver, big.NewInt(20), big.NewInt(30), big.NewInt(0), false},
+		{"insufficient_balance", sender, Sender, big.NewInt(11), nil, nil, true},
+		{"zero_amount", sender, Sender, big.NewInt(0), nil, nil, true},
+		{"nil_amount", sender, Sender, nil, nil, nil, true},
+		{"role_not_set", &Instance{mscBaseState: sender.mscBaseState}, Sender, big.NewInt(1), nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.instance.newTransferState(tt.payer, tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Instance.newTransferState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.VPCState.BlockedSender.Cmp(tt.wantSender) != 0 || got.VPCState.BlockedReceiver.Cmp(tt.wantReceiver) != 0 {
+				t.Errorf("Instance.newTransferState() blocked = %v, %v, want %v, %v",
+					got.VPCState.BlockedSender, got.VPCState.BlockedReceiver, tt.wantSender, tt.wantReceiver)
+			}
+			if got.VPCState.Version.Cmp(big.NewInt(1)) != 0 {
+				t.Errorf("Instance.newTransferState() version = %v, want 1", got.VPCState.Version)
+			}
+		})
+	}
+}
+
+func Test_Instance_Pay(t *testing.T) {
+
+	sender, receiver, listener := setupPaymentChannels(t, 10, 20)
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	//Alice pays bob and then requests a payment from him
+	respondErr := make(chan error, 1)
+	go func() {
+		_, err := respondVPCState(receiver, MessageStatusAccept)
+		respondErr <- err
+	}()
+	state, err := sender.Pay(big.NewInt(4))
+	if err != nil {
+		t.Fatalf("Instance.Pay() error = %v, want nil", err)
+	}
+	if err = <-respondErr; err != nil {
+		t.Fatalf("respondVPCState() error = %v", err)
+	}
+	if state.VPCState.BlockedSender.Cmp(big.NewInt(6)) != 0 || state.VPCState.BlockedReceiver.Cmp(big.NewInt(24)) != 0 ||
+		state.VPCState.Version.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Instance.Pay() state = %v, want version 1 with blocked 6, 24", state.VPCState)
+	}
+	if current := sender.CurrentVpcState(); !current.Equal(state) {
+		t.Errorf("Instance.Pay() current vpc state not updated")
+	}
+
+	go func() {
+		_, err := respondVPCState(receiver, MessageStatusAccept)
+		respondErr <- err
+	}()
+	state, err = sender.RequestPayment(big.NewInt(2))
+	if err != nil {
+		t.Fatalf("Instance.RequestPayment() error = %v, want nil", err)
+	}
+	if err = <-respondErr; err != nil {
+		t.Fatalf("respondVPCState() error = %v", err)
+	}
+	if state.VPCState.BlockedSender.Cmp(big.NewInt(8)) != 0 || state.VPCState.BlockedReceiver.Cmp(big.NewInt(22)) != 0 ||
+		state.VPCState.Version.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("Instance.RequestPayment() state = %v, want version 2 with blocked 8, 22", state.VPCState)
+	}
+
+	//Declined payment request does not change the current state
+	go func() {
+		_, err := respondVPCState(receiver, MessageStatusDecline)
+		respondErr <- err
+	}()
+	if _, err = sender.RequestPayment(big.NewInt(1)); err == nil {
+		t.Errorf("Instance.RequestPayment() declined by peer error = nil, want non nil")
+	}
+	if err = <-respondErr; err != nil {
+		t.Fatalf("respondVPCState() error = %v", err)
+	}
+	if current := sender.CurrentVpcState(); !current.Equal(state) {
+		t.Errorf("Instance.RequestPayment() declined by peer - current vpc state changed")
+	}
+
+	//Payment exceeding the balance is not sent to the peer
+	if _, err = receiver.Pay(big.NewInt(23)); err == nil {
+		t.Errorf("Instance.Pay() exceeding balance error = nil, want non nil")
+	}
+}
+
+func Test_Instance_Pay_concurrent(t *testing.T) {
+
+	sender, receiver, listener := setupPaymentChannels(t, 10, 20)
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	const payments = 5
+	respondErr := make(chan error, 1)
+	go func() {
+		for idx := 0; idx < payments; idx++ {
+			if _, err := respondVPCState(receiver, MessageStatusAccept); err != nil {
+				respondErr <- err
+				return
+			}
+		}
+		respondErr <- nil
+	}()
+
+	//Each payment should follow the state set by the previous one, while the state is being read
+	payErrs := make(chan error, payments)
+	for idx := 0; idx < payments; idx++ {
+		go func() {
+			_, err := sender.Pay(big.NewInt(1))
+			payErrs <- err
+		}()
+	}
+	for idx := 0; idx < payments; idx++ {
+		_, _, _ = sender.Balances()
+		if err := <-payErrs; err != nil {
+			t.Errorf("Instance.Pay() error = %v, want nil", err)
+		}
+	}
+	if err := <-respondErr; err != nil {
+		t.Fatalf("respondVPCState() error = %v", err)
+	}
+
+	for _, ch := range []*Instance{sender, receiver} {
+		state := ch.CurrentVpcState().VPCState
+		if state.Version.Cmp(big.NewInt(payments)) != 0 || state.BlockedSender.Cmp(big.NewInt(10-payments)) != 0 ||
+			state.BlockedReceiver.Cmp(big.NewInt(20+payments)) != 0 {
+			t.Errorf("Instance.Pay() current state of %s = %v, want version %d with blocked %d, %d",
+				ch.RoleChannel(), state, payments, 10-payments, 20+payments)
+		}
+	}
+}
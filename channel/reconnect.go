@@ -0,0 +1,218 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+type reconnectConfigType struct {
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+var reconnectConfig = reconnectConfigType{
+	initialBackoff: 1 * time.Second,
+	maxBackoff:     1 * time.Minute,
+}
+
+// Reconnect re-establishes the connection with the peer of the channel, after the previous connection was dropped.
+//
+// A new connection to the listener of the peer is attempted using adapterType, with the interval between the attempts
+// doubled after each failure upto a maximum, until it succeeds or ctx is done. The identity of the peer is verified
+// on the new connection as in NewChannel. Then a resync request is sent to rebind the connection to the session id
+// of the channel, in which both sides exchange their latest vpc states. If the state of the peer is newer (e.g the
+// response to the last vpc state request was lost), it is set as the current vpc state after validation.
+//
+// On success, the channel uses the new connection. A dispatcher running on the previous connection is not restarted.
+func (inst *Instance) Reconnect(ctx context.Context, adapterType AdapterType) (err error) {
+
+	if inst.Connected() {
+		return fmt.Errorf("Channel already connected")
+	}
+	sid := inst.SessionID()
+	if sid.SidComplete == nil {
+		return fmt.Errorf("Session id not set for the channel")
+	}
+
+	backoff := reconnectConfig.initialBackoff
+	for {
+		var newConn *Instance
+		newConn, err = NewChannel(inst.SelfID(), inst.PeerID(), adapterType)
+		if err == nil {
+			err = inst.resync(ctx, newConn, sid)
+			if err == nil {
+				logger.Info("Reconnected channel with", inst.PeerID())
+				return nil
+			}
+			if errClose := newConn.Close(); errClose != nil {
+				logger.Debug("Error closing connection after failed resync -", errClose)
+			}
+			if _, ok := err.(*resyncError); ok {
+				return err
+			}
+		}
+		logger.Info("Reconnecting channel with", inst.PeerID(), "failed, retrying in", backoff, "-", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("Reconnect aborted - %s, last error - %s", ctx.Err(), err.Error())
+		}
+		backoff = backoff * 2
+		if backoff > reconnectConfig.maxBackoff {
+			backoff = reconnectConfig.maxBackoff
+		}
+	}
+}
+
+// resyncError is an error in resynchronisation that is not resolved by retrying, such as the session
+// being declined by the peer or conflicting states.
+type resyncError struct {
+	err error
+}
+
+func (e *resyncError) Error() string {
+	return e.err.Error()
+}
+
+// resync requests the peer to resume the channel on newConn and rebinds the channel to it if successful.
+func (inst *Instance) resync(ctx context.Context, newConn *Instance, sid SessionID) (err error) {
+
+	ctx, cancel := context.WithTimeout(ctx, identityExchangeTimeout)
+	defer cancel()
+
+	peerState, status, err := newConn.ResyncRequestContext(ctx, sid, inst.CurrentVpcState())
+	if err != nil {
+		return err
+	}
+	if status != MessageStatusAccept {
+		return &resyncError{fmt.Errorf("Resync declined by peer")}
+	}
+	if err = inst.adoptPeerState(peerState); err != nil {
+		return &resyncError{err}
+	}
+
+	inst.rebind(newConn)
+	return nil
+}
+
+// Resume rebinds the channel to newConn, an incoming connection on which the peer of the channel requests
+// to resume it after the previous connection was dropped.
+//
+// The resync request is read from newConn and accepted if the peer is the same and the session id matches that
+// of the channel. If the vpc state of the peer is newer than the current vpc state, it is set as the current vpc state
+// after validation. The latest state is sent in the response, so that the peer can do the same.
+// If the request is declined, an error is returned and newConn is closed.
+func (inst *Instance) Resume(ctx context.Context, newConn *Instance) (err error) {
+
+	if inst.Connected() {
+		err = fmt.Errorf("Channel already connected")
+	} else if !identity.Equal(newConn.PeerID(), inst.PeerID()) {
+		err = fmt.Errorf("Peer in connection (%s) is not the peer of the channel (%s)", newConn.PeerID(), inst.PeerID())
+	}
+	if err != nil {
+		if errClose := newConn.Close(); errClose != nil {
+			logger.Debug("Error closing connection -", errClose)
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identityExchangeTimeout)
+	defer cancel()
+
+	sid, peerState, err := newConn.ResyncReadContext(ctx)
+	if err != nil {
+		if errClose := newConn.Close(); errClose != nil {
+			logger.Debug("Error closing connection -", errClose)
+		}
+		return err
+	}
+
+	ownSid := inst.SessionID()
+	if ownSid.SidComplete == nil || !ownSid.Equal(sid) {
+		err = fmt.Errorf("Session id in resync request does not match that of the channel")
+	} else {
+		err = inst.adoptPeerState(peerState)
+	}
+	if err != nil {
+		if errRespond := newConn.ResyncRespond(sid, VPCStateSigned{}, MessageStatusDecline); errRespond != nil {
+			logger.Error("Error declining resync request -", errRespond)
+		}
+		if errClose := newConn.Close(); errClose != nil {
+			logger.Debug("Error closing connection -", errClose)
+		}
+		return err
+	}
+
+	if err = newConn.ResyncRespond(sid, inst.CurrentVpcState(), MessageStatusAccept); err != nil {
+		if errClose := newConn.Close(); errClose != nil {
+			logger.Debug("Error closing connection -", errClose)
+		}
+		return err
+	}
+
+	inst.rebind(newConn)
+	logger.Info("Resumed channel with", inst.PeerID())
+	return nil
+}
+
+// adoptPeerState sets the latest vpc state of the peer as the current vpc state, if it is newer.
+// The state is validated and its signatures are verified as in SetCurrentVPCState.
+// An error is returned, if the state is invalid or differs from the current vpc state having the same version.
+func (inst *Instance) adoptPeerState(peerState VPCStateSigned) (err error) {
+
+	if peerState.VPCState.Version == nil {
+		return nil
+	}
+
+	current := inst.CurrentVpcState()
+	if current.VPCState.Version != nil {
+		switch peerState.VPCState.Version.Cmp(current.VPCState.Version) {
+		case -1:
+			return nil
+		case 0:
+			//Signatures are not compared, as both the states are fully signed
+			if peerState.VPCState.BlockedSender == nil || peerState.VPCState.BlockedReceiver == nil ||
+				!current.VPCState.Equal(peerState.VPCState) {
+				return fmt.Errorf("VPC state of peer differs from current vpc state with same version (%s)",
+					current.VPCState.Version.String())
+			}
+			return nil
+		}
+	}
+
+	if err = inst.SetCurrentVPCState(peerState); err != nil {
+		return fmt.Errorf("Invalid vpc state from peer - %s", err.Error())
+	}
+	logger.Info("VPC state with version", peerState.VPCState.Version, "recovered from", inst.PeerID())
+	return nil
+}
+
+// rebind replaces the connection of the channel with that of newConn.
+func (inst *Instance) rebind(newConn *Instance) {
+
+	inst.access.Lock()
+	defer inst.access.Unlock()
+
+	inst.adapter = newConn.adapter
+	inst.dispatcher = nil //Dispatcher of the previous connection stopped with it
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// setupResumableChannels returns a pair of payment channels over mock adapter, with alice as sender and bob as receiver.
+// The listener of bob keeps running, so that alice can reconnect. Its id verified connections are returned.
+func setupResumableChannels(t *testing.T) (sender, receiver *Instance, bobConns chan *Instance, listener Shutdown) {
+
+	alice, bob := idsWithCredentials()
+
+	bobConns, listener, err := startListener(bob, 10, Mock)
+	if err != nil {
+		t.Fatalf("startListener() err = %v, want nil", err)
+	}
+	sender, err = NewChannel(alice, bobID, Mock)
+	if err != nil {
+		_ = listener.Shutdown(context.Background())
+		t.Fatalf("NewChannel() err = %v, want nil", err)
+	}
+	receiver = <-bobConns
+
+	setupPaymentSession(t, sender, receiver, 10, 20)
+	return sender, receiver, bobConns, listener
+}
+
+// signedTransferState returns the next vpc state with a transfer from sender to receiver, signed by sender.
+func signedTransferState(t *testing.T, sender *Instance) VPCStateSigned {
+
+	newState, err := sender.newTransferState(Sender, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("newTransferState() err = %v, want nil", err)
+	}
+	if err = newState.AddSign(sender.SelfID(), Sender); err != nil {
+		t.Fatalf("AddSign() err = %v, want nil", err)
+	}
+	return newState
+}
+
+// exchangeVPCState makes a transfer from sender to receiver and returns the new state agreed on.
+func exchangeVPCState(t *testing.T, sender, receiver *Instance) VPCStateSigned {
+
+	newState := signedTransferState(t, sender)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := respondVPCState(receiver, MessageStatusAccept)
+		errs <- err
+	}()
+
+	gotState, status, err := sender.NewVPCStateRequest(newState)
+	if err != nil || status != MessageStatusAccept {
+		t.Fatalf("NewVPCStateRequest() = %v, %v, want accept, nil", status, err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatalf("respondVPCState() err = %v, want nil", err)
+	}
+	if err = sender.SetCurrentVPCState(gotState); err != nil {
+		t.Fatalf("SetCurrentVPCState() err = %v, want nil", err)
+	}
+	return gotState
+}
+
+func Test_Instance_Reconnect_Resume(t *testing.T) {
+
+	sender, receiver, bobConns, listener := setupResumableChannels(t)
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	exchangeVPCState(t, sender, receiver)
+
+	//Half completed exchange: receiver signs and sets the new state, but the connection drops before it responds
+	newState := signedTransferState(t, sender)
+	go func() {
+		state, err := receiver.NewVPCStateRead()
+		if err == nil {
+			err = state.AddSign(receiver.SelfID(), receiver.RoleChannel())
+		}
+		if err == nil {
+			err = receiver.SetCurrentVPCState(state)
+		}
+		if err != nil {
+			t.Errorf("Receiver setting vpc state err = %v, want nil", err)
+		}
+		_ = receiver.Close()
+	}()
+	if _, _, err := sender.NewVPCStateRequest(newState); err == nil {
+		t.Fatalf("NewVPCStateRequest() err = nil, want non nil as connection dropped")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if sender.Connected() || receiver.Connected() {
+		t.Fatalf("Connected() = %v, %v after connection dropped, want false, false", sender.Connected(), receiver.Connected())
+	}
+	wantState := receiver.CurrentVpcState()
+
+	resumeErr := make(chan error, 1)
+	go func() {
+		newConn := <-bobConns
+		resumeErr <- receiver.Resume(context.Background(), newConn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*identityExchangeTimeout)
+	defer cancel()
+	if err := sender.Reconnect(ctx, Mock); err != nil {
+		t.Fatalf("Reconnect() err = %v, want nil", err)
+	}
+	if err := <-resumeErr; err != nil {
+		t.Fatalf("Resume() err = %v, want nil", err)
+	}
+
+	if !sender.Connected() || !receiver.Connected() || !sender.Encrypted() {
+		t.Errorf("Connected(), Encrypted() after reconnect = %v, %v, %v, want true", sender.Connected(), receiver.Connected(), sender.Encrypted())
+	}
+	if gotState := sender.CurrentVpcState(); !gotState.Equal(wantState) {
+		t.Errorf("CurrentVpcState() of sender after reconnect = %v, want %v", gotState, wantState)
+	}
+
+	//Channel continues on the new connection
+	exchangeVPCState(t, sender, receiver)
+	if sender.CurrentVpcState().VPCState.Version.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("CurrentVpcState() version = %v, want 3", sender.CurrentVpcState().VPCState.Version)
+	}
+
+	if err := sender.Reconnect(ctx, Mock); err == nil {
+		t.Errorf("Reconnect() on connected channel err = nil, want non nil")
+	}
+	_ = sender.Close()
+}
+
+func Test_Instance_Resume_declined(t *testing.T) {
+
+	sender, receiver, bobConns, listener := setupResumableChannels(t)
+	defer func() {
+		_ = listener.Shutdown(context.Background())
+	}()
+
+	_ = sender.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	//Session id of the receiver differs, hence resync is declined and is not retried
+	otherSid := receiver.SessionID()
+	otherSid.SidComplete = new(big.Int).Add(otherSid.SidComplete, big.NewInt(1))
+	receiver.sessionID = otherSid
+
+	resumeErr := make(chan error, 1)
+	go func() {
+		newConn := <-bobConns
+		resumeErr <- receiver.Resume(context.Background(), newConn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*identityExchangeTimeout)
+	defer cancel()
+	if err := sender.Reconnect(ctx, Mock); err == nil || ctx.Err() != nil {
+		t.Errorf("Reconnect() err = %v, ctx err = %v, want non nil error before ctx is done", err, ctx.Err())
+	}
+	if err := <-resumeErr; err == nil {
+		t.Errorf("Resume() err = nil, want non nil")
+	}
+	if sender.Connected() || receiver.Connected() {
+		t.Errorf("Connected() = %v, %v after declined resume, want false, false", sender.Connected(), receiver.Connected())
+	}
+}
+
+func Test_Instance_Reconnect_backoff(t *testing.T) {
+
+	oldConfig := reconnectConfig
+	reconnectConfig = reconnectConfigType{initialBackoff: 10 * time.Millisecond, maxBackoff: 40 * time.Millisecond}
+	defer func() {
+		reconnectConfig = oldConfig
+	}()
+
+	alice, _ := idsWithCredentials()
+	peer := bobID
+	peer.ListenerEndpoint = "/reconnect-no-listener"
+	ch := &Instance{adapter: &genericChannelAdapter{}}
+	ch.setSelfID(alice)
+	ch.setPeerID(peer)
+
+	t.Run("session_id_not_set", func(t *testing.T) {
+		if err := ch.Reconnect(context.Background(), Mock); err == nil {
+			t.Errorf("Reconnect() err = nil, want non nil")
+		}
+	})
+
+	t.Run("peer_not_reachable", func(t *testing.T) {
+		ch.sessionID = SessionID{SidComplete: big.NewInt(1)}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := ch.Reconnect(ctx, Mock); err == nil {
+			t.Errorf("Reconnect() err = nil, want non nil")
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("Reconnect() returned after %v, want it to retry until ctx is done", elapsed)
+		}
+	})
+}
+
+func Test_Instance_adoptPeerState(t *testing.T) {
+
+	sender, receiver, _, listener := setupResumableChannels(t)
+	_ = sender.Close()
+	_ = listener.Shutdown(context.Background())
+
+	//States of version 1 and 2 signed by both
+	state1 := signedTransferState(t, sender)
+	if err := state1.AddSign(receiver.SelfID(), Receiver); err != nil {
+		t.Fatalf("AddSign() err = %v, want nil", err)
+	}
+	if err := sender.SetCurrentVPCState(state1); err != nil {
+		t.Fatalf("SetCurrentVPCState() err = %v, want nil", err)
+	}
+	state2 := signedTransferState(t, sender)
+	state2Unsigned := state2
+	if err := state2.AddSign(receiver.SelfID(), Receiver); err != nil {
+		t.Fatalf("AddSign() err = %v, want nil", err)
+	}
+	conflicting := state1
+	conflicting.VPCState.BlockedSender = big.NewInt(8)
+	conflicting.VPCState.BlockedReceiver = big.NewInt(22)
+
+	tests := []struct {
+		name        string
+		peerState   VPCStateSigned
+		wantErr     bool
+		wantVersion int64
+	}{
+		{"no_state", VPCStateSigned{}, false, 1},
+		{"same_state", state1, false, 1},
+		{"conflicting_state", conflicting, true, 1},
+		{"newer_state_not_signed_by_receiver", state2Unsigned, true, 1},
+		{"newer_state", state2, false, 2},
+		{"older_state", state1, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sender.adoptPeerState(tt.peerState)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("adoptPeerState() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := sender.CurrentVpcState().VPCState.Version; got.Cmp(big.NewInt(tt.wantVersion)) != 0 {
+				t.Errorf("CurrentVpcState() version = %v, want %v", got, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// Store is the interface for a key value store used to persist the state of channels,
+// so that the channels can be restored after a restart of the node.
+//
+// Put should return only after the value is durably written,
+// because the persisted states are the only means to protect funds in case of a dispute.
+type Store interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+	Close() error
+}
+
+// Key prefixes for the records in the store.
+// Channel record is stored at channelKeyPrefix + self address + record id of the channel.
+// Each vpc state is stored at vpcStateKeyPrefix + self address + record id + version (32 bytes, big endian),
+// so that iterating over the prefix returns the states in order of version.
+//
+// Record id is the complete session id (32 bytes, big endian) of the channel. Until the session id is agreed,
+// a random provisional id is used and the records are moved when the session id is set. So the records of
+// different channels between the same users never overwrite each other.
+var (
+	channelKeyPrefix  = []byte("channel/")
+	vpcStateKeyPrefix = []byte("vpcstate/")
+)
+
+// channelRecord is the persisted form of a channel instance. The vpc states are stored as separate records.
+type channelRecord struct {
+	SelfID         identity.OffChainID `json:"self_id"`
+	PeerID         identity.OffChainID `json:"peer_id"`
+	RoleChannel    Role                `json:"role_channel"`
+	RoleClosing    Role                `json:"role_closing"`
+	ClosingMode    ClosingMode         `json:"closing_mode"`
+	Status         Status              `json:"status"`
+	ContractStore  []byte              `json:"contract_store"` //SHA256Sum of contract store
+	MSContractAddr types.Address       `json:"ms_contract_addr"`
+	VPCAddr        types.Address       `json:"vpc_addr"`
+	SessionID      SessionID           `json:"session_id"`
+	Terms          Terms               `json:"terms"`
+	MSCBaseState   MSCBaseStateSigned  `json:"msc_base_state"`
+}
+
+// recordIDSize is the size (in bytes) of the record id of a channel.
+const recordIDSize = 32
+
+func channelKey(selfAddr types.Address, recordID []byte) []byte {
+	return concatBytes(channelKeyPrefix, selfAddr.Bytes(), recordID)
+}
+
+func vpcStateKeyPrefixOf(selfAddr types.Address, recordID []byte) []byte {
+	return concatBytes(vpcStateKeyPrefix, selfAddr.Bytes(), recordID)
+}
+
+func vpcStateKey(selfAddr types.Address, recordID []byte, version *big.Int) ([]byte, error) {
+	versionBytes, err := bigEndian32(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vpc state version - %v", version)
+	}
+	return concatBytes(vpcStateKeyPrefixOf(selfAddr, recordID), versionBytes), nil
+}
+
+// bigEndian32 returns the 32 bytes big endian representation of the non negative value.
+func bigEndian32(value *big.Int) ([]byte, error) {
+	if value == nil || value.Sign() < 0 || value.BitLen() > 256 {
+		return nil, fmt.Errorf("value out of range - %v", value)
+	}
+	valueBytes := make([]byte, 32)
+	valueBigEndian := value.Bytes()
+	copy(valueBytes[32-len(valueBigEndian):], valueBigEndian)
+	return valueBytes, nil
+}
+
+// sessionRecordID returns the record id derived from the complete session id of the channel,
+// or nil if the session id is not yet set.
+func (inst *Instance) sessionRecordID() []byte {
+	recordID, err := bigEndian32(inst.sessionID.SidComplete)
+	if err != nil {
+		return nil
+	}
+	return recordID
+}
+
+func concatBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// SetStore sets the store in which the channel state is persisted and writes the current state of the channel to it.
+// After this, every change in the state of the channel is written to the store.
+//
+// The records are stored under the record id of the channel (see channelKeyPrefix), so records of other
+// channels in the store, including earlier channels between the same users, are not modified.
+func (inst *Instance) SetStore(store Store) (err error) {
+
+	inst.stateAccess.Lock()
+	defer inst.stateAccess.Unlock()
+
+	if inst.recordID == nil {
+		inst.recordID = inst.sessionRecordID()
+	}
+	if inst.recordID == nil {
+		if inst.recordID, err = GenerateRandomNumber(recordIDSize); err != nil {
+			return fmt.Errorf("generating record id - %s", err.Error())
+		}
+	}
+	inst.store = store
+
+	err = inst.writeRecord()
+	if err != nil {
+		return err
+	}
+	for idx := range inst.vpcStatesList {
+		err = inst.persistVPCState(inst.vpcStatesList[idx])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persistRecord writes all properties of the channel except vpc states to the store.
+// If the session id has been set since the records were last written, the records are moved
+// from the provisional record id to the one derived from the session id.
+// It is a no-op if store is not set.
+func (inst *Instance) persistRecord() (err error) {
+
+	inst.stateAccess.Lock()
+	defer inst.stateAccess.Unlock()
+
+	return inst.writeRecord()
+}
+
+// writeRecord is same as persistRecord, but should be called with stateAccess held.
+func (inst *Instance) writeRecord() (err error) {
+
+	if inst.store == nil {
+		return nil
+	}
+
+	record := channelRecord{
+		SelfID:         inst.selfID,
+		PeerID:         inst.peerID,
+		RoleChannel:    inst.roleChannel,
+		RoleClosing:    inst.roleClosing,
+		ClosingMode:    inst.closingMode,
+		Status:         inst.status,
+		MSContractAddr: inst.msContractAddr,
+		VPCAddr:        inst.vpcAddr,
+		SessionID:      inst.sessionID,
+		Terms:          inst.terms,
+		MSCBaseState:   inst.mscBaseState,
+	}
+	if inst.contractStore != (contract.StoreType{}) {
+		record.ContractStore = inst.contractStore.SHA256Sum()
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encoding channel record - %s", err.Error())
+	}
+
+	recordID := inst.sessionRecordID()
+	if recordID == nil {
+		recordID = inst.recordID
+	}
+	err = inst.store.Put(channelKey(inst.selfID.OnChainID, recordID), value)
+	if err != nil {
+		return fmt.Errorf("writing channel record - %s", err.Error())
+	}
+	if !bytes.Equal(recordID, inst.recordID) {
+		if err = inst.moveRecords(recordID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveRecords moves the vpc states of the channel to newRecordID and removes the channel record stored
+// under the previous record id. The channel record should already be written under newRecordID.
+func (inst *Instance) moveRecords(newRecordID []byte) (err error) {
+
+	selfAddr := inst.selfID.OnChainID
+	oldPrefix := vpcStateKeyPrefixOf(selfAddr, inst.recordID)
+
+	var oldKeys, values [][]byte
+	err = inst.store.Iterate(oldPrefix, func(key, value []byte) error {
+		oldKeys = append(oldKeys, key)
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading vpc states - %s", err.Error())
+	}
+	for idx := range oldKeys {
+		newKey := concatBytes(vpcStateKeyPrefixOf(selfAddr, newRecordID), oldKeys[idx][len(oldPrefix):])
+		if err = inst.store.Put(newKey, values[idx]); err != nil {
+			return fmt.Errorf("writing vpc state - %s", err.Error())
+		}
+	}
+	for idx := range oldKeys {
+		if err = inst.store.Delete(oldKeys[idx]); err != nil {
+			return fmt.Errorf("removing vpc state - %s", err.Error())
+		}
+	}
+	if err = inst.store.Delete(channelKey(selfAddr, inst.recordID)); err != nil {
+		return fmt.Errorf("removing channel record - %s", err.Error())
+	}
+
+	inst.recordID = newRecordID
+	return nil
+}
+
+// persistVPCState writes the vpc state to the store. It is a no-op if store is not set.
+// It should be called with stateAccess held.
+func (inst *Instance) persistVPCState(state VPCStateSigned) (err error) {
+
+	if inst.store == nil {
+		return nil
+	}
+
+	key, err := vpcStateKey(inst.selfID.OnChainID, inst.recordID, state.VPCState.Version)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding vpc state - %s", err.Error())
+	}
+	err = inst.store.Put(key, value)
+	if err != nil {
+		return fmt.Errorf("writing vpc state - %s", err.Error())
+	}
+	return nil
+}
+
+// logPersistRecord persists the channel record and logs the error if any.
+// It is used by setters that do not return an error.
+func (inst *Instance) logPersistRecord() {
+	if err := inst.persistRecord(); err != nil {
+		logger.Error("Error persisting channel state with", inst.peerID, "-", err)
+	}
+}
+
+// RestoreChannels reads all the channels of the user with selfID from the store and rebuilds the channel instances.
+//
+// The restored channels are not connected, but all other properties such as status, roles, session id,
+// terms, contract addresses, msc base state and vpc states are restored. The store is also set in the restored channels.
+// selfID should include the credentials of the user, as it will replace the id read from the store.
+//
+// As each channel is stored separately, there can be more than one restored channel with the same peer,
+// though at most one of them is expected to be not Closed.
+//
+// Records that cannot be restored, such as those that cannot be decoded or were stored with a different
+// contract store, are logged and skipped, so that they do not prevent the other channels from being restored.
+// Error is returned only if the store cannot be read.
+func RestoreChannels(store Store, selfID identity.OffChainID) (channels []*Instance, err error) {
+
+	prefix := concatBytes(channelKeyPrefix, selfID.OnChainID.Bytes())
+	skipped := 0
+	err = store.Iterate(prefix, func(key, value []byte) error {
+
+		inst, errRestore := restoreChannel(store, selfID, key[len(prefix):], value)
+		if errRestore != nil {
+			logger.Error("Skipping channel record", fmt.Sprintf("%x", key), "-", errRestore)
+			skipped++
+			return nil
+		}
+		channels = append(channels, inst)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("restoring channels - %s", err.Error())
+	}
+
+	logger.Debug("Restored", len(channels), "channels for", selfID.OnChainID.Hex(), "skipped", skipped)
+	return channels, nil
+}
+
+// restoreChannel rebuilds the channel instance from the channel record stored under recordID
+// and the vpc states stored for it.
+func restoreChannel(store Store, selfID identity.OffChainID, recordID, value []byte) (inst *Instance, err error) {
+
+	if len(recordID) != recordIDSize {
+		return nil, fmt.Errorf("invalid channel record id %x", recordID)
+	}
+	var record channelRecord
+	if err = json.Unmarshal(value, &record); err != nil {
+		return nil, fmt.Errorf("decoding channel record - %s", err.Error())
+	}
+
+	inst = &Instance{
+		closingMode:    record.ClosingMode,
+		selfID:         selfID,
+		peerID:         record.PeerID,
+		roleChannel:    record.RoleChannel,
+		roleClosing:    record.RoleClosing,
+		status:         record.Status,
+		msContractAddr: record.MSContractAddr,
+		vpcAddr:        record.VPCAddr,
+		sessionID:      record.SessionID,
+		terms:          record.Terms,
+		mscBaseState:   record.MSCBaseState,
+		store:          store,
+		recordID:       append([]byte{}, recordID...),
+	}
+
+	if len(record.ContractStore) != 0 {
+		if !bytes.Equal(record.ContractStore, contract.Store.SHA256Sum()) {
+			return nil, fmt.Errorf("contract store of channel with %s does not match the current contract store", record.PeerID)
+		}
+		inst.contractStore = contract.Store
+	}
+
+	err = store.Iterate(vpcStateKeyPrefixOf(selfID.OnChainID, recordID), func(key, value []byte) error {
+		var state VPCStateSigned
+		if errDecode := json.Unmarshal(value, &state); errDecode != nil {
+			return fmt.Errorf("decoding vpc state %x - %s", key, errDecode.Error())
+		}
+		inst.vpcStatesList = append(inst.vpcStatesList, state)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// memoryStore is an in-memory implementation of Store.
+// The values are not persisted across restarts and it is meant to be used only for testing
+// or when persistence is not required.
+type memoryStore struct {
+	values map[string][]byte
+	access sync.Mutex
+}
+
+// NewMemoryStore returns an in-memory store. The values written to it are lost when the node stops.
+func NewMemoryStore() Store {
+	return &memoryStore{values: make(map[string][]byte)}
+}
+
+// Put implements Store interface.
+func (store *memoryStore) Put(key, value []byte) error {
+
+	store.access.Lock()
+	defer store.access.Unlock()
+
+	if store.values == nil {
+		return fmt.Errorf("store closed")
+	}
+	store.values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete implements Store interface.
+func (store *memoryStore) Delete(key []byte) error {
+
+	store.access.Lock()
+	defer store.access.Unlock()
+
+	if store.values == nil {
+		return fmt.Errorf("store closed")
+	}
+	delete(store.values, string(key))
+	return nil
+}
+
+// Iterate implements Store interface. The keys are iterated in lexicographic order.
+func (store *memoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+
+	store.access.Lock()
+	if store.values == nil {
+		store.access.Unlock()
+		return fmt.Errorf("store closed")
+	}
+	var keys []string
+	for key := range store.values {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for idx := range keys {
+		values[idx] = store.values[keys[idx]]
+	}
+	store.access.Unlock()
+
+	for idx := range keys {
+		if err := fn([]byte(keys[idx]), values[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Store interface.
+func (store *memoryStore) Close() error {
+
+	store.access.Lock()
+	defer store.access.Unlock()
+
+	store.values = nil
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// levelDBStore is an implementation of Store using an embedded leveldb database.
+type levelDBStore struct {
+	db *leveldb.DB
+}
+
+// NewLevelDBStore opens (or creates if not present) a leveldb database in dir and returns a store backed by it.
+// Each write is synced to disk before it returns.
+func NewLevelDBStore(dir string) (Store, error) {
+
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening leveldb store at %s - %s", dir, err.Error())
+	}
+	return &levelDBStore{db: db}, nil
+}
+
+// Put implements Store interface.
+func (store *levelDBStore) Put(key, value []byte) error {
+	return store.db.Put(key, value, &opt.WriteOptions{Sync: true})
+}
+
+// Delete implements Store interface.
+func (store *levelDBStore) Delete(key []byte) error {
+	return store.db.Delete(key, &opt.WriteOptions{Sync: true})
+}
+
+// Iterate implements Store interface. The keys are iterated in lexicographic order.
+func (store *levelDBStore) Iterate(prefix []byte, fn func(key, value []byte) error) (err error) {
+
+	itr := store.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer itr.Release()
+
+	for itr.Next() {
+		//Key and value are only valid until the next call to Next, hence a copy is passed
+		key := append([]byte{}, itr.Key()...)
+		value := append([]byte{}, itr.Value()...)
+		if err = fn(key, value); err != nil {
+			return err
+		}
+	}
+	return itr.Error()
+}
+
+// Close implements Store interface.
+func (store *levelDBStore) Close() error {
+	return store.db.Close()
+}
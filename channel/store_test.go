@@ -0,0 +1,354 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+//Valid vpc state with alice as sender, bob as receiver and testSessionID as session id
+var testVPCState = VPCStateSigned{
+	VPCState: VPCState{
+		ID:              types.Hex2Bytes("76080832380c1083dee72ddc1072723513fdeeba589ee0ae86b605f0653a69c9"),
+		Version:         big.NewInt(1),
+		BlockedSender:   big.NewInt(10),
+		BlockedReceiver: big.NewInt(20),
+	},
+	SignSender:   types.Hex2Bytes("2a7056d333b8323cb0a3cdd614650318f4d654363a24bb3ad48b5cd50da784731aad13c300ec1714094ef59b720b992b030506be8fed81045b468f428fffdb451b"),
+	SignReceiver: types.Hex2Bytes("bb7722f787c67763397a7c7eaa44b3021996306a4979cb740076fbeabf24f29b7c8560ea71074c8b38cdbc310e54c624bc0c934f50482432738654e7f61bfb6a1c"),
+}
+
+//MSC base state blocking the same total amount as testVPCState
+var testMSCBaseState = MSCBaseStateSigned{
+	MSContractBaseState: MSCBaseState{
+		Sid:             testSessionID.SidComplete,
+		BlockedSender:   big.NewInt(15),
+		BlockedReceiver: big.NewInt(15),
+		Version:         big.NewInt(1),
+	},
+}
+
+type failingStore struct {
+	Store
+}
+
+func (store *failingStore) Put(key, value []byte) error {
+	return fmt.Errorf("disk full")
+}
+
+func testStore(t *testing.T, store Store) {
+
+	t.Run("put_and_iterate", func(t *testing.T) {
+		values := map[string]string{"a/2": "two", "a/1": "one", "b/1": "other"}
+		for key, value := range values {
+			if err := store.Put([]byte(key), []byte(value)); err != nil {
+				t.Fatalf("Store.Put() error = %v, want nil", err)
+			}
+		}
+
+		var gotKeys []string
+		err := store.Iterate([]byte("a/"), func(key, value []byte) error {
+			gotKeys = append(gotKeys, string(key))
+			if values[string(key)] != string(value) {
+				t.Errorf("Store.Iterate() value = %s, want %s", value, values[string(key)])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Store.Iterate() error = %v, want nil", err)
+		}
+		if wantKeys := []string{"a/1", "a/2"}; !reflect.DeepEqual(gotKeys, wantKeys) {
+			t.Errorf("Store.Iterate() keys = %v, want %v", gotKeys, wantKeys)
+		}
+	})
+	t.Run("iterate_error", func(t *testing.T) {
+		err := store.Iterate([]byte("a/"), func(key, value []byte) error {
+			return fmt.Errorf("stop")
+		})
+		if err == nil {
+			t.Errorf("Store.Iterate() error = nil, want non nil")
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete([]byte("a/1")); err != nil {
+			t.Fatalf("Store.Delete() error = %v, want nil", err)
+		}
+		count := 0
+		_ = store.Iterate([]byte("a/"), func(key, value []byte) error {
+			count++
+			return nil
+		})
+		if count != 1 {
+			t.Errorf("Store.Iterate() after delete - got %d keys, want 1", count)
+		}
+	})
+	t.Run("closed", func(t *testing.T) {
+		if err := store.Close(); err != nil {
+			t.Fatalf("Store.Close() error = %v, want nil", err)
+		}
+		if err := store.Put([]byte("a/3"), []byte("three")); err == nil {
+			t.Errorf("Store.Put() after close error = nil, want non nil")
+		}
+	})
+}
+
+func Test_memoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func Test_levelDBStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dst-go-channel-store")
+	if err != nil {
+		t.Fatalf("Error creating temp dir - %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	store, err := NewLevelDBStore(dir)
+	if err != nil {
+		t.Fatalf("NewLevelDBStore() error = %v, want nil", err)
+	}
+	testStore(t, store)
+
+	t.Run("reopen", func(t *testing.T) {
+		store, err := NewLevelDBStore(dir)
+		if err != nil {
+			t.Fatalf("NewLevelDBStore() error = %v, want nil", err)
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+
+		count := 0
+		_ = store.Iterate([]byte("a/"), func(key, value []byte) error {
+			count++
+			return nil
+		})
+		if count != 1 {
+			t.Errorf("Store.Iterate() after reopen - got %d keys, want 1", count)
+		}
+	})
+}
+
+func Test_RestoreChannels(t *testing.T) {
+
+	newTestInstance := func() *Instance {
+		return &Instance{
+			selfID:       aliceID,
+			peerID:       bobID,
+			roleChannel:  Sender,
+			status:       Init,
+			sessionID:    testSessionID,
+			mscBaseState: testMSCBaseState,
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		store := NewMemoryStore()
+		inst := newTestInstance()
+		if err := inst.SetStore(store); err != nil {
+			t.Fatalf("Instance.SetStore() error = %v, want nil", err)
+		}
+		inst.SetContractStore(contract.Store)
+		inst.SetClosingMode(ClosingModeAutoNormal)
+		terms := Terms{DepositSender: big.NewInt(15), DepositReceiver: big.NewInt(15), ConfirmTimeout: 6000, Expiry: 2000000000}
+		if err := inst.SetTerms(terms); err != nil {
+			t.Fatalf("Instance.SetTerms() error = %v, want nil", err)
+		}
+		_ = inst.SetMSContractAddr(types.HexToAddress("0x21c7c9b5aC63D9930d6410Ed29499CBD6AFcee4D"))
+		_ = inst.SetVPCAddr(types.HexToAddress("0x847a3AC37aB4bB1f0C3be0B2B2Ed4B6cE3e1F2b4"))
+		if err := inst.SetCurrentVPCState(testVPCState); err != nil {
+			t.Fatalf("Instance.SetCurrentVPCState() error = %v, want nil", err)
+		}
+		inst.SetStatus(Open)
+
+		channels, err := RestoreChannels(store, aliceID)
+		if err != nil {
+			t.Fatalf("RestoreChannels() error = %v, want nil", err)
+		}
+		if len(channels) != 1 {
+			t.Fatalf("RestoreChannels() - got %d channels, want 1", len(channels))
+		}
+		got := channels[0]
+		if got.Status() != Open || got.RoleChannel() != Sender || got.ClosingMode() != ClosingModeAutoNormal {
+			t.Errorf("RestoreChannels() - got status %s, role %s, closing mode %s, want %s, %s, %s",
+				got.Status(), got.RoleChannel(), got.ClosingMode(), Open, Sender, ClosingModeAutoNormal)
+		}
+		if got.MSContractAddr() != inst.MSContractAddr() || got.VPCAddr() != inst.VPCAddr() {
+			t.Errorf("RestoreChannels() - contract addresses not restored")
+		}
+		if got.ContractStore() != contract.Store {
+			t.Errorf("RestoreChannels() - contract store not restored")
+		}
+		if !got.Terms().Equal(terms) {
+			t.Errorf("RestoreChannels() - terms = %v, want %v", got.Terms(), terms)
+		}
+		if gotState := got.CurrentVpcState(); !gotState.Equal(testVPCState) {
+			t.Errorf("RestoreChannels() - current vpc state = %v, want %v", gotState, testVPCState)
+		}
+		if got.PeerID().OnChainID != bobID.OnChainID || got.Connected() {
+			t.Errorf("RestoreChannels() - got peer %v, connected %t, want %v, false", got.PeerID(), got.Connected(), bobID)
+		}
+	})
+	t.Run("other_user", func(t *testing.T) {
+		store := NewMemoryStore()
+		_ = newTestInstance().SetStore(store)
+
+		channels, err := RestoreChannels(store, bobID)
+		if err != nil || len(channels) != 0 {
+			t.Errorf("RestoreChannels() = %d channels, %v, want 0 channels, nil", len(channels), err)
+		}
+	})
+	t.Run("new_channel_keeps_other_channels", func(t *testing.T) {
+		store := NewMemoryStore()
+		inst := newTestInstance()
+		_ = inst.SetStore(store)
+		_ = inst.SetCurrentVPCState(testVPCState)
+
+		newInst := newTestInstance()
+		newInst.sessionID = SessionID{}
+		newInst.status = PreSetup
+		if err := newInst.SetStore(store); err != nil {
+			t.Fatalf("Instance.SetStore() error = %v, want nil", err)
+		}
+
+		channels, err := RestoreChannels(store, aliceID)
+		if err != nil || len(channels) != 2 {
+			t.Fatalf("RestoreChannels() = %d channels, %v, want 2 channels, nil", len(channels), err)
+		}
+		for idx := range channels {
+			if channels[idx].Status() != Init {
+				continue
+			}
+			if gotState := channels[idx].CurrentVpcState(); !gotState.Equal(testVPCState) {
+				t.Errorf("RestoreChannels() - current vpc state = %v, want %v", gotState, testVPCState)
+			}
+		}
+	})
+	t.Run("records_moved_on_session_id", func(t *testing.T) {
+		store := NewMemoryStore()
+		inst := newTestInstance()
+		inst.sessionID = SessionID{}
+		if err := inst.SetStore(store); err != nil {
+			t.Fatalf("Instance.SetStore() error = %v, want nil", err)
+		}
+		provisionalID := inst.recordID
+		//Set as in SetSessionID, without validation as testSessionID is not derived from the nonces
+		inst.sessionID = testSessionID
+		if err := inst.persistRecord(); err != nil {
+			t.Fatalf("Instance.persistRecord() error = %v, want nil", err)
+		}
+		if err := inst.SetCurrentVPCState(testVPCState); err != nil {
+			t.Fatalf("Instance.SetCurrentVPCState() error = %v, want nil", err)
+		}
+
+		if !bytes.Equal(inst.recordID, inst.sessionRecordID()) {
+			t.Errorf("Instance.persistRecord() - record id = %x, want %x", inst.recordID, inst.sessionRecordID())
+		}
+		count := 0
+		countKeys := func(key, value []byte) error {
+			count++
+			return nil
+		}
+		_ = store.Iterate(vpcStateKeyPrefixOf(aliceID.OnChainID, provisionalID), countKeys)
+		_ = store.Iterate(channelKey(aliceID.OnChainID, provisionalID), countKeys)
+		if count != 0 {
+			t.Errorf("Instance.persistRecord() - records under provisional id not removed")
+		}
+		channels, err := RestoreChannels(store, aliceID)
+		if err != nil || len(channels) != 1 {
+			t.Fatalf("RestoreChannels() = %d channels, %v, want 1 channel, nil", len(channels), err)
+		}
+		if gotState := channels[0].CurrentVpcState(); !gotState.Equal(testVPCState) {
+			t.Errorf("RestoreChannels() - current vpc state = %v, want %v", gotState, testVPCState)
+		}
+	})
+	t.Run("invalid_record_skipped", func(t *testing.T) {
+		store := NewMemoryStore()
+		_ = store.Put(channelKey(aliceID.OnChainID, make([]byte, recordIDSize)), []byte("invalid-json"))
+
+		channels, err := RestoreChannels(store, aliceID)
+		if err != nil || len(channels) != 0 {
+			t.Errorf("RestoreChannels() = %d channels, %v, want 0 channels, nil", len(channels), err)
+		}
+	})
+	t.Run("bad_record_does_not_stop_restore", func(t *testing.T) {
+		store := NewMemoryStore()
+		//Record stored with another version of the contract store
+		badRecord := channelRecord{
+			SelfID:        aliceID,
+			PeerID:        bobID,
+			Status:        Open,
+			SessionID:     testSessionID,
+			ContractStore: []byte("other-contract-store"),
+		}
+		value, _ := json.Marshal(badRecord)
+		_ = store.Put(channelKey(aliceID.OnChainID, bytes.Repeat([]byte{0xff}, recordIDSize)), value)
+
+		goodInst := newTestInstance()
+		goodInst.sessionID = SessionID{}
+		goodInst.status = PreSetup
+		if err := goodInst.SetStore(store); err != nil {
+			t.Fatalf("Instance.SetStore() error = %v, want nil", err)
+		}
+
+		channels, err := RestoreChannels(store, aliceID)
+		if err != nil || len(channels) != 1 {
+			t.Fatalf("RestoreChannels() = %d channels, %v, want 1 channel, nil", len(channels), err)
+		}
+		if channels[0].Status() != PreSetup {
+			t.Errorf("RestoreChannels() - got status %s, want %s", channels[0].Status(), PreSetup)
+		}
+	})
+}
+
+func Test_Instance_persist_error(t *testing.T) {
+
+	inst := &Instance{
+		selfID:       aliceID,
+		peerID:       bobID,
+		roleChannel:  Sender,
+		sessionID:    testSessionID,
+		mscBaseState: testMSCBaseState,
+		store:        &failingStore{NewMemoryStore()},
+	}
+
+	if err := inst.SetCurrentVPCState(testVPCState); err == nil {
+		t.Errorf("Instance.SetCurrentVPCState() error = nil, want non nil")
+	}
+	if gotState := inst.CurrentVpcState(); gotState.VPCState.Version != nil {
+		t.Errorf("Instance.SetCurrentVPCState() - state set even though persisting failed")
+	}
+	if err := inst.SetVPCAddr(types.HexToAddress("0x847a3AC37aB4bB1f0C3be0B2B2Ed4B6cE3e1F2b4")); err == nil {
+		t.Errorf("Instance.SetVPCAddr() error = nil, want non nil")
+	}
+	if inst.VPCAddr() != (types.Address{}) {
+		t.Errorf("Instance.SetVPCAddr() - address set even though persisting failed")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Terms are the terms of a channel, proposed by the sender in the new channel request and accepted by the receiver.
+//
+// DepositSender and DepositReceiver are the amounts (in Wei) to be deposited by the respective users in the mscontract.
+// ConfirmTimeout (in seconds) is the maximum time that a deposit can remain locked in the mscontract,
+// if the other user does not confirm its deposit. Expiry (unix time in seconds) is the time after which the
+// channel can no longer be opened, zero if it does not expire.
+type Terms struct {
+	DepositSender   *big.Int `json:"deposit_sender"`
+	DepositReceiver *big.Int `json:"deposit_receiver"`
+	ConfirmTimeout  uint64   `json:"confirm_timeout"`
+	Expiry          int64    `json:"expiry,omitempty"`
+}
+
+// Validate checks if the deposits are set and are not negative and the confirm timeout is set.
+func (terms Terms) Validate() error {
+
+	switch {
+	case terms.DepositSender == nil || terms.DepositReceiver == nil:
+		return fmt.Errorf("Terms incomplete - deposits of both users are required")
+	case terms.DepositSender.Sign() < 0:
+		return fmt.Errorf("Deposit of sender (%s) is negative", terms.DepositSender.String())
+	case terms.DepositReceiver.Sign() < 0:
+		return fmt.Errorf("Deposit of receiver (%s) is negative", terms.DepositReceiver.String())
+	case terms.ConfirmTimeout == 0:
+		return fmt.Errorf("Terms incomplete - confirm timeout is required")
+	}
+	return nil
+}
+
+// Deposit returns the amount to be deposited by the user with role in the channel.
+func (terms Terms) Deposit(role Role) *big.Int {
+	if role == Receiver {
+		return terms.DepositReceiver
+	}
+	return terms.DepositSender
+}
+
+// Expired returns true if the expiry is set and has passed at now.
+func (terms Terms) Expired(now time.Time) bool {
+	return terms.Expiry != 0 && now.Unix() > terms.Expiry
+}
+
+// Equal returns true if both the terms are same.
+func (terms Terms) Equal(other Terms) bool {
+	return equalAmounts(terms.DepositSender, other.DepositSender) &&
+		equalAmounts(terms.DepositReceiver, other.DepositReceiver) &&
+		terms.ConfirmTimeout == other.ConfirmTimeout && terms.Expiry == other.Expiry
+}
+
+// String implements fmt.Stringer.
+func (terms Terms) String() string {
+	return fmt.Sprintf("{DepositSender:%v DepositReceiver:%v ConfirmTimeout:%ds Expiry:%d}",
+		terms.DepositSender, terms.DepositReceiver, terms.ConfirmTimeout, terms.Expiry)
+}
+
+func equalAmounts(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+var termsForTest = Terms{
+	DepositSender:   big.NewInt(10),
+	DepositReceiver: big.NewInt(20),
+	ConfirmTimeout:  6000,
+}
+
+func Test_Terms_Validate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		modify  func(*Terms)
+		wantErr bool
+	}{
+		{"valid", func(*Terms) {}, false},
+		{"valid_zero_deposits", func(terms *Terms) { terms.DepositSender, terms.DepositReceiver = big.NewInt(0), big.NewInt(0) }, false},
+		{"deposit_sender_nil", func(terms *Terms) { terms.DepositSender = nil }, true},
+		{"deposit_receiver_nil", func(terms *Terms) { terms.DepositReceiver = nil }, true},
+		{"deposit_sender_negative", func(terms *Terms) { terms.DepositSender = big.NewInt(-1) }, true},
+		{"deposit_receiver_negative", func(terms *Terms) { terms.DepositReceiver = big.NewInt(-1) }, true},
+		{"confirm_timeout_not_set", func(terms *Terms) { terms.ConfirmTimeout = 0 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms := termsForTest
+			tt.modify(&terms)
+			if err := terms.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Terms.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_Terms_Deposit(t *testing.T) {
+
+	if got := termsForTest.Deposit(Sender); got.Cmp(termsForTest.DepositSender) != 0 {
+		t.Errorf("Terms.Deposit(Sender) = %v, want %v", got, termsForTest.DepositSender)
+	}
+	if got := termsForTest.Deposit(Receiver); got.Cmp(termsForTest.DepositReceiver) != 0 {
+		t.Errorf("Terms.Deposit(Receiver) = %v, want %v", got, termsForTest.DepositReceiver)
+	}
+}
+
+func Test_Terms_Expired(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name   string
+		expiry int64
+		want   bool
+	}{
+		{"not_set", 0, false},
+		{"before_expiry", 1100, false},
+		{"at_expiry", 1000, false},
+		{"after_expiry", 900, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms := termsForTest
+			terms.Expiry = tt.expiry
+			if got := terms.Expired(now); got != tt.want {
+				t.Errorf("Terms.Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Terms_Equal(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		modify func(*Terms)
+		want   bool
+	}{
+		{"same", func(*Terms) {}, true},
+		{"same_amounts_different_pointers", func(terms *Terms) { terms.DepositSender = big.NewInt(10) }, true},
+		{"deposit_sender_differs", func(terms *Terms) { terms.DepositSender = big.NewInt(11) }, false},
+		{"deposit_receiver_nil", func(terms *Terms) { terms.DepositReceiver = nil }, false},
+		{"confirm_timeout_differs", func(terms *Terms) { terms.ConfirmTimeout = 1 }, false},
+		{"expiry_differs", func(terms *Terms) { terms.Expiry = 1 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms := termsForTest
+			tt.modify(&terms)
+			if got := termsForTest.Equal(terms); got != tt.want {
+				t.Errorf("Terms.Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !(Terms{}).Equal(Terms{}) {
+		t.Errorf("Terms.Equal() on empty terms = false, want true")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// tlsConfigType holds the tls configuration used by the websocket adapter.
+// If it is not enabled, connections are not encrypted.
+type tlsConfigType struct {
+	enabled  bool
+	server   *tls.Config //Used by the listener for incoming connections
+	client   *tls.Config //Used for dialing outgoing connections
+	bindToID bool        //Verify that certificate of the peer is issued for its on-chain id
+}
+
+var tlsConfig = tlsConfigType{}
+
+// newTLSConfig loads the certificate, key and ca bundle in cfg and returns the tls configuration for the
+// websocket adapter. If no certificate is configured, tls is disabled.
+//
+// If client authentication is enabled, the listener requires a certificate signed by the ca
+// from the peer and the same certificate is presented to the peers when dialing.
+// Binding the certificates to ids requires the certificates of both users, hence it enables client
+// authentication as well.
+func newTLSConfig(cfg *Config) (tlsCfg tlsConfigType, err error) {
+
+	if cfg.tlsCertFile == "" && cfg.tlsKeyFile == "" {
+		if cfg.tlsCAFile != "" || cfg.tlsClientAuth || cfg.tlsBindID {
+			return tlsConfigType{}, fmt.Errorf("tls certificate and key are required to enable tls")
+		}
+		return tlsConfigType{}, nil
+	}
+	if cfg.tlsCertFile == "" || cfg.tlsKeyFile == "" {
+		return tlsConfigType{}, fmt.Errorf("both tls certificate and key are required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.tlsCertFile, cfg.tlsKeyFile)
+	if err != nil {
+		return tlsConfigType{}, fmt.Errorf("Error loading tls key pair - %s", err.Error())
+	}
+
+	//System roots are used if ca bundle is not configured
+	var caPool *x509.CertPool
+	if cfg.tlsCAFile != "" {
+		caBytes, err := ioutil.ReadFile(cfg.tlsCAFile)
+		if err != nil {
+			return tlsConfigType{}, fmt.Errorf("Error reading tls ca bundle - %s", err.Error())
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caBytes) {
+			return tlsConfigType{}, fmt.Errorf("No valid certificates in tls ca bundle %s", cfg.tlsCAFile)
+		}
+	}
+
+	clientAuth := tls.NoClientCert
+	if cfg.tlsClientAuth || cfg.tlsBindID {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	tlsCfg = tlsConfigType{
+		enabled: true,
+		server: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    caPool,
+			ClientAuth:   clientAuth,
+			MinVersion:   tls.VersionTLS12,
+		},
+		client: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      caPool,
+			MinVersion:   tls.VersionTLS12,
+		},
+		bindToID: cfg.tlsBindID,
+	}
+	return tlsCfg, nil
+}
+
+// peerCertificateProvider is implemented by adapters that can provide the certificate presented by the peer.
+type peerCertificateProvider interface {
+	peerCertificate() *x509.Certificate
+}
+
+// verifyCertBinding verifies that the certificate presented by the peer on the connection was issued for the
+// on-chain id of peerID, so that certificate of a user cannot be swapped for the certificate of another.
+// The certificate is bound to the id, if its common name is the hex encoded on-chain address.
+//
+// It returns nil if binding of certificates to ids is not enabled.
+func verifyCertBinding(conn *Instance, peerID identity.OffChainID) error {
+
+	if !tlsConfig.bindToID {
+		return nil
+	}
+
+	provider, ok := conn.adapter.(peerCertificateProvider)
+	if !ok {
+		return fmt.Errorf("Adapter does not support certificates")
+	}
+	cert := provider.peerCertificate()
+	if cert == nil {
+		return fmt.Errorf("Peer did not present a certificate")
+	}
+	if !certBoundToID(cert, peerID) {
+		return fmt.Errorf("Certificate (%s) is not bound to the peer id (0x%x)", cert.Subject.CommonName, peerID.OnChainID)
+	}
+	return nil
+}
+
+func certBoundToID(cert *x509.Certificate, id identity.OffChainID) bool {
+	commonName := strings.TrimPrefix(strings.ToLower(cert.Subject.CommonName), "0x")
+	return commonName == fmt.Sprintf("%x", id.OnChainID.Bytes())
+}
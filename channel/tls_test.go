@@ -0,0 +1,438 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// testCA is a certificate authority generated locally for the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string //Directory in which the certificates and keys are written
+}
+
+func newTestCA(t *testing.T, dir, name string) testCA {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Setup - GenerateKey() err = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Setup - CreateCertificate() err = %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("Setup - ParseCertificate() err = %v", err)
+	}
+	writePEM(t, filepath.Join(dir, name+"-ca.pem"), "CERTIFICATE", certDER)
+	return testCA{cert: cert, key: key, dir: dir}
+}
+
+// caFile returns the path of the ca bundle containing the certificate of the ca.
+func (ca testCA) caFile() string {
+	return filepath.Join(ca.dir, ca.cert.Subject.CommonName+"-ca.pem")
+}
+
+// issue generates a certificate with commonName for localhost, signed by the ca.
+// It returns the path of the certificate and key files.
+func (ca testCA) issue(t *testing.T, name, commonName string) (certFile, keyFile string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Setup - GenerateKey() err = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Setup - CreateCertificate() err = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Setup - MarshalECPrivateKey() err = %v", err)
+	}
+
+	certFile = filepath.Join(ca.dir, name+"-cert.pem")
+	keyFile = filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", certDER)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, filename, blockType string, data []byte) {
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data})
+	if err := ioutil.WriteFile(filename, pemBytes, 0600); err != nil {
+		t.Fatalf("Setup - WriteFile() err = %v", err)
+	}
+}
+
+func Test_newTLSConfig(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dst-go-tls-test")
+	if err != nil {
+		t.Fatalf("Setup - TempDir() err = %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	ca := newTestCA(t, dir, "test")
+	certFile, keyFile := ca.issue(t, "alice", aliceID.OnChainID.Hex())
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	if err = ioutil.WriteFile(invalidFile, []byte("invalid"), 0600); err != nil {
+		t.Fatalf("Setup - WriteFile() err = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		cfg            Config
+		wantEnabled    bool
+		wantClientAuth tls.ClientAuthType
+		wantBindToID   bool
+		wantErr        bool
+	}{
+		{
+			name:        "disabled",
+			cfg:         Config{},
+			wantEnabled: false,
+			wantErr:     false,
+		},
+		{
+			name:    "ca_without_cert",
+			cfg:     Config{tlsCAFile: ca.caFile()},
+			wantErr: true,
+		},
+		{
+			name:    "bind_id_without_cert",
+			cfg:     Config{tlsBindID: true},
+			wantErr: true,
+		},
+		{
+			name:    "cert_without_key",
+			cfg:     Config{tlsCertFile: certFile},
+			wantErr: true,
+		},
+		{
+			name:    "key_without_cert",
+			cfg:     Config{tlsKeyFile: keyFile},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_cert_file",
+			cfg:     Config{tlsCertFile: invalidFile, tlsKeyFile: keyFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing_ca_file",
+			cfg:     Config{tlsCertFile: certFile, tlsKeyFile: keyFile, tlsCAFile: filepath.Join(dir, "missing.pem")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_ca_file",
+			cfg:     Config{tlsCertFile: certFile, tlsKeyFile: keyFile, tlsCAFile: invalidFile},
+			wantErr: true,
+		},
+		{
+			name:           "valid",
+			cfg:            Config{tlsCertFile: certFile, tlsKeyFile: keyFile, tlsCAFile: ca.caFile()},
+			wantEnabled:    true,
+			wantClientAuth: tls.NoClientCert,
+			wantErr:        false,
+		},
+		{
+			name:           "valid_client_auth",
+			cfg:            Config{tlsCertFile: certFile, tlsKeyFile: keyFile, tlsCAFile: ca.caFile(), tlsClientAuth: true},
+			wantEnabled:    true,
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+			wantErr:        false,
+		},
+		{
+			name:           "valid_bind_id",
+			cfg:            Config{tlsCertFile: certFile, tlsKeyFile: keyFile, tlsCAFile: ca.caFile(), tlsBindID: true},
+			wantEnabled:    true,
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+			wantBindToID:   true,
+			wantErr:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTLSConfig(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.enabled != tt.wantEnabled {
+				t.Fatalf("newTLSConfig() enabled = %v, want %v", got.enabled, tt.wantEnabled)
+			}
+			if !got.enabled {
+				return
+			}
+			if got.server.ClientAuth != tt.wantClientAuth {
+				t.Errorf("newTLSConfig() server.ClientAuth = %v, want %v", got.server.ClientAuth, tt.wantClientAuth)
+			}
+			if got.bindToID != tt.wantBindToID {
+				t.Errorf("newTLSConfig() bindToID = %v, want %v", got.bindToID, tt.wantBindToID)
+			}
+			if got.client.RootCAs == nil || got.server.ClientCAs == nil {
+				t.Errorf("newTLSConfig() ca pool not set")
+			}
+		})
+	}
+}
+
+func Test_certBoundToID(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		commonName string
+		id         identity.OffChainID
+		want       bool
+	}{
+		{"valid_checksum_hex", aliceID.OnChainID.Hex(), aliceID, true},
+		{"valid_lower_case", fmt.Sprintf("0x%x", aliceID.OnChainID.Bytes()), aliceID, true},
+		{"valid_without_prefix", fmt.Sprintf("%x", aliceID.OnChainID.Bytes()), aliceID, true},
+		{"other_id", aliceID.OnChainID.Hex(), bobID, false},
+		{"hostname", "localhost", aliceID, false},
+		{"empty", "", aliceID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.commonName}}
+			if got := certBoundToID(cert, tt.id); got != tt.want {
+				t.Errorf("certBoundToID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_verifyCertBinding(t *testing.T) {
+
+	defer func(cfg tlsConfigType) {
+		tlsConfig = cfg
+	}(tlsConfig)
+
+	aliceCert := &x509.Certificate{Subject: pkix.Name{CommonName: aliceID.OnChainID.Hex()}}
+
+	tests := []struct {
+		name     string
+		bindToID bool
+		adapter  ReadWriteCloser
+		wantErr  bool
+	}{
+		{"binding_disabled", false, &MockReadWriteCloser{}, false},
+		{"adapter_without_certificate_support", true, &MockReadWriteCloser{}, true},
+		{"no_certificate", true, &wsChannel{}, true},
+		{"certificate_of_other_id", true, &wsChannel{peerCert: &x509.Certificate{Subject: pkix.Name{CommonName: bobID.OnChainID.Hex()}}}, true},
+		{"valid", true, &wsChannel{peerCert: aliceCert}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig = tlsConfigType{bindToID: tt.bindToID}
+			conn := &Instance{adapter: tt.adapter}
+			if err := verifyCertBinding(conn, aliceID); (err != nil) != tt.wantErr {
+				t.Errorf("verifyCertBinding() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_NewChannel_TLS(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dst-go-tls-test")
+	if err != nil {
+		t.Fatalf("Setup - TempDir() err = %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	defer func(cfg tlsConfigType) {
+		tlsConfig = cfg
+	}(tlsConfig)
+
+	alice, bob := idsWithCredentials()
+	ca := newTestCA(t, dir, "test")
+	otherCA := newTestCA(t, dir, "other")
+
+	newConfig := func(certFile, keyFile, caFile string, bindID bool) tlsConfigType {
+		cfg, err := newTLSConfig(&Config{tlsCertFile: certFile, tlsKeyFile: keyFile, tlsCAFile: caFile, tlsBindID: bindID})
+		if err != nil {
+			t.Fatalf("Setup - newTLSConfig() err = %v", err)
+		}
+		return cfg
+	}
+
+	aliceCert, aliceKey := ca.issue(t, "alice", aliceID.OnChainID.Hex())
+	bobCert, bobKey := ca.issue(t, "bob", bobID.OnChainID.Hex())
+	untrustedCert, untrustedKey := otherCA.issue(t, "untrusted", aliceID.OnChainID.Hex())
+
+	//The listener captures the tls config when started. Hence config of alice can be
+	//set for dialing after the listener of bob is started, though both use the same module variable.
+	startListener := func(listenerTLS tlsConfigType) (listener Shutdown, acceptErr chan error) {
+
+		_ = exec.Command("fuser", "-k 9602/tcp").Run()
+		tlsConfig = listenerTLS
+
+		localAddr, err := bobID.ListenerLocalAddr()
+		if err != nil {
+			t.Fatalf("ListenerLocalAddr() err = %v", err)
+		}
+		listener, inConn, err := wsStartListener(localAddr, bobID.ListenerEndpoint, 10)
+		if err != nil {
+			t.Fatalf("Setup - wsStartListener() err = %v", err)
+		}
+		acceptErr = make(chan error, 10)
+		go func() {
+			for {
+				newConn := <-inConn
+				_, err := acceptIdentity(context.Background(), newConn, bob)
+				acceptErr <- err
+			}
+		}()
+		return listener, acceptErr
+	}
+
+	tests := []struct {
+		name          string
+		listenerTLS   tlsConfigType
+		dialerTLS     tlsConfigType
+		wantErr       bool
+		wantAccepted  bool
+		wantAcceptErr bool
+	}{
+		{
+			name:         "valid_without_binding",
+			listenerTLS:  newConfig(bobCert, bobKey, ca.caFile(), false),
+			dialerTLS:    newConfig(aliceCert, aliceKey, ca.caFile(), false),
+			wantErr:      false,
+			wantAccepted: true,
+		},
+		{
+			name:         "valid_with_binding",
+			listenerTLS:  newConfig(bobCert, bobKey, ca.caFile(), true),
+			dialerTLS:    newConfig(aliceCert, aliceKey, ca.caFile(), true),
+			wantErr:      false,
+			wantAccepted: true,
+		},
+		{
+			//Identity exchange completes on the listener side, as the proof is sent before verifying the certificate
+			name:         "listener_certificate_swapped",
+			listenerTLS:  newConfig(aliceCert, aliceKey, ca.caFile(), true),
+			dialerTLS:    newConfig(aliceCert, aliceKey, ca.caFile(), true),
+			wantErr:      true,
+			wantAccepted: true,
+		},
+		{
+			name:          "dialer_certificate_swapped",
+			listenerTLS:   newConfig(bobCert, bobKey, ca.caFile(), true),
+			dialerTLS:     newConfig(bobCert, bobKey, ca.caFile(), true),
+			wantAccepted:  true,
+			wantAcceptErr: true,
+		},
+		{
+			name:        "listener_certificate_untrusted",
+			listenerTLS: newConfig(untrustedCert, untrustedKey, otherCA.caFile(), false),
+			dialerTLS:   newConfig(aliceCert, aliceKey, ca.caFile(), false),
+			wantErr:     true,
+		},
+		{
+			name:        "dialer_without_tls",
+			listenerTLS: newConfig(bobCert, bobKey, ca.caFile(), false),
+			dialerTLS:   tlsConfigType{},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			listener, acceptErr := startListener(tt.listenerTLS)
+			defer func() {
+				_ = listener.Shutdown(context.Background())
+			}()
+			tlsConfig = tt.dialerTLS
+
+			conn, err := NewChannel(alice, bobID, WebSocket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewChannel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				defer func() {
+					_ = conn.Close()
+				}()
+			}
+
+			//Wait shorter when the connection is expected to be rejected during the tls handshake
+			wait := time.Second
+			if tt.wantAccepted {
+				wait = identityExchangeTimeout
+			}
+			select {
+			case err := <-acceptErr:
+				if !tt.wantAccepted {
+					t.Fatalf("acceptIdentity() called, want connection rejected before identity exchange")
+				}
+				if (err != nil) != tt.wantAcceptErr {
+					t.Errorf("acceptIdentity() error = %v, wantErr %v", err, tt.wantAcceptErr)
+				}
+			case <-time.After(wait):
+				if tt.wantAccepted {
+					t.Errorf("acceptIdentity() not called, want connection accepted")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// ValidateVPCState checks if state is a valid successor of the latest state of the channel.
+// Only the contents of the state are checked, signatures are verified by SetCurrentVPCState.
+//
+// The state is valid if its id matches the vpc state id of the channel, its version is greater than that of
+// the current vpc state, the blocked amounts are not negative and their sum equals the total amount blocked
+// in the msc base state. Hence a valid state can neither create nor destroy funds in the channel.
+func (inst *Instance) ValidateVPCState(state VPCState) error {
+	return inst.validateVPCState(state, inst.CurrentVpcState().VPCState, inst.MscBaseState().MSContractBaseState)
+}
+
+// validateVPCState validates state as described in ValidateVPCState,
+// with current as the current vpc state and baseState as the msc base state of the channel.
+func (inst *Instance) validateVPCState(state, current VPCState, baseState MSCBaseState) error {
+
+	if state.Version == nil || state.BlockedSender == nil || state.BlockedReceiver == nil {
+		return fmt.Errorf("VPCState incomplete - version and blocked amounts are required")
+	}
+
+	wantID, err := inst.vpcStateID()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(state.ID, wantID) {
+		return fmt.Errorf("VPCState id (%x) does not match the vpc state id of the channel (%x)", state.ID, wantID)
+	}
+
+	if state.Version.Sign() < 0 {
+		return fmt.Errorf("VPCState version (%s) is negative", state.Version.String())
+	}
+	if current.Version != nil {
+		if state.Version.Cmp(current.Version) != 1 {
+			return fmt.Errorf("Current Version number (%s) less than previous (%s)", state.Version.String(), current.Version.String())
+		}
+	}
+
+	if state.BlockedSender.Sign() < 0 {
+		return fmt.Errorf("Amount blocked by sender (%s) is negative", state.BlockedSender.String())
+	}
+	if state.BlockedReceiver.Sign() < 0 {
+		return fmt.Errorf("Amount blocked by receiver (%s) is negative", state.BlockedReceiver.String())
+	}
+
+	if baseState.BlockedSender == nil || baseState.BlockedReceiver == nil {
+		return fmt.Errorf("MSC base state not set for the channel")
+	}
+	total := new(big.Int).Add(state.BlockedSender, state.BlockedReceiver)
+	wantTotal := new(big.Int).Add(baseState.BlockedSender, baseState.BlockedReceiver)
+	if total.Cmp(wantTotal) != 0 {
+		return fmt.Errorf("Total amount in VPCState (%s) does not match the amount blocked in MSC base state (%s)",
+			total.String(), wantTotal.String())
+	}
+	return nil
+}
+
+// vpcStateID returns the id that all the vpc states of the channel should have.
+// It is derived from the addresses of the sender, receiver and the session id of the channel.
+func (inst *Instance) vpcStateID() ([]byte, error) {
+
+	sid := inst.SessionID()
+	if sid.SidComplete == nil {
+		return nil, fmt.Errorf("Session id not set for the channel")
+	}
+	vpcStateID := VPCStateID{
+		AddSender:    inst.SenderID().OnChainID,
+		AddrReceiver: inst.ReceiverID().OnChainID,
+		SID:          sid.SidComplete,
+	}
+	return vpcStateID.SoliditySHA3(), nil
+}
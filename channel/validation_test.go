@@ -0,0 +1,116 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"math/big"
+	"testing"
+)
+
+func Test_Instance_ValidateVPCState(t *testing.T) {
+
+	//modified returns a copy of the state in testVPCState with modify applied to it
+	modified := func(modify func(state *VPCState)) VPCState {
+		state := testVPCState.VPCState
+		state.Version = new(big.Int).Set(state.Version)
+		state.BlockedSender = new(big.Int).Set(state.BlockedSender)
+		state.BlockedReceiver = new(big.Int).Set(state.BlockedReceiver)
+		modify(&state)
+		return state
+	}
+	newInstance := func() *Instance {
+		return &Instance{
+			selfID:       aliceID,
+			peerID:       bobID,
+			roleChannel:  Sender,
+			sessionID:    testSessionID,
+			mscBaseState: testMSCBaseState,
+		}
+	}
+	withCurrentState := func(inst *Instance) *Instance {
+		inst.vpcStatesList = []VPCStateSigned{testVPCState}
+		return inst
+	}
+
+	tests := []struct {
+		name     string
+		instance *Instance
+		state    VPCState
+		wantErr  bool
+	}{
+		{"valid-first-state", newInstance(), testVPCState.VPCState, false},
+		{"valid-next-state", withCurrentState(newInstance()), modified(func(state *VPCState) {
+			state.Version.SetInt64(2)
+			state.BlockedSender.SetInt64(30)
+			state.BlockedReceiver.SetInt64(0)
+		}), false},
+		{"missing-version", newInstance(), modified(func(state *VPCState) { state.Version = nil }), true},
+		{"missing-blocked-receiver", newInstance(), modified(func(state *VPCState) { state.BlockedReceiver = nil }), true},
+		{"session-id-not-set", &Instance{selfID: aliceID, peerID: bobID, roleChannel: Sender, mscBaseState: testMSCBaseState},
+			testVPCState.VPCState, true},
+		{"invalid-id", newInstance(), modified(func(state *VPCState) { state.ID = []byte("sample-id") }), true},
+		{"id-of-other-channel", &Instance{selfID: bobID, peerID: aliceID, roleChannel: Sender, sessionID: testSessionID,
+			mscBaseState: testMSCBaseState}, testVPCState.VPCState, true},
+		{"negative-version", newInstance(), modified(func(state *VPCState) { state.Version.SetInt64(-1) }), true},
+		{"same-version", withCurrentState(newInstance()), testVPCState.VPCState, true},
+		{"older-version", withCurrentState(newInstance()), modified(func(state *VPCState) { state.Version.SetInt64(0) }), true},
+		{"negative-blocked-sender", newInstance(), modified(func(state *VPCState) {
+			state.BlockedSender.SetInt64(-10)
+			state.BlockedReceiver.SetInt64(40)
+		}), true},
+		{"negative-blocked-receiver", newInstance(), modified(func(state *VPCState) {
+			state.BlockedSender.SetInt64(40)
+			state.BlockedReceiver.SetInt64(-10)
+		}), true},
+		{"msc-base-state-not-set", &Instance{selfID: aliceID, peerID: bobID, roleChannel: Sender, sessionID: testSessionID},
+			testVPCState.VPCState, true},
+		{"creates-funds", newInstance(), modified(func(state *VPCState) { state.BlockedReceiver.SetInt64(21) }), true},
+		{"destroys-funds", newInstance(), modified(func(state *VPCState) { state.BlockedSender.SetInt64(9) }), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.instance.ValidateVPCState(tt.state); (err != nil) != tt.wantErr {
+				t.Errorf("Instance.ValidateVPCState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_Instance_SetCurrentVPCState_invalidContents(t *testing.T) {
+
+	//Both the signatures on the state are valid, but it does not preserve the total amount in msc base state
+	inst := &Instance{
+		selfID:      aliceID,
+		peerID:      bobID,
+		roleChannel: Sender,
+		sessionID:   testSessionID,
+		mscBaseState: MSCBaseStateSigned{
+			MSContractBaseState: MSCBaseState{
+				Sid:             testSessionID.SidComplete,
+				BlockedSender:   big.NewInt(10),
+				BlockedReceiver: big.NewInt(10),
+				Version:         big.NewInt(1),
+			},
+		},
+	}
+	if err := inst.SetCurrentVPCState(testVPCState); err == nil {
+		t.Errorf("Instance.SetCurrentVPCState() error = nil, want non nil")
+	}
+	if gotState := inst.CurrentVpcState(); gotState.VPCState.Version != nil {
+		t.Errorf("Instance.SetCurrentVPCState() - invalid state set")
+	}
+}
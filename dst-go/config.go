@@ -17,6 +17,11 @@
 package main
 
 import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/api"
 	"github.com/direct-state-transfer/dst-go/blockchain"
 	"github.com/direct-state-transfer/dst-go/channel"
 	"github.com/direct-state-transfer/dst-go/config"
@@ -33,20 +38,39 @@ type Config struct {
 	Identity   identity.Config
 	Channel    channel.Config
 	Blockchain blockchain.Config
+	API        api.Config
 
 	Logger log.Config
+
+	shutdownTimeout time.Duration //Maximum time to wait for the node to shutdown gracefully
+	storeDir        string        //Directory to persist the channel states, in-memory store is used if empty
+	policy          string        //Policy for deciding on the requests made by the peers, see newPolicy
+	deposit         string        //Amount (in Wei) deposited by the users in each new channel
+	closingMode     string        //Closing mode set in each new channel, see channel.ClosingMode
 }
 
+// Names of the policies that can be configured for the sessions in the node.
+const (
+	policyDefault   = "default"    //DefaultPolicy
+	policyAcceptAll = "accept-all" //AcceptAllPolicy, only for trusted peers
+)
+
 // ConfigDefault represents the default configuration for this module.
 var ConfigDefault = Config{
 	Identity:   identity.ConfigDefault,
 	Channel:    channel.ConfigDefault,
 	Blockchain: blockchain.ConfigDefault,
+	API:        api.ConfigDefault,
 
 	Logger: log.Config{
 		Level:   log.InfoLevel,
 		Backend: log.StdoutBackend,
 	},
+
+	shutdownTimeout: 30 * time.Second,
+	policy:          policyDefault,
+	deposit:         "0",
+	closingMode:     string(channel.ClosingModeManual),
 }
 
 // GetFlagSet initializes and returns a flagset with flags for configuring this module.
@@ -57,6 +81,17 @@ func GetFlagSet() *pflag.FlagSet {
 		"programLogLevel", "", "Default log level for all modules")
 	nodeMgrFlags.String(
 		"programLogBackend", "", "Default log backend for all modules")
+	nodeMgrFlags.Duration(
+		"shutdownTimeout", 0, "Maximum time to wait for the node to shutdown gracefully")
+	nodeMgrFlags.String(
+		"storeDir", "", "Directory to persist the channel states of all users")
+	nodeMgrFlags.String(
+		"policy", "", "Policy for deciding on requests from peers - "+policyDefault+" or "+policyAcceptAll)
+	nodeMgrFlags.String(
+		"deposit", "", "Amount (in Wei) deposited by the users in each new channel")
+	nodeMgrFlags.String(
+		"closingMode", "", "Action on vpc closing events of new channels - "+string(channel.ClosingModeManual)+", "+
+			string(channel.ClosingModeAutoNormal)+" or "+string(channel.ClosingModeAutoImmediate))
 
 	return &nodeMgrFlags
 }
@@ -66,6 +101,7 @@ func addFlagSet(cmd *cobra.Command) {
 	cmd.PersistentFlags().AddFlagSet(identity.GetFlagSet())
 	cmd.PersistentFlags().AddFlagSet(channel.GetFlagSet())
 	cmd.PersistentFlags().AddFlagSet(blockchain.GetFlagSet())
+	cmd.PersistentFlags().AddFlagSet(api.GetFlagSet())
 
 }
 
@@ -95,6 +131,12 @@ func parseFlagSet(flagSet *pflag.FlagSet, nodeConfig *Config) (
 	}
 	resolveLoggerConfig(&nodeConfig.Logger, &nodeConfig.Blockchain.Logger)
 
+	err = api.ParseFlags(flagSet, &nodeConfig.API)
+	if err != nil {
+		return err
+	}
+	resolveLoggerConfig(&nodeConfig.Logger, &nodeConfig.API.Logger)
+
 	return nil
 }
 
@@ -104,12 +146,35 @@ func ParseFlags(flagSet *pflag.FlagSet, nodeConfig *Config) (
 	var flagsToParse = []config.FlagInfo{
 		{Name: "programLogLevel", Ptr: &nodeConfig.Logger.Level},
 		{Name: "programLogBackend", Ptr: &nodeConfig.Logger.Backend},
+		{Name: "shutdownTimeout", Ptr: &nodeConfig.shutdownTimeout},
+		{Name: "storeDir", Ptr: &nodeConfig.storeDir},
+		{Name: "policy", Ptr: &nodeConfig.policy},
+		{Name: "deposit", Ptr: &nodeConfig.deposit},
+		{Name: "closingMode", Ptr: &nodeConfig.closingMode},
 	}
 
 	return config.LookUpMultiple(flagSet, flagsToParse)
 
 }
 
+// newPolicy returns the policy with name, that deposits the amount (in Wei) in each new channel.
+func newPolicy(name, deposit string) (Policy, error) {
+
+	depositAmount, ok := new(big.Int).SetString(deposit, 10)
+	if !ok || depositAmount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid deposit amount - %s", deposit)
+	}
+
+	switch name {
+	case policyDefault:
+		return DefaultPolicy{AcceptAllPolicy{DepositAmount: depositAmount}}, nil
+	case policyAcceptAll:
+		return AcceptAllPolicy{DepositAmount: depositAmount}, nil
+	default:
+		return nil, fmt.Errorf("unknown policy - %s", name)
+	}
+}
+
 //TODO : Find a way to resolve configuration
 func resolveLoggerConfig(defaultCfg log.Configurer, moduleCfg log.Configurer) {
 
@@ -17,14 +17,69 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/direct-state-transfer/dst-go/blockchain"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/identity"
+	"github.com/direct-state-transfer/dst-go/log"
 )
 
 var configFile string
 
 func TestMain(m *testing.M) {
 	flag.StringVar(&configFile, "configFile", "", "Config file for unit tests")
+	setupLogger()
 	os.Exit(m.Run())
 }
+
+func setupLogger() {
+	var err error
+	logger, err = log.NewLogger(log.DebugLevel, log.StdoutBackend, "dst-go-test")
+	if err != nil {
+		fmt.Printf("error setting up logger - %s\n", err)
+		os.Exit(1)
+	}
+
+	//Modules used by the session in tests
+	identity.SetLogger(logger)
+	channel.SetLogger(logger)
+	blockchain.SetLogger(logger)
+}
+
+// testIDsFile is the file with the identities used in tests, signatures used in tests are for these keys.
+const testIDsFile = "../testdata/test_addresses.json"
+
+// testIDs returns the identities of alice and bob with credentials set, having listener addresses
+// different from those used in the tests of other packages, so that tests can be run in parallel.
+func testIDs(t *testing.T) (alice, bob identity.OffChainID) {
+
+	jsonFile, err := ioutil.ReadFile(testIDsFile)
+	if err != nil {
+		t.Fatalf("Cannot open test_addresses file - %v", err)
+	}
+	jsonData := struct {
+		KeystoreDir   string              `json:"keystore_dir"`
+		AlicePassword string              `json:"alice_password"`
+		BobPassword   string              `json:"bob_password"`
+		AliceID       identity.OffChainID `json:"alice_id"`
+		BobID         identity.OffChainID `json:"bob_id"`
+	}{}
+	if err = json.Unmarshal(jsonFile, &jsonData); err != nil {
+		t.Fatalf("Cannot parse test_addresses data - %v", err)
+	}
+
+	testKeyStore := identity.NewKeystore(filepath.Join(filepath.Dir(testIDsFile), jsonData.KeystoreDir))
+	alice, bob = jsonData.AliceID, jsonData.BobID
+	alice.ListenerIPAddr = "localhost:9631"
+	bob.ListenerIPAddr = "localhost:9632"
+	alice.SetCredentials(testKeyStore, jsonData.AlicePassword)
+	bob.SetCredentials(testKeyStore, jsonData.BobPassword)
+	return alice, bob
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+func Test_newPolicy(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		policyName  string
+		deposit     string
+		wantPolicy  Policy
+		wantDeposit *big.Int
+		wantErr     bool
+	}{
+		{"default", policyDefault, "10", DefaultPolicy{}, big.NewInt(10), false},
+		{"accept_all", policyAcceptAll, "0", AcceptAllPolicy{}, big.NewInt(0), false},
+		{"unknown_policy", "accept-some", "10", nil, nil, true},
+		{"invalid_deposit", policyDefault, "ten", nil, nil, true},
+		{"negative_deposit", policyDefault, "-10", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newPolicy(tt.policyName, tt.deposit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if reflect.TypeOf(got) != reflect.TypeOf(tt.wantPolicy) {
+				t.Errorf("newPolicy() = %T, want %T", got, tt.wantPolicy)
+			}
+			if deposit, _ := got.Deposit(identity.OffChainID{}); deposit.Cmp(tt.wantDeposit) != 0 {
+				t.Errorf("newPolicy() deposit = %v, want %v", deposit, tt.wantDeposit)
+			}
+		})
+	}
+}
@@ -17,8 +17,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/direct-state-transfer/dst-go/api"
 	"github.com/direct-state-transfer/dst-go/blockchain"
 	"github.com/direct-state-transfer/dst-go/channel"
 	"github.com/direct-state-transfer/dst-go/ethereum/adapter"
@@ -76,16 +82,76 @@ func nodeInit(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	BlockchainConn, LibSignAddr, err = blockchain.InitModule(&ConfigDefault.Blockchain)
+	realBackend, libSignAddr, err := blockchain.InitModule(&ConfigDefault.Blockchain)
 	if err != nil {
 		logger.Error("error initialising blockchain module -", err)
 		return
 	}
-	if err == nil {
-		logger.Info("Node successfully initialised")
+	BlockchainConn, LibSignAddr = realBackend, libSignAddr
+
+	policy, err := newPolicy(ConfigDefault.policy, ConfigDefault.deposit)
+	if err != nil {
+		logger.Error("error initialising session policy -", err)
+		realBackend.Close()
+		return
+	}
+
+	closingMode, err := channel.ParseClosingMode(ConfigDefault.closingMode)
+	if err != nil {
+		logger.Error("error initialising session closing mode -", err)
+		realBackend.Close()
+		return
+	}
+
+	node := newNodeManager(ConfigDefault.storeDir, policy, closingMode)
+	apiServer, err := api.InitModule(&ConfigDefault.API, node)
+	if err != nil {
+		logger.Error("error initialising api module -", err)
+		realBackend.Close()
+		return
+	}
+	logger.Info("Node successfully initialised")
+
+	//Wait for exit signal from keyboard interrupt or process manager
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	logger.Info("Received", sig, "signal, shutting down node. Send again to force exit")
+	go func() {
+		<-sigs
+		logger.Error("Received second exit signal, forcing exit")
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ConfigDefault.shutdownTimeout)
+	defer cancel()
+	err = shutdown(ctx, apiServer, node, realBackend)
+	if err != nil {
+		logger.Error("Node shutdown with error -", err)
+		return
+	}
+	logger.Info("Node successfully shutdown")
+}
+
+// shutdown gracefully stops all the components of the node within the deadline of ctx.
+// The api server is stopped first so that no new requests are accepted, then all user sessions are closed
+// and finally the blockchain connection is closed.
+// All the components are stopped even if an error occurs and the first error is returned.
+func shutdown(ctx context.Context, apiServer *http.Server, node *nodeManager, conn *adapter.RealBackend) (err error) {
+
+	if apiServer != nil {
+		if errShutdown := apiServer.Shutdown(ctx); errShutdown != nil {
+			logger.Error("Error shutting down api server -", errShutdown)
+			err = fmt.Errorf("api server shutdown error - %s", errShutdown.Error())
+		}
+	}
+
+	if errClose := node.Close(ctx); errClose != nil && err == nil {
+		err = errClose
 	}
 
-	//TODO : Exit signal from keyboard interrupt and other modules
-	for {
+	if conn != nil {
+		conn.Close()
 	}
+	return err
 }
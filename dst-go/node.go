@@ -0,0 +1,139 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/direct-state-transfer/dst-go/api"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+// nodeManager keeps track of all the user sessions in this node.
+// It implements the api.Node interface, so that the sessions can be controlled via the api.
+type nodeManager struct {
+	sessions    map[types.Address]*Session
+	storeDir    string              //Directory in which channel store of each session is created
+	policy      Policy              //Policy set in each new session
+	closingMode channel.ClosingMode //Closing mode set in each new session, if not empty
+	access      sync.Mutex
+}
+
+func newNodeManager(storeDir string, policy Policy, closingMode channel.ClosingMode) *nodeManager {
+	return &nodeManager{
+		sessions:    make(map[types.Address]*Session),
+		storeDir:    storeDir,
+		policy:      policy,
+		closingMode: closingMode,
+	}
+}
+
+// NewSession initialises a new user session with ethAddr as owner and adds it to the node.
+// Only one session can exist for each user. The policy and closing mode of the node are set in the session.
+func (node *nodeManager) NewSession(ethAddr types.Address, password, keysDir, idFile string, maxConn uint32) (
+	api.Session, error) {
+
+	node.access.Lock()
+	defer node.access.Unlock()
+
+	if _, present := node.sessions[ethAddr]; present {
+		return nil, fmt.Errorf("Session for %s already exists", ethAddr.Hex())
+	}
+
+	store, err := node.openStore(ethAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := NewSession(ethAddr, password, keysDir, idFile, maxConn, store)
+	if err != nil {
+		if errClose := store.Close(); errClose != nil {
+			logger.Error("Error closing channel store -", errClose)
+		}
+		return nil, err
+	}
+	if node.policy != nil {
+		session.SetPolicy(node.policy)
+	}
+	if node.closingMode != "" {
+		if err = session.SetClosingMode(node.closingMode); err != nil {
+			logger.Error("Error setting closing mode in session -", err)
+		}
+	}
+	node.sessions[ethAddr] = session
+	return session, nil
+}
+
+// Session returns the session of the user with ethAddr, if any.
+func (node *nodeManager) Session(ethAddr types.Address) (api.Session, bool) {
+
+	node.access.Lock()
+	defer node.access.Unlock()
+
+	session, present := node.sessions[ethAddr]
+	if !present {
+		return nil, false
+	}
+	return session, true
+}
+
+// openStore opens the channel store for the session of user with ethAddr.
+// Each user has a separate store in the store directory of the node.
+// If store directory is not configured, an in-memory store is used and channel states will be lost when the node stops.
+func (node *nodeManager) openStore(ethAddr types.Address) (channel.Store, error) {
+
+	if node.storeDir == "" {
+		logger.Info("Store directory not configured, channel states of", ethAddr.Hex(), "will not be persisted")
+		return channel.NewMemoryStore(), nil
+	}
+	return channel.NewLevelDBStore(filepath.Join(node.storeDir, ethAddr.Hex()))
+}
+
+// Close closes all the sessions in the node concurrently within the deadline of ctx.
+// Sessions are removed from the node irrespective of the error and the first error is returned.
+func (node *nodeManager) Close(ctx context.Context) (err error) {
+
+	node.access.Lock()
+	sessions := node.sessions
+	node.sessions = make(map[types.Address]*Session)
+	node.access.Unlock()
+
+	errs := make(chan error, len(sessions))
+	for ethAddr, session := range sessions {
+		go func(ethAddr types.Address, session *Session) {
+			errClose := session.Close(ctx)
+			if errClose != nil {
+				errClose = fmt.Errorf("Session %s close error - %s", ethAddr.Hex(), errClose.Error())
+			}
+			errs <- errClose
+		}(ethAddr, session)
+	}
+
+	for range sessions {
+		if errClose := <-errs; errClose != nil {
+			logger.Error(errClose)
+			if err == nil {
+				err = errClose
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+func Test_nodeManager_Close(t *testing.T) {
+
+	node := newNodeManager("", nil, "")
+	node.sessions[types.HexToAddress("932a74da117eb9288ea759487360cd700e7777e1")] = newTestSession()
+	node.sessions[types.HexToAddress("815430d6ea7275317d09199a5a5675f017e011ef")] = newTestSession()
+
+	if err := node.Close(context.Background()); err != nil {
+		t.Fatalf("nodeManager.Close() error = %v, want nil", err)
+	}
+	if len(node.sessions) != 0 {
+		t.Errorf("nodeManager.Close() - %d sessions remaining, want 0", len(node.sessions))
+	}
+}
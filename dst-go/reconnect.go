@@ -0,0 +1,106 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+)
+
+// channelReconnectTimeout is the maximum time to keep trying to reconnect a channel after its connection dropped.
+const channelReconnectTimeout = 1 * time.Hour
+
+// watchConnection waits till the connection of the channel ch, on which dispatcher is running, drops.
+//
+// If this user initiated the channel, it reconnects to the peer with backoff, resynchronises the vpc states
+// and restarts the dispatcher, see channel.Instance.Reconnect. Else the peer is expected to reconnect,
+// which is handled when the incoming connection arrives.
+// Channels that are not open or were closed by the user are not reconnected.
+func (session *Session) watchConnection(ch *channel.Instance, dispatcher *channel.Dispatcher) {
+
+	select {
+	case <-dispatcher.Done():
+	case <-session.quit:
+		return
+	}
+	session.reconnect(ch)
+}
+
+// reconnect reconnects the channel ch to the peer, if this user initiated the channel and it is resumable.
+// On success, the dispatcher is started on the channel.
+func (session *Session) reconnect(ch *channel.Instance) {
+
+	if ch.RoleChannel() != channel.Sender || !session.resumable(ch) {
+		return
+	}
+	if err := session.beginOp(); err != nil {
+		return
+	}
+	defer session.endOp()
+
+	logger.Info("Reconnecting channel with", ch.PeerID())
+	ctx, cancel := session.timeoutContext(channelReconnectTimeout)
+	defer cancel()
+
+	if err := ch.Reconnect(ctx, channel.WebSocket); err != nil {
+		logger.Error("Error reconnecting channel with", ch.PeerID(), "-", err)
+		return
+	}
+	if err := session.startDispatcher(ch); err != nil {
+		logger.Error("Error starting dispatcher for channel with", ch.PeerID(), "-", err)
+	}
+}
+
+// resume resumes the channel ch on newConn, an incoming connection from the peer of the channel
+// after the previous connection dropped. See channel.Instance.Resume.
+func (session *Session) resume(ch, newConn *channel.Instance) {
+
+	if err := session.beginOp(); err != nil {
+		logger.Info("Not resuming channel with", ch.PeerID(), "-", err)
+		if errClose := newConn.Close(); errClose != nil {
+			logger.Error("Error closing channel -", errClose)
+		}
+		return
+	}
+	defer session.endOp()
+
+	ctx, cancel := session.timeoutContext(channelReconnectTimeout)
+	defer cancel()
+
+	if err := ch.Resume(ctx, newConn); err != nil {
+		logger.Error("Error resuming channel with", ch.PeerID(), "-", err)
+		return
+	}
+	if err := session.startDispatcher(ch); err != nil {
+		logger.Error("Error starting dispatcher for channel with", ch.PeerID(), "-", err)
+	}
+}
+
+// resumable returns true if the channel ch can be resumed on a new connection.
+// It should be open, not connected and should not have been closed by the user.
+func (session *Session) resumable(ch *channel.Instance) bool {
+
+	if ch.Connected() || ch.Status() != channel.Open {
+		return false
+	}
+
+	session.channelsAccess.Lock()
+	defer session.channelsAccess.Unlock()
+
+	return !session.closedByUser[ch.PeerID().OnChainID]
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+)
+
+func newOpenTestChannel(t *testing.T) *channel.Instance {
+	ch := &channel.Instance{}
+	for _, status := range []channel.Status{channel.PreSetup, channel.Setup, channel.Init, channel.Open} {
+		if !ch.SetStatus(status) {
+			t.Fatalf("SetStatus(%s) = false, want true", status)
+		}
+	}
+	return ch
+}
+
+func Test_Session_resumable(t *testing.T) {
+
+	t.Run("open", func(t *testing.T) {
+		session := newTestSession()
+		ch := newOpenTestChannel(t)
+
+		if got := session.resumable(ch); !got {
+			t.Errorf("Session.resumable() = %v, want true", got)
+		}
+	})
+	t.Run("not_open", func(t *testing.T) {
+		session := newTestSession()
+		ch := &channel.Instance{}
+		ch.SetStatus(channel.PreSetup)
+
+		if got := session.resumable(ch); got {
+			t.Errorf("Session.resumable() = %v, want false", got)
+		}
+	})
+	t.Run("closed_by_user", func(t *testing.T) {
+		session := newTestSession()
+		ch := newOpenTestChannel(t)
+		session.addChannel(ch)
+
+		//Set as in CloseChannel, which can close an open channel only when it is connected
+		session.closedByUser[ch.PeerID().OnChainID] = true
+		if got := session.resumable(ch); got {
+			t.Errorf("Session.resumable() after closed by user = %v, want false", got)
+		}
+
+		//Adding the channel again should make it resumable
+		session.addChannel(ch)
+		if got := session.resumable(ch); !got {
+			t.Errorf("Session.resumable() after addChannel = %v, want true", got)
+		}
+	})
+	t.Run("other_peer_closed_by_user", func(t *testing.T) {
+		session := newTestSession()
+		ch := newOpenTestChannel(t)
+		session.closedByUser[types.HexToAddress("815430d6ea7275317d09199a5a5675f017e011ef")] = true
+
+		if got := session.resumable(ch); !got {
+			t.Errorf("Session.resumable() = %v, want true", got)
+		}
+	})
+}
@@ -0,0 +1,375 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/blockchain"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+// channelOpeningTimeout is the maximum time to wait for the procedure of opening a channel to complete.
+const channelOpeningTimeout = 10 * time.Minute
+
+// channelClosingTimeout is the maximum time to wait for the procedure of closing a channel cooperatively to complete.
+const channelClosingTimeout = 10 * time.Minute
+
+// dispatcherBufferSize is the number of messages buffered by the dispatcher of each channel in the session.
+const dispatcherBufferSize = 10
+
+// Policy decides whether the requests made by the peers in the channels of a session are accepted.
+//
+// NewChannel and MSCBaseState are consulted when a peer opens a channel, see blockchain.OpeningPolicy.
+// Deposit returns the amount (in Wei) to be deposited by this user in a new incoming channel with the peer,
+// the channel is declined if the terms proposed by the peer require a different deposit.
+// Terms returns the terms to be proposed to the peer when opening an outgoing channel.
+// An error from Deposit or Terms declines the incoming channel or aborts opening the outgoing channel respectively.
+// VPCState is consulted when the peer proposes a new vpc state, role is the role of this user in the channel.
+// Current is the latest vpc state of the channel, or if no vpc state has been set yet, a state without version
+// holding the amounts blocked in the msc base state.
+//
+// Each method returns nil to accept the request or an error describing why it is declined.
+type Policy interface {
+	blockchain.OpeningPolicy
+	Deposit(peerID identity.OffChainID) (*big.Int, error)
+	Terms(peerID identity.OffChainID) (channel.Terms, error)
+	VPCState(peerID identity.OffChainID, role channel.Role, current, proposed channel.VPCState) error
+}
+
+// AcceptAllPolicy accepts all requests from the peers and deposits DepositAmount (in Wei) in each new channel.
+// If DepositAmount is nil, nothing is deposited. Outgoing channels are proposed with the same deposit for the peer.
+//
+// As it co-signs any vpc state that conserves the funds in the channel, including those that transfer all the funds
+// of this user to the peer, it should be used only when the peers are trusted. See DefaultPolicy.
+type AcceptAllPolicy struct {
+	DepositAmount *big.Int
+}
+
+// NewChannel accepts all new channel requests.
+func (p AcceptAllPolicy) NewChannel(peerID identity.OffChainID, msgProtocolVersion string, contractStoreVersion []byte,
+	terms channel.Terms) error {
+	return nil
+}
+
+// MSCBaseState accepts all msc base states.
+func (p AcceptAllPolicy) MSCBaseState(peerID identity.OffChainID, state channel.MSCBaseState) error {
+	return nil
+}
+
+// Deposit returns DepositAmount, or zero if it is nil.
+func (p AcceptAllPolicy) Deposit(peerID identity.OffChainID) (*big.Int, error) {
+	if p.DepositAmount == nil {
+		return big.NewInt(0), nil
+	}
+	return new(big.Int).Set(p.DepositAmount), nil
+}
+
+// Terms returns the terms with DepositAmount as deposit for both the users and the confirm timeout fixed in the mscontract.
+func (p AcceptAllPolicy) Terms(peerID identity.OffChainID) (channel.Terms, error) {
+	depositSender, _ := p.Deposit(peerID)
+	depositReceiver, _ := p.Deposit(peerID)
+	return channel.Terms{
+		DepositSender:   depositSender,
+		DepositReceiver: depositReceiver,
+		ConfirmTimeout:  uint64(blockchain.MSCConfirmTimeout / time.Second),
+	}, nil
+}
+
+// VPCState accepts all vpc states.
+func (p AcceptAllPolicy) VPCState(peerID identity.OffChainID, role channel.Role, current, proposed channel.VPCState) error {
+	return nil
+}
+
+// DefaultPolicy is the policy used in the sessions, unless another one is set.
+//
+// It accepts new channels and deposits as AcceptAllPolicy, but declines the vpc states proposed by the peer
+// in which the amount blocked for this user is lower than in the current state,
+// i.e the peer can only propose states that pay this user.
+type DefaultPolicy struct {
+	AcceptAllPolicy
+}
+
+// VPCState declines the proposed state if it lowers the amount blocked for this user.
+func (p DefaultPolicy) VPCState(peerID identity.OffChainID, role channel.Role, current, proposed channel.VPCState) error {
+
+	currentAmount, proposedAmount := blockedAmountOf(role, current), blockedAmountOf(role, proposed)
+	if currentAmount == nil || proposedAmount == nil {
+		return fmt.Errorf("amount blocked for %s not known", role)
+	}
+	if proposedAmount.Cmp(currentAmount) < 0 {
+		return fmt.Errorf("amount blocked for %s lowered from %s to %s", role, currentAmount.String(), proposedAmount.String())
+	}
+	return nil
+}
+
+// blockedAmountOf returns the amount blocked for the user with role in the vpc state.
+func blockedAmountOf(role channel.Role, state channel.VPCState) *big.Int {
+	switch role {
+	case channel.Sender:
+		return state.BlockedSender
+	case channel.Receiver:
+		return state.BlockedReceiver
+	default:
+		return nil
+	}
+}
+
+// SetPolicy sets the policy used for deciding on the requests made by the peers in the channels of the session.
+func (session *Session) SetPolicy(policy Policy) {
+
+	session.policyAccess.Lock()
+	defer session.policyAccess.Unlock()
+
+	session.policy = policy
+}
+
+func (session *Session) currentPolicy() Policy {
+
+	session.policyAccess.Lock()
+	defer session.policyAccess.Unlock()
+
+	return session.policy
+}
+
+// openingContext returns a context for opening a channel, that is done after channelOpeningTimeout
+// or when the session is closing, whichever is earlier.
+func (session *Session) openingContext() (ctx context.Context, cancel context.CancelFunc) {
+	return session.timeoutContext(channelOpeningTimeout)
+}
+
+// timeoutContext returns a context that is done after timeout or when the session is closing, whichever is earlier.
+func (session *Session) timeoutContext(timeout time.Duration) (ctx context.Context, cancel context.CancelFunc) {
+
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	go func() {
+		select {
+		case <-session.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// respond drives the receiver side of the protocol on the incoming channel ch.
+//
+// The procedure for opening the channel is performed with the deposit returned by the policy of the session.
+// Once the channel is open, vpc states proposed by the peer are handled in the background until the channel is closed.
+func (session *Session) respond(ch *channel.Instance) {
+
+	if err := session.beginOp(); err != nil {
+		logger.Info("Not responding to channel with", ch.PeerID(), "-", err)
+		return
+	}
+	defer session.endOp()
+
+	policy := session.currentPolicy()
+	peerID := ch.PeerID()
+
+	deposit, err := policy.Deposit(peerID)
+	if err != nil {
+		logger.Info("Deposit for channel with", peerID, "declined by policy -", err)
+		if errClose := ch.Close(); errClose != nil {
+			logger.Error("Error closing channel -", errClose)
+		}
+		return
+	}
+
+	ctx, cancel := session.openingContext()
+	defer cancel()
+
+	bcInst := blockchain.NewInstance(BlockchainConn, session.owner)
+	err = blockchain.AcceptChannel(ctx, ch, &bcInst, deposit, policy)
+	if err != nil {
+		//Deposit locked in mscontract can be refunded only after the timeout, let the scheduler take care of it
+		if openingErr, ok := err.(*blockchain.OpeningError); ok && openingErr.DepositLocked {
+			if errAdd := session.addBlockchainInstance(peerID.OnChainID, &bcInst); errAdd != nil {
+				logger.Error("Error tracking blockchain instance for refund -", errAdd)
+			}
+		}
+		return
+	}
+
+	if err = session.addBlockchainInstance(peerID.OnChainID, &bcInst); err != nil {
+		logger.Error("Error adding blockchain instance for channel with", peerID, "-", err)
+	}
+	if err = session.startDispatcher(ch); err != nil {
+		logger.Error("Error starting dispatcher for channel with", peerID, "-", err)
+	}
+}
+
+// startDispatcher starts a dispatcher on the open channel ch, that handles the vpc states proposed by the peer
+// according to the policy of the session and the requests to close the channel cooperatively. If the connection drops, the channel is reconnected as described in watchConnection.
+func (session *Session) startDispatcher(ch *channel.Instance) error {
+
+	dispatcher := channel.NewDispatcher(ch, dispatcherBufferSize)
+	dispatcher.HandleVPCStateRequest(func(state channel.VPCStateSigned) error {
+		return session.handleVPCState(ch, state)
+	})
+	dispatcher.HandleCloseChannelRequest(func(finalState channel.VPCStateSigned) error {
+		return session.handleCloseChannel(ch, finalState)
+	})
+	if err := dispatcher.Start(); err != nil {
+		return err
+	}
+	go session.watchConnection(ch, dispatcher)
+	return nil
+}
+
+// handleVPCState responds to the vpc state proposed by the peer in the channel ch.
+// If the state is valid and accepted by the policy, it is signed, set as the current vpc state and accepted.
+// Else the request is aborted with the code describing why it was not accepted. The peer never gets the signature
+// of this user on an aborted state, so that it cannot register a state that this user has not set as current
+// (e.g if persisting it failed).
+func (session *Session) handleVPCState(ch *channel.Instance, state channel.VPCStateSigned) (err error) {
+
+	//Request is aborted by the dispatcher, as no response is sent
+	if err = session.beginOp(); err != nil {
+		return err
+	}
+	defer session.endOp()
+
+	//Validate before signing, so that the peer cannot get a state that creates or destroys funds co-signed
+	code := channel.AbortPolicyRejection
+	if ch.Status() != channel.Open {
+		err = fmt.Errorf("channel status is %s, want %s", ch.Status(), channel.Open)
+	}
+	if err == nil {
+		if err = checkVPCStateVersion(latestVPCState(ch), state.VPCState); err != nil {
+			code = channel.AbortVersionMismatch
+		}
+	}
+	if err == nil {
+		err = ch.ValidateVPCState(state.VPCState)
+	}
+	if err == nil {
+		if err = verifyPeerSign(ch, state); err != nil {
+			code = channel.AbortInvalidSignature
+		}
+	}
+	if err == nil {
+		err = checkVPCState(session.currentPolicy(), ch.PeerID(), ch.RoleChannel(), latestVPCState(ch), state.VPCState)
+	}
+	signedState := state
+	if err == nil {
+		if err = signedState.AddSign(session.owner, ch.RoleChannel()); err != nil {
+			code = channel.AbortInternalError
+		}
+	}
+	if err == nil {
+		if err = ch.SetCurrentVPCState(signedState); err != nil {
+			code = channel.AbortInternalError
+		}
+	}
+	if err != nil {
+		if errAbort := ch.Abort(channel.MsgVPCStateRequest, code, err.Error()); errAbort != nil {
+			logger.Error("Error aborting vpc state request -", errAbort)
+		}
+		return fmt.Errorf("vpc state aborted with code %s - %s", code, err.Error())
+	}
+	return ch.NewVPCStateRespond(signedState, channel.MessageStatusAccept)
+}
+
+// handleCloseChannel responds to the request of the peer to close the channel ch cooperatively with finalState
+// and if accepted, settles the channel on the blockchain. See blockchain.AcceptCloseChannel.
+func (session *Session) handleCloseChannel(ch *channel.Instance, finalState channel.VPCStateSigned) (err error) {
+
+	if err = session.beginOp(); err != nil {
+		return abortCloseChannel(ch, channel.AbortInternalError, err)
+	}
+	defer session.endOp()
+
+	bcInst, present := session.blockchainInstance(ch.PeerID().OnChainID)
+	if !present {
+		return abortCloseChannel(ch, channel.AbortInternalError, fmt.Errorf("blockchain instance not found for the channel"))
+	}
+
+	ctx, cancel := session.timeoutContext(channelClosingTimeout)
+	defer cancel()
+
+	if _, err = blockchain.AcceptCloseChannel(ctx, ch, bcInst, finalState); err != nil {
+		return err
+	}
+	session.scheduler.Untrack(bcInst)
+	return nil
+}
+
+// abortCloseChannel aborts the close channel request with code and reason and returns it as error.
+func abortCloseChannel(ch *channel.Instance, code channel.AbortCode, reason error) error {
+
+	if errAbort := ch.Abort(channel.MsgCloseChannelRequest, code, reason.Error()); errAbort != nil {
+		logger.Error("Error aborting close channel request -", errAbort)
+	}
+	return fmt.Errorf("close channel request aborted with code %s - %s", code, reason.Error())
+}
+
+// checkVPCState checks if the proposed vpc state has all the required values and is accepted by the policy.
+func checkVPCState(policy Policy, peerID identity.OffChainID, role channel.Role, current, proposed channel.VPCState) error {
+
+	if proposed.Version == nil || proposed.BlockedSender == nil || proposed.BlockedReceiver == nil {
+		return fmt.Errorf("version and blocked amounts are required")
+	}
+	return policy.VPCState(peerID, role, current, proposed)
+}
+
+// checkVPCStateVersion checks if the version of the proposed vpc state is greater than that of the current one.
+func checkVPCStateVersion(current, proposed channel.VPCState) error {
+
+	if proposed.Version == nil {
+		return fmt.Errorf("version is required")
+	}
+	if current.Version != nil && proposed.Version.Cmp(current.Version) != 1 {
+		return fmt.Errorf("version (%s) is not greater than current version (%s)", proposed.Version, current.Version)
+	}
+	return nil
+}
+
+// verifyPeerSign checks if the vpc state is signed by the peer of the channel ch in its role.
+func verifyPeerSign(ch *channel.Instance, state channel.VPCStateSigned) error {
+
+	peerRole := channel.Sender
+	if ch.RoleChannel() == channel.Sender {
+		peerRole = channel.Receiver
+	}
+	isValid, err := state.VerifySign(ch.PeerID(), peerRole)
+	if err != nil {
+		return err
+	}
+	if !isValid {
+		return fmt.Errorf("signature of the peer (%s) on vpc state invalid", peerRole)
+	}
+	return nil
+}
+
+// latestVPCState returns the current vpc state of the channel ch. If no vpc state has been set yet,
+// it returns a state without version holding the amounts blocked in the msc base state.
+func latestVPCState(ch *channel.Instance) channel.VPCState {
+
+	if current := ch.CurrentVpcState(); current.VPCState.Version != nil {
+		return current.VPCState
+	}
+	baseState := ch.MscBaseState().MSContractBaseState
+	return channel.VPCState{
+		BlockedSender:   baseState.BlockedSender,
+		BlockedReceiver: baseState.BlockedReceiver,
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/blockchain"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/identity"
+)
+
+type dummyPolicy struct {
+	AcceptAllPolicy
+	depositErr  error
+	vpcStateErr error
+}
+
+func (p dummyPolicy) Deposit(peerID identity.OffChainID) (*big.Int, error) {
+	if p.depositErr != nil {
+		return nil, p.depositErr
+	}
+	return p.AcceptAllPolicy.Deposit(peerID)
+}
+
+func (p dummyPolicy) VPCState(peerID identity.OffChainID, role channel.Role, current, proposed channel.VPCState) error {
+	return p.vpcStateErr
+}
+
+func Test_AcceptAllPolicy_Deposit(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		policy AcceptAllPolicy
+		want   *big.Int
+	}{
+		{"deposit_not_set", AcceptAllPolicy{}, big.NewInt(0)},
+		{"deposit_set", AcceptAllPolicy{DepositAmount: big.NewInt(10)}, big.NewInt(10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Deposit(identity.OffChainID{})
+			if err != nil {
+				t.Fatalf("AcceptAllPolicy.Deposit() error = %v, want nil", err)
+			}
+			if got.Cmp(tt.want) != 0 {
+				t.Errorf("AcceptAllPolicy.Deposit() = %v, want %v", got, tt.want)
+			}
+			//Modifying the returned value should not modify the policy
+			got.Add(got, big.NewInt(1))
+			if tt.policy.DepositAmount != nil && tt.policy.DepositAmount.Cmp(tt.want) != 0 {
+				t.Errorf("AcceptAllPolicy.DepositAmount modified to %v", tt.policy.DepositAmount)
+			}
+		})
+	}
+}
+
+func Test_AcceptAllPolicy_Terms(t *testing.T) {
+
+	policy := AcceptAllPolicy{DepositAmount: big.NewInt(10)}
+	terms, err := policy.Terms(identity.OffChainID{})
+	if err != nil {
+		t.Fatalf("AcceptAllPolicy.Terms() error = %v, want nil", err)
+	}
+	if err = terms.Validate(); err != nil {
+		t.Errorf("AcceptAllPolicy.Terms() = %v, invalid - %v", terms, err)
+	}
+	if terms.DepositSender.Cmp(policy.DepositAmount) != 0 || terms.DepositReceiver.Cmp(policy.DepositAmount) != 0 {
+		t.Errorf("AcceptAllPolicy.Terms() = %v, want deposit %v for both users", terms, policy.DepositAmount)
+	}
+	if time.Duration(terms.ConfirmTimeout)*time.Second != blockchain.MSCConfirmTimeout {
+		t.Errorf("AcceptAllPolicy.Terms() confirm timeout = %ds, want %s", terms.ConfirmTimeout, blockchain.MSCConfirmTimeout)
+	}
+}
+
+func Test_checkVPCState(t *testing.T) {
+
+	validState := channel.VPCState{
+		Version:         big.NewInt(2),
+		BlockedSender:   big.NewInt(9),
+		BlockedReceiver: big.NewInt(11),
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		proposed channel.VPCState
+		wantErr  bool
+	}{
+		{"valid", AcceptAllPolicy{}, validState, false},
+		{"declined_by_policy", dummyPolicy{vpcStateErr: fmt.Errorf("balance too low")}, validState, true},
+		{"version_missing", AcceptAllPolicy{}, channel.VPCState{BlockedSender: big.NewInt(9), BlockedReceiver: big.NewInt(11)}, true},
+		{"blocked_amount_missing", AcceptAllPolicy{}, channel.VPCState{Version: big.NewInt(2), BlockedSender: big.NewInt(9)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVPCState(tt.policy, identity.OffChainID{}, channel.Sender, channel.VPCState{}, tt.proposed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkVPCState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_DefaultPolicy_VPCState(t *testing.T) {
+
+	current := channel.VPCState{Version: big.NewInt(1), BlockedSender: big.NewInt(10), BlockedReceiver: big.NewInt(10)}
+	fromBaseState := channel.VPCState{BlockedSender: big.NewInt(10), BlockedReceiver: big.NewInt(10)}
+	payingSender := channel.VPCState{Version: big.NewInt(2), BlockedSender: big.NewInt(12), BlockedReceiver: big.NewInt(8)}
+
+	tests := []struct {
+		name     string
+		role     channel.Role
+		current  channel.VPCState
+		proposed channel.VPCState
+		wantErr  bool
+	}{
+		{"sender_paid", channel.Sender, current, payingSender, false},
+		{"receiver_pays", channel.Receiver, current, payingSender, true},
+		{"receiver_pays_from_base_state", channel.Receiver, fromBaseState, payingSender, true},
+		{"unchanged", channel.Receiver, current, channel.VPCState{Version: big.NewInt(2), BlockedSender: big.NewInt(10), BlockedReceiver: big.NewInt(10)}, false},
+		{"current_unknown", channel.Sender, channel.VPCState{}, payingSender, true},
+		{"role_unknown", channel.Role(""), current, payingSender, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DefaultPolicy{}.VPCState(identity.OffChainID{}, tt.role, tt.current, tt.proposed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DefaultPolicy.VPCState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_Session_SetPolicy(t *testing.T) {
+
+	session := newTestSession()
+	policy := dummyPolicy{depositErr: fmt.Errorf("no channels allowed")}
+	session.SetPolicy(policy)
+
+	if got := session.currentPolicy(); got != policy {
+		t.Errorf("Session.currentPolicy() = %v, want %v", got, policy)
+	}
+}
+
+func Test_Session_respond(t *testing.T) {
+
+	t.Run("deposit_declined", func(t *testing.T) {
+		session := newTestSession()
+		session.SetPolicy(dummyPolicy{depositErr: fmt.Errorf("no channels allowed")})
+
+		ch := &channel.Instance{}
+		session.respond(ch)
+		if ch.Status() != channel.Status("") {
+			t.Errorf("Session.respond() channel status = %s, want unchanged", ch.Status())
+		}
+	})
+	t.Run("session_closing", func(t *testing.T) {
+		session := newTestSession()
+		if err := session.Close(context.Background()); err != nil {
+			t.Fatalf("Session.Close() error = %v, want nil", err)
+		}
+
+		ch := &channel.Instance{}
+		session.respond(ch)
+		if ch.Status() != channel.Status("") {
+			t.Errorf("Session.respond() channel status = %s, want unchanged", ch.Status())
+		}
+	})
+}
+
+func Test_Session_openingContext(t *testing.T) {
+
+	session := newTestSession()
+	ctx, cancel := session.openingContext()
+	defer cancel()
+
+	close(session.quit)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("Session.openingContext() not done after session quit")
+	}
+}
+
+// failingStore is a store in which writes fail once failWrites is set.
+type failingStore struct {
+	channel.Store
+	failWrites bool
+}
+
+func (store *failingStore) Put(key, value []byte) error {
+	if store.failWrites {
+		return fmt.Errorf("disk full")
+	}
+	return store.Store.Put(key, value)
+}
+
+// openTestChannelPair connects a channel from alice to bob and sets them up as open channels
+// with a common session id and an msc base state blocking 10 Wei for each user.
+func openTestChannelPair(t *testing.T) (aliceCh, bobCh *channel.Instance, listener channel.Shutdown) {
+
+	//Loggers of the modules may have been reset by Test_System, when initialising them with the node config
+	setupLogger()
+
+	alice, bob := testIDs(t)
+	idVerifiedConn, listener, err := channel.NewSession(bob, channel.WebSocket, 10)
+	if err != nil {
+		t.Fatalf("channel.NewSession() error = %v", err)
+	}
+	aliceCh, err = channel.NewChannel(alice, bob, channel.WebSocket)
+	if err != nil {
+		t.Fatalf("channel.NewChannel() error = %v", err)
+	}
+	select {
+	case bobCh = <-idVerifiedConn:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Incoming channel not received")
+	}
+
+	sid := channel.NewSessionID(alice.OnChainID, bob.OnChainID)
+	_ = sid.GenerateSenderPart(alice.OnChainID)
+	_ = sid.GenerateReceiverPart(bob.OnChainID)
+	if err = sid.GenerateCompleteSid(); err != nil {
+		t.Fatalf("SessionID.GenerateCompleteSid() error = %v", err)
+	}
+	baseState := channel.MSCBaseStateSigned{
+		MSContractBaseState: channel.MSCBaseState{
+			Sid:             sid.SidComplete,
+			BlockedSender:   big.NewInt(10),
+			BlockedReceiver: big.NewInt(10),
+			Version:         big.NewInt(1),
+		},
+	}
+	_ = baseState.AddSign(alice, channel.Sender)
+	_ = baseState.AddSign(bob, channel.Receiver)
+
+	for _, ch := range []*channel.Instance{aliceCh, bobCh} {
+		if err = ch.SetSessionID(sid); err != nil {
+			t.Fatalf("Instance.SetSessionID() error = %v", err)
+		}
+		if err = ch.SetMSCBaseState(baseState); err != nil {
+			t.Fatalf("Instance.SetMSCBaseState() error = %v", err)
+		}
+		for _, status := range []channel.Status{channel.PreSetup, channel.Setup, channel.Init, channel.Open} {
+			ch.SetStatus(status)
+		}
+	}
+	return aliceCh, bobCh, listener
+}
+
+func Test_Session_handleVPCState(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		unsigned   bool
+		failWrites bool
+		wantCode   channel.AbortCode //Empty if the state should be accepted
+	}{
+		{"accepted", false, false, ""},
+		{"store_write_fails", false, true, channel.AbortInternalError},
+		{"not_signed_by_peer", true, false, channel.AbortInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aliceCh, bobCh, listener := openTestChannelPair(t)
+			defer func() {
+				_ = aliceCh.Close()
+				_ = bobCh.Close()
+				_ = listener.Shutdown(context.Background())
+			}()
+
+			store := &failingStore{Store: channel.NewMemoryStore()}
+			if err := bobCh.SetStore(store); err != nil {
+				t.Fatalf("Instance.SetStore() error = %v", err)
+			}
+			store.failWrites = tt.failWrites
+
+			alice, bob := testIDs(t)
+			session := newTestSession()
+			session.owner = bob
+
+			vpcStateID := channel.VPCStateID{
+				AddSender:    aliceCh.SenderID().OnChainID,
+				AddrReceiver: aliceCh.ReceiverID().OnChainID,
+				SID:          aliceCh.SessionID().SidComplete,
+			}
+			proposed := channel.VPCStateSigned{
+				VPCState: channel.VPCState{
+					ID:              vpcStateID.SoliditySHA3(),
+					Version:         big.NewInt(1),
+					BlockedSender:   big.NewInt(8),
+					BlockedReceiver: big.NewInt(12),
+				},
+			}
+			if !tt.unsigned {
+				_ = proposed.AddSign(alice, channel.Sender)
+			}
+
+			type response struct {
+				state  channel.VPCStateSigned
+				status channel.MessageStatus
+				err    error
+			}
+			responses := make(chan response, 1)
+			go func() {
+				state, status, err := aliceCh.NewVPCStateRequest(proposed)
+				responses <- response{state, status, err}
+			}()
+
+			request, err := bobCh.NewVPCStateRead()
+			if err != nil {
+				t.Fatalf("Instance.NewVPCStateRead() error = %v", err)
+			}
+			wantAccept := tt.wantCode == ""
+			err = session.handleVPCState(bobCh, request)
+			if (err != nil) == wantAccept {
+				t.Errorf("Session.handleVPCState() error = %v, wantErr %v", err, !wantAccept)
+			}
+
+			got := <-responses
+			if wantAccept {
+				if got.err != nil || got.status != channel.MessageStatusAccept {
+					t.Fatalf("Instance.NewVPCStateRequest() = %s, %v, want %s, nil", got.status, got.err,
+						channel.MessageStatusAccept)
+				}
+				if len(got.state.SignReceiver) == 0 {
+					t.Errorf("Session.handleVPCState() response not signed by receiver")
+				}
+			} else if abortErr, ok := got.err.(*channel.AbortError); !ok || abortErr.Code != tt.wantCode {
+				t.Fatalf("Instance.NewVPCStateRequest() err = %v, want *AbortError with code %s", got.err, tt.wantCode)
+			}
+			if set := bobCh.CurrentVpcState().VPCState.Version != nil; set != wantAccept {
+				t.Errorf("Session.handleVPCState() current vpc state set = %t, want %t", set, wantAccept)
+			}
+		})
+	}
+}
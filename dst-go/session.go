@@ -17,8 +17,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"time"
+	"math/big"
+	"sync"
 
 	"github.com/direct-state-transfer/dst-go/blockchain"
 	"github.com/direct-state-transfer/dst-go/channel"
@@ -40,48 +42,86 @@ type Session struct {
 	LibSignAddr types.Address //LibSignatures contract addressed for all owner initiated sessions
 
 	maxConn uint32 //Maximum number of off chain connections
+
+	store channel.Store //Store to persist the state of all channels in the session
+
+	channels       map[types.Address]*channel.Instance          //All channels of the session, mapped by on chain address of the peer
+	bcInstances    map[types.Address]*blockchain.Instance       //Blockchain instances of the channels, mapped by on chain address of the peer
+	closingHandler map[types.Address]*blockchain.ClosingHandler //Handlers for vpc closing events, mapped by on chain address of the peer
+	closedByUser   map[types.Address]bool                       //Channels closed by the user, that should not be reconnected
+	channelsAccess sync.Mutex                                   //Access control for channels, bcInstances, closingHandler and closedByUser map
+
+	closingNotifications chan blockchain.ClosingNotification //Vpc closing events of channels in manual closing mode
+	pendingNotifications []blockchain.ClosingNotification    //Closing notifications not yet read by the user
+	notificationsAccess  sync.Mutex                          //Access control for pendingNotifications
+	scheduler            *blockchain.Scheduler               //Scheduler to make transactions after deadlines in the contracts of channels
+
+	policy       Policy              //Policy for deciding on the requests made by the peers
+	closingMode  channel.ClosingMode //Closing mode set in the new channels of the session
+	policyAccess sync.Mutex          //Access control for policy and closingMode
+
+	quit        chan struct{}  //Closed when the session is closing, to stop the background routines
+	closing     bool           //Set when the session is closing, no new operations are accepted after this
+	inFlight    sync.WaitGroup //Operations on channels that are in progress
+	closeAccess sync.Mutex     //Access control for closing and inFlight
 }
 
 // NewSession initialises and returns a user session with ethAddr as owner.
 // It also initialises a listener that can simultaneously have maxConn number of active offchain channels,
-// and also instances to access keystore at keysdir and idstore in idFile
-func NewSession(ethAddr types.Address, keysDir, idFile string, maxConn uint32) (session Session, err error) {
+// and also instances to access keystore at keysdir and idstore in idFile.
+// The password is used to unlock the key of the owner for signing states and transactions.
+//
+// The state of all channels in the session are persisted in the store and the channels
+// persisted previously are restored from it, see restoreChannels. Session closes the store when it is closed.
+func NewSession(ethAddr types.Address, password, keysDir, idFile string, maxConn uint32, store channel.Store) (
+	session *Session, err error) {
 
 	keyStore, idStore, err := identity.NewSession(keysDir, idFile)
 	if err != nil {
-		return Session{}, err
+		return nil, err
 	}
 
 	keyPresent := keyStore.HasAddress(ethAddr.Address)
 	if !keyPresent {
 		err = fmt.Errorf("Address %s not found in specified keystore dir", ethAddr.Hex())
-		return Session{}, err
+		return nil, err
 	}
 
 	selfID, idPresent := idStore.OffChainID(ethAddr)
 	if !idPresent {
 		err = fmt.Errorf("Address %s not found in specified idstore dir", ethAddr.Hex())
-		return Session{}, err
+		return nil, err
+	}
+	selfID.SetCredentials(keyStore, password)
+
+	restoredChannels, err := channel.RestoreChannels(store, selfID)
+	if err != nil {
+		return nil, err
 	}
-	selfID.KeyStore = keyStore
-	//TODO - Passsword to be obtained as user input
-	selfID.Password = ""
 
 	idVerifiedConn, listener, err := channel.NewSession(selfID, channel.WebSocket, maxConn)
 	if err != nil {
 		err = fmt.Errorf("Channel store init error - %s", err.Error())
-		return Session{}, err
+		return nil, err
 	}
+	defer func() {
+		//Release the listener address, so that the session can be initialised again after the error
+		if err != nil {
+			if errShutdown := listener.Shutdown(context.Background()); errShutdown != nil {
+				logger.Error("Error shutting down listener -", errShutdown)
+			}
+		}
+	}()
 
 	logger.Debug("Deploying libSig for", selfID.OnChainID.Hex())
 	sessionLibSignAddr, err := blockchain.SetupLibSignatures(LibSignAddr, BlockchainConn, selfID)
 	if err != nil {
 		err = fmt.Errorf("Cannot setup libSign contract %s", err.Error())
-		return Session{}, err
+		return nil, err
 	}
 	logger.Debug("Deployed libSig for", selfID.OnChainID.Hex())
 
-	session = Session{
+	session = &Session{
 		owner:       selfID,
 		keyStore:    keyStore,
 		idStore:     idStore,
@@ -89,25 +129,634 @@ func NewSession(ethAddr types.Address, keysDir, idFile string, maxConn uint32) (
 		listener:    listener,
 		LibSignAddr: sessionLibSignAddr,
 		maxConn:     maxConn,
+		store:       store,
+		channels:    make(map[types.Address]*channel.Instance),
+		bcInstances: make(map[types.Address]*blockchain.Instance),
+		quit:        make(chan struct{}),
+
+		closingHandler:       make(map[types.Address]*blockchain.ClosingHandler),
+		closedByUser:         make(map[types.Address]bool),
+		closingNotifications: make(chan blockchain.ClosingNotification, maxConn),
+		scheduler:            blockchain.NewScheduler(blockchain.SystemClock, 0),
+
+		policy:      DefaultPolicy{},
+		closingMode: channel.ClosingModeManual,
+	}
+
+	session.restoreChannels(restoredChannels)
+	if len(restoredChannels) != 0 {
+		logger.Info("Restored", len(restoredChannels), "channels from store for", ethAddr.Hex())
 	}
 
-	//TODO : Session handler go routines
-	go idVerifiedConnHandler(session.idVerified)
+	go session.idVerifiedConnHandler()
+	go session.closingNotificationHandler()
 
 	return session, nil
 }
 
-func idVerifiedConnHandler(idVerifiedConn chan *channel.Instance) {
+// Owner returns the offchain identity of the user owning the session.
+func (session *Session) Owner() identity.OffChainID {
+	owner := session.owner
+	owner.ClearCredentials()
+	return owner
+}
+
+// KnownIDs returns the list of all offchain identities in the identity store of the session.
+func (session *Session) KnownIDs() []identity.OffChainID {
+	return session.idStore.IDList
+}
+
+// SetClosingMode sets the closing mode for the new channels opened or accepted in the session.
+// Channels that already exist retain their closing mode.
+func (session *Session) SetClosingMode(closingMode channel.ClosingMode) (err error) {
+
+	if _, err = channel.ParseClosingMode(string(closingMode)); err != nil {
+		return err
+	}
+
+	session.policyAccess.Lock()
+	defer session.policyAccess.Unlock()
+
+	session.closingMode = closingMode
+	return nil
+}
+
+func (session *Session) currentClosingMode() channel.ClosingMode {
+
+	session.policyAccess.Lock()
+	defer session.policyAccess.Unlock()
+
+	return session.closingMode
+}
+
+// OpenChannel opens a new offchain channel with the peer having peerAddr as on chain address.
+// The peer's offchain identity is looked up in the identity store of the session.
+// After the connection is established, the channel is opened with the given terms,
+// see blockchain.SetupChannel for the steps involved. Deposits and confirm timeout not set in terms
+// are taken from the terms returned by the policy of the session. Once the channel is open, vpc states
+// proposed by the peer are handled in the background according to the policy.
+// Vpc closing events of the channel are handled according to closingMode, or the closing mode of the session if it is empty.
+func (session *Session) OpenChannel(peerAddr types.Address, terms channel.Terms, closingMode channel.ClosingMode) (
+	ch *channel.Instance, err error) {
+
+	if err = session.beginOp(); err != nil {
+		return nil, err
+	}
+	defer session.endOp()
+
+	if existingCh, present := session.Channel(peerAddr); present {
+		if err = releaseChannel(existingCh); err != nil {
+			return nil, err
+		}
+	}
+
+	peerID, idPresent := session.idStore.OffChainID(peerAddr)
+	if !idPresent {
+		return nil, fmt.Errorf("Address %s not found in idstore", peerAddr.Hex())
+	}
+
+	defaultTerms, err := session.currentPolicy().Terms(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("Terms for channel with %s declined by policy - %s", peerAddr.Hex(), err.Error())
+	}
+	terms = mergeTerms(terms, defaultTerms)
+	if err = terms.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid terms for channel with %s - %s", peerAddr.Hex(), err.Error())
+	}
+	if closingMode == "" {
+		closingMode = session.currentClosingMode()
+	} else if _, err = channel.ParseClosingMode(string(closingMode)); err != nil {
+		return nil, err
+	}
+
+	ch, err = channel.NewChannel(session.owner, peerID, channel.WebSocket)
+	if err != nil {
+		return nil, err
+	}
+
+	err = session.initChannel(ch, closingMode)
+	if err != nil {
+		if errClose := ch.Close(); errClose != nil {
+			logger.Error("Error closing channel -", errClose)
+		}
+		return nil, err
+	}
+
+	ctx, cancel := session.openingContext()
+	defer cancel()
+
+	bcInst := blockchain.NewInstance(BlockchainConn, session.owner)
+	if err = bcInst.SetLibSignatures(session.LibSignAddr); err != nil {
+		if errClose := ch.Close(); errClose != nil {
+			logger.Error("Error closing channel -", errClose)
+		}
+		return nil, err
+	}
+
+	session.addChannel(ch)
+	err = blockchain.SetupChannel(ctx, ch, &bcInst, terms)
+	if err != nil {
+		//Deposit locked in mscontract can be refunded only after the timeout, let the scheduler take care of it
+		if openingErr, ok := err.(*blockchain.OpeningError); ok && openingErr.DepositLocked {
+			if errAdd := session.addBlockchainInstance(peerAddr, &bcInst); errAdd != nil {
+				logger.Error("Error tracking blockchain instance for refund -", errAdd)
+			}
+		}
+		return nil, err
+	}
+
+	if err = session.addBlockchainInstance(peerAddr, &bcInst); err != nil {
+		return nil, err
+	}
+	if err = session.startDispatcher(ch); err != nil {
+		return nil, err
+	}
+	logger.Info("New outgoing channel opened with", peerID)
+	return ch, nil
+}
+
+// initChannel sets the closing mode of the new channel ch and persists it in the store of the session.
+func (session *Session) initChannel(ch *channel.Instance, closingMode channel.ClosingMode) error {
+
+	//Closing mode is persisted along with the channel, when the store is set
+	ch.SetClosingMode(closingMode)
+	return ch.SetStore(session.store)
+}
+
+// mergeTerms returns the requested terms, with deposits and confirm timeout that are not set taken from defaults.
+func mergeTerms(requested, defaults channel.Terms) channel.Terms {
+	if requested.DepositSender == nil {
+		requested.DepositSender = defaults.DepositSender
+	}
+	if requested.DepositReceiver == nil {
+		requested.DepositReceiver = defaults.DepositReceiver
+	}
+	if requested.ConfirmTimeout == 0 {
+		requested.ConfirmTimeout = defaults.ConfirmTimeout
+	}
+	if requested.Expiry == 0 {
+		requested.Expiry = defaults.Expiry
+	}
+	return requested
+}
+
+// Channel returns the channel with the peer having peerAddr as on chain address.
+func (session *Session) Channel(peerAddr types.Address) (ch *channel.Instance, present bool) {
+
+	session.channelsAccess.Lock()
+	defer session.channelsAccess.Unlock()
+
+	ch, present = session.channels[peerAddr]
+	return ch, present
+}
+
+// Channels returns the list of all channels in the session.
+func (session *Session) Channels() []*channel.Instance {
+
+	session.channelsAccess.Lock()
+	defer session.channelsAccess.Unlock()
+
+	channels := make([]*channel.Instance, 0, len(session.channels))
+	for _, ch := range session.channels {
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+// releaseChannel checks if the existing channel ch can be replaced by a new channel with the same peer.
+//
+// A channel that is Closed can be replaced. A channel that is not connected and was not opened beyond the Setup status
+// has no funds locked in the contracts, so it is set to Closed and can be replaced.
+// In all other cases, the channel may hold funds and an error is returned.
+func releaseChannel(ch *channel.Instance) error {
+
+	peerAddr := ch.PeerID().OnChainID
+	if ch.Status() == channel.Closed {
+		return nil
+	}
+	if ch.Connected() {
+		return fmt.Errorf("Channel with %s already in use", peerAddr.Hex())
+	}
+
+	switch ch.Status() {
+	case channel.Status(""):
+		return nil
+	case channel.PreSetup, channel.Setup:
+		ch.SetStatus(channel.Closed)
+		return nil
+	default:
+		return fmt.Errorf("Channel with %s in status %s is not closed, close it before opening a new one",
+			peerAddr.Hex(), ch.Status())
+	}
+}
+
+// restoreChannels adds the channels restored from the store to the session.
+//
+// If there is more than one channel with the same peer, the one that is not Closed is retained.
+// Channels that were not opened beyond the Setup status have no funds locked and are set to Closed.
+// For channels with contracts deployed, the blockchain instance is re-created, so that the vpc closing events
+// are handled and the scheduler makes the transactions after the deadlines in the contracts, as for a new channel.
+// Open channels initiated by this user are reconnected in the background.
+func (session *Session) restoreChannels(channels []*channel.Instance) {
+
+	for _, ch := range channels {
+		peerAddr := ch.PeerID().OnChainID
+		if existingCh, present := session.Channel(peerAddr); present && existingCh.Status() != channel.Closed {
+			if ch.Status() != channel.Closed {
+				logger.Error("More than one unsettled channel restored with", peerAddr.Hex(), "- retaining the one with session id",
+					existingCh.SessionID().SidComplete)
+			}
+			continue
+		}
+		session.addChannel(ch)
+	}
+
+	for _, ch := range session.Channels() {
+		switch ch.Status() {
+		case channel.Status(""), channel.Closed:
+			continue
+		case channel.PreSetup, channel.Setup:
+			ch.SetStatus(channel.Closed)
+			continue
+		}
+
+		bcInst, err := blockchain.RestoreInstance(BlockchainConn, session.owner, ch)
+		if err != nil {
+			logger.Error("Error restoring blockchain instance for channel with", ch.PeerID(), "-", err)
+			continue
+		}
+		if err = session.addBlockchainInstance(ch.PeerID().OnChainID, bcInst); err != nil {
+			logger.Error("Error tracking restored channel with", ch.PeerID(), "-", err)
+			continue
+		}
+		if ch.Status() == channel.Open && ch.RoleChannel() == channel.Sender {
+			go session.reconnect(ch)
+		}
+	}
+}
+
+func (session *Session) addChannel(ch *channel.Instance) {
+
+	session.channelsAccess.Lock()
+	defer session.channelsAccess.Unlock()
+
+	session.channels[ch.PeerID().OnChainID] = ch
+	delete(session.closedByUser, ch.PeerID().OnChainID)
+}
+
+// NewVPCState proposes a new vpc state with the blocked amounts to the peer in the channel.
+// Version of the new state is incremented from the current vpc state of the channel.
+// If the peer accepts, the doubly signed state is set as current vpc state and returned.
+func (session *Session) NewVPCState(peerAddr types.Address, blockedSender, blockedReceiver *big.Int) (
+	newState channel.VPCStateSigned, err error) {
+
+	if err = session.beginOp(); err != nil {
+		return channel.VPCStateSigned{}, err
+	}
+	defer session.endOp()
+
+	ch, present := session.Channel(peerAddr)
+	if !present {
+		return channel.VPCStateSigned{}, fmt.Errorf("Channel with %s not found", peerAddr.Hex())
+	}
+
+	sid := ch.SessionID()
+	if sid.SidComplete == nil {
+		return channel.VPCStateSigned{}, fmt.Errorf("Session id not set for channel with %s", peerAddr.Hex())
+	}
+
+	version := big.NewInt(1)
+	if currentState := ch.CurrentVpcState(); currentState.VPCState.Version != nil {
+		version.Add(currentState.VPCState.Version, big.NewInt(1))
+	}
+
+	vpcStateID := channel.VPCStateID{
+		AddSender:    ch.SenderID().OnChainID,
+		AddrReceiver: ch.ReceiverID().OnChainID,
+		SID:          sid.SidComplete,
+	}
+	newStatePartial := channel.VPCStateSigned{
+		VPCState: channel.VPCState{
+			ID:              vpcStateID.SoliditySHA3(),
+			Version:         version,
+			BlockedSender:   blockedSender,
+			BlockedReceiver: blockedReceiver,
+		},
+	}
+	if err = ch.ValidateVPCState(newStatePartial.VPCState); err != nil {
+		return channel.VPCStateSigned{}, err
+	}
+	err = newStatePartial.AddSign(session.owner, ch.RoleChannel())
+	if err != nil {
+		return channel.VPCStateSigned{}, err
+	}
+
+	newState, status, err := ch.NewVPCStateRequest(newStatePartial)
+	if err != nil {
+		return channel.VPCStateSigned{}, err
+	}
+	if status != channel.MessageStatusAccept {
+		return channel.VPCStateSigned{}, fmt.Errorf("VPC state declined by peer")
+	}
+
+	err = ch.SetCurrentVPCState(newState)
+	if err != nil {
+		return channel.VPCStateSigned{}, err
+	}
+	return newState, nil
+}
+
+// CloseChannel closes the channel with the peer.
+//
+// If the channel is open and connected, it is closed cooperatively with the peer and settled on the blockchain,
+// see blockchain.CloseChannel. Else if the channel has not been opened (or is already being closed),
+// only the offchain connection of the channel is closed. An open channel that is not connected cannot be closed,
+// as the funds in it can only be paid out with the peer, so an error is returned and the channel is still reconnected.
+// The channel is retained in the session, so that its states can be queried later, but it is not reconnected.
+func (session *Session) CloseChannel(peerAddr types.Address) (err error) {
+
+	if err = session.beginOp(); err != nil {
+		return err
+	}
+	defer session.endOp()
+
+	ch, present := session.Channel(peerAddr)
+	if !present {
+		return fmt.Errorf("Channel with %s not found", peerAddr.Hex())
+	}
+
+	_, bcInstPresent := session.blockchainInstance(peerAddr)
+	cooperative := bcInstPresent && ch.Connected() && ch.Status() == channel.Open
+	if !cooperative && !closableOffchain(ch.Status()) {
+		return fmt.Errorf("Channel with %s in status %s cannot be closed, it can be closed only when open and connected to the peer",
+			peerAddr.Hex(), ch.Status())
+	}
+
+	session.channelsAccess.Lock()
+	session.closedByUser[peerAddr] = true
+	session.channelsAccess.Unlock()
+
+	if cooperative {
+		bcInst, _ := session.blockchainInstance(peerAddr)
+		ctx, cancel := session.timeoutContext(channelClosingTimeout)
+		defer cancel()
+
+		if _, err = blockchain.CloseChannel(ctx, ch, bcInst); err != nil {
+			return err
+		}
+		session.scheduler.Untrack(bcInst)
+		return nil
+	}
+
+	if ch.Connected() {
+		err = ch.Close()
+		if err != nil {
+			return err
+		}
+	}
+	ch.SetStatus(channel.Closed)
+	logger.Info("Channel closed with", ch.PeerID())
+	return nil
+}
+
+// closableOffchain returns true if a channel in status can be closed without settling it on the blockchain,
+// because it was not opened (funds locked during opening are refunded by the scheduler) or is already closed.
+func closableOffchain(status channel.Status) bool {
+	switch status {
+	case channel.Status(""), channel.PreSetup, channel.Setup, channel.Init, channel.Closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (session *Session) idVerifiedConnHandler() {
 
-	sessionTimeout := time.Tick(60 * time.Minute)
 	for {
 		select {
-		case newConn := <-idVerifiedConn:
-			//TODO : Pass the connection for user confirmation via remote interface
-			//For now, it is assumed that user confirms all incoming requests
+		case newConn := <-session.idVerified:
+			//Connection from the peer of an existing channel, after the previous one dropped
+			if existingCh, present := session.Channel(newConn.PeerID().OnChainID); present && session.resumable(existingCh) {
+				logger.Info("Incoming connection to resume channel with", newConn.PeerID())
+				go session.resume(existingCh, newConn)
+				continue
+			}
+
+			//Channel that may hold funds is not replaced, until it is closed
+			if existingCh, present := session.Channel(newConn.PeerID().OnChainID); present {
+				if err := releaseChannel(existingCh); err != nil {
+					logger.Error("Refusing incoming connection from", newConn.PeerID(), "-", err)
+					if errClose := newConn.Close(); errClose != nil {
+						logger.Error("Error closing channel -", errClose)
+					}
+					continue
+				}
+			}
+
+			//Requests made by the peer are accepted or declined according to the policy of the session
 			logger.Info("New Incoming connection - ", newConn.PeerID())
-		case <-sessionTimeout:
+			if err := session.initChannel(newConn, session.currentClosingMode()); err != nil {
+				logger.Error("Error persisting incoming channel with", newConn.PeerID(), "-", err)
+				if errClose := newConn.Close(); errClose != nil {
+					logger.Error("Error closing channel -", errClose)
+				}
+				continue
+			}
+			session.addChannel(newConn)
+			go session.respond(newConn)
+		case <-session.quit:
 			return
 		}
 	}
 }
+
+// addBlockchainInstance adds the blockchain instance used for the channel with peer having peerAddr as on chain address
+// and starts handling the vpc closing events of the channel according to its closing mode.
+// The channel is also tracked by the scheduler to make transactions after the deadlines in its contracts.
+func (session *Session) addBlockchainInstance(peerAddr types.Address, bcInst *blockchain.Instance) (err error) {
+
+	ch, present := session.Channel(peerAddr)
+	if !present {
+		return fmt.Errorf("Channel with %s not found", peerAddr.Hex())
+	}
+
+	session.channelsAccess.Lock()
+	defer session.channelsAccess.Unlock()
+
+	if previousHandler, present := session.closingHandler[peerAddr]; present {
+		previousHandler.Stop()
+	}
+	if previousInst, present := session.bcInstances[peerAddr]; present {
+		session.scheduler.Untrack(previousInst)
+	}
+	session.bcInstances[peerAddr] = bcInst
+	session.closingHandler[peerAddr] = blockchain.NewClosingHandler(bcInst, ch, session.closingNotifications)
+	session.scheduler.Track(bcInst, ch)
+	return nil
+}
+
+// blockchainInstance returns the blockchain instance used for the channel with the peer having peerAddr as on chain address.
+func (session *Session) blockchainInstance(peerAddr types.Address) (bcInst *blockchain.Instance, present bool) {
+
+	session.channelsAccess.Lock()
+	defer session.channelsAccess.Unlock()
+
+	bcInst, present = session.bcInstances[peerAddr]
+	return bcInst, present
+}
+
+// maxPendingNotifications is the maximum number of closing notifications retained until they are read by the user.
+const maxPendingNotifications = 100
+
+// closingNotificationHandler retains the closing notifications of channels in manual closing mode,
+// until they are read by the user using ClosingNotifications.
+// If the user does not read them, only the latest maxPendingNotifications are retained.
+func (session *Session) closingNotificationHandler() {
+
+	for {
+		select {
+		case notification := <-session.closingNotifications:
+			logger.Info("VPC closing event for channel with", notification.Channel.PeerID(),
+				"with version", notification.OnChainState.SeqNo, "- awaiting manual response")
+			session.addPendingNotification(notification)
+		case <-session.quit:
+			return
+		}
+	}
+}
+
+func (session *Session) addPendingNotification(notification blockchain.ClosingNotification) {
+
+	session.notificationsAccess.Lock()
+	defer session.notificationsAccess.Unlock()
+
+	if len(session.pendingNotifications) == maxPendingNotifications {
+		dropped := session.pendingNotifications[0]
+		logger.Error("Too many unread closing notifications, dropping the one for channel with", dropped.Channel.PeerID(),
+			"with version", dropped.OnChainState.SeqNo)
+		session.pendingNotifications = session.pendingNotifications[1:]
+	}
+	session.pendingNotifications = append(session.pendingNotifications, notification)
+}
+
+// ClosingNotifications returns the vpc closing events received for the channels in manual closing mode,
+// that require a response from the user. Notifications are returned only once, in the order they were received.
+func (session *Session) ClosingNotifications() []blockchain.ClosingNotification {
+
+	session.notificationsAccess.Lock()
+	defer session.notificationsAccess.Unlock()
+
+	notifications := session.pendingNotifications
+	session.pendingNotifications = nil
+	return notifications
+}
+
+// beginOp registers a new operation on the session as in-flight.
+// Error is returned if the session is closing.
+func (session *Session) beginOp() error {
+
+	session.closeAccess.Lock()
+	defer session.closeAccess.Unlock()
+
+	if session.closing {
+		return fmt.Errorf("Session is closing")
+	}
+	session.inFlight.Add(1)
+	return nil
+}
+
+// endOp marks an in-flight operation started with beginOp as complete.
+func (session *Session) endOp() {
+	session.inFlight.Done()
+}
+
+// Close closes the session gracefully within the deadline of ctx.
+//
+// It stops the listener from accepting new connections, rejects new operations
+// and waits for the in-flight operations to complete. Then all the connected channels are closed
+// and the scheduler, blockchain event subscriptions and closing handlers of the channels are stopped.
+// The channel store is closed at the end.
+// If the deadline expires in between, the remaining steps are still performed
+// without waiting and an error is returned. As the operations still in-flight may persist channel records,
+// the channel store is then closed in the background once they complete.
+func (session *Session) Close(ctx context.Context) (err error) {
+
+	session.closeAccess.Lock()
+	if session.closing {
+		session.closeAccess.Unlock()
+		return fmt.Errorf("Session already closed")
+	}
+	session.closing = true
+	session.closeAccess.Unlock()
+	close(session.quit)
+
+	if session.listener != nil {
+		if errShutdown := session.listener.Shutdown(ctx); errShutdown != nil {
+			err = fmt.Errorf("listener shutdown error - %s", errShutdown.Error())
+		}
+	}
+
+	inFlightDone := waitOrDone(ctx, session.inFlight.Wait)
+	if !inFlightDone && err == nil {
+		err = fmt.Errorf("in-flight operations not completed - %s", ctx.Err())
+	}
+
+	for _, ch := range session.Channels() {
+		if !ch.Connected() {
+			continue
+		}
+		closeCh := func() {
+			if errClose := ch.Close(); errClose != nil {
+				logger.Error("Error closing channel with", ch.PeerID(), "-", errClose)
+			}
+		}
+		if !waitOrDone(ctx, closeCh) && err == nil {
+			err = fmt.Errorf("closing channel with %s not completed - %s", ch.PeerID().OnChainID.Hex(), ctx.Err())
+		}
+	}
+
+	session.scheduler.Stop()
+
+	session.channelsAccess.Lock()
+	for _, handler := range session.closingHandler {
+		handler.Stop()
+	}
+	for _, bcInst := range session.bcInstances {
+		bcInst.EventsChan.Unsubscribe()
+	}
+	session.channelsAccess.Unlock()
+
+	if session.store != nil && inFlightDone {
+		if errClose := session.store.Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("channel store close error - %s", errClose.Error())
+		}
+	} else if session.store != nil {
+		go func() {
+			session.inFlight.Wait()
+			if errClose := session.store.Close(); errClose != nil {
+				logger.Error("Error closing channel store of", session.owner.OnChainID.Hex(), "-", errClose)
+			}
+		}()
+	}
+
+	logger.Info("Session closed for", session.owner.OnChainID.Hex())
+	return err
+}
+
+// waitOrDone runs fn in background and waits till it returns or ctx is done.
+// It returns true if fn returned before ctx was done.
+func waitOrDone(ctx context.Context, fn func()) bool {
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
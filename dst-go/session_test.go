@@ -0,0 +1,487 @@
+// Copyright (c) 2019 - for information on the respective copyright owner
+// see the NOTICE file and/or the repository at
+//     https://github.com/direct-state-transfer/dst-go/NOTICE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/direct-state-transfer/dst-go/blockchain"
+	"github.com/direct-state-transfer/dst-go/channel"
+	"github.com/direct-state-transfer/dst-go/ethereum/adapter"
+	"github.com/direct-state-transfer/dst-go/ethereum/contract"
+	"github.com/direct-state-transfer/dst-go/ethereum/types"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+func newTestSession() *Session {
+	return &Session{
+		channels:    make(map[types.Address]*channel.Instance),
+		bcInstances: make(map[types.Address]*blockchain.Instance),
+		quit:        make(chan struct{}),
+
+		closingHandler:       make(map[types.Address]*blockchain.ClosingHandler),
+		closedByUser:         make(map[types.Address]bool),
+		closingNotifications: make(chan blockchain.ClosingNotification, 1),
+		scheduler:            blockchain.NewScheduler(blockchain.SystemClock, time.Hour),
+
+		policy: AcceptAllPolicy{},
+	}
+}
+
+// closeTrackingStore is a store that closes the closed channel when it is closed.
+type closeTrackingStore struct {
+	channel.Store
+	closed chan struct{}
+}
+
+func (store *closeTrackingStore) Close() error {
+	close(store.closed)
+	return store.Store.Close()
+}
+
+func Test_Session_Close(t *testing.T) {
+
+	t.Run("valid", func(t *testing.T) {
+		session := newTestSession()
+
+		err := session.Close(context.Background())
+		if err != nil {
+			t.Fatalf("Session.Close() error = %v, want nil", err)
+		}
+		if err = session.beginOp(); err == nil {
+			t.Errorf("Session.beginOp() after close error = nil, want non nil")
+		}
+		if _, err = session.OpenChannel(types.Address{}, channel.Terms{}, ""); err == nil {
+			t.Errorf("Session.OpenChannel() after close error = nil, want non nil")
+		}
+	})
+	t.Run("already_closed", func(t *testing.T) {
+		session := newTestSession()
+
+		_ = session.Close(context.Background())
+		if err := session.Close(context.Background()); err == nil {
+			t.Errorf("Session.Close() second call error = nil, want non nil")
+		}
+	})
+	t.Run("in_flight_op_completes", func(t *testing.T) {
+		session := newTestSession()
+		_ = session.beginOp()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			session.endOp()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := session.Close(ctx); err != nil {
+			t.Errorf("Session.Close() error = %v, want nil", err)
+		}
+	})
+	t.Run("in_flight_op_timeout", func(t *testing.T) {
+		session := newTestSession()
+		store := &closeTrackingStore{Store: channel.NewMemoryStore(), closed: make(chan struct{})}
+		session.store = store
+		_ = session.beginOp()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := session.Close(ctx); err == nil {
+			t.Errorf("Session.Close() error = nil, want non nil")
+		}
+
+		//Store is closed only after the in-flight operation completes
+		select {
+		case <-store.closed:
+			t.Fatalf("Session.Close() closed the store while an operation is in-flight")
+		case <-time.After(50 * time.Millisecond):
+		}
+		session.endOp()
+		select {
+		case <-store.closed:
+		case <-time.After(time.Second):
+			t.Errorf("Session.Close() did not close the store after the in-flight operation completed")
+		}
+	})
+}
+
+func Test_mergeTerms(t *testing.T) {
+
+	defaults := channel.Terms{DepositSender: big.NewInt(10), DepositReceiver: big.NewInt(20), ConfirmTimeout: 60}
+
+	tests := []struct {
+		name      string
+		requested channel.Terms
+		want      channel.Terms
+	}{
+		{
+			name:      "none_set",
+			requested: channel.Terms{},
+			want:      defaults,
+		},
+		{
+			name:      "deposits_set",
+			requested: channel.Terms{DepositSender: big.NewInt(5), DepositReceiver: big.NewInt(0)},
+			want:      channel.Terms{DepositSender: big.NewInt(5), DepositReceiver: big.NewInt(0), ConfirmTimeout: 60},
+		},
+		{
+			name:      "all_set",
+			requested: channel.Terms{DepositSender: big.NewInt(1), DepositReceiver: big.NewInt(2), ConfirmTimeout: 30, Expiry: 100},
+			want:      channel.Terms{DepositSender: big.NewInt(1), DepositReceiver: big.NewInt(2), ConfirmTimeout: 30, Expiry: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeTerms(tt.requested, defaults); !got.Equal(tt.want) {
+				t.Errorf("mergeTerms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Session_addBlockchainInstance(t *testing.T) {
+
+	peerAddr := types.HexToAddress("815430d6ea7275317d09199a5a5675f017e011ef")
+	newBlockchainInstance := func() *blockchain.Instance {
+		bcInst := &blockchain.Instance{}
+		bcInst.EventsChan.VPCVPCClosingChan = make(chan *contract.VPCEventVpcClosing)
+		return bcInst
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		session := newTestSession()
+		session.channels[peerAddr] = &channel.Instance{}
+
+		if err := session.addBlockchainInstance(peerAddr, newBlockchainInstance()); err != nil {
+			t.Fatalf("Session.addBlockchainInstance() error = %v, want nil", err)
+		}
+		//Replacing the instance should stop the previous closing handler
+		if err := session.addBlockchainInstance(peerAddr, newBlockchainInstance()); err != nil {
+			t.Fatalf("Session.addBlockchainInstance() error = %v, want nil", err)
+		}
+		if len(session.closingHandler) != 1 || len(session.bcInstances) != 1 {
+			t.Errorf("Session.addBlockchainInstance() - got %d handlers, %d instances, want 1, 1",
+				len(session.closingHandler), len(session.bcInstances))
+		}
+		if got := session.scheduler.Tracked(); got != 1 {
+			t.Errorf("Session.addBlockchainInstance() - scheduler tracking %d channels, want 1", got)
+		}
+		if err := session.Close(context.Background()); err != nil {
+			t.Errorf("Session.Close() error = %v, want nil", err)
+		}
+	})
+	t.Run("channel_not_found", func(t *testing.T) {
+		session := newTestSession()
+
+		if err := session.addBlockchainInstance(peerAddr, newBlockchainInstance()); err == nil {
+			t.Errorf("Session.addBlockchainInstance() error = nil, want non nil")
+		}
+	})
+}
+
+func Test_Session_CloseChannel(t *testing.T) {
+
+	peerAddr := types.HexToAddress("815430d6ea7275317d09199a5a5675f017e011ef")
+
+	t.Run("channel_not_found", func(t *testing.T) {
+		session := newTestSession()
+
+		if err := session.CloseChannel(peerAddr); err == nil {
+			t.Errorf("Session.CloseChannel() error = nil, want non nil")
+		}
+	})
+	t.Run("not_connected", func(t *testing.T) {
+		session := newTestSession()
+		ch := &channel.Instance{}
+		for _, status := range []channel.Status{channel.PreSetup, channel.Setup, channel.Init, channel.Open} {
+			ch.SetStatus(status)
+		}
+		session.channels[peerAddr] = ch
+		//Blockchain instance is not initialised, so the channel should not be settled on the blockchain
+		session.bcInstances[peerAddr] = &blockchain.Instance{}
+
+		if err := session.CloseChannel(peerAddr); err == nil {
+			t.Errorf("Session.CloseChannel() error = nil, want non nil")
+		}
+		if ch.Status() != channel.Open {
+			t.Errorf("Session.CloseChannel() channel status = %s, want %s", ch.Status(), channel.Open)
+		}
+		if !session.resumable(ch) {
+			t.Errorf("Session.CloseChannel() failed, but channel not resumable")
+		}
+	})
+	t.Run("not_opened", func(t *testing.T) {
+		session := newTestSession()
+		ch := &channel.Instance{}
+		ch.SetStatus(channel.PreSetup)
+		session.channels[peerAddr] = ch
+
+		if err := session.CloseChannel(peerAddr); err != nil {
+			t.Errorf("Session.CloseChannel() error = %v, want nil", err)
+		}
+		if ch.Status() != channel.Closed {
+			t.Errorf("Session.CloseChannel() channel status = %s, want %s", ch.Status(), channel.Closed)
+		}
+	})
+}
+
+// newTestChannelInStatus returns a channel moved through each of the statuses.
+func newTestChannelInStatus(t *testing.T, statuses ...channel.Status) *channel.Instance {
+	ch := &channel.Instance{}
+	for _, status := range statuses {
+		if !ch.SetStatus(status) {
+			t.Fatalf("SetStatus(%s) = false, want true", status)
+		}
+	}
+	return ch
+}
+
+func Test_releaseChannel(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		statuses   []channel.Status
+		wantErr    bool
+		wantStatus channel.Status
+	}{
+		{"new", nil, false, channel.Status("")},
+		{"setup", []channel.Status{channel.PreSetup, channel.Setup}, false, channel.Closed},
+		{"init", []channel.Status{channel.PreSetup, channel.Setup, channel.Init}, true, channel.Init},
+		{"open", []channel.Status{channel.PreSetup, channel.Setup, channel.Init, channel.Open}, true, channel.Open},
+		{"closed", []channel.Status{channel.PreSetup, channel.Closed}, false, channel.Closed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := newTestChannelInStatus(t, tt.statuses...)
+
+			if err := releaseChannel(ch); (err != nil) != tt.wantErr {
+				t.Errorf("releaseChannel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ch.Status() != tt.wantStatus {
+				t.Errorf("releaseChannel() channel status = %s, want %s", ch.Status(), tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_Session_restoreChannels(t *testing.T) {
+
+	t.Run("unsettled_retained", func(t *testing.T) {
+		session := newTestSession()
+		closedCh := newTestChannelInStatus(t, channel.PreSetup, channel.Closed)
+		openCh := newTestChannelInStatus(t, channel.PreSetup, channel.Setup, channel.Init, channel.Open)
+
+		session.restoreChannels([]*channel.Instance{openCh, closedCh})
+
+		if got, _ := session.Channel(types.Address{}); got != openCh {
+			t.Errorf("Session.restoreChannels() - closed channel replaced the unsettled channel")
+		}
+		//Contract addresses are not set, so blockchain instance cannot be restored
+		if len(session.bcInstances) != 0 {
+			t.Errorf("Session.restoreChannels() - got %d blockchain instances, want 0", len(session.bcInstances))
+		}
+	})
+	t.Run("not_opened_closed", func(t *testing.T) {
+		session := newTestSession()
+		ch := newTestChannelInStatus(t, channel.PreSetup, channel.Setup)
+
+		session.restoreChannels([]*channel.Instance{ch})
+
+		if ch.Status() != channel.Closed {
+			t.Errorf("Session.restoreChannels() channel status = %s, want %s", ch.Status(), channel.Closed)
+		}
+		if err := releaseChannel(ch); err != nil {
+			t.Errorf("releaseChannel() after restore error = %v, want nil", err)
+		}
+	})
+}
+
+func Test_Session_SetClosingMode(t *testing.T) {
+
+	session := newTestSession()
+	if err := session.SetClosingMode(channel.ClosingModeAutoNormal); err != nil {
+		t.Fatalf("Session.SetClosingMode() error = %v, want nil", err)
+	}
+	if err := session.SetClosingMode(channel.ClosingMode("auto")); err == nil {
+		t.Errorf("Session.SetClosingMode() with unknown mode error = nil, want non nil")
+	}
+	if got := session.currentClosingMode(); got != channel.ClosingModeAutoNormal {
+		t.Errorf("Session.currentClosingMode() = %s, want %s", got, channel.ClosingModeAutoNormal)
+	}
+}
+
+// closingTestBackend is a contract backend, in which state is registered as the vpc state of all channels.
+// Transactions are not mined, they are only reported on sent.
+type closingTestBackend struct {
+	adapter.ContractBackend
+	state blockchain.VPCState
+	sent  chan struct{}
+}
+
+func (backend *closingTestBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (
+	[]byte, error) {
+
+	//Return values of vpc states call, each encoded as a 32 byte word
+	output := make([]byte, 0, 9*32)
+	for _, value := range []*big.Int{backend.state.AliceCash, backend.state.BobCash, backend.state.SeqNo,
+		backend.state.Validity, backend.state.ExtendedValidity} {
+		word := make([]byte, 32)
+		valueBytes := value.Bytes()
+		copy(word[32-len(valueBytes):], valueBytes)
+		output = append(output, word...)
+	}
+	for _, value := range []bool{backend.state.Open, backend.state.WaitingForAlice, backend.state.WaitingForBob,
+		backend.state.Init} {
+		word := make([]byte, 32)
+		if value {
+			word[31] = 1
+		}
+		output = append(output, word...)
+	}
+	return output, nil
+}
+
+func (backend *closingTestBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return 0, nil
+}
+
+func (backend *closingTestBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
+
+func (backend *closingTestBackend) SendTransaction(ctx context.Context, tx *ethereumTypes.Transaction) error {
+	backend.sent <- struct{}{}
+	return fmt.Errorf("transactions are not mined in test backend")
+}
+
+func Test_Session_closingEvent(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		closingMode      channel.ClosingMode
+		wantRefute       bool
+		wantNotification bool
+	}{
+		{"manual", channel.ClosingModeManual, false, true},
+		{"auto_normal_stale_state", channel.ClosingModeAutoNormal, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aliceCh, bobCh, listener := openTestChannelPair(t)
+			defer func() {
+				_ = aliceCh.Close()
+				_ = bobCh.Close()
+				_ = listener.Shutdown(context.Background())
+			}()
+			alice, bob := testIDs(t)
+
+			session := newTestSession()
+			session.owner = alice
+			session.store = channel.NewMemoryStore()
+			if err := session.SetClosingMode(tt.closingMode); err != nil {
+				t.Fatalf("Session.SetClosingMode() error = %v", err)
+			}
+			if err := session.initChannel(aliceCh, session.currentClosingMode()); err != nil {
+				t.Fatalf("Session.initChannel() error = %v", err)
+			}
+			session.addChannel(aliceCh)
+			go session.closingNotificationHandler()
+
+			//Latest state of the channel is version 5, while version 2 is registered in the blockchain
+			vpcStateID := channel.VPCStateID{
+				AddSender:    aliceCh.SenderID().OnChainID,
+				AddrReceiver: aliceCh.ReceiverID().OnChainID,
+				SID:          aliceCh.SessionID().SidComplete,
+			}
+			latest := channel.VPCStateSigned{
+				VPCState: channel.VPCState{
+					ID:              vpcStateID.SoliditySHA3(),
+					Version:         big.NewInt(5),
+					BlockedSender:   big.NewInt(8),
+					BlockedReceiver: big.NewInt(12),
+				},
+			}
+			_ = latest.AddSign(alice, channel.Sender)
+			_ = latest.AddSign(bob, channel.Receiver)
+			if err := aliceCh.SetCurrentVPCState(latest); err != nil {
+				t.Fatalf("Instance.SetCurrentVPCState() error = %v", err)
+			}
+
+			backend := &closingTestBackend{
+				state: blockchain.VPCState{
+					AliceCash:        big.NewInt(10),
+					BobCash:          big.NewInt(10),
+					SeqNo:            big.NewInt(2),
+					Validity:         big.NewInt(0),
+					ExtendedValidity: big.NewInt(0),
+					Open:             true,
+					WaitingForAlice:  true,
+				},
+				sent: make(chan struct{}, 1),
+			}
+			bcInst := blockchain.NewInstance(backend, alice)
+			vpcInst, err := contract.NewVPC(types.HexToAddress("0x847a3AC37aB4bB1f0C3be0B2B2Ed4B6cE3e1F2b4").Address, backend)
+			if err != nil {
+				t.Fatalf("contract.NewVPC() error = %v", err)
+			}
+			bcInst.VPCInst = vpcInst
+			bcInst.EventsChan.VPCVPCClosingChan = make(chan *contract.VPCEventVpcClosing, 1)
+			if err = session.addBlockchainInstance(bob.OnChainID, &bcInst); err != nil {
+				t.Fatalf("Session.addBlockchainInstance() error = %v", err)
+			}
+
+			event := &contract.VPCEventVpcClosing{}
+			copy(event.Id[:], vpcStateID.SoliditySHA3())
+			bcInst.EventsChan.VPCVPCClosingChan <- event
+
+			var notifications []blockchain.ClosingNotification
+			refuted := false
+			deadline := time.After(10 * time.Second)
+		wait:
+			for len(notifications) == 0 && !refuted {
+				select {
+				case <-backend.sent:
+					refuted = true
+				case <-deadline:
+					break wait
+				case <-time.After(10 * time.Millisecond):
+					notifications = session.ClosingNotifications()
+				}
+			}
+
+			if refuted != tt.wantRefute {
+				t.Errorf("Closing event handled with refute = %t, want %t", refuted, tt.wantRefute)
+			}
+			if gotNotification := len(notifications) != 0; gotNotification != tt.wantNotification {
+				t.Errorf("Session.ClosingNotifications() = %d notifications, want notification %t", len(notifications), tt.wantNotification)
+			}
+			if len(notifications) != 0 && notifications[0].OnChainState.SeqNo.Cmp(big.NewInt(2)) != 0 {
+				t.Errorf("Session.ClosingNotifications() version = %v, want 2", notifications[0].OnChainState.SeqNo)
+			}
+			if err = session.Close(context.Background()); err != nil {
+				t.Errorf("Session.Close() error = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package keystore
 
 import (
 	"crypto/ecdsa"
+	"fmt"
 
 	"github.com/direct-state-transfer/dst-go/ethereum/types"
 	"github.com/ethereum/go-ethereum/common"
@@ -31,6 +32,8 @@ type CryptoWrapperInterface interface {
 	FromECDSAPub(pub *ecdsa.PublicKey) []byte
 	VerifySignature(pubkey, hash, signature []byte) bool
 	Keccak256(data ...[]byte) []byte
+	GenerateKey() (*ecdsa.PrivateKey, error)
+	UnmarshalPubkey(pub []byte) (*ecdsa.PublicKey, error)
 }
 
 // EthereumCryptoWrapper wraps the ethereum specific crypto related functions.
@@ -65,6 +68,16 @@ func (wrapper EthereumCryptoWrapper) Keccak256(data ...[]byte) []byte {
 	return crypto.Keccak256(data...)
 }
 
+// GenerateKey wraps the GenerateKey function from ethereum/crypto package.
+func (wrapper EthereumCryptoWrapper) GenerateKey() (*ecdsa.PrivateKey, error) {
+	return crypto.GenerateKey()
+}
+
+// UnmarshalPubkey wraps the UnmarshalPubkey function from ethereum/crypto package.
+func (wrapper EthereumCryptoWrapper) UnmarshalPubkey(pub []byte) (*ecdsa.PublicKey, error) {
+	return crypto.UnmarshalPubkey(pub)
+}
+
 // SigToPub  retrieves and returns the public key that created the given signature.
 func SigToPub(hash, sig []byte) (*ecdsa.PublicKey, error) {
 	return CryptoWrapperInstance.SigToPub(hash, sig)
@@ -91,3 +104,37 @@ func VerifySignature(pubkey, hash, signature []byte) bool {
 func Keccak256(data ...[]byte) []byte {
 	return CryptoWrapperInstance.Keccak256(data...)
 }
+
+// GenerateKey generates a new secp256k1 key pair, that can be used as ephemeral key for key agreement.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return CryptoWrapperInstance.GenerateKey()
+}
+
+// UnmarshalPubkey converts the byte representation of a secp256k1 public key to ecdsa public key.
+func UnmarshalPubkey(pub []byte) (*ecdsa.PublicKey, error) {
+	return CryptoWrapperInstance.UnmarshalPubkey(pub)
+}
+
+// SharedSecret computes the elliptic curve diffie-hellman shared secret between the private key and
+// the public key of the peer. Both the keys should be on the same curve.
+// The x co-ordinate of the shared point, padded to the size of the curve, is returned.
+func SharedSecret(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey) ([]byte, error) {
+
+	if priv == nil || pub == nil || pub.X == nil || pub.Y == nil {
+		return nil, fmt.Errorf("invalid key for shared secret")
+	}
+	if priv.Curve != pub.Curve || !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("public key not on the curve of private key")
+	}
+
+	x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	if x == nil || x.Sign() == 0 {
+		return nil, fmt.Errorf("shared secret is infinity")
+	}
+
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	secret := make([]byte, size)
+	xBytes := x.Bytes()
+	copy(secret[size-len(xBytes):], xBytes)
+	return secret, nil
+}
@@ -194,6 +194,89 @@ func Test_EthereumCryptoWrapper_Keccak256(t *testing.T) {
 	}
 }
 
+func Test_EthereumCryptoWrapper_GenerateKey(t *testing.T) {
+
+	wrapper := EthereumCryptoWrapper{}
+	got, err := wrapper.GenerateKey()
+	if err != nil {
+		t.Fatalf("EthereumCryptoWrapper.GenerateKey() err = %v, want nil", err)
+	}
+	if got.Curve != crypto.S256() || !got.Curve.IsOnCurve(got.X, got.Y) {
+		t.Errorf("EthereumCryptoWrapper.GenerateKey() key not on secp256k1 curve")
+	}
+}
+
+func Test_EthereumCryptoWrapper_UnmarshalPubkey(t *testing.T) {
+	tests := []struct {
+		name    string
+		pub     []byte
+		wantErr bool
+	}{
+		{"valid", alicePubKey, false},
+		{"invalid_length", alicePubKey[1:], true},
+		{"not_on_curve", append([]byte{4}, make([]byte, 64)...), true},
+	}
+	wrapper := EthereumCryptoWrapper{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wrapper.UnmarshalPubkey(tt.pub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EthereumCryptoWrapper.UnmarshalPubkey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(crypto.FromECDSAPub(got), tt.pub) {
+				t.Errorf("EthereumCryptoWrapper.UnmarshalPubkey() = %x, want %x", crypto.FromECDSAPub(got), tt.pub)
+			}
+		})
+	}
+}
+
+func Test_SharedSecret(t *testing.T) {
+
+	alicePriv, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Setup - GenerateKey() err = %v", err)
+	}
+	bobPriv, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Setup - GenerateKey() err = %v", err)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		aliceSecret, err := SharedSecret(alicePriv, &bobPriv.PublicKey)
+		if err != nil {
+			t.Fatalf("SharedSecret() err = %v, want nil", err)
+		}
+		bobSecret, err := SharedSecret(bobPriv, &alicePriv.PublicKey)
+		if err != nil {
+			t.Fatalf("SharedSecret() err = %v, want nil", err)
+		}
+		if !bytes.Equal(aliceSecret, bobSecret) {
+			t.Errorf("SharedSecret() = %x and %x, want equal for both users", aliceSecret, bobSecret)
+		}
+		if len(aliceSecret) != 32 {
+			t.Errorf("SharedSecret() length = %d, want 32", len(aliceSecret))
+		}
+	})
+
+	invalidTests := []struct {
+		name string
+		priv *ecdsa.PrivateKey
+		pub  *ecdsa.PublicKey
+	}{
+		{"nil_private_key", nil, &bobPriv.PublicKey},
+		{"nil_public_key", alicePriv, nil},
+		{"empty_public_key", alicePriv, &ecdsa.PublicKey{Curve: crypto.S256()}},
+		{"not_on_curve", alicePriv, &ecdsa.PublicKey{Curve: crypto.S256(), X: big.NewInt(1), Y: big.NewInt(1)}},
+	}
+	for _, tt := range invalidTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SharedSecret(tt.priv, tt.pub); err == nil {
+				t.Errorf("SharedSecret() err = nil, want non nil")
+			}
+		})
+	}
+}
+
 var CryptoWrapperObj = &mocks.CryptoWrapperInterface{}
 
 func Test_SigToPub(t *testing.T) {
@@ -284,3 +367,36 @@ func Test_Keccak256(t *testing.T) {
 		t.Errorf("Keccak256() was not called as expected")
 	}
 }
+
+func Test_GenerateKey(t *testing.T) {
+
+	//Setup
+	ActualCryptoWrapper := CryptoWrapperInstance
+	CryptoWrapperInstance = CryptoWrapperObj
+	//Teardown
+	defer func() { CryptoWrapperInstance = ActualCryptoWrapper }()
+
+	CryptoWrapperObj.On("GenerateKey").Return(nil, nil)
+	_, _ = GenerateKey()
+
+	if !CryptoWrapperObj.AssertCalled(t, "GenerateKey") {
+		t.Errorf("GenerateKey() was not called as expected")
+	}
+}
+
+func Test_UnmarshalPubkey(t *testing.T) {
+
+	//Setup
+	ActualCryptoWrapper := CryptoWrapperInstance
+	CryptoWrapperInstance = CryptoWrapperObj
+	//Teardown
+	defer func() { CryptoWrapperInstance = ActualCryptoWrapper }()
+
+	pub := []byte{}
+	CryptoWrapperObj.On("UnmarshalPubkey", pub).Return(nil, nil)
+	_, _ = UnmarshalPubkey(pub)
+
+	if !CryptoWrapperObj.AssertCalled(t, "UnmarshalPubkey", pub) {
+		t.Errorf("UnmarshalPubkey() was not called as expected")
+	}
+}
@@ -28,6 +28,29 @@ func (_m *CryptoWrapperInterface) FromECDSAPub(pub *ecdsa.PublicKey) []byte {
 	return r0
 }
 
+// GenerateKey provides a mock function with given fields:
+func (_m *CryptoWrapperInterface) GenerateKey() (*ecdsa.PrivateKey, error) {
+	ret := _m.Called()
+
+	var r0 *ecdsa.PrivateKey
+	if rf, ok := ret.Get(0).(func() *ecdsa.PrivateKey); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ecdsa.PrivateKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Keccak256 provides a mock function with given fields: data
 func (_m *CryptoWrapperInterface) Keccak256(data ...[]byte) []byte {
 	_va := make([]interface{}, len(data))
@@ -89,6 +112,29 @@ func (_m *CryptoWrapperInterface) SigToPub(hash []byte, sig []byte) (*ecdsa.Publ
 	return r0, r1
 }
 
+// UnmarshalPubkey provides a mock function with given fields: pub
+func (_m *CryptoWrapperInterface) UnmarshalPubkey(pub []byte) (*ecdsa.PublicKey, error) {
+	ret := _m.Called(pub)
+
+	var r0 *ecdsa.PublicKey
+	if rf, ok := ret.Get(0).(func([]byte) *ecdsa.PublicKey); ok {
+		r0 = rf(pub)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ecdsa.PublicKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte) error); ok {
+		r1 = rf(pub)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // VerifySignature provides a mock function with given fields: pubkey, hash, signature
 func (_m *CryptoWrapperInterface) VerifySignature(pubkey []byte, hash []byte, signature []byte) bool {
 	ret := _m.Called(pubkey, hash, signature)
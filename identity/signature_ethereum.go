@@ -74,11 +74,14 @@ func VerifySignatureEth(hash, sign, ethAddr []byte) (isSuccess bool, err error)
 	if sign[64] != 27 && sign[64] != 28 {
 		return false, fmt.Errorf("invalid Ethereum signature (V is not 27 or 28)")
 	}
-	sign[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	//Copy the signature, so that the signature held by the caller is not modified
+	signCopy := make([]byte, len(sign))
+	copy(signCopy, sign)
+	signCopy[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
 
 	hash = RehashWithEthereumPrefix(hash)
 	logger.Debug("Signature Verified")
-	return VerifySignature(hash, sign, ethAddr)
+	return VerifySignature(hash, signCopy, ethAddr)
 }
 
 // VerifySignature checks if the given ethereum address created the ecdsa signature over hash.
@@ -17,6 +17,7 @@
 package identity
 
 import (
+	"bytes"
 	"encoding/json"
 	"reflect"
 	"testing"
@@ -366,6 +367,7 @@ func Test_VerifySignatureEth(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			signBefore := append([]byte{}, tt.args.sign...)
 			gotIsSuccess, err := VerifySignatureEth(tt.args.hash, tt.args.sign, tt.args.ethAddr)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("VerifySignature() error = %v, wantErr %v", err, tt.wantErr)
@@ -373,6 +375,9 @@ func Test_VerifySignatureEth(t *testing.T) {
 			if gotIsSuccess != tt.wantIsSuccess {
 				t.Errorf("VerifySignature() = %v, want %v", gotIsSuccess, tt.wantIsSuccess)
 			}
+			if !bytes.Equal(tt.args.sign, signBefore) {
+				t.Errorf("VerifySignature() modified the signature")
+			}
 		})
 	}
 }
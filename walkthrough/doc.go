@@ -18,6 +18,7 @@
 //
 // Walkthrough can be run using either a real backend or a simulated backend.
 // To run the walkthrough for dispute condition, enable the corresponding flag.
+// As alice and bob run in the same process, channel connections between them can also use the in-memory mock adapter.
 //
 // Build the package and run it with -h flag to see the different configuration options.
 package main
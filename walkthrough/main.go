@@ -61,6 +61,9 @@ var (
 
 	defaultConfigFile = "../testdata/test_addresses.json"
 	configFile        string
+
+	//Adapter used for channel connections between alice and bob
+	chAdapterType = channel.WebSocket
 )
 
 func setupConfig(filePath string) {
@@ -138,6 +141,10 @@ func addFlagSet(app *cobra.Command) {
 		"real_backend_bob", false, "Run walkthrough with real backend for bob")
 	app.PersistentFlags().Bool(
 		"ch_message_print", false, "Enable/Disable printing of channel messages")
+	app.PersistentFlags().String(
+		"ch_adapter", string(channel.WebSocket), "Adapter for channel connections (websocket, tcp or mock). mock runs in memory")
+	app.PersistentFlags().Duration(
+		"ch_mock_latency", 0, "Latency of each channel message, when using mock adapter")
 	app.PersistentFlags().Bool(
 		"dispute", false, "Run walkthrough for dispute condition during closure")
 
@@ -158,6 +165,17 @@ func walkthrough(app *cobra.Command, args []string) {
 
 	dispute, _ := app.Flags().GetBool("dispute")
 
+	chAdapter, _ := app.Flags().GetString("ch_adapter")
+	chMockLatency, _ := app.Flags().GetDuration("ch_mock_latency")
+	switch channel.AdapterType(chAdapter) {
+	case channel.WebSocket, channel.TCP, channel.Mock:
+		chAdapterType = channel.AdapterType(chAdapter)
+	default:
+		_, _ = fmt.Fprintf(app.OutOrStderr(), "\nUnsupported channel adapter - %s.\n\n", chAdapter)
+		_ = app.Help()
+		return
+	}
+
 	if !(simulatedBackend || realBackendAlice || realBackendBob) {
 		_, _ = fmt.Fprintf(app.OutOrStderr(), "\nNo blockchain backend specified.\n\n")
 		_ = app.Help()
@@ -169,6 +187,7 @@ func walkthrough(app *cobra.Command, args []string) {
 
 	configModuleLogger(log.ErrorLevel)
 	channel.ReadWriteLogging = chMsgPrint
+	channel.MockLatency = chMockLatency
 
 	wg := &sync.WaitGroup{}
 
@@ -188,11 +207,10 @@ func walkthrough(app *cobra.Command, args []string) {
 
 func configModuleLogger(logLevel log.Level) {
 
-	chConfig := channel.Config{
-		Logger: log.Config{
-			Level:   logLevel,
-			Backend: log.StdoutBackend,
-		},
+	chConfig := channel.ConfigDefault
+	chConfig.Logger = log.Config{
+		Level:   logLevel,
+		Backend: log.StdoutBackend,
 	}
 
 	err := channel.InitModule(&chConfig)
@@ -71,14 +71,20 @@ func realBlockchainAlice(printer *color.Color, wg *sync.WaitGroup, dispute bool)
 
 	var params []interface{}
 
-	newConnToBob, err := channel.NewChannel(aliceID, bobID, channel.WebSocket)
+	aliceID.SetCredentials(testKeystore, alicePassword)
+	newConnToBob, err := channel.NewChannel(aliceID, bobID, chAdapterType)
 	if err != nil {
 		_, _ = printer.Printf("\nNew channel error - %v\n", err)
 		return
 	}
 	_, _ = printer.Printf("\n\nFound user at %s\n\n", newConnToBob.PeerID())
 
-	status, reason, err := newConnToBob.NewChannelRequest(channel.Version, contract.Store.SHA256Sum())
+	terms := channel.Terms{
+		DepositSender:   types.EtherToWei(big.NewInt(10)),
+		DepositReceiver: types.EtherToWei(big.NewInt(10)),
+		ConfirmTimeout:  uint64(blockchain.MSCConfirmTimeout / time.Second),
+	}
+	status, reason, err := newConnToBob.NewChannelRequest(channel.Version, contract.Store.SHA256Sum(), terms)
 	if err != nil {
 		_, _ = printer.Printf("\nNew channel request error - %v\n", err)
 		return
@@ -87,6 +93,11 @@ func realBlockchainAlice(printer *color.Color, wg *sync.WaitGroup, dispute bool)
 		_, _ = printer.Printf("\nNew channel request not accepted by peer, got status - %s, reason -%s\n", status, reason)
 		return
 	}
+	err = newConnToBob.SetTerms(terms)
+	if err != nil {
+		_, _ = printer.Printf("\nSet channel terms error - %v\n", err)
+		return
+	}
 	_, _ = printer.Printf("\n\nNew outgoing channel established with %s\n\n", newConnToBob.PeerID())
 
 	sid := channel.NewSessionID(aliceID.OnChainID, bobID.OnChainID)
@@ -194,7 +205,7 @@ func realBlockchainAlice(printer *color.Color, wg *sync.WaitGroup, dispute bool)
 		_, _ = printer.Printf("\nMscEventInitializing : Timedout %s\n", err)
 	}
 
-	blockedSender := types.EtherToWei(big.NewInt(10))
+	blockedSender := newConnToBob.Terms().DepositSender
 	_ = bcInst.OwnerID.SetCredentials(testKeystore, alicePassword)
 	_, _ = printer.Printf("\nConfirm call\n")
 	_ = bcInst.Confirm(blockedSender)
@@ -578,7 +589,8 @@ func realBlockchainBob(printer *color.Color, wg *sync.WaitGroup) (err error) {
 
 	//Initialize a new channel listener for bob
 	maxConn := uint32(100)
-	incomingConnChan, listener, err := channel.NewSession(bobID, channel.WebSocket, maxConn)
+	bobID.SetCredentials(testKeystore, bobPassword)
+	incomingConnChan, listener, err := channel.NewSession(bobID, chAdapterType, maxConn)
 	if err != nil {
 		_, _ = printer.Printf("\nNew channel session error - %v\n", err)
 		return
@@ -594,13 +606,19 @@ func realBlockchainBob(printer *color.Color, wg *sync.WaitGroup) (err error) {
 		_, _ = printer.Printf("\n\nNew channel request from Ethereum Address %s\n\n",
 			newConnFromAlice.PeerID().OnChainID.String())
 
-		msgProtocolVersion, contractStoreVersion, err := newConnFromAlice.NewChannelRead()
+		msgProtocolVersion, contractStoreVersion, terms, err := newConnFromAlice.NewChannelRead()
 		if err != nil {
 			_, _ = printer.Printf("\nNew channel read error - %v\n", err)
 			return
 		}
+		_, _ = printer.Printf("\nChannel terms proposed by alice - %s\n", terms)
 
-		err = newConnFromAlice.NewChannelRespond(msgProtocolVersion, contractStoreVersion, channel.MessageStatusAccept, "")
+		err = newConnFromAlice.SetTerms(terms)
+		if err != nil {
+			_, _ = printer.Printf("\nSet channel terms error - %v\n", err)
+			return
+		}
+		err = newConnFromAlice.NewChannelRespond(msgProtocolVersion, contractStoreVersion, terms, channel.MessageStatusAccept, "")
 		if err != nil {
 			_, _ = printer.Printf("\nNew channel respond error - %v\n", err)
 			return
@@ -743,7 +761,7 @@ func realBlockchainBob(printer *color.Color, wg *sync.WaitGroup) (err error) {
 			_, _ = printer.Printf("\nMscEventInitializing : Timedout %s\n", err)
 		}
 
-		blockedReceiver := types.EtherToWei(big.NewInt(10))
+		blockedReceiver := newConnFromAlice.Terms().DepositReceiver
 		_ = bcInst2.OwnerID.SetCredentials(testKeystore, bobPassword)
 		_, _ = printer.Printf("\nConfirm call\n")
 		_ = bcInst2.Confirm(blockedReceiver)
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math/big"
 	"sync"
+	"time"
 
 	"github.com/direct-state-transfer/dst-go/blockchain"
 	"github.com/direct-state-transfer/dst-go/channel"
@@ -62,14 +63,20 @@ func simulatedBlockchainAlice(printer *color.Color, wg *sync.WaitGroup, dispute
 		return
 	}
 
-	newConnToBob, err := channel.NewChannel(aliceID, bobID, channel.WebSocket)
+	aliceID.SetCredentials(testKeystore, alicePassword)
+	newConnToBob, err := channel.NewChannel(aliceID, bobID, chAdapterType)
 	if err != nil {
 		_, _ = printer.Printf("\nnew channel to bob error= %v\n", err)
 		return
 	}
 	_, _ = printer.Printf("\n\nFound user at %s\n\n", newConnToBob.PeerID())
 
-	status, reason, err := newConnToBob.NewChannelRequest(channel.Version, contract.Store.SHA256Sum())
+	terms := channel.Terms{
+		DepositSender:   types.EtherToWei(big.NewInt(10)),
+		DepositReceiver: types.EtherToWei(big.NewInt(10)),
+		ConfirmTimeout:  uint64(blockchain.MSCConfirmTimeout / time.Second),
+	}
+	status, reason, err := newConnToBob.NewChannelRequest(channel.Version, contract.Store.SHA256Sum(), terms)
 	if err != nil {
 		_, _ = printer.Printf("\nnew channel request to bob error= %v\n", err)
 		return
@@ -78,6 +85,11 @@ func simulatedBlockchainAlice(printer *color.Color, wg *sync.WaitGroup, dispute
 		_, _ = printer.Printf("\nnew channel request non accepted by bob, got status - %s, reason -%s\n", status, reason)
 		return
 	}
+	err = newConnToBob.SetTerms(terms)
+	if err != nil {
+		_, _ = printer.Printf("\nSet channel terms error - %v\n", err)
+		return
+	}
 	_, _ = printer.Printf("\n\nNew outgoing channel established with %s\n\n", newConnToBob.PeerID())
 
 	sid := channel.NewSessionID(aliceID.OnChainID, bobID.OnChainID)
@@ -178,7 +190,7 @@ func simulatedBlockchainAlice(printer *color.Color, wg *sync.WaitGroup, dispute
 	_, _ = printer.Printf("\nmscEventInitializing : Address sender - %s, Address receiver -%s\n",
 		mscEventInitializing.AddressAlice.String(), mscEventInitializing.AddressBob.String())
 
-	blockedSender := types.EtherToWei(big.NewInt(10))
+	blockedSender := newConnToBob.Terms().DepositSender
 	_ = bcInst.OwnerID.SetCredentials(testKeystore, alicePassword)
 	_, _ = printer.Printf("\nConfirm call\n")
 	_ = bcInst.Confirm(blockedSender)
@@ -557,7 +569,8 @@ func simulatedBlockchainBob(bcInst *blockchain.Instance,
 
 	//Initialize a new channel listener for bob
 	maxConn := uint32(100)
-	incomingConnChan, listener, err := channel.NewSession(bobID, channel.WebSocket, maxConn)
+	bobID.SetCredentials(testKeystore, bobPassword)
+	incomingConnChan, listener, err := channel.NewSession(bobID, chAdapterType, maxConn)
 	if err != nil {
 		_, _ = printer.Printf("\nNew channel session error - %v\n", err)
 		return
@@ -573,13 +586,19 @@ func simulatedBlockchainBob(bcInst *blockchain.Instance,
 		_, _ = printer.Printf("\n\nNew channel request from Ethereum Address %s\n\n",
 			newConnFromAlice.PeerID().OnChainID.String())
 
-		msgProtocolVersion, contractStoreVersion, err := newConnFromAlice.NewChannelRead()
+		msgProtocolVersion, contractStoreVersion, terms, err := newConnFromAlice.NewChannelRead()
 		if err != nil {
 			_, _ = printer.Printf("\nNew channel read error - %v\n", err)
 			return
 		}
+		_, _ = printer.Printf("\nChannel terms proposed by alice - %s\n", terms)
 
-		err = newConnFromAlice.NewChannelRespond(msgProtocolVersion, contractStoreVersion, channel.MessageStatusAccept, "")
+		err = newConnFromAlice.SetTerms(terms)
+		if err != nil {
+			_, _ = printer.Printf("\nSet channel terms error - %v\n", err)
+			return
+		}
+		err = newConnFromAlice.NewChannelRespond(msgProtocolVersion, contractStoreVersion, terms, channel.MessageStatusAccept, "")
 		if err != nil {
 			_, _ = printer.Printf("\nNew channel respond error - %v\n", err)
 			return
@@ -702,7 +721,7 @@ func simulatedBlockchainBob(bcInst *blockchain.Instance,
 		_, _ = printer.Printf("\nmscEventInitializing : Address sender - %s, Address receiver -%s\n",
 			mscEventInitializing.AddressAlice.String(), mscEventInitializing.AddressBob.String())
 
-		blockedReceiver := types.EtherToWei(big.NewInt(10))
+		blockedReceiver := newConnFromAlice.Terms().DepositReceiver
 		_ = bcInst2.OwnerID.SetCredentials(testKeystore, bobPassword)
 		_, _ = printer.Printf("\nConfirm call\n")
 		_ = bcInst2.Confirm(blockedReceiver)